@@ -0,0 +1,150 @@
+// Package audit records the changes of the users and the posts, and the
+// admin actions, in the audit log of the store. An entry has who made the
+// change, from which request, and the fields it changed.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Redacted replaces the values of the secret fields in the changes
+const Redacted = "[redacted]"
+
+// the JSON names of the secret fields, like the password hashes of the users
+// and the secrets of the webhooks
+var secretFields = map[string]bool{"password": true, "secret": true}
+
+type actorKey struct{}
+
+// ContextWithActor returns a copy of ctx for the changes made by an actor
+// other than a user or the admin token, like models.ActorCLI
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns who makes the changes of a context: the authenticated user,
+// the admin token, or the actor set by ContextWithActor, or else an
+// anonymous client
+func Actor(ctx context.Context) (string, *primitive.ObjectID) {
+	if userID, ok := utils.UserID(ctx); ok {
+		return models.ActorUser, &userID
+	}
+	if utils.IsAdmin(ctx) {
+		return models.ActorAdmin, nil
+	}
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor, nil
+	}
+	return models.ActorAnonymous, nil
+}
+
+// Log appends entries to the audit log of a store
+type Log struct {
+	Store store.Store
+	// hash-chain the entries, see store.VerifyAuditLog
+	Chain bool
+}
+
+// Record appends the entry of an action on a document of a collection, with
+// the changes from before to after, which are nil when the document is
+// created or deleted. The actor, the request ID and the IP address are taken
+// from ctx. The collection and id are empty for the actions on no document.
+func (l Log) Record(ctx context.Context, action, collection string, id primitive.ObjectID, before, after interface{}) error {
+	changes, err := Diff(before, after)
+	if err != nil {
+		return err
+	}
+	entry := models.AuditEntry{
+		Action:     action,
+		Collection: collection,
+		RequestID:  utils.RequestID(ctx),
+		IP:         utils.ClientIP(ctx),
+		Changes:    changes,
+	}
+	if !id.IsZero() {
+		entry.TargetID = &id
+	}
+	entry.Actor, entry.ActorID = Actor(ctx)
+	return l.Store.AppendAuditEntry(ctx, &entry, l.Chain)
+}
+
+// Diff returns the changed fields between the JSON encodings of before and
+// after, either of which may be nil. The fields of nested objects are named
+// with dots, like "a.b", and the secret fields are redacted.
+func Diff(before, after interface{}) (map[string]models.AuditChange, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.AuditChange{}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			a[name] = nil
+		}
+	}
+	for name, value := range a {
+		if reflect.DeepEqual(b[name], value) {
+			continue
+		}
+		change := models.AuditChange{Before: b[name], After: value}
+		if secretFields[name] {
+			change = models.AuditChange{Before: redact(change.Before), After: redact(change.After)}
+		}
+		changes[name] = change
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return changes, nil
+}
+
+func redact(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return Redacted
+}
+
+// fields returns the fields of the JSON encoding of an object, which are
+// JSON values like the ones read back from the store
+func fields(v interface{}) (map[string]interface{}, error) {
+	flat := map[string]interface{}{}
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return flat, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(b, &object); err != nil {
+		return nil, err
+	}
+	flatten(flat, "", object)
+	return flat, nil
+}
+
+func flatten(flat map[string]interface{}, prefix string, object map[string]interface{}) {
+	for name, value := range object {
+		// the empty objects are left out, since they are read back from the
+		// store as empty documents, encoded differently
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(flat, prefix+name+".", nested)
+			continue
+		}
+		flat[prefix+name] = value
+	}
+}
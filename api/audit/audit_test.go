@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDiff(t *testing.T) {
+	before := models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "hash"}
+	after := before
+	after.Private, after.PwdHash = true, "other hash"
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]models.AuditChange{
+		"private":  {Before: nil, After: true},
+		"password": {Before: Redacted, After: Redacted},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Diff returned %+v, expected %+v", changes, want)
+	}
+
+	nested := map[string]interface{}{"limits": map[string]interface{}{"read": 1}}
+	if changes, _ := Diff(nil, nested); !reflect.DeepEqual(changes, map[string]models.AuditChange{"limits.read": {After: 1.0}}) {
+		t.Errorf("Diff of a nested object returned %+v", changes)
+	}
+	var none *models.Post
+	if changes, _ := Diff(none, none); changes != nil {
+		t.Errorf("Diff without changes returned %+v", changes)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	st := store.NewMemoryStore()
+	log := Log{Store: st, Chain: true}
+	userID := primitive.NewObjectID()
+
+	ctx := utils.ContextWithRequestID(context.Background(), "req-1")
+	ctx = utils.ContextWithClientIP(ctx, "192.0.2.1")
+	if err := log.Record(utils.ContextWithUserID(ctx, userID), "users.privacy", "users", userID, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Record(ContextWithActor(ctx, models.ActorCLI), "admin.import", "posts", primitive.NilObjectID, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := st.ListAuditEntries(context.Background(), store.AuditFilter{}, 10)
+	if len(entries) != 2 {
+		t.Fatalf("audit log %+v", entries)
+	}
+	if e := entries[1]; e.Actor != models.ActorUser || *e.ActorID != userID || *e.TargetID != userID || e.RequestID != "req-1" || e.IP != "192.0.2.1" {
+		t.Errorf("entry of a user %+v", e)
+	}
+	if e := entries[0]; e.Actor != models.ActorCLI || e.ActorID != nil || e.TargetID != nil || e.PrevHash != entries[1].Hash {
+		t.Errorf("entry of the CLI %+v", e)
+	}
+}
@@ -0,0 +1,81 @@
+// Package caption extracts the hashtags and the mentions of the captions of
+// posts. A hashtag is # followed by letters, digits and underscores, and a
+// mention is @ followed by a username. They must not follow a letter, a digit
+// or an underscore, so that the @ of an email address is not a mention.
+package caption
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxUsernameLength is the maximum length of a username, in bytes
+const MaxUsernameLength = 30
+
+// Parse returns the distinct hashtags and mentions of a caption, in
+// lowercase and without their # and @, in the order they appear
+func Parse(text string) (tags []string, mentions []string) {
+	seenTags := map[string]bool{}
+	seenMentions := map[string]bool{}
+
+	prev := ' '
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if (r != '#' && r != '@') || isWordRune(prev) {
+			prev = r
+			i += size
+			continue
+		}
+
+		start := i + size
+		end := start
+		for end < len(text) {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if !isWordRune(r) {
+				break
+			}
+			end += size
+		}
+
+		word := strings.ToLower(text[start:end])
+		switch {
+		case word == "":
+		case r == '#' && !seenTags[word]:
+			seenTags[word] = true
+			tags = append(tags, word)
+		case r == '@' && IsUsername(word) && !seenMentions[word]:
+			seenMentions[word] = true
+			mentions = append(mentions, word)
+		}
+
+		// the word, or the # or @ if there is no word
+		prev, _ = utf8.DecodeLastRuneInString(text[:end])
+		i = end
+	}
+	return tags, mentions
+}
+
+// IsUsername reports whether s is a valid username: lowercase ASCII letters,
+// digits and underscores, at most MaxUsernameLength of them
+func IsUsername(s string) bool {
+	if s == "" || len(s) > MaxUsernameLength {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeTag returns a hashtag as it is stored, in lowercase and without #
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
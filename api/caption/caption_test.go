@@ -0,0 +1,37 @@
+package caption
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text     string
+		tags     []string
+		mentions []string
+	}{
+		{"Sunset with @ada_p #Beach #sunset #beach", []string{"beach", "sunset"}, []string{"ada_p"}},
+		{"#été à Paris, #2021!", []string{"été", "2021"}, nil},
+		{"mail me at ada@example.com, not a#tag", nil, nil},
+		{"(@Ada) @ada ##double # @ @été", []string{"double"}, []string{"ada"}},
+		{"no tags", nil, nil},
+	}
+	for _, test := range tests {
+		tags, mentions := Parse(test.text)
+		if !reflect.DeepEqual(tags, test.tags) || !reflect.DeepEqual(mentions, test.mentions) {
+			t.Errorf("Parse(%q) = %q, %q, expected %q, %q", test.text, tags, mentions, test.tags, test.mentions)
+		}
+	}
+}
+
+func TestIsUsername(t *testing.T) {
+	for s, want := range map[string]bool{
+		"ada": true, "ada_poster2": true, "": false, "Ada": false, "ada.p": false,
+		"été": false, "a23456789012345678901234567890": true, "a234567890123456789012345678901": false,
+	} {
+		if got := IsUsername(s); got != want {
+			t.Errorf("IsUsername(%q) = %v", s, got)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"context"
+	"strconv"
+
+	"appyinsta/api/store"
+)
+
+func auditCommands() []Command {
+	return []Command{
+		{Name: "audit verify", Args: "", Summary: "Check the hashes of the audit log, and that none of its entries were deleted", Run: auditVerify},
+	}
+}
+
+// the result of audit verify
+type auditVerification struct {
+	Entries int64 `json:"entries"`
+}
+
+func auditVerify(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("audit verify", "")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	n, err := store.VerifyAuditLog(ctx, env.Store)
+	if err != nil {
+		return err
+	}
+	return env.print(*format, table{header: []string{"ENTRIES"}, rows: [][]string{{strconv.FormatInt(n, 10)}}, value: auditVerification{Entries: n}})
+}
@@ -0,0 +1,163 @@
+// Package cli implements the commands of the appyinsta executable other
+// than serve. They use the same configuration and store as the server.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"appyinsta/api/audit"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Env struct {
+	Store  store.Store
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// the environment variables, like os.Getenv, or nil for none
+	Getenv func(key string) string
+
+	// the writes are recorded in the audit log, hash-chained if this is set
+	AuditHashChain bool
+}
+
+type Command struct {
+	// the words naming the command, e.g. "users create"
+	Name string
+	// the flags and arguments of the command
+	Args    string
+	Summary string
+	Run     func(ctx context.Context, env *Env, args []string) error
+}
+
+// ErrUsage is returned when a command is run with wrong arguments.
+// The usage of the command has then been written to Env.Stderr.
+var ErrUsage = errors.New("wrong usage")
+
+func Commands() []Command {
+	commands := append(userCommands(), postCommands()...)
+	commands = append(commands, dbCommands()...)
+	commands = append(commands, auditCommands()...)
+	return append(commands, transferCommands()...)
+}
+
+// Run runs the command named by the first args with the rest of them
+func Run(ctx context.Context, env *Env, args []string) error {
+	var match *Command
+	var rest []string
+	commands := Commands()
+	for i, cmd := range commands {
+		words := strings.Fields(cmd.Name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cmd.Name {
+			if match == nil || len(words) > len(strings.Fields(match.Name)) {
+				match, rest = &commands[i], args[len(words):]
+			}
+		}
+	}
+
+	if match == nil {
+		Usage(env.Stderr)
+		return ErrUsage
+	}
+	return match.Run(ctx, env, rest)
+}
+
+// Usage writes the list of commands to w
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: appyinsta <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "  serve\tRun the server (the default)\n")
+	for _, cmd := range Commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.Name, cmd.Summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run appyinsta <command> -h for the flags of a command.")
+}
+
+// auditLog is the audit log of the store
+func (env *Env) auditLog() audit.Log {
+	return audit.Log{Store: env.Store, Chain: env.AuditHashChain}
+}
+
+// audit appends an entry made by the CLI to the audit log, see audit.Log.Record
+func (env *Env) audit(ctx context.Context, action, collection string, id primitive.ObjectID, before, after interface{}) error {
+	ctx = audit.ContextWithActor(ctx, models.ActorCLI)
+	return env.auditLog().Record(ctx, action, collection, id, before, after)
+}
+
+// flags returns the flag set of a command, with the -o flag selecting the output format
+func (env *Env) flags(cmd string, args string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(env.Stderr, "Usage: appyinsta %s %s\n", cmd, args)
+		fs.PrintDefaults()
+	}
+	return fs, fs.String("o", "table", "the output format, table or json")
+}
+
+// parse parses the flags and checks the number of arguments left
+func parse(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return ErrUsage
+	}
+	return nil
+}
+
+func parseID(s string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(s)
+	if err != nil {
+		return id, fmt.Errorf("bad ID %q", s)
+	}
+	return id, nil
+}
+
+// parseOptionalID parses the ID given to a flag, if any
+func parseOptionalID(s string) (primitive.ObjectID, error) {
+	if s == "" {
+		return primitive.NilObjectID, nil
+	}
+	return parseID(s)
+}
+
+// table is the output of a command. It is written either as a table
+// with the header and rows, or as the JSON encoding of value.
+type table struct {
+	header []string
+	rows   [][]string
+	value  interface{}
+}
+
+func (env *Env) print(format string, t table) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(env.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t.value)
+	case "table":
+		tw := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown output format %q, expected table or json", format)
+}
@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// run runs a command on the store and returns what it wrote to stdout
+func run(t *testing.T, st store.Store, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	env := &Env{Store: st, Stdin: strings.NewReader(stdin), Stdout: &stdout, Stderr: &stderr}
+	err := Run(context.Background(), env, args)
+	return stdout.String(), err
+}
+
+func TestUsers(t *testing.T) {
+	st := store.NewMemoryStore()
+
+	out, err := run(t, st, "secret\n", "users", "create", "-o", "json", "-name", "Ann", "-email", "ann@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created models.InsertedID
+	if err := json.Unmarshal([]byte(out), &created); err != nil {
+		t.Fatal(err)
+	}
+	id := created.ID.Hex()
+
+	out, err = run(t, st, "", "users", "get", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || strings.Fields(lines[0])[0] != "ID" || strings.Join(strings.Fields(lines[1]), " ") != id+" Ann ann@example.com user false" {
+		t.Errorf("unexpected table:\n%s", out)
+	}
+
+	if _, err := run(t, st, "", "users", "disable", id); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = run(t, st, "", "users", "list", "-o", "json")
+	var users []models.User
+	if err := json.Unmarshal([]byte(out), &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || !users[0].Disabled || users[0].PwdHash != "" {
+		t.Errorf("users list returned %+v", users)
+	}
+
+	if _, err := run(t, st, "", "users", "get", primitive.NewObjectID().Hex()); err == nil || !strings.HasPrefix(err.Error(), "no user") {
+		t.Errorf("expected an error for an unknown user, got %v", err)
+	}
+
+	// the webhooks are sent the creation
+	recorded, _ := st.ReadEvents(context.Background(), 0, 10)
+	if len(recorded) != 1 || recorded[0].Type != events.SignedUp || recorded[0].Actor != created.ID {
+		t.Errorf("recorded events %+v", recorded)
+	}
+
+	// the password is read from the standard input, or from APPYINSTA_PASSWORD
+	if user, _ := st.GetUser(context.Background(), created.ID); user.PwdHash != utils.GetHashed256("secret") {
+		t.Errorf("the password read from the standard input is hashed as %q", user.PwdHash)
+	}
+	var stdout bytes.Buffer
+	env := &Env{Store: st, Stdin: strings.NewReader("ignored\n"), Stdout: &stdout, Stderr: &stdout, Getenv: func(key string) string {
+		if key == "APPYINSTA_PASSWORD" {
+			return "from env"
+		}
+		return ""
+	}}
+	if err := Run(context.Background(), env, []string{"users", "create", "-o", "json", "-name", "Bob", "-email", "bob@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := st.GetUser(context.Background(), created.ID); user.PwdHash != utils.GetHashed256("from env") {
+		t.Errorf("the password of APPYINSTA_PASSWORD is hashed as %q", user.PwdHash)
+	}
+}
+
+func TestAdminBootstrap(t *testing.T) {
+	st := store.NewMemoryStore()
+	ctx := context.Background()
+	user := models.User{Name: "Ann", Email: "ann@example.com", PwdHash: utils.GetHashed256("secret"), Username: "ann"}
+	st.CreateUser(ctx, &user)
+
+	// the user with the username only becomes the admin with their password
+	if _, err := run(t, st, "other", "admin", "bootstrap", "-name", "Admin", "-email", "admin@example.com", "-username", "Ann"); !errors.Is(err, store.ErrDuplicateUsername) {
+		t.Errorf("bootstrapping with the username of a user returned %v", err)
+	}
+	if got, _ := st.GetUser(ctx, user.UserID); got.Role != "" {
+		t.Errorf("bootstrapped admin %+v", got)
+	}
+	if _, err := run(t, st, "secret\n", "admin", "bootstrap", "-name", "Admin", "-email", "admin@example.com", "-username", "Ann"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := st.GetUser(ctx, user.UserID); got.Role != models.RoleAdmin {
+		t.Errorf("bootstrapped admin %+v", got)
+	}
+	if _, err := run(t, st, "secret\n", "admin", "bootstrap", "-name", "Admin", "-email", "admin@example.com"); err == nil {
+		t.Error("bootstrapped a second admin")
+	}
+
+	if _, err := run(t, st, "", "users", "role", user.UserID.Hex(), "moderator"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := st.GetUser(ctx, user.UserID); got.Role != models.RoleModerator {
+		t.Errorf("user with a new role %+v", got)
+	}
+	if _, err := run(t, st, "", "users", "role", user.UserID.Hex(), "owner"); err == nil {
+		t.Error("set an unknown role")
+	}
+
+	entries, _ := st.ListAuditEntries(ctx, store.AuditFilter{Actor: models.ActorCLI}, 10)
+	if len(entries) != 2 || entries[0].Action != "admin.users.role" || entries[1].Action != "admin.bootstrap" {
+		t.Errorf("audit log %+v", entries)
+	}
+	if out, err := run(t, st, "", "audit", "verify", "-o", "json"); err != nil || strings.TrimSpace(out) != "{\n  \"entries\": 2\n}" {
+		t.Errorf("audit verify returned %q, %v", out, err)
+	}
+}
+
+func TestPosts(t *testing.T) {
+	st := store.NewMemoryStore()
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	start := time.Date(2021, 10, 9, 12, 0, 0, 0, time.UTC)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		post := models.Post{PostedByUID: userID, Caption: "post", ImgURL: "img", PostedOn: start.Add(time.Duration(i) * time.Minute)}
+		st.CreatePost(ctx, &post)
+		ids = append(ids, post.PostID.Hex())
+	}
+
+	out, err := run(t, st, "", "posts", "list", "-user", userID.Hex(), "-after", ids[0], "-limit", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], ids[1]+" ") {
+		t.Errorf("unexpected table:\n%s", out)
+	}
+
+	if _, err := run(t, st, "", "posts", "delete", ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = run(t, st, "", "posts", "list", "-o", "json")
+	var posts []models.Post
+	json.Unmarshal([]byte(out), &posts)
+	if len(posts) != 2 || posts[0].PostID.Hex() != ids[0] || posts[1].PostID.Hex() != ids[2] {
+		t.Errorf("posts list returned %+v", posts)
+	}
+	recorded, _ := st.ReadEvents(ctx, 0, 10)
+	if len(recorded) != 1 || recorded[0].Type != events.PostDeleted || recorded[0].Post.Hex() != ids[1] {
+		t.Errorf("recorded events %+v", recorded)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src := store.NewMemoryStore()
+	ctx := context.Background()
+	user := models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "hash"}
+	src.CreateUser(ctx, &user)
+	post := models.Post{PostedByUID: user.UserID, Caption: "post", ImgURL: "img", PostedOn: time.Date(2021, 10, 9, 8, 49, 17, 482000000, time.UTC)}
+	src.CreatePost(ctx, &post)
+
+	dst := store.NewMemoryStore()
+	for _, collection := range []string{"users", "posts"} {
+		out, err := run(t, src, "", "export", collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, dst, out, "import", collection); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, _ := dst.GetUser(ctx, user.UserID); got != user {
+		t.Errorf("imported user %+v, expected %+v", got, user)
+	}
+	if got, _ := dst.GetPost(ctx, post.PostID); !reflect.DeepEqual(got, post) {
+		t.Errorf("imported post %+v, expected %+v", got, post)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	st := store.NewMemoryStore()
+	for _, args := range [][]string{
+		{}, {"users"}, {"nope"}, {"users", "get"}, {"users", "get", "-x", "1"},
+		// without a password, and with one on the command line
+		{"users", "create", "-name", "Ann", "-email", "ann@example.com"},
+		{"users", "create", "-name", "Ann", "-email", "ann@example.com", "-password", "secret"},
+	} {
+		if _, err := run(t, st, "", args...); err != ErrUsage {
+			t.Errorf("%q: expected ErrUsage, got %v", args, err)
+		}
+	}
+	if _, err := run(t, st, "", "migrate", "status"); err != errNoMigrations {
+		t.Errorf("expected errNoMigrations, got %v", err)
+	}
+	if _, err := run(t, st, "", "users", "list", "-o", "xml"); err == nil {
+		t.Error("expected an error for an unknown output format")
+	}
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"appyinsta/api/store"
+)
+
+func dbCommands() []Command {
+	return []Command{
+		{Name: "migrate up", Args: "", Summary: "Apply the migrations which have not been applied", Run: migrateUp},
+		{Name: "migrate status", Args: "", Summary: "List the migrations and when they were applied", Run: migrateStatus},
+		{Name: "reindex", Args: "", Summary: "Drop and create again the indexes of users and posts", Run: reindex},
+	}
+}
+
+var errNoMigrations = errors.New("the store has no migrations or indexes")
+
+func migrationsTable(statuses []store.MigrationStatus) table {
+	t := table{header: []string{"VERSION", "DESCRIPTION", "APPLIED_ON"}, value: statuses}
+	for _, status := range statuses {
+		appliedOn := "pending"
+		if status.AppliedOn != nil {
+			appliedOn = status.AppliedOn.Format(time.RFC3339)
+		}
+		t.rows = append(t.rows, []string{strconv.Itoa(status.Version), status.Description, appliedOn})
+	}
+	return t
+}
+
+func migrateUp(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("migrate up", "")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	migrator, ok := env.Store.(store.Migrator)
+	if !ok {
+		return errNoMigrations
+	}
+
+	applied, err := migrator.Migrate(ctx)
+	if applied == nil {
+		applied = []store.MigrationStatus{}
+	}
+	if printErr := env.print(*format, migrationsTable(applied)); err == nil {
+		err = printErr
+	}
+	return err
+}
+
+func migrateStatus(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("migrate status", "")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	migrator, ok := env.Store.(store.Migrator)
+	if !ok {
+		return errNoMigrations
+	}
+
+	statuses, err := migrator.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	return env.print(*format, migrationsTable(statuses))
+}
+
+func reindex(ctx context.Context, env *Env, args []string) error {
+	fs, _ := env.flags("reindex", "")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	migrator, ok := env.Store.(store.Migrator)
+	if !ok {
+		return errNoMigrations
+	}
+
+	if err := migrator.Reindex(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stderr, "Indexes created again")
+	return nil
+}
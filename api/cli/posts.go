@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func postCommands() []Command {
+	return []Command{
+		{Name: "posts get", Args: "<id>", Summary: "Show a post", Run: postsGet},
+		{Name: "posts list", Args: "[-user <id>] [-after <id>] [-limit <n>]", Summary: "List the posts, or the posts of a user in the order they were posted", Run: postsList},
+		{Name: "posts delete", Args: "<id>", Summary: "Delete a post", Run: postsDelete},
+	}
+}
+
+func postsTable(posts []models.Post) table {
+	t := table{header: []string{"ID", "POSTED_BY", "POSTED_ON", "CAPTION", "IMG_URL"}, value: posts}
+	for _, post := range posts {
+		t.rows = append(t.rows, []string{post.PostID.Hex(), post.PostedByUID.Hex(), post.PostedOn.Format(time.RFC3339), post.Caption, post.ImgURL})
+	}
+	return t
+}
+
+func postsGet(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("posts get", "<id>")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	id, err := parseID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	post, err := env.Store.GetPost(ctx, id)
+	if err == store.ErrNotFound {
+		return fmt.Errorf("no post with ID %s", id.Hex())
+	} else if err != nil {
+		return err
+	}
+
+	t := postsTable([]models.Post{post})
+	t.value = post
+	return env.print(*format, t)
+}
+
+func postsList(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("posts list", "[-user <id>] [-after <id>] [-limit <n>]")
+	user := fs.String("user", "", "list the posts of this user")
+	after := fs.String("after", "", "list the posts after this one")
+	limit := fs.Int64("limit", 50, "the maximum number of posts listed")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	userID, err := parseOptionalID(*user)
+	if err != nil {
+		return err
+	}
+	afterID, err := parseOptionalID(*after)
+	if err != nil {
+		return err
+	}
+
+	var posts []models.Post
+	if userID.IsZero() {
+		posts, err = env.Store.ListPosts(ctx, afterID, *limit)
+	} else {
+		posts, err = listUserPosts(ctx, env.Store, userID, afterID, *limit)
+	}
+	if err != nil {
+		return err
+	}
+	if posts == nil {
+		posts = []models.Post{}
+	}
+	return env.print(*format, postsTable(posts))
+}
+
+// listUserPosts pages through the posts of a user like a client of the API,
+// see handlers.HandleUserPostsGet
+func listUserPosts(ctx context.Context, st store.Store, userID, afterID primitive.ObjectID, limit int64) ([]models.Post, error) {
+	pagInfo := models.PostPaginationInfo{NumberOfNewPosts: limit, FirstRequest: true}
+	if !afterID.IsZero() {
+		last, err := st.GetPost(ctx, afterID)
+		if err == store.ErrNotFound {
+			return nil, fmt.Errorf("no post with ID %s", afterID.Hex())
+		} else if err != nil {
+			return nil, err
+		}
+		pagInfo = models.PostPaginationInfo{LastPostID: last.PostID, LastPostedOn: last.PostedOn, NumberOfNewPosts: limit}
+	}
+	// the CLI sees all the posts
+	return st.ListUserPosts(ctx, nil, userID, pagInfo)
+}
+
+func postsDelete(ctx context.Context, env *Env, args []string) error {
+	fs, _ := env.flags("posts delete", "<id>")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	id, err := parseID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// like HandlePostDelete: the dispatcher of the server delivers the events
+	err = store.Record(ctx, env.Store, func(ctx context.Context) ([]events.Event, error) {
+		post, err := env.Store.GetPost(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := env.Store.DeletePost(ctx, id); err != nil {
+			return nil, err
+		}
+		if err := env.audit(ctx, "posts.delete", "posts", id, post, nil); err != nil {
+			return nil, err
+		}
+		return []events.Event{{Type: events.PostDeleted, Actor: post.PostedByUID, Post: id}}, nil
+	})
+	if err == store.ErrNotFound {
+		return fmt.Errorf("no post with ID %s", id.Hex())
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"appyinsta/api/audit"
+	"appyinsta/api/models"
+	"appyinsta/api/transfer"
+)
+
+func transferCommands() []Command {
+	return []Command{
+		{Name: "export", Args: "[-file <path>] users|posts", Summary: "Write a collection as NDJSON, to stdout by default", Run: export},
+		{Name: "import", Args: importArgs, Summary: "Insert the documents of a collection from NDJSON, read from stdin by default", Run: importCmd},
+	}
+}
+
+func export(ctx context.Context, env *Env, args []string) error {
+	fs, _ := env.flags("export", "[-file <path>] users|posts")
+	path := fs.String("file", "", "the file written")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	var w io.Writer = env.Stdout
+	var f *os.File
+	if *path != "" {
+		var err error
+		if f, err = os.Create(*path); err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := transfer.Export(ctx, env.Store, fs.Arg(0), w)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(env.Stderr, "Exported %d %s\n", n, fs.Arg(0))
+	return nil
+}
+
+const importArgs = "[-file <path>] [-on-conflict error|skip|upsert] [-dry-run] users|posts"
+
+func importCmd(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("import", importArgs)
+	path := fs.String("file", "", "the file read")
+	onConflict := fs.String("on-conflict", "error", "what to do with documents with an existing ID: stop with an error, skip them, or upsert them")
+	dryRun := fs.Bool("dry-run", false, "only check the documents, without inserting them")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	opts := transfer.Options{DryRun: *dryRun}
+	var err error
+	if opts.OnConflict, err = transfer.ParseOnConflict(*onConflict); err != nil {
+		return err
+	}
+
+	r := env.Stdin
+	if *path != "" {
+		f, err := os.Open(*path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	// like HandleImport
+	opts.Audit = env.auditLog()
+	res, err := transfer.Import(audit.ContextWithActor(ctx, models.ActorCLI), env.Store, fs.Arg(0), r, opts)
+	t := table{
+		header: []string{"INSERTED", "REPLACED", "SKIPPED"},
+		rows:   [][]string{{strconv.Itoa(res.Inserted), strconv.Itoa(res.Replaced), strconv.Itoa(res.Skipped)}},
+		value:  res,
+	}
+	if opts.DryRun {
+		t.header = []string{"VALID", "INVALID"}
+		t.rows = [][]string{{strconv.Itoa(res.Valid), strconv.Itoa(res.Invalid)}}
+		for _, lineErr := range res.Errors {
+			fmt.Fprintln(env.Stderr, lineErr)
+		}
+	}
+	if printErr := env.print(*format, t); err == nil {
+		err = printErr
+	}
+	if err == nil && res.Invalid > 0 {
+		err = fmt.Errorf("%d invalid lines", res.Invalid)
+	}
+	return err
+}
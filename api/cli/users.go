@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"appyinsta/api/caption"
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+)
+
+func userCommands() []Command {
+	return []Command{
+		{Name: "users create", Args: "-name <name> -email <email> [-username <username>] < password", Summary: "Create a user", Run: usersCreate},
+		{Name: "users get", Args: "<id>", Summary: "Show a user", Run: usersGet},
+		{Name: "users list", Args: "[-after <id>] [-limit <n>]", Summary: "List the users in the order of their IDs", Run: usersList},
+		{Name: "users disable", Args: "<id>", Summary: "Disable a user, who can then no longer log in", Run: usersSetDisabled(true)},
+		{Name: "users enable", Args: "<id>", Summary: "Enable a disabled user", Run: usersSetDisabled(false)},
+		{Name: "users role", Args: "<id> <user|moderator|admin>", Summary: "Change the role of a user", Run: usersRole},
+		{Name: "admin bootstrap", Args: "-name <name> -email <email> [-username <username>] < password", Summary: "Create the first admin, or make the user with the username and password the admin", Run: adminBootstrap},
+	}
+}
+
+func usersTable(users []models.User) table {
+	t := table{header: []string{"ID", "NAME", "USERNAME", "EMAIL", "ROLE", "DISABLED"}, value: users}
+	for _, user := range users {
+		role := user.Role
+		if role == "" {
+			role = models.RoleUser
+		}
+		t.rows = append(t.rows, []string{user.UserID.Hex(), user.Name, user.Username, user.Email, role, strconv.FormatBool(user.Disabled)})
+	}
+	return t
+}
+
+// the password hashes are not printed
+func hidePasswords(users []models.User) []models.User {
+	for i := range users {
+		users[i].PwdHash = ""
+	}
+	return users
+}
+
+func usersCreate(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("users create", "-name <name> -email <email> [-username <username>] < password")
+	user, err := parseNewUser(env, fs, args)
+	if err != nil {
+		return err
+	}
+	// like HandleUserCreate: the dispatcher of the server delivers the events
+	err = store.Record(ctx, env.Store, func(ctx context.Context) ([]events.Event, error) {
+		if err := env.Store.CreateUser(ctx, &user); err != nil {
+			return nil, err
+		}
+		if err := env.audit(ctx, "users.create", "users", user.UserID, nil, user); err != nil {
+			return nil, err
+		}
+		return []events.Event{{Type: events.SignedUp, Actor: user.UserID}}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return env.print(*format, table{header: []string{"ID"}, rows: [][]string{{user.UserID.Hex()}}, value: models.InsertedID{ID: user.UserID}})
+}
+
+// parseNewUser parses the flags and the password of a new user, checked and
+// hashed like in HandleUserCreate
+func parseNewUser(env *Env, fs *flag.FlagSet, args []string) (models.User, error) {
+	var user models.User
+	fs.StringVar(&user.Name, "name", "", "the name of the user")
+	fs.StringVar(&user.Email, "email", "", "the email address of the user")
+	fs.StringVar(&user.Username, "username", "", "the username of the user, to mention them in captions")
+	if err := parse(fs, args, 0); err != nil {
+		return user, err
+	}
+	password, err := env.password()
+	if err != nil {
+		return user, err
+	}
+	user.PwdHash = password
+	if user.Name == "" || user.Email == "" || user.PwdHash == "" {
+		fs.Usage()
+		return user, ErrUsage
+	}
+
+	user.Username = strings.ToLower(user.Username)
+	if user.Username != "" && !caption.IsUsername(user.Username) {
+		return user, fmt.Errorf("bad username %q: only letters, digits and underscores are allowed", user.Username)
+	}
+	user.PwdHash = utils.GetHashed256(user.PwdHash)
+	return user, nil
+}
+
+// password returns the password of a new user: the APPYINSTA_PASSWORD
+// environment variable, or else the first line of the standard input. It is
+// not a flag, which would show in the shell history and the process list.
+func (env *Env) password() (string, error) {
+	if env.Getenv != nil {
+		if password := env.Getenv("APPYINSTA_PASSWORD"); password != "" {
+			return password, nil
+		}
+	}
+	line, err := bufio.NewReader(env.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func usersGet(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("users get", "<id>")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	id, err := parseID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	user, err := env.Store.GetUser(ctx, id)
+	if err == store.ErrNotFound {
+		return fmt.Errorf("no user with ID %s", id.Hex())
+	} else if err != nil {
+		return err
+	}
+
+	users := hidePasswords([]models.User{user})
+	t := usersTable(users)
+	t.value = users[0]
+	return env.print(*format, t)
+}
+
+func usersList(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("users list", "[-after <id>] [-limit <n>]")
+	after := fs.String("after", "", "list the users with an ID greater than this one")
+	limit := fs.Int64("limit", 50, "the maximum number of users listed")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	afterID, err := parseOptionalID(*after)
+	if err != nil {
+		return err
+	}
+
+	users, err := env.Store.ListUsers(ctx, afterID, *limit)
+	if err != nil {
+		return err
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+	return env.print(*format, usersTable(hidePasswords(users)))
+}
+
+func usersSetDisabled(disabled bool) func(ctx context.Context, env *Env, args []string) error {
+	name := "users enable"
+	if disabled {
+		name = "users disable"
+	}
+
+	return func(ctx context.Context, env *Env, args []string) error {
+		fs, _ := env.flags(name, "<id>")
+		if err := parse(fs, args, 1); err != nil {
+			return err
+		}
+		id, err := parseID(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		err = env.Store.RunInTransaction(ctx, func(ctx context.Context) error {
+			user, err := env.Store.GetUser(ctx, id)
+			if err != nil {
+				return err
+			}
+			if err := env.Store.SetUserDisabled(ctx, id, disabled); err != nil {
+				return err
+			}
+			updated := user
+			updated.Disabled = disabled
+			return env.audit(ctx, strings.Replace(name, " ", ".", 1), "users", id, user, updated)
+		})
+		if err == store.ErrNotFound {
+			return fmt.Errorf("no user with ID %s", id.Hex())
+		}
+		return err
+	}
+}
+
+func usersRole(ctx context.Context, env *Env, args []string) error {
+	fs, _ := env.flags("users role", "<id> <user|moderator|admin>")
+	if err := parse(fs, args, 2); err != nil {
+		return err
+	}
+	id, err := parseID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	role := fs.Arg(1)
+	if role == "" || !models.IsRole(role) {
+		return fmt.Errorf("bad role %q: expected user, moderator or admin", role)
+	}
+
+	err = env.Store.RunInTransaction(ctx, func(ctx context.Context) error {
+		user, err := env.Store.GetUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := env.Store.SetUserRole(ctx, id, role); err != nil {
+			return err
+		}
+		updated := user
+		if updated.Role = role; role == models.RoleUser {
+			updated.Role = ""
+		}
+		// like the route of the same change
+		return env.audit(ctx, "admin.users.role", "users", id, user, updated)
+	})
+	if err == store.ErrNotFound {
+		return fmt.Errorf("no user with ID %s", id.Hex())
+	}
+	return err
+}
+
+// adminBootstrap is like the APPYINSTA_BOOTSTRAP_ADMIN_* variables of the
+// server, and does nothing when there is already an admin
+func adminBootstrap(ctx context.Context, env *Env, args []string) error {
+	fs, format := env.flags("admin bootstrap", "-name <name> -email <email> [-username <username>] < password")
+	admin, err := parseNewUser(env, fs, args)
+	if err != nil {
+		return err
+	}
+	created, err := store.BootstrapAdmin(ctx, env.Store, &admin)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("there is already an admin")
+	}
+	if err := env.audit(ctx, "admin.bootstrap", "users", admin.UserID, nil, admin); err != nil {
+		return err
+	}
+	return env.print(*format, table{header: []string{"ID"}, rows: [][]string{{admin.UserID.Hex()}}, value: models.InsertedID{ID: admin.UserID}})
+}
@@ -0,0 +1,360 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// CBOR, see RFC 8949
+
+const CBORMediaType = "application/cbor"
+
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+
+	// tags for standard date/time strings and epoch-based date/times
+	cborTagDateTime = 0
+	cborTagEpoch    = 1
+
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+type cborWriter struct {
+	buf []byte
+}
+
+// writeHead writes the initial byte of an item and its argument
+func (w *cborWriter) writeHead(major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		w.buf = append(w.buf, major|byte(arg))
+	case arg <= math.MaxUint8:
+		w.buf = append(w.buf, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		w.buf = append(w.buf, major|25)
+		w.buf = appendUint16(w.buf, uint16(arg))
+	case arg <= math.MaxUint32:
+		w.buf = append(w.buf, major|26)
+		w.buf = appendUint32(w.buf, uint32(arg))
+	default:
+		w.buf = append(w.buf, major|27)
+		w.buf = appendUint64(w.buf, arg)
+	}
+}
+
+func (w *cborWriter) writeNil() { w.buf = append(w.buf, 0xf6) }
+
+func (w *cborWriter) writeBool(b bool) {
+	if b {
+		w.buf = append(w.buf, 0xf5)
+	} else {
+		w.buf = append(w.buf, 0xf4)
+	}
+}
+
+func (w *cborWriter) writeInt(i int64) {
+	if i >= 0 {
+		w.writeHead(cborUint, uint64(i))
+	} else {
+		w.writeHead(cborNegInt, uint64(-1-i))
+	}
+}
+
+func (w *cborWriter) writeUint(u uint64) { w.writeHead(cborUint, u) }
+
+func (w *cborWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		w.buf = append(w.buf, 0xfa)
+		w.buf = appendUint32(w.buf, math.Float32bits(float32(f)))
+		return
+	}
+	w.buf = append(w.buf, 0xfb)
+	w.buf = appendUint64(w.buf, math.Float64bits(f))
+}
+
+func (w *cborWriter) writeString(s string) {
+	w.writeHead(cborText, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *cborWriter) writeBytes(b []byte) {
+	w.writeHead(cborBytes, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// Times are written as standard date/time strings (tag 0), which keep
+// the nanoseconds unlike epoch-based floats
+func (w *cborWriter) writeTime(t time.Time) {
+	w.writeHead(cborTag, cborTagDateTime)
+	w.writeString(t.Format(time.RFC3339Nano))
+}
+
+func (w *cborWriter) writeArrayHeader(n int) { w.writeHead(cborArray, uint64(n)) }
+func (w *cborWriter) writeMapHeader(n int)   { w.writeHead(cborMap, uint64(n)) }
+
+// MarshalCBOR encodes v as CBOR
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	w := &cborWriter{}
+	if err := encodeValue(w, reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+	return w.buf, nil
+}
+
+type cborReader struct {
+	msgpackReader // for next and readUint
+}
+
+// readHead reads the initial byte of an item and its argument.
+// info is cborIndefinite for items of indefinite length.
+func (r *cborReader) readHead() (major byte, info byte, arg uint64, err error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]&0xe0, b[0]&0x1f
+
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		arg, err = r.readUint(1 << (info - 24))
+	case info == cborIndefinite:
+	default:
+		err = fmt.Errorf("codec: invalid CBOR additional information %d", info)
+	}
+	return major, info, arg, err
+}
+
+func (r *cborReader) checkLength(n uint64) (int, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+func (r *cborReader) atBreak() bool {
+	return r.pos < len(r.data) && r.data[r.pos] == cborBreak
+}
+
+func (r *cborReader) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("codec: value is nested too deeply")
+	}
+
+	major, info, arg, err := r.readHead()
+	if err != nil {
+		return nil, err
+	}
+	indefinite := info == cborIndefinite
+
+	switch major {
+	case cborUint:
+		if indefinite {
+			break
+		}
+		return arg, nil
+
+	case cborNegInt:
+		if indefinite {
+			break
+		}
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("codec: CBOR negative integer out of range")
+		}
+		return -1 - int64(arg), nil
+
+	case cborBytes, cborText:
+		b, err := r.decodeString(major, indefinite, arg)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborText {
+			return string(b), nil
+		}
+		return b, nil
+
+	case cborArray:
+		arr := []interface{}{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && r.atBreak() {
+				r.pos++
+				break
+			}
+			v, err := r.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+
+	case cborMap:
+		m := map[string]interface{}{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && r.atBreak() {
+				r.pos++
+				break
+			}
+			k, err := r.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("codec: map keys must be strings")
+			}
+			if m[key], err = r.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+
+	case cborTag:
+		if indefinite {
+			break
+		}
+		v, err := r.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return decodeTagged(arg, v)
+
+	case cborSimple:
+		return r.decodeSimple(info, arg)
+	}
+
+	return nil, fmt.Errorf("codec: invalid CBOR item of major type %d", major>>5)
+}
+
+// decodeString reads a byte or text string, joining the chunks of indefinite-length strings
+func (r *cborReader) decodeString(major byte, indefinite bool, arg uint64) ([]byte, error) {
+	if !indefinite {
+		n, err := r.checkLength(arg)
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.next(n)
+		return append([]byte(nil), b...), err
+	}
+
+	var joined []byte
+	for !r.atBreak() {
+		chunkMajor, chunkInfo, chunkArg, err := r.readHead()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || chunkInfo == cborIndefinite {
+			return nil, fmt.Errorf("codec: invalid chunk in indefinite-length CBOR string")
+		}
+		n, err := r.checkLength(chunkArg)
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.next(n)
+		if err != nil {
+			return nil, err
+		}
+		joined = append(joined, b...)
+	}
+	r.pos++ // break
+	return joined, nil
+}
+
+func (r *cborReader) decodeSimple(info byte, arg uint64) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23: // null, undefined
+		return nil, nil
+	case 25:
+		return halfToFloat64(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	}
+	return nil, fmt.Errorf("codec: unsupported CBOR simple value %d", info)
+}
+
+// decodeTagged interprets the date/time tags, other tags are ignored
+func decodeTagged(tag uint64, v interface{}) (interface{}, error) {
+	switch tag {
+	case cborTagDateTime:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("codec: CBOR date/time must be a string")
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case cborTagEpoch:
+		switch n := v.(type) {
+		case uint64:
+			return time.Unix(int64(n), 0).UTC(), nil
+		case int64:
+			return time.Unix(n, 0).UTC(), nil
+		case float64:
+			sec, frac := math.Modf(n)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+		return nil, fmt.Errorf("codec: CBOR epoch date/time must be a number")
+	}
+	return v, nil
+}
+
+func halfToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// UnmarshalCBOR decodes a single CBOR item into generic values, like UnmarshalMsgpack
+func UnmarshalCBOR(data []byte) (interface{}, error) {
+	r := &cborReader{msgpackReader{data: data}}
+	v, err := r.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(data) {
+		return nil, fmt.Errorf("codec: data must only contain a single CBOR item")
+	}
+	return v, nil
+}
+
+// CBORToJSON converts a CBOR document to JSON
+func CBORToJSON(data []byte) ([]byte, error) {
+	v, err := UnmarshalCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	return toJSON(v)
+}
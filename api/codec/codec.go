@@ -0,0 +1,242 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Binary encodings (MessagePack and CBOR) of the API's models.
+//
+// Values are encoded following the same rules as encoding/json (field names
+// and omitempty are taken from the json struct tags), so that a client sees the
+// same documents whatever the format. ObjectIDs are encoded as hex strings like
+// in JSON, and times use the native timestamp type of each format.
+//
+// Decoding goes the other way round: the body is decoded to generic values,
+// which are converted to JSON and then decoded into the target with the same
+// strict JSON rules as any other request body. See utils.DecodeBody.
+
+// writer is implemented by each format
+type writer interface {
+	writeNil()
+	writeBool(b bool)
+	writeInt(i int64)
+	writeUint(u uint64)
+	writeFloat(f float64, bits int)
+	writeString(s string)
+	writeBytes(b []byte)
+	writeTime(t time.Time)
+	writeArrayHeader(n int)
+	writeMapHeader(n int)
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+)
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // reflect.Type -> []field
+
+// structFields returns the encoded fields of a struct type, including those
+// of embedded structs without a json tag (which are flattened like in JSON)
+func structFields(t reflect.Type) []field {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for _, embedded := range structFields(sf.Type) {
+				embedded.index = append([]int{i}, embedded.index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		if sf.PkgPath != "" { // unexported
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		fields = append(fields, field{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// isEmpty follows the definition of empty values for omitempty in encoding/json
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+const maxDepth = 64
+
+func encodeValue(w writer, v reflect.Value, depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("codec: value is nested too deeply")
+	}
+
+	if !v.IsValid() {
+		w.writeNil()
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		w.writeTime(v.Interface().(time.Time))
+		return nil
+	case objectIDType:
+		w.writeString(v.Interface().(primitive.ObjectID).Hex())
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		return encodeValue(w, v.Elem(), depth+1)
+
+	case reflect.Bool:
+		w.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32:
+		w.writeFloat(v.Float(), 32)
+	case reflect.Float64:
+		w.writeFloat(v.Float(), 64)
+	case reflect.String:
+		w.writeString(v.String())
+
+	case reflect.Slice:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			w.writeBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		w.writeArrayHeader(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(w, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("codec: unsupported map key type %s", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		w.writeMapHeader(len(keys))
+		for _, key := range keys {
+			w.writeString(key.String())
+			if err := encodeValue(w, v.MapIndex(key), depth+1); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		values := make([]reflect.Value, 0, len(fields))
+		names := make([]string, 0, len(fields))
+
+		for _, f := range fields {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmpty(fv)) {
+				continue
+			}
+			names = append(names, f.name)
+			values = append(values, fv)
+		}
+
+		w.writeMapHeader(len(values))
+		for i, fv := range values {
+			w.writeString(names[i])
+			if err := encodeValue(w, fv, depth+1); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("codec: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v, true
+}
+
+// toJSON converts the generic values produced by the decoders to JSON.
+// Times are converted to RFC 3339 strings, which is how they appear in JSON.
+func toJSON(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
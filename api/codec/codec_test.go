@@ -0,0 +1,184 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type format struct {
+	name    string
+	marshal func(v interface{}) ([]byte, error)
+	toJSON  func(data []byte) ([]byte, error)
+}
+
+var formats = []format{
+	{"msgpack", MarshalMsgpack, MsgpackToJSON},
+	{"cbor", MarshalCBOR, CBORToJSON},
+}
+
+func mustObjectID(hex string) primitive.ObjectID {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// roundTrip encodes src, converts it to JSON and decodes that into dst
+func roundTrip(t *testing.T, f format, src interface{}, dst interface{}) {
+	data, err := f.marshal(src)
+	if err != nil {
+		t.Fatalf("%s: could not encode %T: %s", f.name, src, err)
+	}
+	jsonData, err := f.toJSON(data)
+	if err != nil {
+		t.Fatalf("%s: could not convert %T to JSON: %s", f.name, src, err)
+	}
+	if err := json.Unmarshal(jsonData, dst); err != nil {
+		t.Fatalf("%s: could not decode JSON %s: %s", f.name, string(jsonData), err)
+	}
+}
+
+func TestModelsRoundTrip(t *testing.T) {
+	post := models.Post{
+		PostID:      mustObjectID("6161578d7ca34c010e0f21d8"),
+		PostedByUID: mustObjectID("616156d49ab2934adcee255e"),
+		Caption:     "Another caption",
+		ImgURL:      "some.url.here",
+		PostedOn:    time.Date(2021, 10, 9, 8, 49, 17, 482123456, time.UTC),
+	}
+	user := models.User{UserID: mustObjectID("6160fe9757a258c6bdc94056"), Name: "Souris Ash", Email: "sasa@lele.com"}
+	pagInfo := models.PostPaginationInfo{
+		LastPostID:       mustObjectID("6161882093c27946c57c996a"),
+		LastPostedOn:     time.Date(2021, 10, 9, 12, 16, 32, 361000000, time.UTC),
+		NumberOfNewPosts: 3,
+		FirstRequest:     true,
+	}
+
+	for _, f := range formats {
+		var posts []models.Post
+		roundTrip(t, f, []models.Post{post, post}, &posts)
+		if len(posts) != 2 || !reflect.DeepEqual(posts[0], post) {
+			t.Errorf("%s: post did not survive the round trip: %+v", f.name, posts)
+		}
+
+		var decodedUser models.User
+		roundTrip(t, f, user, &decodedUser)
+		if decodedUser != user {
+			t.Errorf("%s: user did not survive the round trip: %+v", f.name, decodedUser)
+		}
+
+		var decodedPagInfo models.PostPaginationInfo
+		roundTrip(t, f, pagInfo, &decodedPagInfo)
+		if !reflect.DeepEqual(decodedPagInfo, pagInfo) {
+			t.Errorf("%s: pagination info did not survive the round trip: %+v", f.name, decodedPagInfo)
+		}
+	}
+}
+
+func TestMsgpackEncoding(t *testing.T) {
+	// omitempty drops the empty password, and the ObjectID is a hex string
+	data, _ := MarshalMsgpack(models.InsertedID{ID: mustObjectID("6161578d7ca34c010e0f21d8")})
+	expected := append([]byte{0x81, 0xa2, 'i', 'd', 0xb8}, "6161578d7ca34c010e0f21d8"...)
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Unexpected encoding of an ID. Expected %x and got %x", expected, data)
+	}
+
+	// timestamp 64 format: nanoseconds in the upper 30 bits, seconds in the lower 34
+	data, _ = MarshalMsgpack(time.Unix(1633769357, 482000000).UTC())
+	expected = []byte{0xd7, 0xff, 0x72, 0xea, 0xf2, 0x00, 0x61, 0x61, 0x57, 0x8d}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Unexpected encoding of a time. Expected %x and got %x", expected, data)
+	}
+
+	for _, n := range []int64{0, 127, 128, -32, -33, 300, -300, 70000, -70000, 1 << 40, -(1 << 40)} {
+		data, _ := MarshalMsgpack(n)
+		v, err := UnmarshalMsgpack(data)
+		if err != nil {
+			t.Errorf("Could not decode %d: %s", n, err)
+			continue
+		}
+		switch d := v.(type) {
+		case int64:
+			if d != n {
+				t.Errorf("Expected %d and got %d", n, d)
+			}
+		case uint64:
+			if int64(d) != n {
+				t.Errorf("Expected %d and got %d", n, d)
+			}
+		}
+	}
+}
+
+func TestCBOREncoding(t *testing.T) {
+	data, _ := MarshalCBOR(time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC))
+	expected := append([]byte{0xc0, 0x74}, "2013-03-21T20:04:00Z"...)
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Unexpected encoding of a time. Expected %x and got %x", expected, data)
+	}
+
+	// examples from appendix A of RFC 8949
+	decoded := map[string]interface{}{
+		"f93c00":                     1.0,
+		"f9c400":                     -4.0,
+		"3903e7":                     int64(-1000),
+		"c11a514b67b0":               time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC),
+		"7f657374726561646d696e67ff": "streaming",
+		"bf61610161629f0203ffff":     map[string]interface{}{"a": uint64(1), "b": []interface{}{uint64(2), uint64(3)}},
+	}
+	for hexData, expected := range decoded {
+		var data []byte
+		for i := 0; i < len(hexData); i += 2 {
+			var b byte
+			for _, c := range hexData[i : i+2] {
+				b <<= 4
+				if c >= 'a' {
+					b |= byte(c-'a') + 10
+				} else {
+					b |= byte(c - '0')
+				}
+			}
+			data = append(data, b)
+		}
+
+		v, err := UnmarshalCBOR(data)
+		if err != nil {
+			t.Errorf("Could not decode %s: %s", hexData, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("Unexpected value decoded from %s. Expected %#v and got %#v", hexData, expected, v)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	invalid := map[string][]byte{
+		"msgpack truncated string": {0xa5, 'a'},
+		"msgpack trailing data":    {0x80, 0x80},
+		"msgpack non-string key":   {0x81, 0x01, 0x01},
+		"msgpack huge array":       {0xdd, 0xff, 0xff, 0xff, 0xff},
+	}
+	for name, data := range invalid {
+		if _, err := UnmarshalMsgpack(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := UnmarshalCBOR([]byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Errorf("Expected an error for a CBOR array longer than the data")
+	}
+
+	deep := bytes.Repeat([]byte{0x91}, maxDepth+2)
+	if _, err := UnmarshalMsgpack(append(deep, 0xc0)); err == nil {
+		t.Errorf("Expected an error for deeply nested data")
+	}
+}
@@ -0,0 +1,387 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// MessagePack, see https://github.com/msgpack/msgpack/blob/master/spec.md
+
+const MsgpackMediaType = "application/msgpack"
+
+// extension type of the timestamps defined by the spec
+const msgpackTimestampExt = -1
+
+type msgpackWriter struct {
+	buf []byte
+}
+
+func (w *msgpackWriter) writeNil() { w.buf = append(w.buf, 0xc0) }
+
+func (w *msgpackWriter) writeBool(b bool) {
+	if b {
+		w.buf = append(w.buf, 0xc3)
+	} else {
+		w.buf = append(w.buf, 0xc2)
+	}
+}
+
+func (w *msgpackWriter) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		w.writeUint(uint64(i))
+	case i >= -32:
+		w.buf = append(w.buf, byte(i))
+	case i >= math.MinInt8:
+		w.buf = append(w.buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		w.buf = append(w.buf, 0xd1)
+		w.buf = appendUint16(w.buf, uint16(i))
+	case i >= math.MinInt32:
+		w.buf = append(w.buf, 0xd2)
+		w.buf = appendUint32(w.buf, uint32(i))
+	default:
+		w.buf = append(w.buf, 0xd3)
+		w.buf = appendUint64(w.buf, uint64(i))
+	}
+}
+
+func (w *msgpackWriter) writeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		w.buf = append(w.buf, byte(u))
+	case u <= math.MaxUint8:
+		w.buf = append(w.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		w.buf = append(w.buf, 0xcd)
+		w.buf = appendUint16(w.buf, uint16(u))
+	case u <= math.MaxUint32:
+		w.buf = append(w.buf, 0xce)
+		w.buf = appendUint32(w.buf, uint32(u))
+	default:
+		w.buf = append(w.buf, 0xcf)
+		w.buf = appendUint64(w.buf, u)
+	}
+}
+
+func (w *msgpackWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		w.buf = append(w.buf, 0xca)
+		w.buf = appendUint32(w.buf, math.Float32bits(float32(f)))
+		return
+	}
+	w.buf = append(w.buf, 0xcb)
+	w.buf = appendUint64(w.buf, math.Float64bits(f))
+}
+
+func (w *msgpackWriter) writeString(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		w.buf = append(w.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		w.buf = append(w.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		w.buf = append(w.buf, 0xda)
+		w.buf = appendUint16(w.buf, uint16(n))
+	default:
+		w.buf = append(w.buf, 0xdb)
+		w.buf = appendUint32(w.buf, uint32(n))
+	}
+	w.buf = append(w.buf, s...)
+}
+
+func (w *msgpackWriter) writeBytes(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		w.buf = append(w.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		w.buf = append(w.buf, 0xc5)
+		w.buf = appendUint16(w.buf, uint16(n))
+	default:
+		w.buf = append(w.buf, 0xc6)
+		w.buf = appendUint32(w.buf, uint32(n))
+	}
+	w.buf = append(w.buf, b...)
+}
+
+// writeTime uses the smallest of the three timestamp formats of the spec
+func (w *msgpackWriter) writeTime(t time.Time) {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+
+	switch {
+	case sec >= 0 && sec>>34 == 0 && nsec == 0 && sec <= math.MaxUint32:
+		w.buf = append(w.buf, 0xd6, byte(0xff))
+		w.buf = appendUint32(w.buf, uint32(sec))
+	case sec >= 0 && sec>>34 == 0:
+		w.buf = append(w.buf, 0xd7, byte(0xff))
+		w.buf = appendUint64(w.buf, nsec<<34|uint64(sec))
+	default:
+		w.buf = append(w.buf, 0xc7, 12, byte(0xff))
+		w.buf = appendUint32(w.buf, uint32(nsec))
+		w.buf = appendUint64(w.buf, uint64(sec))
+	}
+}
+
+func (w *msgpackWriter) writeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		w.buf = append(w.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		w.buf = append(w.buf, 0xdc)
+		w.buf = appendUint16(w.buf, uint16(n))
+	default:
+		w.buf = append(w.buf, 0xdd)
+		w.buf = appendUint32(w.buf, uint32(n))
+	}
+}
+
+func (w *msgpackWriter) writeMapHeader(n int) {
+	switch {
+	case n < 16:
+		w.buf = append(w.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		w.buf = append(w.buf, 0xde)
+		w.buf = appendUint16(w.buf, uint16(n))
+	default:
+		w.buf = append(w.buf, 0xdf)
+		w.buf = appendUint32(w.buf, uint32(n))
+	}
+}
+
+// MarshalMsgpack encodes v as MessagePack
+func MarshalMsgpack(v interface{}) ([]byte, error) {
+	w := &msgpackWriter{}
+	if err := encodeValue(w, reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+	return w.buf, nil
+}
+
+var errTruncated = errors.New("codec: unexpected end of data")
+
+type msgpackReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, errTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *msgpackReader) readUint(n int) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (r *msgpackReader) readLength(n int) (int, error) {
+	u, err := r.readUint(n)
+	if err != nil {
+		return 0, err
+	}
+	// every element takes at least one byte, so longer lengths are invalid
+	if u > uint64(len(r.data)-r.pos) {
+		return 0, errTruncated
+	}
+	return int(u), nil
+}
+
+func (r *msgpackReader) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("codec: value is nested too deeply")
+	}
+
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return r.decodeMap(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return r.decodeArray(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		s, err := r.next(int(c & 0x1f))
+		return string(s), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.readLength(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.next(n)
+		return append([]byte(nil), b...), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.readLength(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return r.decodeExt(n)
+	case 0xca:
+		u, err := r.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := r.readUint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return r.readUint(1 << (c - 0xcc))
+	case 0xd0:
+		u, err := r.readUint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := r.readUint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := r.readUint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := r.readUint(8)
+		return int64(u), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return r.decodeExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.readLength(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		s, err := r.next(n)
+		return string(s), err
+	case 0xdc, 0xdd:
+		n, err := r.readLength(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.decodeArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := r.readLength(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.decodeMap(n, depth)
+	}
+
+	return nil, fmt.Errorf("codec: invalid MessagePack byte 0x%02x", c)
+}
+
+func (r *msgpackReader) decodeArray(n int, depth int) (interface{}, error) {
+	arr := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := r.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func (r *msgpackReader) decodeMap(n int, depth int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := r.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("codec: map keys must be strings")
+		}
+		if m[key], err = r.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (r *msgpackReader) decodeExt(n int) (interface{}, error) {
+	typ, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ[0]) != msgpackTimestampExt {
+		return nil, fmt.Errorf("codec: unsupported MessagePack extension type %d", int8(typ[0]))
+	}
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data[:4])
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return nil, fmt.Errorf("codec: invalid MessagePack timestamp of %d bytes", n)
+}
+
+// UnmarshalMsgpack decodes a single MessagePack value into generic values:
+// maps with string keys, slices, strings, numbers, booleans, nil, byte slices and times
+func UnmarshalMsgpack(data []byte) (interface{}, error) {
+	r := &msgpackReader{data: data}
+	v, err := r.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(data) {
+		return nil, fmt.Errorf("codec: data must only contain a single MessagePack value")
+	}
+	return v, nil
+}
+
+// MsgpackToJSON converts a MessagePack document to JSON
+func MsgpackToJSON(data []byte) ([]byte, error) {
+	v, err := UnmarshalMsgpack(data)
+	if err != nil {
+		return nil, err
+	}
+	return toJSON(v)
+}
+
+func appendUint16(b []byte, u uint16) []byte {
+	return append(b, byte(u>>8), byte(u))
+}
+
+func appendUint32(b []byte, u uint32) []byte {
+	return append(b, byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
+
+func appendUint64(b []byte, u uint64) []byte {
+	return append(b, byte(u>>56), byte(u>>48), byte(u>>40), byte(u>>32), byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"appyinsta/api/graphql"
+	"appyinsta/api/models"
+	"appyinsta/api/ratelimit"
+	"appyinsta/api/utils"
+)
+
+// The server is configured through environment variables.
+// See the "Running the API" section of the README for the list.
+
+type RateLimits struct {
+	// "memory" (the default) or "mongo" to share limits between replicas
+	Store string
+	// trust the X-Forwarded-For header to identify clients
+	TrustProxy bool
+
+	Read   ratelimit.Limit // GET routes
+	Write  ratelimit.Limit // creation of posts
+	Signup ratelimit.Limit // creation of users
+	// failed authentications with HTTP Basic credentials
+	AuthFailures ratelimit.Limit
+}
+
+type Stream struct {
+	// "memory" (the default) streams the events of this server, and "mongo"
+	// the events of every replica from a change stream of the database
+	Source string
+	// the number of messages buffered for each connection
+	Buffer int
+}
+
+type Moderation struct {
+	// posts are hidden when they have this number of open reports, never if 0
+	ReportThreshold int
+	// the captions with one of these words are rejected, or flagged
+	RejectedWords []string
+	FlaggedWords  []string
+	// the captions with more links are flagged as spam, never if 0
+	MaxLinks int
+}
+
+type Config struct {
+	MongoURI string
+	DBName   string
+	Port     string
+
+	// the gRPC API is only served when a port is set for it
+	GRPCPort string
+
+	LogLevel string
+	Traces   string
+
+	RateLimits RateLimits
+	CORS       utils.CORSOptions
+
+	// responses smaller than this (in bytes) are not compressed
+	CompressionMinSize int
+
+	GraphQL graphql.Limits
+
+	Stream Stream
+
+	// a webhook delivery is a dead letter after this number of failed attempts
+	WebhookMaxAttempts int
+
+	Moderation Moderation
+
+	// the token of the admin routes, which are not served if it is empty,
+	// apart from the ones which users with a role can call
+	AdminToken string
+
+	// hash-chain the entries of the audit log, see store.VerifyAuditLog
+	AuditHashChain bool
+
+	// apply the pending migrations at startup, instead of refusing to start
+	AutoMigrate bool
+
+	// the first admin, created at startup when there is no admin yet,
+	// if an email is set. PwdHash is the password, hashed by the server.
+	BootstrapAdmin models.User
+}
+
+// FromEnv reads the configuration of the server from the environment
+func FromEnv() (*Config, error) {
+	return fromEnv(true)
+}
+
+// FromEnvForCLI is like FromEnv, but APPYINSTA_PORT is optional
+// since the commands other than serve only use the database
+func FromEnvForCLI() (*Config, error) {
+	return fromEnv(false)
+}
+
+func fromEnv(requirePort bool) (*Config, error) {
+	conf := &Config{
+		MongoURI: os.Getenv("MONGODB_URI"),
+		DBName:   os.Getenv("MONGODB_DBNAME"),
+		Port:     os.Getenv("APPYINSTA_PORT"),
+		GRPCPort: os.Getenv("APPYINSTA_GRPC_PORT"),
+		LogLevel: os.Getenv("APPYINSTA_LOG_LEVEL"),
+		Traces:   os.Getenv("APPYINSTA_TRACES"),
+
+		AdminToken: os.Getenv("APPYINSTA_ADMIN_TOKEN"),
+	}
+
+	if conf.MongoURI == "" || conf.DBName == "" {
+		return nil, fmt.Errorf("You must set the MONGODB_URI and MONGODB_DBNAME environment variables.")
+	}
+	if requirePort && conf.Port == "" {
+		return nil, fmt.Errorf("You must set the MONGODB_URI, MONGODB_DBNAME and APPYINSTA_PORT environment variables.")
+	}
+
+	var err error
+	conf.RateLimits.Store = getEnv("APPYINSTA_RATE_LIMIT_STORE", "memory")
+	if conf.RateLimits.Store != "memory" && conf.RateLimits.Store != "mongo" {
+		return nil, fmt.Errorf("APPYINSTA_RATE_LIMIT_STORE must be memory or mongo, found %q", conf.RateLimits.Store)
+	}
+
+	if conf.RateLimits.TrustProxy, err = getBoolEnv("APPYINSTA_TRUST_PROXY", false); err != nil {
+		return nil, err
+	}
+	if conf.RateLimits.Read, err = getLimitEnv("APPYINSTA_RATE_LIMIT_READ", "120/m"); err != nil {
+		return nil, err
+	}
+	if conf.RateLimits.Write, err = getLimitEnv("APPYINSTA_RATE_LIMIT_WRITE", "30/m"); err != nil {
+		return nil, err
+	}
+	if conf.RateLimits.Signup, err = getLimitEnv("APPYINSTA_RATE_LIMIT_SIGNUP", "5/m"); err != nil {
+		return nil, err
+	}
+	if conf.RateLimits.AuthFailures, err = getLimitEnv("APPYINSTA_RATE_LIMIT_AUTH_FAILURES", "20/h"); err != nil {
+		return nil, err
+	}
+
+	conf.CORS = utils.CORSOptions{
+		AllowedOrigins: getListEnv("APPYINSTA_CORS_ORIGINS", ""),
+		AllowedMethods: getListEnv("APPYINSTA_CORS_METHODS", "GET,POST,PUT,DELETE"),
+		AllowedHeaders: getListEnv("APPYINSTA_CORS_HEADERS", "Content-Type,Authorization,X-Request-ID,traceparent"),
+		ExposedHeaders: []string{utils.RequestIDHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
+	}
+	if conf.CORS.AllowCredentials, err = getBoolEnv("APPYINSTA_CORS_CREDENTIALS", false); err != nil {
+		return nil, err
+	}
+	if err := conf.CORS.Validate(); err != nil {
+		return nil, fmt.Errorf("APPYINSTA_CORS_ORIGINS and APPYINSTA_CORS_CREDENTIALS: %w", err)
+	}
+	if conf.CORS.MaxAge, err = getIntEnv("APPYINSTA_CORS_MAX_AGE", 600); err != nil {
+		return nil, err
+	}
+
+	if conf.CompressionMinSize, err = getIntEnv("APPYINSTA_COMPRESSION_MIN_SIZE", 1024); err != nil {
+		return nil, err
+	}
+
+	if conf.GraphQL.MaxDepth, err = getIntEnv("APPYINSTA_GRAPHQL_MAX_DEPTH", 8); err != nil {
+		return nil, err
+	}
+	if conf.GraphQL.MaxComplexity, err = getIntEnv("APPYINSTA_GRAPHQL_MAX_COMPLEXITY", 1000); err != nil {
+		return nil, err
+	}
+
+	conf.Stream.Source = getEnv("APPYINSTA_STREAM_SOURCE", "memory")
+	if conf.Stream.Source != "memory" && conf.Stream.Source != "mongo" {
+		return nil, fmt.Errorf("APPYINSTA_STREAM_SOURCE must be memory or mongo, found %q", conf.Stream.Source)
+	}
+	if conf.Stream.Buffer, err = getIntEnv("APPYINSTA_STREAM_BUFFER", 64); err != nil {
+		return nil, err
+	}
+	if conf.Stream.Buffer < 1 {
+		return nil, fmt.Errorf("APPYINSTA_STREAM_BUFFER must be at least 1, found %d", conf.Stream.Buffer)
+	}
+
+	if conf.WebhookMaxAttempts, err = getIntEnv("APPYINSTA_WEBHOOK_MAX_ATTEMPTS", 8); err != nil {
+		return nil, err
+	}
+	if conf.WebhookMaxAttempts < 1 {
+		return nil, fmt.Errorf("APPYINSTA_WEBHOOK_MAX_ATTEMPTS must be at least 1, found %d", conf.WebhookMaxAttempts)
+	}
+
+	if conf.Moderation.ReportThreshold, err = getIntEnv("APPYINSTA_REPORT_THRESHOLD", 3); err != nil {
+		return nil, err
+	}
+	if conf.Moderation.ReportThreshold < 0 {
+		return nil, fmt.Errorf("APPYINSTA_REPORT_THRESHOLD must not be negative, found %d", conf.Moderation.ReportThreshold)
+	}
+	conf.Moderation.RejectedWords = getListEnv("APPYINSTA_REJECTED_WORDS", "")
+	conf.Moderation.FlaggedWords = getListEnv("APPYINSTA_FLAGGED_WORDS", "")
+	if conf.Moderation.MaxLinks, err = getIntEnv("APPYINSTA_MAX_LINKS", 5); err != nil {
+		return nil, err
+	}
+	if conf.Moderation.MaxLinks < 0 {
+		return nil, fmt.Errorf("APPYINSTA_MAX_LINKS must not be negative, found %d", conf.Moderation.MaxLinks)
+	}
+
+	if conf.AuditHashChain, err = getBoolEnv("APPYINSTA_AUDIT_HASH_CHAIN", false); err != nil {
+		return nil, err
+	}
+	if conf.AutoMigrate, err = getBoolEnv("APPYINSTA_AUTO_MIGRATE", false); err != nil {
+		return nil, err
+	}
+
+	conf.BootstrapAdmin = models.User{
+		Name:     getEnv("APPYINSTA_BOOTSTRAP_ADMIN_NAME", "Admin"),
+		Email:    os.Getenv("APPYINSTA_BOOTSTRAP_ADMIN_EMAIL"),
+		Username: strings.ToLower(os.Getenv("APPYINSTA_BOOTSTRAP_ADMIN_USERNAME")),
+		PwdHash:  os.Getenv("APPYINSTA_BOOTSTRAP_ADMIN_PASSWORD"),
+	}
+	if (conf.BootstrapAdmin.Email == "") != (conf.BootstrapAdmin.PwdHash == "") {
+		return nil, fmt.Errorf("You must set both APPYINSTA_BOOTSTRAP_ADMIN_EMAIL and APPYINSTA_BOOTSTRAP_ADMIN_PASSWORD, or neither.")
+	}
+
+	return conf, nil
+}
+
+func getEnv(name string, fallback string) string {
+	if val := os.Getenv(name); val != "" {
+		return val
+	}
+	return fallback
+}
+
+func getBoolEnv(name string, fallback bool) (bool, error) {
+	val := os.Getenv(name)
+	if val == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, found %q", name, val)
+	}
+	return b, nil
+}
+
+func getLimitEnv(name string, fallback string) (ratelimit.Limit, error) {
+	limit, err := ratelimit.ParseLimit(getEnv(name, fallback))
+	if err != nil {
+		return limit, fmt.Errorf("%s: %s", name, err)
+	}
+	return limit, nil
+}
+
+func getIntEnv(name string, fallback int) (int, error) {
+	val := os.Getenv(name)
+	if val == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer, found %q", name, val)
+	}
+	return n, nil
+}
+
+// getListEnv splits a comma-separated list
+func getListEnv(name string, fallback string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(name, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
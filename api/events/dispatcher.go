@@ -0,0 +1,131 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"appyinsta/api/logging"
+)
+
+// Log is the outbox of the events, implemented by the stores
+type Log interface {
+	// ReadEvents returns at most limit events recorded after afterSeq, in order
+	ReadEvents(ctx context.Context, afterSeq int64, limit int64) ([]Event, error)
+	// AcquireEventLease makes owner the only dispatcher of the named offset
+	// until the given time, if it is not held by another owner, and returns
+	// the offset, which is the sequence number of the last event delivered
+	AcquireEventLease(ctx context.Context, name, owner string, now, until time.Time) (offset int64, ok bool, err error)
+	// SetEventOffset moves the named offset, and extends the lease of its owner until the given time.
+	// It fails if owner does not hold the lease anymore.
+	SetEventOffset(ctx context.Context, name, owner string, seq int64, until time.Time) error
+}
+
+// Defaults of the Dispatcher
+const (
+	DefaultMaxAttempts = 5
+	DefaultLease       = 30 * time.Second
+	dispatchBatchSize  = 100
+)
+
+// Dispatcher delivers the events of a log to the handlers of a bus, in
+// order, and moves its offset in the log after each event. The dispatchers
+// with the same name share the offset, and deliver the events one at a time
+// thanks to a lease, so several replicas can run one.
+//
+// An event is delivered again when one of the handlers fails, until it has
+// failed MaxAttempts times, after which it is skipped so that it does not
+// block the events after it.
+type Dispatcher struct {
+	Log         Log
+	Bus         *Bus
+	Name        string
+	MaxAttempts int
+	Lease       time.Duration
+
+	owner string
+	wake  chan struct{}
+	// the failed deliveries of the event after the offset
+	failures int
+}
+
+// NewDispatcher returns a Dispatcher of the named offset with the default settings
+func NewDispatcher(log Log, bus *Bus, name string) *Dispatcher {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &Dispatcher{
+		Log:         log,
+		Bus:         bus,
+		Name:        name,
+		MaxAttempts: DefaultMaxAttempts,
+		Lease:       DefaultLease,
+		owner:       hex.EncodeToString(b),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Wake makes Run deliver the events without waiting for the next interval,
+// after new events are recorded. It does nothing on a nil Dispatcher.
+func (d *Dispatcher) Wake() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers the events when it is woken, and every interval in case
+// events were recorded by another replica, until ctx is done
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			logging.FromContext(ctx).Error("could not dispatch events", "err", err, "dispatcher", d.Name)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// RunOnce delivers the events after the offset, if this dispatcher can get
+// the lease, and returns how many it delivered
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	offset, ok, err := d.Log.AcquireEventLease(ctx, d.Name, d.owner, now, now.Add(d.Lease))
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	delivered := 0
+	for {
+		events, err := d.Log.ReadEvents(ctx, offset, dispatchBatchSize)
+		if err != nil {
+			return delivered, err
+		}
+		for _, event := range events {
+			if err := d.Bus.Deliver(ctx, event); err != nil {
+				if d.failures++; d.failures < d.MaxAttempts {
+					return delivered, err
+				}
+				logging.FromContext(ctx).Error("skipping event", "err", err, "type", event.Type, "seq", event.Seq, "attempts", d.failures)
+			}
+			d.failures = 0
+			offset = event.Seq
+			if err := d.Log.SetEventOffset(ctx, d.Name, d.owner, offset, time.Now().UTC().Add(d.Lease)); err != nil {
+				return delivered, err
+			}
+			delivered++
+		}
+		if len(events) < dispatchBatchSize {
+			return delivered, nil
+		}
+	}
+}
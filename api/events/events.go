@@ -0,0 +1,129 @@
+// Package events carries the domain events emitted by the handlers, such as
+// a user following another one, to the parts of the server which react to
+// them, such as the notifications.
+//
+// Handlers record the events of a write in the outbox of the store, in the
+// same transaction as the write (see store.Record), so that an event is
+// recorded if and only if its change is stored. A Dispatcher reads the
+// outbox and delivers the events to the handlers subscribed to a Bus, at
+// least once: handlers must accept an event delivered again.
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Types of events
+const (
+	// Actor creates Post
+	Posted = "post"
+	// Actor deletes their Post
+	PostDeleted = "post_delete"
+	// Actor signs up
+	SignedUp = "signup"
+	// Actor follows User
+	Followed = "follow"
+	// Actor asks to follow User, who is private
+	FollowRequested = "follow_request"
+	// Actor accepts the request of User to follow them
+	FollowAccepted = "follow_accept"
+	// Actor mentions User in the caption of Post
+	Mentioned = "mention"
+)
+
+type Event struct {
+	// the position of the event in the outbox, set when it is recorded
+	Seq int64 `bson:"_id"`
+	// the ID of the event, set when it is recorded, which is the same when
+	// the event is delivered again
+	ID   primitive.ObjectID `bson:"id"`
+	Type string             `bson:"type"`
+	// the user who acted
+	Actor primitive.ObjectID `bson:"actor"`
+	// the user the event is about, if any
+	User primitive.ObjectID `bson:"user,omitempty"`
+	// the post the event is about, if any
+	Post primitive.ObjectID `bson:"post,omitempty"`
+	Time time.Time          `bson:"time"`
+}
+
+// Handler reacts to an event. Errors are logged, and do not stop the other handlers.
+type Handler func(ctx context.Context, event Event) error
+
+// Bus delivers the events to the handlers subscribed to it, in the order
+// they subscribed, in the goroutine of the publisher
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish calls the handlers for each event. Events without a time are
+// given the current time. Publishing on a nil Bus does nothing.
+func (b *Bus) Publish(ctx context.Context, events ...Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, event := range events {
+		if event.Time.IsZero() {
+			event.Time = time.Now().UTC()
+		}
+		deliver(ctx, handlers, event)
+	}
+}
+
+// Deliver calls the handlers for an event, and returns an error if any of them failed
+func (b *Bus) Deliver(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	return deliver(ctx, handlers, event)
+}
+
+func deliver(ctx context.Context, handlers []Handler, event Event) error {
+	failed := 0
+	var first error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			logging.FromContext(ctx).Error("could not handle event", "err", err, "type", event.Type, "seq", event.Seq)
+			if failed++; first == nil {
+				first = err
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d handlers of %s event %d failed, the first with: %w", failed, event.Type, event.Seq, first)
+	}
+	return nil
+}
+
+// PostCreated returns the events of a new post: the post itself, and the
+// mentions of its caption
+func PostCreated(post models.Post) []Event {
+	events := []Event{{Type: Posted, Actor: post.PostedByUID, Post: post.PostID, Time: post.PostedOn}}
+	for _, userID := range post.Mentions {
+		events = append(events, Event{Type: Mentioned, Actor: post.PostedByUID, User: userID, Post: post.PostID, Time: post.PostedOn})
+	}
+	return events
+}
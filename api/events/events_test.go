@@ -0,0 +1,37 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	var got []string
+	bus := NewBus()
+	bus.Subscribe(func(ctx context.Context, event Event) error {
+		got = append(got, "first "+event.Type)
+		return errors.New("ignored")
+	})
+	bus.Subscribe(func(ctx context.Context, event Event) error {
+		if event.Time.IsZero() {
+			t.Error("the time of the event is not set")
+		}
+		got = append(got, "second "+event.Type)
+		return nil
+	})
+
+	bus.Publish(context.Background(), Event{Type: Followed}, Event{Type: Mentioned})
+	want := []string{"first follow", "second follow", "first mention", "second mention"}
+	if len(got) != len(want) {
+		t.Fatalf("handlers were called for %q, expected %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("call %d was %q, expected %q", i, got[i], want[i])
+		}
+	}
+
+	var nilBus *Bus
+	nilBus.Publish(context.Background(), Event{Type: Followed})
+}
@@ -0,0 +1,158 @@
+// Package fixtures loads declarative test data into a fresh store, so that
+// tests do not depend on the contents of a shared database.
+//
+// Fixtures are JSON files with a list of users and a list of posts, in the
+// JSON form of the models. Every document must have an ID, posts must have
+// their posted_on timestamp, and the passwords of users are in plain text
+// and hashed when they are loaded, like the API does.
+//
+// A test gets its store from NewStore, which is an in-memory store unless
+// MONGODB_URI is set, in which case the fixtures are loaded into a new
+// database which is dropped when the test ends.
+package fixtures
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Fixtures struct {
+	Users []models.User `json:"users"`
+	Posts []models.Post `json:"posts"`
+}
+
+//go:embed fixtures.json
+var defaultFixtures []byte
+
+// Default returns the fixtures used by the tests of the handlers
+func Default() *Fixtures {
+	f, err := Parse(defaultFixtures)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Load reads fixtures from a file
+func Load(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Parse decodes and checks fixtures, and hashes the passwords of the users
+func Parse(data []byte) (*Fixtures, error) {
+	var f Fixtures
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+
+	for i, user := range f.Users {
+		if user.UserID.IsZero() || user.Name == "" || user.Email == "" || user.PwdHash == "" {
+			return nil, fmt.Errorf("user %d: id, name, email and password are required", i)
+		}
+		f.Users[i].PwdHash = utils.GetHashed256(user.PwdHash)
+	}
+	for i, post := range f.Posts {
+		if post.PostID.IsZero() || post.PostedByUID.IsZero() || post.PostedOn.IsZero() {
+			return nil, fmt.Errorf("post %d: id, posted_by and posted_on are required", i)
+		}
+	}
+	return &f, nil
+}
+
+// Insert inserts the fixtures into a store, in the order they are listed
+func (f *Fixtures) Insert(ctx context.Context, st store.Store) error {
+	if _, err := st.InsertUsers(ctx, f.Users, store.ConflictError); err != nil {
+		return err
+	}
+	_, err := st.InsertPosts(ctx, f.Posts, store.ConflictError)
+	return err
+}
+
+// NewStore returns a store with the fixtures, in a new MongoDB database if
+// MONGODB_URI is set (see NewMongoStore), or else in memory
+func NewStore(t testing.TB, f *Fixtures) store.Store {
+	t.Helper()
+	if os.Getenv("MONGODB_URI") != "" {
+		return NewMongoStore(t, f)
+	}
+	return NewMemoryStore(t, f)
+}
+
+func NewMemoryStore(t testing.TB, f *Fixtures) *store.MemoryStore {
+	t.Helper()
+	st := store.NewMemoryStore()
+	if err := f.Insert(context.Background(), st); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// NewMongoStore creates a database with a unique name on the server at
+// MONGODB_URI, applies the migrations and inserts the fixtures. The database
+// is dropped when the test ends. The test is skipped if MONGODB_URI is not set.
+func NewMongoStore(t testing.TB, f *Fixtures) *store.MongoStore {
+	t.Helper()
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		t.Skip("MONGODB_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database(uniqueName())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := db.Drop(ctx); err != nil {
+			t.Errorf("could not drop the test database %s: %v", db.Name(), err)
+		}
+		client.Disconnect(ctx)
+	})
+
+	st := store.NewMongoStore(db)
+	if _, err := st.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Insert(ctx, st); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// uniqueName returns the name of a test database, which sorts by creation
+// time so that databases left by interrupted runs are easy to find
+func uniqueName() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("appyinsta_test_%s_%s", time.Now().UTC().Format("20060102150405"), hex.EncodeToString(b))
+}
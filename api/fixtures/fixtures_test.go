@@ -0,0 +1,44 @@
+package fixtures
+
+import (
+	"context"
+	"testing"
+
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDefault(t *testing.T) {
+	f := Default()
+	if len(f.Users) == 0 || len(f.Posts) == 0 {
+		t.Fatalf("no default fixtures: %+v", f)
+	}
+
+	st := NewMemoryStore(t, f)
+	user, err := st.GetUser(context.Background(), f.Users[0].UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PwdHash != utils.GetHashed256("password") {
+		t.Errorf("password stored as %q, expected the hash of the fixture", user.PwdHash)
+	}
+
+	posts, _ := st.ListPosts(context.Background(), primitive.NilObjectID, 0)
+	if len(posts) != len(f.Posts) {
+		t.Errorf("%d posts inserted, expected %d", len(posts), len(f.Posts))
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []string{
+		`{"users":[{"name":"Ann","email":"ann@example.com","password":"pw"}]}`,
+		`{"posts":[{"id":"616156d49ab2934adcee255e","posted_by":"616156d49ab2934adcee255e","caption":"c","img_url":"i"}]}`,
+		`{"comments":[]}`,
+	}
+	for _, c := range cases {
+		if _, err := Parse([]byte(c)); err == nil {
+			t.Errorf("%s: expected an error", c)
+		}
+	}
+}
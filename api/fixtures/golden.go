@@ -0,0 +1,74 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Golden files hold the expected output of a test. When the output changes
+// on purpose, run the tests with -update to write the new output, and
+// review the change of the golden files before committing them.
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// Golden compares got with the contents of the file at path, or writes it
+// to the file if the tests are run with -update
+func Golden(t testing.TB, path string, got []byte) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run the tests with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the output: %s\nrun the tests with -update if the change is expected", path, firstDiff(want, got))
+	}
+}
+
+// GoldenJSON is like Golden for JSON documents, which are indented in the
+// golden file so that changes to it are easy to review
+func GoldenJSON(t testing.TB, path string, got []byte) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, got, "", "  "); err != nil {
+		t.Fatalf("output for %s is not JSON: %v: %s", path, err, got)
+	}
+	buf.WriteByte('\n')
+	Golden(t, path, buf.Bytes())
+}
+
+// firstDiff describes the first line which differs
+func firstDiff(want, got []byte) string {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d: expected %q, got %q", i+1, w, g)
+		}
+	}
+	return "no line differs"
+}
@@ -0,0 +1,111 @@
+package graphql
+
+// The analyzer validates an operation against the schema before it is
+// executed, and computes its depth and complexity so that expensive queries
+// can be rejected without running any resolver.
+//
+// Every field costs 1 plus the cost of its selection set, unless its
+// definition says otherwise (a connection multiplies the cost of its
+// selection set by the number of items requested). Selections excluded by
+// @skip or @include are counted as well.
+
+type analyzer struct {
+	doc      *Document
+	vars     map[string]interface{}
+	varTypes map[string]Type
+}
+
+// selectionSet returns the depth and complexity of a selection set on type t.
+// spreading holds the fragments being expanded, to detect cycles.
+func (an *analyzer) selectionSet(t *Object, sels []Selection, depth int, spreading []string) (int, int, error) {
+	maxDepth, complexity := 0, 0
+
+	for _, sel := range sels {
+		var d, c int
+		var err error
+
+		switch s := sel.(type) {
+		case *Field:
+			if _, err := shouldInclude(s.Directives, an.vars, an.varTypes); err != nil {
+				return 0, 0, err
+			}
+			d, c, err = an.field(t, s, depth, spreading)
+
+		case *InlineFragment:
+			if _, err := shouldInclude(s.Directives, an.vars, an.varTypes); err != nil {
+				return 0, 0, err
+			}
+			if s.TypeCondition != "" && s.TypeCondition != t.Name {
+				return 0, 0, locatedError(s.Loc, "Fragment cannot be spread here as objects of type \"%s\" can never be of type \"%s\".", t.Name, s.TypeCondition)
+			}
+			d, c, err = an.selectionSet(t, s.Selections, depth, spreading)
+
+		case *FragmentSpread:
+			if _, err := shouldInclude(s.Directives, an.vars, an.varTypes); err != nil {
+				return 0, 0, err
+			}
+			frag := an.doc.Fragments[s.Name]
+			if frag == nil {
+				return 0, 0, locatedError(s.Loc, "Unknown fragment \"%s\".", s.Name)
+			}
+			for _, name := range spreading {
+				if name == s.Name {
+					return 0, 0, locatedError(s.Loc, "Cannot spread fragment \"%s\" within itself.", s.Name)
+				}
+			}
+			if frag.TypeCondition != t.Name {
+				return 0, 0, locatedError(s.Loc, "Fragment \"%s\" cannot be spread here as objects of type \"%s\" can never be of type \"%s\".", s.Name, t.Name, frag.TypeCondition)
+			}
+			d, c, err = an.selectionSet(t, frag.Selections, depth, append(spreading, s.Name))
+		}
+
+		if err != nil {
+			return 0, 0, err
+		}
+		if d > maxDepth {
+			maxDepth = d
+		}
+		complexity += c
+	}
+
+	return maxDepth, complexity, nil
+}
+
+func (an *analyzer) field(t *Object, f *Field, depth int, spreading []string) (int, int, error) {
+	if f.Name == "__typename" {
+		if len(f.Selections) > 0 {
+			return 0, 0, locatedError(f.Loc, "Field \"__typename\" must not have a selection since type \"String!\" has no subfields.")
+		}
+		return depth, 0, nil
+	}
+
+	def, ok := t.Fields[f.Name]
+	if !ok {
+		return 0, 0, locatedError(f.Loc, "Cannot query field \"%s\" on type \"%s\".", f.Name, t.Name)
+	}
+
+	args, err := coerceArgs(def.Args, f.Arguments, an.vars, an.varTypes, "field \""+t.Name+"."+f.Name+"\"")
+	if err != nil {
+		if gqlErr, ok := err.(*Error); ok && gqlErr.Locations == nil {
+			gqlErr.Locations = []Location{f.Loc}
+		}
+		return 0, 0, err
+	}
+
+	fieldDepth, childComplexity := depth, 0
+	if obj, isObject := unwrap(def.Type).(*Object); isObject {
+		if len(f.Selections) == 0 {
+			return 0, 0, locatedError(f.Loc, "Field \"%s\" of type \"%s\" must have a selection of subfields.", f.Name, def.Type)
+		}
+		if fieldDepth, childComplexity, err = an.selectionSet(obj, f.Selections, depth+1, spreading); err != nil {
+			return 0, 0, err
+		}
+	} else if len(f.Selections) > 0 {
+		return 0, 0, locatedError(f.Loc, "Field \"%s\" must not have a selection since type \"%s\" has no subfields.", f.Name, def.Type)
+	}
+
+	if def.Complexity != nil {
+		return fieldDepth, def.Complexity(args, childComplexity), nil
+	}
+	return fieldDepth, 1 + childComplexity, nil
+}
@@ -0,0 +1,88 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Loader batches the lookups of values by key made while a request is
+// executed. Since the items of a list are completed concurrently, the loads
+// made by their fields within the Wait window are sent as a single call to
+// Fetch. Results are cached for the lifetime of the loader, so a loader
+// should be created for every request.
+type Loader[K comparable, V any] struct {
+	// Fetch returns the values of the given keys.
+	// Keys which are missing from the map have the zero value.
+	Fetch    func(ctx context.Context, keys []K) (map[K]V, error)
+	Wait     time.Duration
+	MaxBatch int
+
+	mu    sync.Mutex
+	batch *loaderBatch[K, V]
+	cache map[K]*loaderBatch[K, V]
+}
+
+type loaderBatch[K comparable, V any] struct {
+	keys   []K
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{Fetch: fetch, Wait: time.Millisecond, MaxBatch: 100}
+}
+
+// Load returns the value of a key, waiting for the batch it is part of
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	if l.cache == nil {
+		l.cache = map[K]*loaderBatch[K, V]{}
+	}
+
+	b, cached := l.cache[key]
+	if !cached {
+		if l.batch == nil {
+			l.batch = &loaderBatch[K, V]{done: make(chan struct{})}
+			go l.dispatchAfterWait(ctx, l.batch)
+		}
+		b = l.batch
+		b.keys = append(b.keys, key)
+		l.cache[key] = b
+
+		if l.MaxBatch > 0 && len(b.keys) >= l.MaxBatch {
+			l.batch = nil
+			go l.fetch(ctx, b)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.values[key], b.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *Loader[K, V]) dispatchAfterWait(ctx context.Context, b *loaderBatch[K, V]) {
+	time.Sleep(l.Wait)
+
+	l.mu.Lock()
+	if l.batch != b {
+		// the batch was already dispatched because it was full
+		l.mu.Unlock()
+		return
+	}
+	l.batch = nil
+	l.mu.Unlock()
+
+	l.fetch(ctx, b)
+}
+
+func (l *Loader[K, V]) fetch(ctx context.Context, b *loaderBatch[K, V]) {
+	b.values, b.err = l.Fetch(ctx, b.keys)
+	close(b.done)
+}
@@ -0,0 +1,432 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"appyinsta/api/logging"
+)
+
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is an error as it appears in the "errors" list of a response.
+// Resolvers return an *Error (see NewError) for errors which can be shown
+// to clients; the message of any other error is logged and replaced.
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func locatedError(loc Location, format string, args ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{loc}}
+}
+
+// Request is the body of a GraphQL request
+type Request struct {
+	Query         string                 `json:"query" openapi:"required"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type Response struct {
+	Data   interface{}
+	Errors []*Error
+
+	// Executed is false if the request failed before execution started
+	// (because the query is invalid), in which case there is no "data" entry
+	Executed bool
+}
+
+func (r *Response) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	if len(r.Errors) > 0 {
+		errs, err := json.Marshal(r.Errors)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(`"errors":`)
+		buf.Write(errs)
+	}
+	if r.Executed {
+		data, err := json.Marshal(r.Data)
+		if err != nil {
+			return nil, err
+		}
+		if len(r.Errors) > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`"data":`)
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// orderedMap keeps the fields of a result in the order they were selected
+type orderedMap struct {
+	keys   []string
+	values []interface{}
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Limits bound the cost of the queries accepted by Execute. Zero means no limit.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// Execute runs a request against the schema
+func Execute(ctx context.Context, schema *Schema, req Request, limits Limits) *Response {
+	fail := func(err error) *Response {
+		var gqlErr *Error
+		if !errors.As(err, &gqlErr) {
+			gqlErr = &Error{Message: err.Error()}
+		}
+		return &Response{Errors: []*Error{gqlErr}}
+	}
+
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return fail(err)
+	}
+
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return fail(err)
+	}
+
+	root := schema.Query
+	if op.Type == "mutation" {
+		if schema.Mutation == nil {
+			return fail(locatedError(op.Loc, "Schema is not configured for mutations."))
+		}
+		root = schema.Mutation
+	}
+
+	vars, varTypes, err := coerceVariables(op, req.Variables)
+	if err != nil {
+		return fail(err)
+	}
+
+	an := &analyzer{doc: doc, vars: vars, varTypes: varTypes}
+	depth, complexity, err := an.selectionSet(root, op.Selections, 1, nil)
+	if err != nil {
+		return fail(err)
+	}
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return fail(locatedError(op.Loc, "Query has a depth of %d, which exceeds the maximum depth of %d.", depth, limits.MaxDepth))
+	}
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		return fail(locatedError(op.Loc, "Query has a complexity of %d, which exceeds the maximum complexity of %d.", complexity, limits.MaxComplexity))
+	}
+
+	ex := &executor{doc: doc, vars: vars, varTypes: varTypes}
+	// the fields of a mutation are executed one after the other
+	data, ok := ex.selectionSet(ctx, root, nil, op.Selections, nil, op.Type == "query")
+
+	res := &Response{Errors: ex.errors, Executed: true}
+	if ok {
+		res.Data = data
+	}
+	return res
+}
+
+func selectOperation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) != 1 {
+			return nil, NewError("Must provide operation name if query contains multiple operations.")
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, NewError("Unknown operation named \"%s\".", name)
+}
+
+// fieldGroups are the fields of a selection set grouped by response key
+type fieldGroups struct {
+	keys  []string
+	byKey map[string][]*Field
+}
+
+// collectFields expands the fragments of a selection set and skips the
+// selections excluded by directives
+func collectFields(doc *Document, t *Object, sels []Selection, vars map[string]interface{}, varTypes map[string]Type, groups *fieldGroups, visited map[string]bool) error {
+	for _, sel := range sels {
+		switch s := sel.(type) {
+		case *Field:
+			include, err := shouldInclude(s.Directives, vars, varTypes)
+			if err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+			key := s.ResponseKey()
+			if _, ok := groups.byKey[key]; !ok {
+				groups.keys = append(groups.keys, key)
+			}
+			groups.byKey[key] = append(groups.byKey[key], s)
+
+		case *InlineFragment:
+			include, err := shouldInclude(s.Directives, vars, varTypes)
+			if err != nil {
+				return err
+			}
+			if !include || (s.TypeCondition != "" && s.TypeCondition != t.Name) {
+				continue
+			}
+			if err := collectFields(doc, t, s.Selections, vars, varTypes, groups, visited); err != nil {
+				return err
+			}
+
+		case *FragmentSpread:
+			include, err := shouldInclude(s.Directives, vars, varTypes)
+			if err != nil {
+				return err
+			}
+			if !include || visited[s.Name] {
+				continue
+			}
+			visited[s.Name] = true
+
+			frag := doc.Fragments[s.Name]
+			if frag == nil || frag.TypeCondition != t.Name {
+				continue
+			}
+			if err := collectFields(doc, t, frag.Selections, vars, varTypes, groups, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type executor struct {
+	doc      *Document
+	vars     map[string]interface{}
+	varTypes map[string]Type
+
+	mu     sync.Mutex
+	errors []*Error
+}
+
+func (ex *executor) addError(err error, loc Location, path []interface{}) {
+	gqlErr := &Error{}
+	var resolverErr *Error
+	if errors.As(err, &resolverErr) {
+		gqlErr.Message = resolverErr.Message
+	} else {
+		gqlErr.Message = "Internal server error"
+	}
+	gqlErr.Locations = []Location{loc}
+	gqlErr.Path = path
+
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	ex.errors = append(ex.errors, gqlErr)
+}
+
+// appendPath copies the path, as paths are shared between goroutines
+func appendPath(path []interface{}, elem interface{}) []interface{} {
+	p := make([]interface{}, len(path), len(path)+1)
+	copy(p, path)
+	return append(p, elem)
+}
+
+// selectionSet executes the selection set of an object. The bool returned
+// is false if a non-null field is null, in which case the object is null.
+func (ex *executor) selectionSet(ctx context.Context, t *Object, source interface{}, sels []Selection, path []interface{}, parallel bool) (interface{}, bool) {
+	groups := &fieldGroups{byKey: map[string][]*Field{}}
+	// directives were checked by the analyzer, so this cannot fail
+	collectFields(ex.doc, t, sels, ex.vars, ex.varTypes, groups, map[string]bool{})
+
+	result := &orderedMap{keys: groups.keys, values: make([]interface{}, len(groups.keys))}
+	oks := make([]bool, len(groups.keys))
+
+	if parallel && len(groups.keys) > 1 {
+		var wg sync.WaitGroup
+		for i, key := range groups.keys {
+			wg.Add(1)
+			go func(i int, key string) {
+				defer wg.Done()
+				result.values[i], oks[i] = ex.field(ctx, t, source, groups.byKey[key], appendPath(path, key))
+			}(i, key)
+		}
+		wg.Wait()
+	} else {
+		for i, key := range groups.keys {
+			result.values[i], oks[i] = ex.field(ctx, t, source, groups.byKey[key], appendPath(path, key))
+		}
+	}
+
+	for _, ok := range oks {
+		if !ok {
+			return nil, false
+		}
+	}
+	return result, true
+}
+
+func (ex *executor) field(ctx context.Context, t *Object, source interface{}, fields []*Field, path []interface{}) (interface{}, bool) {
+	f := fields[0]
+	if f.Name == "__typename" {
+		return t.Name, true
+	}
+	def := t.Fields[f.Name]
+
+	value, err := ex.resolve(ctx, t, def, f, source)
+	if err != nil {
+		ex.addError(err, f.Loc, path)
+		_, nonNull := def.Type.(*NonNull)
+		return nil, !nonNull
+	}
+
+	return ex.complete(ctx, def.Type, fields, path, value)
+}
+
+func (ex *executor) resolve(ctx context.Context, t *Object, def *FieldDef, f *Field, source interface{}) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.FromContext(ctx).Error("graphql resolver panicked", "field", t.Name+"."+f.Name, "panic", fmt.Sprint(r))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	args, err := coerceArgs(def.Args, f.Arguments, ex.vars, ex.varTypes, "field \""+t.Name+"."+f.Name+"\"")
+	if err != nil {
+		return nil, err
+	}
+
+	if def.Resolve == nil {
+		m, _ := source.(map[string]interface{})
+		return m[f.Name], nil
+	}
+
+	value, err = def.Resolve(ResolveParams{Context: ctx, Source: source, Args: args})
+	var gqlErr *Error
+	if err != nil && !errors.As(err, &gqlErr) {
+		logging.FromContext(ctx).Error("graphql resolver failed", "field", t.Name+"."+f.Name, "err", err)
+	}
+	return value, err
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// complete converts the value returned by a resolver to the result of the
+// field. The bool returned is false if the value is null and must not be,
+// in which case the null propagates to the parent field.
+func (ex *executor) complete(ctx context.Context, t Type, fields []*Field, path []interface{}, value interface{}) (interface{}, bool) {
+	if nn, ok := t.(*NonNull); ok {
+		if isNil(value) {
+			ex.addError(NewError("Cannot return null for non-nullable field."), fields[0].Loc, path)
+			return nil, false
+		}
+		return ex.completeValue(ctx, nn.Of, fields, path, value)
+	}
+
+	if isNil(value) {
+		return nil, true
+	}
+	result, ok := ex.completeValue(ctx, t, fields, path, value)
+	if !ok {
+		return nil, true
+	}
+	return result, true
+}
+
+func (ex *executor) completeValue(ctx context.Context, t Type, fields []*Field, path []interface{}, value interface{}) (interface{}, bool) {
+	switch tt := t.(type) {
+	case *Scalar:
+		result, err := tt.Serialize(value)
+		if err != nil {
+			ex.addError(NewError("%s", err.Error()), fields[0].Loc, path)
+			return nil, false
+		}
+		return result, true
+
+	case *List:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			ex.addError(fmt.Errorf("expected a list, got %T", value), fields[0].Loc, path)
+			return nil, false
+		}
+
+		// the items are completed concurrently, so that the lookups made by
+		// their fields can be batched by the data loaders
+		items := make([]interface{}, rv.Len())
+		oks := make([]bool, rv.Len())
+		var wg sync.WaitGroup
+		for i := range items {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				items[i], oks[i] = ex.complete(ctx, tt.Of, fields, appendPath(path, i), rv.Index(i).Interface())
+			}(i)
+		}
+		wg.Wait()
+
+		for _, ok := range oks {
+			if !ok {
+				return nil, false
+			}
+		}
+		return items, true
+
+	case *Object:
+		var sels []Selection
+		for _, f := range fields {
+			sels = append(sels, f.Selections...)
+		}
+		return ex.selectionSet(ctx, tt, value, sels, path, false)
+	}
+
+	ex.addError(fmt.Errorf("unknown type %s", t), fields[0].Loc, path)
+	return nil, false
+}
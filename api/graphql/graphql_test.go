@@ -0,0 +1,320 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// A small schema of authors and books for the tests
+
+type testAuthor struct {
+	ID   string
+	Name string
+}
+
+type testBook struct {
+	Title    string
+	AuthorID string
+}
+
+type loaderKey struct{}
+
+func testSchema(log *[]string) *Schema {
+	authors := map[string]*testAuthor{"1": {ID: "1", Name: "Ann"}, "2": {ID: "2", Name: "Bob"}}
+	books := []*testBook{{"A", "1"}, {"B", "2"}, {"C", "1"}, {"D", "3"}}
+
+	authorType := &Object{Name: "Author"}
+	bookType := &Object{Name: "Book"}
+
+	authorType.Fields = map[string]*FieldDef{
+		"id":   {Type: &NonNull{Of: ID}, Resolve: func(p ResolveParams) (interface{}, error) { return p.Source.(*testAuthor).ID, nil }},
+		"name": {Type: &NonNull{Of: String}, Resolve: func(p ResolveParams) (interface{}, error) { return p.Source.(*testAuthor).Name, nil }},
+		"books": {
+			Type: &NonNull{Of: &List{Of: &NonNull{Of: bookType}}},
+			Args: []*ArgDef{{Name: "first", Type: Int, Default: 10}},
+			Resolve: func(p ResolveParams) (interface{}, error) {
+				var res []*testBook
+				for _, b := range books {
+					if b.AuthorID == p.Source.(*testAuthor).ID && len(res) < p.Args["first"].(int) {
+						res = append(res, b)
+					}
+				}
+				return res, nil
+			},
+			Complexity: func(args map[string]interface{}, child int) int { return 1 + args["first"].(int)*child },
+		},
+	}
+	bookType.Fields = map[string]*FieldDef{
+		"title": {Type: &NonNull{Of: String}, Resolve: func(p ResolveParams) (interface{}, error) { return p.Source.(*testBook).Title, nil }},
+		"author": {
+			Type: authorType,
+			Resolve: func(p ResolveParams) (interface{}, error) {
+				return p.Context.Value(loaderKey{}).(*Loader[string, *testAuthor]).Load(p.Context, p.Source.(*testBook).AuthorID)
+			},
+		},
+		// a non-null field whose author may be missing
+		"authorName": {
+			Type: &NonNull{Of: String},
+			Resolve: func(p ResolveParams) (interface{}, error) {
+				if a := authors[p.Source.(*testBook).AuthorID]; a != nil {
+					return a.Name, nil
+				}
+				return nil, nil
+			},
+		},
+	}
+
+	var mu sync.Mutex
+	return &Schema{
+		Query: &Object{
+			Name: "Query",
+			Fields: map[string]*FieldDef{
+				"author": {
+					Type: authorType,
+					Args: []*ArgDef{{Name: "id", Type: &NonNull{Of: ID}}},
+					Resolve: func(p ResolveParams) (interface{}, error) {
+						return authors[p.Args["id"].(string)], nil
+					},
+				},
+				"books": {
+					Type:    &List{Of: bookType},
+					Resolve: func(p ResolveParams) (interface{}, error) { return books, nil },
+				},
+				"fail": {
+					Type:    String,
+					Resolve: func(p ResolveParams) (interface{}, error) { return nil, NewError("this field fails") },
+				},
+				"internal": {
+					Type:    String,
+					Resolve: func(p ResolveParams) (interface{}, error) { return nil, errors.New("connection refused") },
+				},
+				"echo": {
+					Type: String,
+					Args: []*ArgDef{{Name: "s", Type: String}, {Name: "n", Type: Int}, {Name: "ids", Type: &List{Of: &NonNull{Of: ID}}}},
+					Resolve: func(p ResolveParams) (interface{}, error) {
+						return fmt.Sprintf("%v %v %v", p.Args["s"], p.Args["n"], p.Args["ids"]), nil
+					},
+				},
+			},
+		},
+		Mutation: &Object{
+			Name: "Mutation",
+			Fields: map[string]*FieldDef{
+				"add": {
+					Type: &NonNull{Of: String},
+					Args: []*ArgDef{{Name: "s", Type: &NonNull{Of: String}}},
+					Resolve: func(p ResolveParams) (interface{}, error) {
+						mu.Lock()
+						defer mu.Unlock()
+						*log = append(*log, p.Args["s"].(string))
+						return strings.Join(*log, ","), nil
+					},
+				},
+			},
+		},
+	}
+}
+
+func run(t *testing.T, req Request, limits Limits) (string, *int32) {
+	t.Helper()
+
+	var fetches int32
+	var log []string
+	loader := NewLoader(func(ctx context.Context, ids []string) (map[string]*testAuthor, error) {
+		atomic.AddInt32(&fetches, 1)
+		res := map[string]*testAuthor{}
+		for _, id := range ids {
+			if id != "3" {
+				res[id] = &testAuthor{ID: id, Name: "author " + id}
+			}
+		}
+		return res, nil
+	})
+	ctx := context.WithValue(context.Background(), loaderKey{}, loader)
+
+	body, err := json.Marshal(Execute(ctx, testSchema(&log), req, limits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), &fetches
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      Request
+		expected string
+	}{
+		{
+			"fields in the order selected, with aliases",
+			Request{Query: `{ author(id: "1") { name, me: id, __typename } }`},
+			`{"data":{"author":{"name":"Ann","me":"1","__typename":"Author"}}}`,
+		},
+		{
+			"null for a missing object",
+			Request{Query: `{ author(id: 9) { name } }`},
+			`{"data":{"author":null}}`,
+		},
+		{
+			"variables and default values",
+			Request{
+				Query:     `query Q($s: String, $n: Int = 3, $ids: [ID!]) { echo(s: $s, n: $n, ids: $ids) }`,
+				Variables: map[string]interface{}{"s": "hi", "ids": "7"},
+			},
+			`{"data":{"echo":"hi 3 [7]"}}`,
+		},
+		{
+			"fragments and directives",
+			Request{
+				Query: `query($skip: Boolean!) { author(id: "2") { ...F ... on Author { id @skip(if: $skip) } } }
+				        fragment F on Author { name books @include(if: false) { title } }`,
+				Variables: map[string]interface{}{"skip": true},
+			},
+			`{"data":{"author":{"name":"Bob"}}}`,
+		},
+		{
+			"field errors leave the other fields",
+			Request{Query: `{ fail author(id: "1") { name } }`},
+			`{"errors":[{"message":"this field fails","locations":[{"line":1,"column":3}],"path":["fail"]}],"data":{"fail":null,"author":{"name":"Ann"}}}`,
+		},
+		{
+			"internal errors are hidden",
+			Request{Query: `{ internal }`},
+			`{"errors":[{"message":"Internal server error","locations":[{"line":1,"column":3}],"path":["internal"]}],"data":{"internal":null}}`,
+		},
+		{
+			"null in a non-null field propagates to the nearest nullable field",
+			Request{Query: `{ books { title authorName } }`},
+			`{"errors":[{"message":"Cannot return null for non-nullable field.","locations":[{"line":1,"column":17}],"path":["books",3,"authorName"]}],"data":{"books":[{"title":"A","authorName":"Ann"},{"title":"B","authorName":"Bob"},{"title":"C","authorName":"Ann"},null]}}`,
+		},
+		{
+			"mutations run in order",
+			Request{Query: `mutation { a: add(s: "a") b: add(s: "b") c: add(s: "c") }`},
+			`{"data":{"a":"a","b":"a,b","c":"a,b,c"}}`,
+		},
+		{
+			"operation name",
+			Request{Query: `query A { echo(s: "a") } query B { echo(s: "b") }`, OperationName: "B"},
+			`{"data":{"echo":"b \u003cnil\u003e \u003cnil\u003e"}}`,
+		},
+		{
+			"block strings",
+			Request{Query: "{ echo(s: \"\"\"\n    two\n      lines\n  \"\"\") }"},
+			`{"data":{"echo":"two\n  lines \u003cnil\u003e \u003cnil\u003e"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if body, _ := run(t, tt.req, Limits{}); body != tt.expected {
+				t.Errorf("got\n%s\nexpected\n%s", body, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      Request
+		expected string
+	}{
+		{"syntax error", Request{Query: "{ author(id: 1) { name }"}, `{"errors":[{"message":"Syntax Error: Expected Name, found \u003cEOF\u003e","locations":[{"line":1,"column":25}]}]}`},
+		{"unknown field", Request{Query: `{ author(id: 1) { age } }`}, `{"errors":[{"message":"Cannot query field \"age\" on type \"Author\".","locations":[{"line":1,"column":19}]}]}`},
+		{"missing selection", Request{Query: `{ author(id: 1) }`}, `{"errors":[{"message":"Field \"author\" of type \"Author\" must have a selection of subfields.","locations":[{"line":1,"column":3}]}]}`},
+		{"missing argument", Request{Query: `{ author { name } }`}, `{"errors":[{"message":"Argument \"id\" of required type \"ID!\" was not provided.","locations":[{"line":1,"column":3}]}]}`},
+		{"bad argument", Request{Query: `{ echo(n: "x") }`}, `{"errors":[{"message":"Argument \"n\" has an invalid value: Int cannot represent non-integer value: x","locations":[{"line":1,"column":8}]}]}`},
+		{"missing variable", Request{Query: `query($id: ID!) { author(id: $id) { name } }`}, `{"errors":[{"message":"Variable \"$id\" of required type \"ID!\" was not provided.","locations":[{"line":1,"column":7}]}]}`},
+		{"variable of the wrong type", Request{Query: `query($id: ID) { author(id: $id) { name } }`}, `{"errors":[{"message":"Variable \"$id\" of type \"ID\" used in position expecting type \"ID!\".","locations":[{"line":1,"column":25}]}]}`},
+		{"fragment cycle", Request{Query: `{ author(id: 1) { ...A } } fragment A on Author { ...B } fragment B on Author { ...A }`}, `{"errors":[{"message":"Cannot spread fragment \"A\" within itself.","locations":[{"line":1,"column":81}]}]}`},
+		{"several operations", Request{Query: `query A { fail } query B { fail }`}, `{"errors":[{"message":"Must provide operation name if query contains multiple operations."}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if body, _ := run(t, tt.req, Limits{}); body != tt.expected {
+				t.Errorf("got\n%s\nexpected\n%s", body, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	query := `{ author(id: 1) { books(first: 5) { author { books { title } } } } }`
+
+	// depth: author > books > author > books > title
+	body, _ := run(t, Request{Query: query}, Limits{MaxDepth: 4})
+	if !strings.Contains(body, "depth of 5, which exceeds the maximum depth of 4") {
+		t.Errorf("query deeper than the limit: got %s", body)
+	}
+
+	// complexity: 1 + (1 + 5 * (1 + (1 + 10 * 1)))
+	body, _ = run(t, Request{Query: query}, Limits{MaxComplexity: 50})
+	if !strings.Contains(body, "complexity of 62, which exceeds the maximum complexity of 50") {
+		t.Errorf("query more complex than the limit: got %s", body)
+	}
+
+	body, _ = run(t, Request{Query: query}, Limits{MaxDepth: 5, MaxComplexity: 62})
+	if strings.Contains(body, "errors") {
+		t.Errorf("query within the limits: got %s", body)
+	}
+}
+
+func TestLoaderBatchesLookups(t *testing.T) {
+	body, fetches := run(t, Request{Query: `{ books { author { name } } a: author(id: "1") { id } }`}, Limits{})
+
+	expected := `{"data":{"books":[{"author":{"name":"author 1"}},{"author":{"name":"author 2"}},{"author":{"name":"author 1"}},{"author":null}]` +
+		`,"a":{"id":"1"}}}`
+	if body != expected {
+		t.Errorf("got %s, expected %s", body, expected)
+	}
+	if *fetches != 1 {
+		t.Errorf("authors were fetched %d times, expected a single batch", *fetches)
+	}
+}
+
+func TestLoaderMaxBatch(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int
+	loader := NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+		res := map[int]int{}
+		for _, k := range keys {
+			res[k] = k * 2
+		}
+		return res, nil
+	})
+	loader.MaxBatch = 3
+
+	var wg sync.WaitGroup
+	for i := 0; i < 7; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if v, err := loader.Load(context.Background(), i%5); err != nil || v != (i%5)*2 {
+				t.Errorf("Load(%d) = %d, %v", i%5, v, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, b := range batches {
+		if len(b) > 3 {
+			t.Errorf("batch of %d keys, expected at most 3", len(b))
+		}
+		total += len(b)
+	}
+	// keys which were already requested come from the cache
+	if total != 5 {
+		t.Errorf("%d keys were fetched, expected 5", total)
+	}
+}
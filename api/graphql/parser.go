@@ -0,0 +1,559 @@
+package graphql
+
+// The syntax tree of a GraphQL document
+
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+type Operation struct {
+	Type       string // "query" or "mutation"
+	Name       string
+	Variables  []*VariableDefinition
+	Directives []*Directive
+	Selections []Selection
+	Loc        Location
+}
+
+type VariableDefinition struct {
+	Name    string
+	Type    *TypeRef
+	Default Value
+	Loc     Location
+}
+
+// TypeRef is a type as written in a variable definition
+type TypeRef struct {
+	Name    string   // set for named types
+	Elem    *TypeRef // set for list types
+	NonNull bool
+}
+
+func (t *TypeRef) String() string {
+	s := t.Name
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+	if t.NonNull {
+		s += "!"
+	}
+	return s
+}
+
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []Selection
+	Loc           Location
+}
+
+type Directive struct {
+	Name      string
+	Arguments []*Argument
+	Loc       Location
+}
+
+type Argument struct {
+	Name  string
+	Value Value
+	Loc   Location
+}
+
+// Selection is a *Field, a *FragmentSpread or an *InlineFragment
+type Selection interface {
+	selection()
+}
+
+type Field struct {
+	Alias      string
+	Name       string
+	Arguments  []*Argument
+	Directives []*Directive
+	Selections []Selection
+	Loc        Location
+}
+
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+	Loc        Location
+}
+
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []Selection
+	Loc           Location
+}
+
+func (*Field) selection()          {}
+func (*FragmentSpread) selection() {}
+func (*InlineFragment) selection() {}
+
+// ResponseKey is the key of the field in the result
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Value is one of the value types below
+type Value interface {
+	value()
+}
+
+type (
+	VariableValue struct{ Name string }
+	IntValue      struct{ Raw string }
+	FloatValue    struct{ Raw string }
+	StringValue   struct{ Value string }
+	BooleanValue  struct{ Value bool }
+	NullValue     struct{}
+	EnumValue     struct{ Name string }
+	ListValue     struct{ Values []Value }
+	ObjectValue   struct{ Fields []*ObjectField }
+	ObjectField   struct {
+		Name  string
+		Value Value
+	}
+)
+
+func (*VariableValue) value() {}
+func (*IntValue) value()      {}
+func (*FloatValue) value()    {}
+func (*StringValue) value()   {}
+func (*BooleanValue) value()  {}
+func (*NullValue) value()     {}
+func (*EnumValue) value()     {}
+func (*ListValue) value()     {}
+func (*ObjectValue) value()   {}
+
+// Parse parses a document. The error returned (if any) is an *Error.
+func Parse(src string) (*Document, error) {
+	p := &parser{lex: newLexer(src)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Fragments: map[string]*Fragment{}}
+	if p.tok.kind == tokEOF {
+		return nil, p.unexpected()
+	}
+
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.peek(tokPunct, "{"):
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", Selections: sels, Loc: sels[0].(locator).location()})
+
+		case p.peek(tokName, "query"), p.peek(tokName, "mutation"), p.peek(tokName, "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+
+		case p.peek(tokName, "fragment"):
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.Fragments[frag.Name]; ok {
+				return nil, &Error{Message: "There can be only one fragment named \"" + frag.Name + "\".", Locations: []Location{frag.Loc}}
+			}
+			doc.Fragments[frag.Name] = frag
+
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	return doc, nil
+}
+
+type locator interface {
+	location() Location
+}
+
+func (f *Field) location() Location          { return f.Loc }
+func (f *FragmentSpread) location() Location { return f.Loc }
+func (f *InlineFragment) location() Location { return f.Loc }
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) peek(kind tokenKind, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *parser) unexpected() *Error {
+	return p.lex.errorf(p.tok.loc, "Unexpected %s", p.tok)
+}
+
+// expect consumes a token of the given kind (and value, if not empty)
+func (p *parser) expect(kind tokenKind, value string) (token, error) {
+	tok := p.tok
+	if tok.kind != kind || (value != "" && tok.value != value) {
+		if value != "" {
+			return tok, p.lex.errorf(tok.loc, "Expected %q, found %s", value, tok)
+		}
+		return tok, p.lex.errorf(tok.loc, "Expected Name, found %s", tok)
+	}
+	return tok, p.advance()
+}
+
+// skip consumes the punctuator if it is the current token
+func (p *parser) skip(value string) (bool, error) {
+	if !p.peek(tokPunct, value) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	tok, err := p.expect(tokName, "")
+	return tok.value, err
+}
+
+func (p *parser) operation() (*Operation, error) {
+	op := &Operation{Type: p.tok.value, Loc: p.tok.loc}
+	if op.Type == "subscription" {
+		return nil, &Error{Message: "Subscriptions are not supported.", Locations: []Location{op.Loc}}
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.tok.kind == tokName {
+		if op.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if op.Variables, err = p.variableDefinitions(); err != nil {
+		return nil, err
+	}
+	if op.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.Selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDefinitions() ([]*VariableDefinition, error) {
+	if ok, err := p.skip("("); !ok || err != nil {
+		return nil, err
+	}
+
+	var defs []*VariableDefinition
+	for {
+		def := &VariableDefinition{Loc: p.tok.loc}
+		if _, err := p.expect(tokPunct, "$"); err != nil {
+			return nil, err
+		}
+		var err error
+		if def.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokPunct, ":"); err != nil {
+			return nil, err
+		}
+		if def.Type, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.skip("="); err != nil {
+			return nil, err
+		} else if ok {
+			if def.Default, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		// directives on variable definitions are parsed and ignored
+		if _, err := p.directives(); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+
+		if ok, err := p.skip(")"); ok || err != nil {
+			return defs, err
+		}
+	}
+}
+
+func (p *parser) typeRef() (*TypeRef, error) {
+	t := &TypeRef{}
+	if ok, err := p.skip("["); err != nil {
+		return nil, err
+	} else if ok {
+		if t.Elem, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokPunct, "]"); err != nil {
+			return nil, err
+		}
+	} else {
+		if t.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+
+	nonNull, err := p.skip("!")
+	t.NonNull = nonNull
+	return t, err
+}
+
+func (p *parser) directives() ([]*Directive, error) {
+	var dirs []*Directive
+	for p.peek(tokPunct, "@") {
+		dir := &Directive{Loc: p.tok.loc}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		if dir.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if dir.Arguments, err = p.arguments(); err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+func (p *parser) arguments() ([]*Argument, error) {
+	if ok, err := p.skip("("); !ok || err != nil {
+		return nil, err
+	}
+
+	var args []*Argument
+	for {
+		arg := &Argument{Loc: p.tok.loc}
+		var err error
+		if arg.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokPunct, ":"); err != nil {
+			return nil, err
+		}
+		if arg.Value, err = p.value(false); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if ok, err := p.skip(")"); ok || err != nil {
+			return args, err
+		}
+	}
+}
+
+func (p *parser) selectionSet() ([]Selection, error) {
+	if _, err := p.expect(tokPunct, "{"); err != nil {
+		return nil, err
+	}
+
+	var sels []Selection
+	for {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+
+		if ok, err := p.skip("}"); ok || err != nil {
+			return sels, err
+		}
+	}
+}
+
+func (p *parser) selection() (Selection, error) {
+	loc := p.tok.loc
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		return p.fragmentSelection(loc)
+	}
+
+	field := &Field{Loc: loc}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		field.Alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	field.Name = name
+
+	if field.Arguments, err = p.arguments(); err != nil {
+		return nil, err
+	}
+	if field.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek(tokPunct, "{") {
+		if field.Selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// fragmentSelection parses what follows "..." in a selection set
+func (p *parser) fragmentSelection(loc Location) (Selection, error) {
+	if p.tok.kind == tokName && p.tok.value != "on" {
+		spread := &FragmentSpread{Name: p.tok.value, Loc: loc}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		spread.Directives, err = p.directives()
+		return spread, err
+	}
+
+	inline := &InlineFragment{Loc: loc}
+	if p.peek(tokName, "on") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		if inline.TypeCondition, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if inline.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if inline.Selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return inline, nil
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	frag := &Fragment{Loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.peek(tokName, "on") {
+		return nil, p.unexpected()
+	}
+	if frag.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokName, "on"); err != nil {
+		return nil, err
+	}
+	if frag.TypeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if frag.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if frag.Selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return frag, nil
+}
+
+// value parses a value; variables are not allowed in constant values
+// (the default values of variables)
+func (p *parser) value(constant bool) (Value, error) {
+	tok := p.tok
+
+	switch tok.kind {
+	case tokInt:
+		return &IntValue{Raw: tok.value}, p.advance()
+	case tokFloat:
+		return &FloatValue{Raw: tok.value}, p.advance()
+	case tokString:
+		return &StringValue{Value: tok.value}, p.advance()
+	case tokName:
+		var v Value
+		switch tok.value {
+		case "true", "false":
+			v = &BooleanValue{Value: tok.value == "true"}
+		case "null":
+			v = &NullValue{}
+		default:
+			v = &EnumValue{Name: tok.value}
+		}
+		return v, p.advance()
+	}
+
+	switch {
+	case p.peek(tokPunct, "$") && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return &VariableValue{Name: name}, err
+
+	case p.peek(tokPunct, "["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := &ListValue{}
+		for {
+			if ok, err := p.skip("]"); ok || err != nil {
+				return list, err
+			}
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list.Values = append(list.Values, v)
+		}
+
+	case p.peek(tokPunct, "{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := &ObjectValue{}
+		for {
+			if ok, err := p.skip("}"); ok || err != nil {
+				return obj, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokPunct, ":"); err != nil {
+				return nil, err
+			}
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			obj.Fields = append(obj.Fields, &ObjectField{Name: name, Value: v})
+		}
+	}
+
+	return nil, p.unexpected()
+}
@@ -0,0 +1,233 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Type is a *Scalar, an *Object, a *List or a *NonNull
+type Type interface {
+	String() string
+}
+
+type Schema struct {
+	Query    *Object
+	Mutation *Object // may be nil
+}
+
+// Scalar is a leaf type. Serialize converts the value returned by a resolver
+// to its JSON representation, and Parse converts an input value (decoded
+// from the variables or from a literal in the query) to the value passed to resolvers.
+type Scalar struct {
+	Name      string
+	Serialize func(v interface{}) (interface{}, error)
+	Parse     func(v interface{}) (interface{}, error)
+}
+
+type Object struct {
+	Name   string
+	Fields map[string]*FieldDef
+}
+
+type List struct {
+	Of Type
+}
+
+type NonNull struct {
+	Of Type
+}
+
+func (t *Scalar) String() string  { return t.Name }
+func (t *Object) String() string  { return t.Name }
+func (t *List) String() string    { return "[" + t.Of.String() + "]" }
+func (t *NonNull) String() string { return t.Of.String() + "!" }
+
+type FieldDef struct {
+	Type Type
+	Args []*ArgDef
+
+	// Resolve returns the value of the field. If it is nil, the field is
+	// read from the source, which must then be a map[string]interface{}.
+	Resolve ResolveFunc
+
+	// Complexity returns the cost of the field given its arguments and the
+	// cost of its selection set. If it is nil, the cost is 1 plus the cost
+	// of the selection set.
+	Complexity func(args map[string]interface{}, childComplexity int) int
+}
+
+type ArgDef struct {
+	Name    string
+	Type    Type
+	Default interface{} // used when the argument is not given, unless nil
+}
+
+type ResolveParams struct {
+	Context context.Context
+	Source  interface{} // the value of the parent field
+	Args    map[string]interface{}
+}
+
+type ResolveFunc func(p ResolveParams) (interface{}, error)
+
+// NewError returns an error for a resolver to return
+func NewError(format string, args ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+// unwrap returns the named type of a type
+func unwrap(t Type) Type {
+	for {
+		switch tt := t.(type) {
+		case *NonNull:
+			t = tt.Of
+		case *List:
+			t = tt.Of
+		default:
+			return t
+		}
+	}
+}
+
+// Built-in scalars
+
+func serializeString(v interface{}) (interface{}, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case fmt.Stringer:
+		return s.String(), nil
+	}
+	return nil, fmt.Errorf("String cannot represent value: %v", v)
+}
+
+func serializeInt(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int32:
+		return int(n), nil
+	case int64:
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("Int cannot represent non 32-bit signed integer value: %d", n)
+		}
+		return int(n), nil
+	}
+	return nil, fmt.Errorf("Int cannot represent value: %v", v)
+}
+
+// parseInt accepts integers written in the query and integral JSON numbers
+func parseInt(v interface{}) (interface{}, error) {
+	var f float64
+	switch n := v.(type) {
+	case int64:
+		f = float64(n)
+	case float64:
+		f = n
+	default:
+		return nil, fmt.Errorf("Int cannot represent non-integer value: %v", v)
+	}
+	if f != math.Trunc(f) || f < math.MinInt32 || f > math.MaxInt32 {
+		return nil, fmt.Errorf("Int cannot represent non 32-bit signed integer value: %v", v)
+	}
+	return int(f), nil
+}
+
+var (
+	String = &Scalar{
+		Name:      "String",
+		Serialize: serializeString,
+		Parse: func(v interface{}) (interface{}, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			return nil, fmt.Errorf("String cannot represent a non string value: %v", v)
+		},
+	}
+
+	Int = &Scalar{Name: "Int", Serialize: serializeInt, Parse: parseInt}
+
+	Boolean = &Scalar{
+		Name: "Boolean",
+		Serialize: func(v interface{}) (interface{}, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean cannot represent value: %v", v)
+		},
+		Parse: func(v interface{}) (interface{}, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean cannot represent a non boolean value: %v", v)
+		},
+	}
+
+	// IDs are sent as strings, but integers are accepted as input
+	ID = &Scalar{
+		Name:      "ID",
+		Serialize: serializeString,
+		Parse: func(v interface{}) (interface{}, error) {
+			switch id := v.(type) {
+			case string:
+				return id, nil
+			case int64:
+				return strconv.FormatInt(id, 10), nil
+			case float64:
+				if id == math.Trunc(id) {
+					return strconv.FormatFloat(id, 'f', -1, 64), nil
+				}
+			}
+			return nil, fmt.Errorf("ID cannot represent value: %v", v)
+		},
+	}
+)
+
+// builtinScalars are the types which can be named in variable definitions
+var builtinScalars = map[string]*Scalar{
+	"String":  String,
+	"Int":     Int,
+	"Boolean": Boolean,
+	"ID":      ID,
+}
+
+// resolveTypeRef converts the type of a variable definition to a schema type
+func resolveTypeRef(ref *TypeRef) (Type, error) {
+	var t Type
+	if ref.Elem != nil {
+		elem, err := resolveTypeRef(ref.Elem)
+		if err != nil {
+			return nil, err
+		}
+		t = &List{Of: elem}
+	} else {
+		scalar, ok := builtinScalars[ref.Name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown input type \"%s\".", ref.Name)
+		}
+		t = scalar
+	}
+	if ref.NonNull {
+		t = &NonNull{Of: t}
+	}
+	return t, nil
+}
+
+// isSubtype reports whether a variable of type varType can be used where
+// an argument of type argType is expected
+func isSubtype(varType, argType Type) bool {
+	if nnArg, ok := argType.(*NonNull); ok {
+		nnVar, ok := varType.(*NonNull)
+		return ok && isSubtype(nnVar.Of, nnArg.Of)
+	}
+	if nnVar, ok := varType.(*NonNull); ok {
+		return isSubtype(nnVar.Of, argType)
+	}
+	if listArg, ok := argType.(*List); ok {
+		listVar, ok := varType.(*List)
+		return ok && isSubtype(listVar.Of, listArg.Of)
+	}
+	return varType == argType
+}
@@ -0,0 +1,235 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Coercion of input values (variables and arguments) to the types of the schema
+
+// errNotProvided is returned by valueFromAST for variables without a value
+var errNotProvided = errors.New("variable not provided")
+
+// coerceVariables checks the variables sent with the request against the
+// definitions of the operation, applying the default values
+func coerceVariables(op *Operation, input map[string]interface{}) (map[string]interface{}, map[string]Type, error) {
+	values := map[string]interface{}{}
+	types := map[string]Type{}
+
+	for _, def := range op.Variables {
+		if _, ok := types[def.Name]; ok {
+			return nil, nil, locatedError(def.Loc, "There can be only one variable named \"$%s\".", def.Name)
+		}
+		t, err := resolveTypeRef(def.Type)
+		if err != nil {
+			return nil, nil, locatedError(def.Loc, "%s", err.Error())
+		}
+		types[def.Name] = t
+
+		raw, provided := input[def.Name]
+		switch {
+		case provided:
+			v, err := coerceInput(t, raw)
+			if err != nil {
+				return nil, nil, locatedError(def.Loc, "Variable \"$%s\" got invalid value: %s", def.Name, err.Error())
+			}
+			values[def.Name] = v
+		case def.Default != nil:
+			v, err := valueFromAST(t, def.Default, nil)
+			if err != nil {
+				return nil, nil, locatedError(def.Loc, "Variable \"$%s\" has an invalid default value: %s", def.Name, err.Error())
+			}
+			values[def.Name] = v
+		default:
+			if _, ok := t.(*NonNull); ok {
+				return nil, nil, locatedError(def.Loc, "Variable \"$%s\" of required type \"%s\" was not provided.", def.Name, t)
+			}
+		}
+	}
+
+	return values, types, nil
+}
+
+// coerceInput converts a value decoded from JSON to the given type
+func coerceInput(t Type, v interface{}) (interface{}, error) {
+	if nn, ok := t.(*NonNull); ok {
+		if v == nil {
+			return nil, fmt.Errorf("Expected non-nullable type \"%s\" not to be null.", t)
+		}
+		return coerceInput(nn.Of, v)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch tt := t.(type) {
+	case *List:
+		items, ok := v.([]interface{})
+		if !ok {
+			// a single value is accepted as a list of one item
+			item, err := coerceInput(tt.Of, v)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			if list[i], err = coerceInput(tt.Of, item); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case *Scalar:
+		return tt.Parse(v)
+	}
+	return nil, fmt.Errorf("Type \"%s\" is not an input type.", t)
+}
+
+// valueFromAST converts a value written in the query to the given type
+func valueFromAST(t Type, v Value, vars map[string]interface{}) (interface{}, error) {
+	if variable, ok := v.(*VariableValue); ok {
+		val, ok := vars[variable.Name]
+		if !ok {
+			return nil, errNotProvided
+		}
+		if _, nonNull := t.(*NonNull); nonNull && val == nil {
+			return nil, fmt.Errorf("Expected non-nullable type \"%s\" not to be null.", t)
+		}
+		return val, nil
+	}
+
+	if nn, ok := t.(*NonNull); ok {
+		if _, null := v.(*NullValue); null {
+			return nil, fmt.Errorf("Expected value of type \"%s\", found null.", t)
+		}
+		return valueFromAST(nn.Of, v, vars)
+	}
+	if _, null := v.(*NullValue); null {
+		return nil, nil
+	}
+
+	switch tt := t.(type) {
+	case *List:
+		list, ok := v.(*ListValue)
+		if !ok {
+			item, err := valueFromAST(tt.Of, v, vars)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		items := make([]interface{}, len(list.Values))
+		for i, item := range list.Values {
+			var err error
+			if items[i], err = valueFromAST(tt.Of, item, vars); err == errNotProvided {
+				items[i] = nil
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+
+	case *Scalar:
+		var literal interface{}
+		switch lit := v.(type) {
+		case *IntValue:
+			n, err := strconv.ParseInt(lit.Raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s cannot represent value: %s", tt.Name, lit.Raw)
+			}
+			literal = n
+		case *FloatValue:
+			f, err := strconv.ParseFloat(lit.Raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s cannot represent value: %s", tt.Name, lit.Raw)
+			}
+			literal = f
+		case *StringValue:
+			literal = lit.Value
+		case *BooleanValue:
+			literal = lit.Value
+		default:
+			return nil, fmt.Errorf("%s cannot represent a non scalar value.", tt.Name)
+		}
+		return tt.Parse(literal)
+	}
+
+	return nil, fmt.Errorf("Type \"%s\" is not an input type.", t)
+}
+
+// coerceArgs computes the arguments of a field (or directive) from those
+// written in the query, the variables and the default values
+func coerceArgs(defs []*ArgDef, args []*Argument, vars map[string]interface{}, varTypes map[string]Type, owner string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	byName := map[string]*Argument{}
+	for _, arg := range args {
+		if _, ok := byName[arg.Name]; ok {
+			return nil, locatedError(arg.Loc, "There can be only one argument named \"%s\".", arg.Name)
+		}
+		byName[arg.Name] = arg
+
+		known := false
+		for _, def := range defs {
+			known = known || def.Name == arg.Name
+		}
+		if !known {
+			return nil, locatedError(arg.Loc, "Unknown argument \"%s\" on %s.", arg.Name, owner)
+		}
+	}
+
+	for _, def := range defs {
+		arg, ok := byName[def.Name]
+		if ok {
+			if variable, isVar := arg.Value.(*VariableValue); isVar {
+				varType, defined := varTypes[variable.Name]
+				if !defined {
+					return nil, locatedError(arg.Loc, "Variable \"$%s\" is not defined.", variable.Name)
+				}
+				if !isSubtype(varType, def.Type) {
+					return nil, locatedError(arg.Loc, "Variable \"$%s\" of type \"%s\" used in position expecting type \"%s\".", variable.Name, varType, def.Type)
+				}
+			}
+
+			v, err := valueFromAST(def.Type, arg.Value, vars)
+			if err == nil {
+				values[def.Name] = v
+				continue
+			}
+			if err != errNotProvided {
+				return nil, locatedError(arg.Loc, "Argument \"%s\" has an invalid value: %s", def.Name, err.Error())
+			}
+		}
+
+		if def.Default != nil {
+			values[def.Name] = def.Default
+		} else if _, nonNull := def.Type.(*NonNull); nonNull {
+			return nil, NewError("Argument \"%s\" of required type \"%s\" was not provided.", def.Name, def.Type)
+		}
+	}
+
+	return values, nil
+}
+
+var conditionArgs = []*ArgDef{{Name: "if", Type: &NonNull{Of: Boolean}}}
+
+// shouldInclude evaluates the @skip and @include directives of a selection
+func shouldInclude(dirs []*Directive, vars map[string]interface{}, varTypes map[string]Type) (bool, error) {
+	for _, dir := range dirs {
+		if dir.Name != "skip" && dir.Name != "include" {
+			return false, locatedError(dir.Loc, "Unknown directive \"@%s\".", dir.Name)
+		}
+
+		args, err := coerceArgs(conditionArgs, dir.Arguments, vars, varTypes, "directive \"@"+dir.Name+"\"")
+		if err != nil {
+			return false, err
+		}
+		if args["if"].(bool) == (dir.Name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,150 @@
+package grpcserver
+
+import (
+	"context"
+	"math"
+	"net"
+	"time"
+
+	"appyinsta/api/appyinstapb"
+	"appyinsta/api/logging"
+	"appyinsta/api/ratelimit"
+	"appyinsta/api/tracing"
+	"appyinsta/api/utils"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// The interceptors do for RPCs what utils.MakeLoggingHandler and
+// utils.MakeTracingHandler do for HTTP requests: they assign a request ID
+// (or keep the one in the x-request-id metadata), join the caller's trace
+// (from the traceparent metadata) and write an access log line. The
+// address of the caller is in the context, see utils.ClientIP, and the
+// calls are rate limited, see RateLimits.
+
+func firstMetadata(md metadata.MD, key string) string {
+	if vals := md.Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func startCall(ctx context.Context, method string, logger *logging.Logger, tracer *tracing.Tracer) (context.Context, *tracing.Span, *logging.Logger) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	reqID := firstMetadata(md, "x-request-id")
+	if !utils.ValidRequestID(reqID) {
+		reqID = utils.NewRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", reqID))
+
+	if sc, err := tracing.ParseTraceparent(firstMetadata(md, tracing.TraceparentHeader)); err == nil {
+		ctx = tracing.ContextWithRemoteParent(ctx, sc)
+	}
+	ctx, span := tracer.Start(ctx, method, tracing.SpanKindServer)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", method)
+
+	reqLogger := logger.With("request_id", reqID)
+	if span != nil {
+		reqLogger = reqLogger.With("trace_id", span.SpanContext().TraceID.String())
+	}
+	ctx = utils.ContextWithRequestID(ctx, reqID)
+	if p, ok := peer.FromContext(ctx); ok {
+		ip := p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		ctx = utils.ContextWithClientIP(ctx, ip)
+	}
+	return logging.NewContext(ctx, reqLogger), span, reqLogger
+}
+
+func endCall(span *tracing.Span, reqLogger *logging.Logger, method string, start time.Time, err error) {
+	code := status.Code(err)
+	span.SetAttribute("rpc.grpc.status_code", int(code))
+	if err != nil {
+		span.SetStatus(tracing.StatusError, code.String())
+	}
+	span.End()
+
+	reqLogger.Info("rpc served", "method", method, "code", code.String(), "latency_ms", time.Since(start))
+}
+
+// RateLimits are the limits of the calls of each client, identified by the
+// address of utils.ClientIP, with the classes of the REST routes: CreateUser
+// takes its tokens from the bucket of POST /users, CreatePost has the write
+// limit and the other calls the read limit. Nothing is limited without Store.
+type RateLimits struct {
+	Store  ratelimit.Store
+	Read   ratelimit.Limit
+	Write  ratelimit.Limit
+	Signup ratelimit.Limit
+}
+
+// take takes a token for a call of method, like utils.MakeRateLimitHandler
+func (l RateLimits) take(ctx context.Context, method string) error {
+	if l.Store == nil {
+		return nil
+	}
+	limit, key := l.Read, "grpc:"+method
+	switch method {
+	case appyinstapb.UserService_CreateUser_FullMethodName:
+		limit, key = l.Signup, "users.create"
+	case appyinstapb.PostService_CreatePost_FullMethodName:
+		limit = l.Write
+	}
+
+	res, err := l.Store.Take(ctx, key+":"+utils.ClientIP(ctx), limit, time.Now())
+	if err != nil {
+		logging.FromContext(ctx).Warn("rate limiter unavailable", "err", err, "method", method)
+		return nil
+	}
+	if !res.Allowed {
+		return status.Errorf(codes.ResourceExhausted, "too many requests, retry in %d seconds", int(math.Ceil(res.RetryAfter.Seconds())))
+	}
+	return nil
+}
+
+func unaryInterceptor(logger *logging.Logger, tracer *tracing.Tracer, limits RateLimits) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, span, reqLogger := startCall(ctx, info.FullMethod, logger, tracer)
+
+		var resp interface{}
+		err := limits.take(ctx, info.FullMethod)
+		if err == nil {
+			resp, err = handler(ctx, req)
+		}
+		endCall(span, reqLogger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// wrappedStream replaces the context of a server stream
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ws *wrappedStream) Context() context.Context {
+	return ws.ctx
+}
+
+func streamInterceptor(logger *logging.Logger, tracer *tracing.Tracer, limits RateLimits) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, span, reqLogger := startCall(ss.Context(), info.FullMethod, logger, tracer)
+
+		err := limits.take(ctx, info.FullMethod)
+		if err == nil {
+			err = handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+		}
+		endCall(span, reqLogger, info.FullMethod, start, err)
+		return err
+	}
+}
@@ -0,0 +1,260 @@
+package grpcserver
+
+import (
+	"context"
+	"net/http"
+
+	"appyinsta/api/appyinstapb"
+	"appyinsta/api/audit"
+	"appyinsta/api/events"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/moderation"
+	"appyinsta/api/store"
+	"appyinsta/api/tracing"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The gRPC API (see api/appyinstapb/appyinsta.proto) for internal services.
+// It applies the same rules as the REST handlers and uses the same store.
+
+// NewServer creates a gRPC server with the user and post services registered.
+// tracer and bus may be nil. authenticate checks the credentials of the
+// users who create posts, and createPost creates them.
+func NewServer(st store.Store, dispatcher *events.Dispatcher, auditLog audit.Log, authenticate utils.Authenticator, createPost PostCreator, limits RateLimits, logger *logging.Logger, tracer *tracing.Tracer) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryInterceptor(logger, tracer, limits)),
+		grpc.ChainStreamInterceptor(streamInterceptor(logger, tracer, limits)),
+	)
+	appyinstapb.RegisterUserServiceServer(srv, &UserServer{Store: st, Events: dispatcher, Audit: auditLog})
+	appyinstapb.RegisterPostServiceServer(srv, &PostServer{Store: st, Authenticate: authenticate, Create: createPost})
+	return srv
+}
+
+type UserServer struct {
+	appyinstapb.UnimplementedUserServiceServer
+	Store store.Store
+	// woken after the events of a write are recorded
+	Events *events.Dispatcher
+	// the writes are recorded in the audit log of Audit.Store
+	Audit audit.Log
+}
+
+// PostCreator creates a post with the rules of the REST API, like
+// handlers.ServerEnv.CreatePost, which records its events and audit entry
+type PostCreator func(ctx context.Context, post *models.Post) error
+
+type PostServer struct {
+	appyinstapb.UnimplementedPostServiceServer
+	Store store.Store
+	// checks the credentials of the authors of new posts
+	Authenticate utils.Authenticator
+	// creates the new posts
+	Create PostCreator
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// the gRPC API only authenticates the authors of new posts, so it only
+// serves the posts everyone sees, see store.Viewer
+var anonymous = &store.Viewer{}
+
+func parseID(id string, field string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return objID, status.Errorf(codes.InvalidArgument, "bad %s", field)
+	}
+	return objID, nil
+}
+
+func internalError(ctx context.Context, msg string, err error) error {
+	logging.FromContext(ctx).Error(msg, "err", err)
+	return status.Error(codes.Internal, "internal server error")
+}
+
+func toPBUser(user models.User) *appyinstapb.User {
+	return &appyinstapb.User{Id: user.UserID.Hex(), Name: user.Name, Email: user.Email}
+}
+
+func toPBPost(post models.Post) *appyinstapb.Post {
+	return &appyinstapb.Post{
+		Id:       post.PostID.Hex(),
+		PostedBy: post.PostedByUID.Hex(),
+		Caption:  post.Caption,
+		ImgUrl:   post.ImgURL,
+		PostedOn: timestamppb.New(post.PostedOn),
+	}
+}
+
+func (s *UserServer) CreateUser(ctx context.Context, req *appyinstapb.CreateUserRequest) (*appyinstapb.CreateUserResponse, error) {
+	if req.Name == "" || req.Email == "" || req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "name, email and password are required")
+	}
+
+	user := models.User{Name: req.Name, Email: req.Email, PwdHash: utils.GetHashed256(req.Password)}
+	err := store.Record(ctx, s.Store, func(ctx context.Context) ([]events.Event, error) {
+		if err := s.Store.CreateUser(ctx, &user); err != nil {
+			return nil, err
+		}
+		if err := s.Audit.Record(ctx, "users.create", "users", user.UserID, nil, user); err != nil {
+			return nil, err
+		}
+		return []events.Event{{Type: events.SignedUp, Actor: user.UserID}}, nil
+	})
+	if err != nil {
+		return nil, internalError(ctx, "could not insert user", err)
+	}
+	s.Events.Wake()
+
+	return &appyinstapb.CreateUserResponse{Id: user.UserID.Hex()}, nil
+}
+
+func (s *UserServer) GetUser(ctx context.Context, req *appyinstapb.GetUserRequest) (*appyinstapb.User, error) {
+	userID, err := parseID(req.Id, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.Store.GetUser(ctx, userID)
+	if err == store.ErrNotFound {
+		return nil, status.Error(codes.NotFound, "user not found")
+	} else if err != nil {
+		return nil, internalError(ctx, "could not find user", err)
+	}
+
+	return toPBUser(user), nil
+}
+
+// authenticate returns the context of a call for the user of the HTTP Basic
+// credentials in its authorization metadata, like utils.MakeUserAuthHandler
+func (s *PostServer) authenticate(ctx context.Context) (context.Context, primitive.ObjectID, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := http.Request{Header: http.Header{"Authorization": md.Get("authorization")}}
+	login, password, ok := header.BasicAuth()
+	if !ok {
+		return ctx, primitive.NilObjectID, status.Error(codes.Unauthenticated, "credentials are required")
+	}
+	userID, ok, err := s.Authenticate(ctx, login, password)
+	if err == utils.ErrTooManyAttempts {
+		return ctx, primitive.NilObjectID, status.Error(codes.ResourceExhausted, "too many failed authentication attempts")
+	} else if err != nil {
+		return ctx, primitive.NilObjectID, internalError(ctx, "could not authenticate", err)
+	}
+	if !ok {
+		return ctx, primitive.NilObjectID, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+	return utils.ContextWithUserID(ctx, userID), userID, nil
+}
+
+func (s *PostServer) CreatePost(ctx context.Context, req *appyinstapb.CreatePostRequest) (*appyinstapb.CreatePostResponse, error) {
+	ctx, postedBy, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.PostedBy != "" {
+		if id, err := parseID(req.PostedBy, "posted_by"); err != nil {
+			return nil, err
+		} else if id != postedBy {
+			return nil, status.Error(codes.PermissionDenied, "posted_by must be the authenticated user")
+		}
+	}
+	if req.Caption == "" || req.ImgUrl == "" {
+		return nil, status.Error(codes.InvalidArgument, "caption and img_url are required")
+	}
+
+	post := models.Post{PostedByUID: postedBy, Caption: req.Caption, ImgURL: req.ImgUrl}
+	if err := s.Create(ctx, &post); err == store.ErrUserDisabled {
+		return nil, status.Error(codes.PermissionDenied, "user is disabled")
+	} else if err == moderation.ErrRejected {
+		return nil, status.Error(codes.InvalidArgument, "the caption is not allowed")
+	} else if err != nil {
+		return nil, internalError(ctx, "could not insert post", err)
+	}
+
+	return &appyinstapb.CreatePostResponse{Id: post.PostID.Hex()}, nil
+}
+
+func (s *PostServer) GetPost(ctx context.Context, req *appyinstapb.GetPostRequest) (*appyinstapb.Post, error) {
+	postID, err := parseID(req.Id, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := s.Store.GetPost(ctx, postID)
+	if err == store.ErrNotFound || (err == nil && !anonymous.CanSee(post)) {
+		return nil, status.Error(codes.NotFound, "post not found")
+	} else if err != nil {
+		return nil, internalError(ctx, "could not find post", err)
+	}
+
+	return toPBPost(post), nil
+}
+
+func (s *PostServer) ListUserPosts(req *appyinstapb.ListUserPostsRequest, stream appyinstapb.PostService_ListUserPostsServer) error {
+	ctx := stream.Context()
+
+	userID, err := parseID(req.UserId, "user_id")
+	if err != nil {
+		return err
+	}
+
+	pageSize := int64(req.PageSize)
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize < 0 || pageSize > maxPageSize {
+		return status.Errorf(codes.InvalidArgument, "page_size must be between 1 and %d", maxPageSize)
+	}
+
+	pagInfo := models.PostPaginationInfo{NumberOfNewPosts: pageSize, FirstRequest: true}
+	if req.After != nil {
+		if pagInfo.LastPostID, err = parseID(req.After.LastId, "after.last_id"); err != nil {
+			return err
+		}
+		pagInfo.LastPostedOn = req.After.LastPostedOn.AsTime()
+		pagInfo.FirstRequest = false
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		posts, err := s.Store.ListUserPosts(ctx, anonymous, userID, pagInfo)
+		if err != nil {
+			return internalError(ctx, "could not query posts", err)
+		}
+		if len(posts) == 0 {
+			return nil
+		}
+
+		last := posts[len(posts)-1]
+		page := &appyinstapb.ListUserPostsResponse{
+			Next: &appyinstapb.PostCursor{LastId: last.PostID.Hex(), LastPostedOn: timestamppb.New(last.PostedOn)},
+		}
+		for _, post := range posts {
+			page.Posts = append(page.Posts, toPBPost(post))
+		}
+
+		if err := stream.Send(page); err != nil {
+			return err
+		}
+		if int64(len(posts)) < pageSize {
+			return nil
+		}
+
+		pagInfo.LastPostID = last.PostID
+		pagInfo.LastPostedOn = last.PostedOn
+		pagInfo.FirstRequest = false
+	}
+}
@@ -0,0 +1,295 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"appyinsta/api/appyinstapb"
+	"appyinsta/api/audit"
+	"appyinsta/api/handlers"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/moderation"
+	"appyinsta/api/ratelimit"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// authenticate accepts the ID of any user as login, with the password "secret"
+func authenticate(ctx context.Context, login, password string) (primitive.ObjectID, bool, error) {
+	id, err := primitive.ObjectIDFromHex(login)
+	return id, err == nil && password == "secret", nil
+}
+
+// asUser returns a copy of ctx for the calls of a user
+func asUser(ctx context.Context, userID, password string) context.Context {
+	credentials := base64.StdEncoding.EncodeToString([]byte(userID + ":" + password))
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Basic "+credentials)
+}
+
+// dial starts a server on an in-process listener and returns a connection to it
+func dial(t *testing.T, st store.Store) *grpc.ClientConn {
+	t.Helper()
+	return dialLimited(t, st, RateLimits{})
+}
+
+// dialLimited is dial with rate limits
+func dialLimited(t *testing.T, st store.Store, limits RateLimits) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	// the posts are created like with the REST API, "scam" is rejected
+	senv := &handlers.ServerEnv{Store: st, CaptionFilter: moderation.NewFilter([]string{"scam"}, nil, 0)}
+	srv := NewServer(st, nil, audit.Log{Store: st}, authenticate, senv.CreatePost, limits, logging.New(io.Discard, logging.LevelError), nil)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestUsers(t *testing.T) {
+	st := store.NewMemoryStore()
+	client := appyinstapb.NewUserServiceClient(dial(t, st))
+	ctx := context.Background()
+
+	created, err := client.CreateUser(ctx, &appyinstapb.CreateUserRequest{Name: "Ann", Email: "ann@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := client.GetUser(ctx, &appyinstapb.GetUserRequest{Id: created.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Id != created.Id || user.Name != "Ann" || user.Email != "ann@example.com" {
+		t.Errorf("GetUser returned %v", user)
+	}
+
+	id, _ := primitive.ObjectIDFromHex(created.Id)
+	if stored, _ := st.GetUser(ctx, id); stored.PwdHash == "" || stored.PwdHash == "secret" {
+		t.Errorf("password stored as %q, expected a hash", stored.PwdHash)
+	}
+	if entries, _ := st.ListAuditEntries(ctx, store.AuditFilter{}, 10); len(entries) != 1 || entries[0].Action != "users.create" || entries[0].RequestID == "" {
+		t.Errorf("audit log %+v", entries)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{"missing fields", func() error {
+			_, err := client.CreateUser(ctx, &appyinstapb.CreateUserRequest{Name: "Ann"})
+			return err
+		}, codes.InvalidArgument},
+		{"bad id", func() error {
+			_, err := client.GetUser(ctx, &appyinstapb.GetUserRequest{Id: "nope"})
+			return err
+		}, codes.InvalidArgument},
+		{"unknown id", func() error {
+			_, err := client.GetUser(ctx, &appyinstapb.GetUserRequest{Id: primitive.NewObjectID().Hex()})
+			return err
+		}, codes.NotFound},
+	}
+	for _, tt := range tests {
+		if code := status.Code(tt.call()); code != tt.code {
+			t.Errorf("%s: got code %v, expected %v", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestPosts(t *testing.T) {
+	st := store.NewMemoryStore()
+	client := appyinstapb.NewPostServiceClient(dial(t, st))
+	ctx := context.Background()
+	userID := primitive.NewObjectID().Hex()
+
+	_, err := client.CreatePost(ctx, &appyinstapb.CreatePostRequest{PostedBy: userID, Caption: "hello", ImgUrl: "img"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("CreatePost without credentials: got %v", err)
+	}
+	_, err = client.CreatePost(asUser(ctx, userID, "wrong"), &appyinstapb.CreatePostRequest{Caption: "hello", ImgUrl: "img"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("CreatePost with a wrong password: got %v", err)
+	}
+	_, err = client.CreatePost(asUser(ctx, userID, "secret"), &appyinstapb.CreatePostRequest{PostedBy: primitive.NewObjectID().Hex(), Caption: "hello", ImgUrl: "img"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("CreatePost for another user: got %v", err)
+	}
+
+	ctx = asUser(ctx, userID, "secret")
+	created, err := client.CreatePost(ctx, &appyinstapb.CreatePostRequest{Caption: "hello", ImgUrl: "https://example.com/a.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := client.GetPost(ctx, &appyinstapb.GetPostRequest{Id: created.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.PostedBy != userID || post.Caption != "hello" || post.PostedOn.AsTime().IsZero() {
+		t.Errorf("GetPost returned %v", post)
+	}
+	entries, _ := st.ListAuditEntries(ctx, store.AuditFilter{Action: "posts.create"}, 10)
+	if len(entries) != 1 || entries[0].Actor != models.ActorUser || entries[0].ActorID.Hex() != userID {
+		t.Errorf("the audit log has %+v", entries)
+	}
+
+	_, err = client.CreatePost(ctx, &appyinstapb.CreatePostRequest{PostedBy: userID})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreatePost without caption: got %v", err)
+	}
+	_, err = client.CreatePost(ctx, &appyinstapb.CreatePostRequest{Caption: "Not a scam", ImgUrl: "img"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreatePost with a rejected caption: got %v", err)
+	}
+	_, err = client.GetPost(ctx, &appyinstapb.GetPostRequest{Id: primitive.NewObjectID().Hex()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetPost with unknown id: got %v", err)
+	}
+}
+
+// receive reads all the pages of a ListUserPosts stream
+func receive(t *testing.T, stream appyinstapb.PostService_ListUserPostsClient) []*appyinstapb.ListUserPostsResponse {
+	t.Helper()
+	var pages []*appyinstapb.ListUserPostsResponse
+	for {
+		page, err := stream.Recv()
+		if err == io.EOF {
+			return pages
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+	}
+}
+
+func TestListUserPosts(t *testing.T) {
+	st := store.NewMemoryStore()
+	client := appyinstapb.NewPostServiceClient(dial(t, st))
+	ctx := context.Background()
+
+	userID := primitive.NewObjectID()
+	start := time.Date(2021, 10, 9, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		st.CreatePost(ctx, &models.Post{PostedByUID: userID, Caption: "post", ImgURL: "img", PostedOn: start.Add(time.Duration(i) * time.Minute)})
+	}
+	// a post by someone else
+	st.CreatePost(ctx, &models.Post{PostedByUID: primitive.NewObjectID(), Caption: "other", ImgURL: "img", PostedOn: start})
+
+	stream, err := client.ListUserPosts(ctx, &appyinstapb.ListUserPostsRequest{UserId: userID.Hex(), PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := receive(t, stream)
+	if len(pages) != 3 {
+		t.Fatalf("got %d pages, expected 3", len(pages))
+	}
+
+	var times []time.Time
+	for _, page := range pages {
+		for _, post := range page.Posts {
+			if post.PostedBy != userID.Hex() {
+				t.Errorf("got a post by %s", post.PostedBy)
+			}
+			times = append(times, post.PostedOn.AsTime())
+		}
+	}
+	if len(times) != 5 {
+		t.Fatalf("got %d posts, expected 5", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if !times[i].After(times[i-1]) {
+			t.Errorf("posts are not in the order they were posted: %v", times)
+		}
+	}
+
+	// resuming from the cursor of the first page skips its posts
+	stream, err = client.ListUserPosts(ctx, &appyinstapb.ListUserPostsRequest{UserId: userID.Hex(), PageSize: 10, After: pages[0].Next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rest := receive(t, stream); len(rest) != 1 || len(rest[0].Posts) != 3 {
+		t.Errorf("resuming got %v, expected one page of 3 posts", rest)
+	}
+
+	stream, err = client.ListUserPosts(ctx, &appyinstapb.ListUserPostsRequest{UserId: userID.Hex(), PageSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("page size over the maximum: got %v", err)
+	}
+}
+
+func TestListUserPostsTiedTimes(t *testing.T) {
+	st := store.NewMemoryStore()
+	client := appyinstapb.NewPostServiceClient(dial(t, st))
+	// the stream never ended when the posts had the same time
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID := primitive.NewObjectID()
+	postedOn := time.Date(2021, 10, 9, 12, 0, 0, 0, time.UTC)
+	ids := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		post := models.Post{PostedByUID: userID, Caption: "post", ImgURL: "img", PostedOn: postedOn}
+		st.CreatePost(ctx, &post)
+		ids[post.PostID.Hex()] = true
+	}
+
+	stream, err := client.ListUserPosts(ctx, &appyinstapb.ListUserPostsRequest{UserId: userID.Hex(), PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := receive(t, stream)
+	if len(pages) != 3 {
+		t.Fatalf("got %d pages, expected 3", len(pages))
+	}
+	for _, page := range pages {
+		if len(page.Posts) != 1 || !ids[page.Posts[0].Id] {
+			t.Fatalf("got page %v, expected one post not sent yet", page)
+		}
+		delete(ids, page.Posts[0].Id)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	st := store.NewMemoryStore()
+	limits := RateLimits{Store: ratelimit.NewMemoryStore(), Read: ratelimit.Limit{Rate: 1, Burst: 100}, Signup: ratelimit.Limit{Rate: 0.01, Burst: 1}}
+	client := appyinstapb.NewUserServiceClient(dialLimited(t, st, limits))
+	ctx := context.Background()
+
+	req := &appyinstapb.CreateUserRequest{Name: "Ann", Email: "ann@example.com", Password: "secret"}
+	created, err := client.CreateUser(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateUser(ctx, req); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("CreateUser over the signup limit: got %v", err)
+	}
+	// the other calls have their own limit
+	if _, err := client.GetUser(ctx, &appyinstapb.GetUserRequest{Id: created.Id}); err != nil {
+		t.Errorf("GetUser after the signup limit: got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/store"
+	"appyinsta/api/transfer"
+	"appyinsta/api/utils"
+)
+
+// The admin routes require the admin token, see utils.MakeAdminHandler.
+// Their writes are recorded in the audit log, see HandleAudit.
+
+// Maximum size of the body of an import
+var MaxImportBytes int64 = 256 << 20
+
+const ndjsonMediaType = "application/x-ndjson"
+
+// collectionFromPath returns the last element of the path if it is the name
+// of a collection that can be exported and imported, or writes an error
+func collectionFromPath(writer http.ResponseWriter, req *http.Request, prefix string) (string, bool) {
+	collection := strings.TrimPrefix(req.URL.Path, prefix)
+	for _, c := range transfer.Collections {
+		if c == collection {
+			return collection, true
+		}
+	}
+	utils.WriteError(writer, req, "Unknown collection, expected users or posts", http.StatusNotFound)
+	return "", false
+}
+
+// GET /admin/export/<users|posts>
+// The documents are streamed as NDJSON, see the transfer package.
+func (senv *ServerEnv) HandleExport(writer http.ResponseWriter, req *http.Request) {
+	collection, ok := collectionFromPath(writer, req, "/admin/export/")
+	if !ok {
+		return
+	}
+	logger := logging.FromContext(req.Context())
+
+	writer.Header().Set("Content-Type", ndjsonMediaType)
+	n, err := transfer.Export(req.Context(), senv.store(), collection, writer)
+	if err != nil {
+		logger.Error("could not export", "err", err, "collection", collection, "exported", n)
+		// once documents have been sent, the status cannot be changed
+		if n == 0 {
+			utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+	logger.Info("exported", "collection", collection, "exported", n)
+}
+
+// POST /admin/import/<users|posts>?on_conflict=<error|skip|upsert>&dry_run=<true|false>
+// The body is NDJSON, as sent by HandleExport.
+func (senv *ServerEnv) HandleImport(writer http.ResponseWriter, req *http.Request) {
+	collection, ok := collectionFromPath(writer, req, "/admin/import/")
+	if !ok {
+		return
+	}
+	logger := logging.FromContext(req.Context())
+
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != ndjsonMediaType {
+			utils.WriteError(writer, req, "Content-Type must be "+ndjsonMediaType, http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	query := req.URL.Query()
+	var opts transfer.Options
+	var err error
+	if opts.OnConflict, err = transfer.ParseOnConflict(query.Get("on_conflict")); err != nil {
+		utils.WriteError(writer, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if dryRun := query.Get("dry_run"); dryRun != "" {
+		if opts.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+			utils.WriteError(writer, req, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(writer, req.Body, MaxImportBytes)
+	opts.Audit = senv.auditLog()
+	res, err := transfer.Import(req.Context(), senv.store(), collection, body, opts)
+	if err == nil {
+		logger.Info("imported", "collection", collection, "dry_run", opts.DryRun, "inserted", res.Inserted, "replaced", res.Replaced, "skipped", res.Skipped)
+		utils.WriteResponse(writer, req, res)
+		return
+	}
+
+	// the documents of the batches before the error have been written
+	message := fmt.Sprintf("%s (%d inserted, %d replaced and %d skipped before the error)", err, res.Inserted, res.Replaced, res.Skipped)
+	var lineErr *transfer.LineError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &lineErr), errors.Is(err, bufio.ErrTooLong):
+		utils.WriteError(writer, req, message, http.StatusBadRequest)
+	case errors.Is(err, store.ErrDuplicateID):
+		utils.WriteError(writer, req, message, http.StatusConflict)
+	case errors.As(err, &maxBytesErr):
+		utils.WriteError(writer, req, fmt.Sprintf("Request body must not be larger than %d bytes", MaxImportBytes), http.StatusRequestEntityTooLarge)
+	default:
+		logger.Error("could not import", "err", err, "collection", collection)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
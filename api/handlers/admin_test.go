@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/transfer"
+)
+
+// These tests use an in-memory store, and do not need the database
+
+func TestAdminExportImport(t *testing.T) {
+	src := &ServerEnv{Store: store.NewMemoryStore()}
+	user := models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "hash"}
+	src.Store.CreateUser(context.Background(), &user)
+
+	w := httptest.NewRecorder()
+	src.HandleExport(w, httptest.NewRequest("GET", "/admin/export/users", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("export returned %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	exported := w.Body.String()
+
+	dst := &ServerEnv{Store: store.NewMemoryStore()}
+	importReq := func(query string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/import/users"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		w := httptest.NewRecorder()
+		dst.HandleImport(w, req)
+		return w
+	}
+
+	cases := []struct {
+		query    string
+		status   int
+		inserted int
+	}{
+		{"?dry_run=true", http.StatusOK, 0},
+		{"", http.StatusOK, 1},
+		{"", http.StatusConflict, 0},
+		{"?on_conflict=skip", http.StatusOK, 0},
+		{"?on_conflict=merge", http.StatusBadRequest, 0},
+		{"?dry_run=maybe", http.StatusBadRequest, 0},
+	}
+	for _, c := range cases {
+		w := importReq(c.query, exported)
+		if w.Code != c.status {
+			t.Errorf("import%s: expected %d, got %d: %s", c.query, c.status, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code == http.StatusOK {
+			var res transfer.Result
+			json.Unmarshal(w.Body.Bytes(), &res)
+			if res.Inserted != c.inserted {
+				t.Errorf("import%s: %+v", c.query, res)
+			}
+		}
+	}
+
+	if got, _ := dst.Store.GetUser(context.Background(), user.UserID); got != user {
+		t.Errorf("imported user %+v, expected %+v", got, user)
+	}
+
+	if w := importReq("", "{\"id\": 1}\n"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "line 1") {
+		t.Errorf("invalid line: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	dst.HandleExport(w, httptest.NewRequest("GET", "/admin/export/comments", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("export of an unknown collection returned %d", w.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/admin/import/users", strings.NewReader(exported))
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	dst.HandleImport(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("import of text/csv returned %d", w.Code)
+	}
+}
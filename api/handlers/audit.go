@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// auditFilter reads the filters of the audit log from the query, or writes an error
+func auditFilter(writer http.ResponseWriter, req *http.Request) (store.AuditFilter, bool) {
+	query := req.URL.Query()
+	filter := store.AuditFilter{
+		Action:     query.Get("action"),
+		Collection: query.Get("collection"),
+		Actor:      query.Get("actor"),
+		RequestID:  query.Get("request_id"),
+	}
+	for _, param := range []struct {
+		name string
+		id   **primitive.ObjectID
+	}{{"target_id", &filter.TargetID}, {"actor_id", &filter.ActorID}} {
+		if hex := query.Get(param.name); hex != "" {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				utils.WriteError(writer, req, "Bad "+param.name, http.StatusBadRequest)
+				return filter, false
+			}
+			*param.id = &id
+		}
+	}
+	for _, param := range []struct {
+		name string
+		time *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if s := query.Get(param.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				utils.WriteError(writer, req, param.name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return filter, false
+			}
+			*param.time = t
+		}
+	}
+	// the cursor is the sequence number of the last entry of the previous page
+	if after := query.Get("after"); after != "" {
+		seq, err := strconv.ParseInt(after, 10, 64)
+		if err != nil || seq < 1 {
+			utils.WriteError(writer, req, "Bad cursor", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.Before = seq
+	}
+	return filter, true
+}
+
+// GET /admin/audit?action=<action>&collection=<name>&target_id=<id>&actor=<actor>&actor_id=<userID>&request_id=<id>&since=<time>&until=<time>&limit=<n>&after=<cursor>
+// The entries of the audit log matching all the filters, the newest first.
+func (senv *ServerEnv) HandleAudit(writer http.ResponseWriter, req *http.Request) {
+	filter, ok := auditFilter(writer, req)
+	if !ok {
+		return
+	}
+	limit, ok := pageLimit(writer, req, DefaultPageLimit, MaxPageLimit)
+	if !ok {
+		return
+	}
+
+	list, err := senv.store().ListAuditEntries(req.Context(), filter, limit)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not list audit entries", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	page := models.AuditLog{Entries: list}
+	if page.Entries == nil {
+		page.Entries = []models.AuditEntry{}
+	}
+	if n := len(list); int64(n) == limit {
+		page.Next = strconv.FormatInt(list[n-1].Seq, 10)
+	}
+	utils.WriteResponse(writer, req, page)
+}
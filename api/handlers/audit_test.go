@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+)
+
+func TestAudit(t *testing.T) {
+	senv := newTestEnv(t)
+	senv.AuditHashChain = true
+	ctx := context.Background()
+
+	post := createPost(t, senv, "Hello #beach")
+	req := asUser(httptest.NewRequest("PUT", "/privacy", strings.NewReader(`{"private": true}`)), fixtureUserID)
+	req = req.WithContext(utils.ContextWithClientIP(utils.ContextWithRequestID(req.Context(), "req-1"), "192.0.2.1"))
+	senv.HandlePrivacy(httptest.NewRecorder(), req)
+	senv.HandlePostDelete(httptest.NewRecorder(), asUser(httptest.NewRequest("DELETE", "/posts/"+post.Hex(), nil), fixtureUserID))
+
+	query := func(query string) (int, models.AuditLog) {
+		w := httptest.NewRecorder()
+		senv.HandleAudit(w, httptest.NewRequest("GET", "/admin/audit?"+query, nil))
+		var log models.AuditLog
+		json.NewDecoder(w.Body).Decode(&log)
+		return w.Code, log
+	}
+
+	_, log := query("")
+	var actions []string
+	for _, e := range log.Entries {
+		actions = append(actions, e.Action)
+	}
+	if strings.Join(actions, " ") != "posts.delete users.privacy posts.create" {
+		t.Fatalf("audit log %q", actions)
+	}
+	privacy := log.Entries[1]
+	if privacy.Actor != models.ActorUser || *privacy.ActorID != fixtureUserID || privacy.RequestID != "req-1" || privacy.IP != "192.0.2.1" {
+		t.Errorf("entry of the privacy change %+v", privacy)
+	}
+	if change := privacy.Changes["private"]; len(privacy.Changes) != 1 || change.Before != nil || change.After != true {
+		t.Errorf("changes of the privacy %+v", privacy.Changes)
+	}
+	if deleted := log.Entries[0]; deleted.Changes["caption"].Before != "Hello #beach" || deleted.Changes["caption"].After != nil {
+		t.Errorf("changes of the deleted post %+v", deleted.Changes)
+	}
+
+	_, log = query("target_id=" + post.Hex() + "&limit=1")
+	if len(log.Entries) != 1 || log.Entries[0].Action != "posts.delete" || log.Next == "" {
+		t.Fatalf("first page of the post %+v", log)
+	}
+	if _, log = query("target_id=" + post.Hex() + "&after=" + log.Next); len(log.Entries) != 1 || log.Entries[0].Action != "posts.create" {
+		t.Errorf("second page of the post %+v", log)
+	}
+	if status, _ := query("since=yesterday"); status != http.StatusBadRequest {
+		t.Errorf("querying with a bad time returned %v", status)
+	}
+
+	// the admin actions are made by the admin token, or by a user with the permission
+	w := httptest.NewRecorder()
+	utils.MakeAdminHandler("s3cret", senv.HandleUserRole)(w, adminRequest("PUT", "/admin/users/"+adaID.Hex()+"/role", `{"role": "moderator"}`))
+	if _, log = query("action=admin.users.role"); len(log.Entries) != 1 || log.Entries[0].Actor != models.ActorAdmin || log.Entries[0].Changes["role"].After != "moderator" {
+		t.Errorf("entry of the admin action %+v", log.Entries)
+	}
+
+	if n, err := store.VerifyAuditLog(ctx, senv.store()); n != 4 || err != nil {
+		t.Errorf("VerifyAuditLog returned %d, %v", n, err)
+	}
+}
+
+func adminRequest(method, path, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	return req
+}
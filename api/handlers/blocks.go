@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/utils"
+)
+
+// POST /users/<userID>/block
+// Users who block each other do not see the posts and the profile of the
+// other one, and do not follow each other anymore.
+func (senv *ServerEnv) HandleBlock(writer http.ResponseWriter, req *http.Request) {
+	blocked, ok := senv.otherUserFromPath(writer, req, "/users/", "/block")
+	if !ok {
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+
+	if _, err := senv.store().Block(req.Context(), userID, blocked.UserID); err != nil {
+		logging.FromContext(req.Context()).Error("could not block", "err", err, "user_id", blocked.UserID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, models.BlockStatus{Blocking: true})
+}
+
+// DELETE /users/<userID>/block
+// The follows deleted by the block are not restored.
+func (senv *ServerEnv) HandleUnblock(writer http.ResponseWriter, req *http.Request) {
+	blocked, ok := senv.otherUserFromPath(writer, req, "/users/", "/block")
+	if !ok {
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+
+	if _, err := senv.store().Unblock(req.Context(), userID, blocked.UserID); err != nil {
+		logging.FromContext(req.Context()).Error("could not unblock", "err", err, "user_id", blocked.UserID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, models.BlockStatus{Blocking: false})
+}
+
+// POST /users/<userID>/mute
+// The new posts of a muted user are not streamed to the user who muted
+// them, who is not notified of what they do either.
+func (senv *ServerEnv) HandleMute(writer http.ResponseWriter, req *http.Request) {
+	muted, ok := senv.otherUserFromPath(writer, req, "/users/", "/mute")
+	if !ok {
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+
+	if _, err := senv.store().Mute(req.Context(), userID, muted.UserID); err != nil {
+		logging.FromContext(req.Context()).Error("could not mute", "err", err, "user_id", muted.UserID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, models.MuteStatus{Muting: true})
+}
+
+// DELETE /users/<userID>/mute
+func (senv *ServerEnv) HandleUnmute(writer http.ResponseWriter, req *http.Request) {
+	muted, ok := senv.otherUserFromPath(writer, req, "/users/", "/mute")
+	if !ok {
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+
+	if _, err := senv.store().Unmute(req.Context(), userID, muted.UserID); err != nil {
+		logging.FromContext(req.Context()).Error("could not unmute", "err", err, "user_id", muted.UserID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, models.MuteStatus{Muting: false})
+}
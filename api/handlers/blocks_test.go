@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appyinsta/api/models"
+)
+
+func TestBlock(t *testing.T) {
+	senv := newNotifyingTestEnv(t)
+	ctx := context.Background()
+
+	senv.HandleFollow(httptest.NewRecorder(), asUser(httptest.NewRequest("POST", "/users/6160fe9757a258c6bdc94056/follow", nil), adaID))
+	post := createPost(t, senv, "Hello #beach")
+
+	block := func(method string) string {
+		w := httptest.NewRecorder()
+		req := asUser(httptest.NewRequest(method, "/users/"+adaID.Hex()+"/block", nil), fixtureUserID)
+		if method == "POST" {
+			senv.HandleBlock(w, req)
+		} else {
+			senv.HandleUnblock(w, req)
+		}
+		return strings.TrimSpace(w.Body.String())
+	}
+	// what Ada sees of Souris: the post, the number of their posts, and whether the profile and the search find them
+	seen := func() (bool, int, bool, bool) {
+		w := httptest.NewRecorder()
+		senv.HandlePostGet(w, asUser(httptest.NewRequest("GET", "/posts/"+post.Hex(), nil), adaID))
+		var got models.Post
+		json.NewDecoder(w.Body).Decode(&got)
+
+		w = httptest.NewRecorder()
+		senv.HandleUserPostsGet(w, asUser(httptest.NewRequest("GET", "/posts/users/"+fixtureUserID.Hex(), strings.NewReader(`{"n_new":10,"first_request":true}`)), adaID))
+		var posts []models.Post
+		json.NewDecoder(w.Body).Decode(&posts)
+
+		w = httptest.NewRecorder()
+		senv.HandleUserGet(w, asUser(httptest.NewRequest("GET", "/users/"+fixtureUserID.Hex(), nil), adaID))
+		var user models.User
+		json.NewDecoder(w.Body).Decode(&user)
+
+		w = httptest.NewRecorder()
+		senv.HandleSearchUsers(w, asUser(httptest.NewRequest("GET", "/search/users?q=souris", nil), adaID))
+		var results models.UserSearchResults
+		json.NewDecoder(w.Body).Decode(&results)
+		return got.PostID == post, len(posts), !user.UserID.IsZero(), len(results.Results) == 1
+	}
+
+	if body := block("POST"); body != `{"blocking":true}` {
+		t.Fatalf("blocking returned %s", body)
+	}
+	if sawPost, n, sawUser, found := seen(); sawPost || n != 0 || sawUser || found {
+		t.Errorf("Ada sees Souris after being blocked: %v, %d posts, %v, %v", sawPost, n, sawUser, found)
+	}
+	if status, _ := senv.store().GetFollowStatus(ctx, adaID, fixtureUserID); status.Following {
+		t.Error("Ada still follows Souris after being blocked")
+	}
+
+	w := httptest.NewRecorder()
+	senv.HandleFollow(w, asUser(httptest.NewRequest("POST", "/users/6160fe9757a258c6bdc94056/follow", nil), adaID))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("following a user who blocks you returned %v", w.Code)
+	}
+
+	if body := block("DELETE"); body != `{"blocking":false}` {
+		t.Fatalf("unblocking returned %s", body)
+	}
+	if sawPost, n, sawUser, found := seen(); !sawPost || n != 1 || !sawUser || !found {
+		t.Errorf("Ada does not see Souris after the block: %v, %d posts, %v, %v", sawPost, n, sawUser, found)
+	}
+}
+
+func TestMute(t *testing.T) {
+	senv := newNotifyingTestEnv(t)
+	ctx := context.Background()
+
+	mute := func(method string) {
+		w := httptest.NewRecorder()
+		req := asUser(httptest.NewRequest(method, "/users/"+fixtureUserID.Hex()+"/mute", nil), adaID)
+		if method == "POST" {
+			senv.HandleMute(w, req)
+		} else {
+			senv.HandleUnmute(w, req)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s mute returned %v", method, w.Code)
+		}
+	}
+
+	mute("POST")
+	post := createPost(t, senv, "Hello @ada")
+	dispatch(t, senv)
+	if list, _ := senv.store().ListNotifications(ctx, adaID, nil, 10); len(list) != 0 {
+		t.Errorf("Ada was notified by a muted user: %+v", list)
+	}
+	// muted users are only hidden from the stream and the notifications
+	w := httptest.NewRecorder()
+	senv.HandlePostGet(w, asUser(httptest.NewRequest("GET", "/posts/"+post.Hex(), nil), adaID))
+	var got models.Post
+	if json.NewDecoder(w.Body).Decode(&got); got.PostID != post {
+		t.Errorf("Ada cannot see the post of a muted user: %s", w.Body)
+	}
+
+	mute("DELETE")
+	createPost(t, senv, "Bye @ada")
+	dispatch(t, senv)
+	if list, _ := senv.store().ListNotifications(ctx, adaID, nil, 10); len(list) != 1 {
+		t.Errorf("notifications of Ada after unmuting: %+v", list)
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"appyinsta/api/events"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Authenticate is the utils.Authenticator of the routes of users. The login
+// is the ID or the username of the user. Disabled users cannot log in.
+func (senv *ServerEnv) Authenticate(ctx context.Context, login, password string) (primitive.ObjectID, bool, error) {
+	var user models.User
+	if id, err := primitive.ObjectIDFromHex(login); err == nil {
+		user, err = senv.store().GetUser(ctx, id)
+		if err == store.ErrNotFound {
+			return primitive.NilObjectID, false, nil
+		} else if err != nil {
+			return primitive.NilObjectID, false, err
+		}
+	} else {
+		users, err := senv.store().GetUsersByUsername(ctx, []string{strings.ToLower(login)})
+		if err != nil || len(users) == 0 {
+			return primitive.NilObjectID, false, err
+		}
+		user = users[0]
+	}
+
+	hash := utils.GetHashed256(password)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(user.PwdHash)) != 1 || user.Disabled {
+		return primitive.NilObjectID, false, nil
+	}
+	return user.UserID, true, nil
+}
+
+// otherUserFromPath returns the user of a path like /users/<userID>/follow
+// if it is not the authenticated user, or writes an error
+func (senv *ServerEnv) otherUserFromPath(writer http.ResponseWriter, req *http.Request, prefix, suffix string) (models.User, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, prefix), suffix)
+	otherID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.WriteError(writer, req, "Bad userID", http.StatusBadRequest)
+		return models.User{}, false
+	}
+	if userID, _ := utils.UserID(req.Context()); userID == otherID {
+		utils.WriteError(writer, req, "The user is the authenticated user", http.StatusBadRequest)
+		return models.User{}, false
+	}
+
+	other, err := senv.store().GetUser(req.Context(), otherID)
+	if err == store.ErrNotFound {
+		utils.WriteError(writer, req, "User not found", http.StatusNotFound)
+		return other, false
+	} else if err != nil {
+		logging.FromContext(req.Context()).Error("could not find user", "err", err, "user_id", id)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return other, false
+	}
+	return other, true
+}
+
+// POST /users/<userID>/follow
+// Following a private user is a request, until they accept it. Users
+// cannot follow the users they block or who block them.
+func (senv *ServerEnv) HandleFollow(writer http.ResponseWriter, req *http.Request) {
+	followee, ok := senv.otherUserFromPath(writer, req, "/users/", "/follow")
+	if !ok {
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+	viewer, ok := senv.viewer(writer, req)
+	if !ok {
+		return
+	}
+	if !viewer.CanSeeUser(followee.UserID) {
+		utils.WriteError(writer, req, "One of the users blocks the other", http.StatusForbidden)
+		return
+	}
+
+	err := senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		created, err := senv.store().Follow(ctx, userID, followee.UserID, followee.Private)
+		// following again is not notified again
+		if err != nil || !created {
+			return nil, err
+		}
+		if followee.Private {
+			return []events.Event{{Type: events.FollowRequested, Actor: userID, User: followee.UserID}}, nil
+		}
+		return []events.Event{{Type: events.Followed, Actor: userID, User: followee.UserID}}, nil
+	})
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not follow", "err", err, "user_id", followee.UserID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	senv.writeFollowStatus(writer, req, userID, followee.UserID)
+}
+
+// writeFollowStatus sends whether a user follows another one, or asked to
+func (senv *ServerEnv) writeFollowStatus(writer http.ResponseWriter, req *http.Request, followerID, followeeID primitive.ObjectID) {
+	status, err := senv.store().GetFollowStatus(req.Context(), followerID, followeeID)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not find follow", "err", err, "user_id", followeeID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, status)
+}
+
+// DELETE /users/<userID>/follow
+// This also cancels a request to follow a private user.
+func (senv *ServerEnv) HandleUnfollow(writer http.ResponseWriter, req *http.Request) {
+	followee, ok := senv.otherUserFromPath(writer, req, "/users/", "/follow")
+	if !ok {
+		return
+	}
+	followeeID := followee.UserID
+	userID, _ := utils.UserID(req.Context())
+
+	if _, err := senv.store().Unfollow(req.Context(), userID, followeeID); err != nil {
+		logging.FromContext(req.Context()).Error("could not unfollow", "err", err, "user_id", followeeID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, models.FollowStatus{Following: false})
+}
+
+// GET /follow-requests
+// The users who asked to follow the authenticated user, oldest first
+func (senv *ServerEnv) HandleFollowRequests(writer http.ResponseWriter, req *http.Request) {
+	userID, _ := utils.UserID(req.Context())
+	logger := logging.FromContext(req.Context())
+
+	ids, err := senv.store().ListFollowRequests(req.Context(), userID)
+	if err != nil {
+		logger.Error("could not list follow requests", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	users, err := senv.store().GetUsers(req.Context(), ids)
+	if err != nil {
+		logger.Error("could not find users", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	byID := make(map[primitive.ObjectID]models.User, len(users))
+	for _, user := range users {
+		user.PwdHash = ""
+		byID[user.UserID] = user
+	}
+	requests := models.FollowRequests{Users: []models.User{}}
+	for _, id := range ids {
+		if user, ok := byID[id]; ok {
+			requests.Users = append(requests.Users, user)
+		}
+	}
+	utils.WriteResponse(writer, req, requests)
+}
+
+// POST /follow-requests/<userID>
+// The user who asked to follow the authenticated user follows them from now on.
+func (senv *ServerEnv) HandleFollowAccept(writer http.ResponseWriter, req *http.Request) {
+	follower, ok := senv.otherUserFromPath(writer, req, "/follow-requests/", "")
+	if !ok {
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+
+	var accepted bool
+	err := senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		var err error
+		if accepted, err = senv.store().AcceptFollow(ctx, follower.UserID, userID); err != nil || !accepted {
+			return nil, err
+		}
+		return []events.Event{{Type: events.FollowAccepted, Actor: userID, User: follower.UserID}}, nil
+	})
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not accept follow", "err", err, "user_id", follower.UserID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !accepted {
+		utils.WriteError(writer, req, "The user did not ask to follow you", http.StatusNotFound)
+		return
+	}
+	senv.writeFollowStatus(writer, req, follower.UserID, userID)
+}
+
+// DELETE /follow-requests/<userID>
+func (senv *ServerEnv) HandleFollowDecline(writer http.ResponseWriter, req *http.Request) {
+	follower, ok := senv.otherUserFromPath(writer, req, "/follow-requests/", "")
+	if !ok {
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+	logger := logging.FromContext(req.Context())
+
+	status, err := senv.store().GetFollowStatus(req.Context(), follower.UserID, userID)
+	if err == nil && status.Requested {
+		_, err = senv.store().Unfollow(req.Context(), follower.UserID, userID)
+	}
+	if err != nil {
+		logger.Error("could not decline follow", "err", err, "user_id", follower.UserID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !status.Requested {
+		utils.WriteError(writer, req, "The user did not ask to follow you", http.StatusNotFound)
+		return
+	}
+	utils.WriteResponse(writer, req, models.FollowStatus{})
+}
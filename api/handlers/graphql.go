@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/graphql"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/moderation"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The GraphQL schema of the API:
+//
+//	type Query {
+//	  user(id: ID!): User
+//	  post(id: ID!): Post
+//	}
+//
+//	type Mutation {
+//	  createUser(name: String!, email: String!, password: String!): User!
+//	  createPost(postedBy: ID, caption: String!, imgUrl: String!): Post!
+//	}
+//
+//	type User {
+//	  id: ID!
+//	  name: String!
+//	  email: String!
+//	  posts(first: Int = 10, after: String): PostConnection!
+//	}
+//
+//	type Post {
+//	  id: ID!
+//	  caption: String!
+//	  imgUrl: String!
+//	  postedOn: String!
+//	  author: User
+//	}
+//
+//	type PostConnection {
+//	  edges: [PostEdge!]!
+//	  pageInfo: PageInfo!
+//	}
+//
+//	type PostEdge {
+//	  cursor: String!
+//	  node: Post!
+//	}
+//
+//	type PageInfo {
+//	  hasNextPage: Boolean!
+//	  hasPreviousPage: Boolean!
+//	  startCursor: String
+//	  endCursor: String
+//	}
+//
+// The posts of a user are listed in the same order as by GET /posts/users/<userID>.
+
+const maxPostsPerPage = 100
+
+type graphQLLoadersKey struct{}
+
+// graphQLLoaders are created for every request, see HandleGraphQL
+type graphQLLoaders struct {
+	users *graphql.Loader[primitive.ObjectID, *models.User]
+	// the user of the request, who only sees the posts visible to them
+	viewer *store.Viewer
+}
+
+func newGraphQLLoaders(st store.Store, viewer *store.Viewer) *graphQLLoaders {
+	return &graphQLLoaders{
+		viewer: viewer,
+		users: graphql.NewLoader(func(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.User, error) {
+			users, err := st.GetUsers(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[primitive.ObjectID]*models.User, len(users))
+			for i := range users {
+				byID[users[i].UserID] = &users[i]
+			}
+			return byID, nil
+		}),
+	}
+}
+
+func loadersFromContext(ctx context.Context) *graphQLLoaders {
+	return ctx.Value(graphQLLoadersKey{}).(*graphQLLoaders)
+}
+
+// A cursor is the time a post was made and its ID, which is what the
+// store needs to continue listing posts after it
+func encodePostCursor(post *models.Post) string {
+	raw := post.PostedOn.UTC().Format(time.RFC3339Nano) + "|" + post.PostID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePostCursor(cursor string) (time.Time, primitive.ObjectID, error) {
+	invalid := graphql.NewError("Invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, invalid
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, primitive.NilObjectID, invalid
+	}
+	postedOn, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, invalid
+	}
+	postID, err := primitive.ObjectIDFromHex(parts[1])
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, invalid
+	}
+	return postedOn, postID, nil
+}
+
+func parseGraphQLID(id interface{}) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(id.(string))
+	if err != nil {
+		return objID, graphql.NewError("Invalid ID: %s", id)
+	}
+	return objID, nil
+}
+
+func nonNull(t graphql.Type) graphql.Type {
+	return &graphql.NonNull{Of: t}
+}
+
+func newGraphQLSchema(senv *ServerEnv) *graphql.Schema {
+	st := senv.store()
+	userType := &graphql.Object{Name: "User"}
+	postType := &graphql.Object{Name: "Post"}
+
+	pageInfoType := &graphql.Object{
+		Name: "PageInfo",
+		Fields: map[string]*graphql.FieldDef{
+			"hasNextPage":     {Type: nonNull(graphql.Boolean)},
+			"hasPreviousPage": {Type: nonNull(graphql.Boolean)},
+			"startCursor":     {Type: graphql.String},
+			"endCursor":       {Type: graphql.String},
+		},
+	}
+	postEdgeType := &graphql.Object{
+		Name: "PostEdge",
+		Fields: map[string]*graphql.FieldDef{
+			"cursor": {Type: nonNull(graphql.String)},
+			"node":   {Type: nonNull(postType)},
+		},
+	}
+	postConnectionType := &graphql.Object{
+		Name: "PostConnection",
+		Fields: map[string]*graphql.FieldDef{
+			"edges":    {Type: nonNull(&graphql.List{Of: nonNull(postEdgeType)})},
+			"pageInfo": {Type: nonNull(pageInfoType)},
+		},
+	}
+
+	userType.Fields = map[string]*graphql.FieldDef{
+		"id": {
+			Type:    nonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*models.User).UserID.Hex(), nil },
+		},
+		"name": {
+			Type:    nonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*models.User).Name, nil },
+		},
+		"email": {
+			Type:    nonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*models.User).Email, nil },
+		},
+		"posts": {
+			Type: nonNull(postConnectionType),
+			Args: []*graphql.ArgDef{
+				{Name: "first", Type: graphql.Int, Default: 10},
+				{Name: "after", Type: graphql.String},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return resolveUserPosts(p, st)
+			},
+			// every post requested costs as much as its selection set
+			Complexity: func(args map[string]interface{}, childComplexity int) int {
+				first, _ := args["first"].(int)
+				return 1 + first*childComplexity
+			},
+		},
+	}
+
+	postType.Fields = map[string]*graphql.FieldDef{
+		"id": {
+			Type:    nonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*models.Post).PostID.Hex(), nil },
+		},
+		"caption": {
+			Type:    nonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*models.Post).Caption, nil },
+		},
+		"imgUrl": {
+			Type:    nonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*models.Post).ImgURL, nil },
+		},
+		"postedOn": {
+			Type: nonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*models.Post).PostedOn.UTC().Format(time.RFC3339Nano), nil
+			},
+		},
+		"author": {
+			Type: userType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				// authors are looked up in batches, see newGraphQLLoaders
+				return loadersFromContext(p.Context).users.Load(p.Context, p.Source.(*models.Post).PostedByUID)
+			},
+		},
+	}
+
+	queryType := &graphql.Object{
+		Name: "Query",
+		Fields: map[string]*graphql.FieldDef{
+			"user": {
+				Type: userType,
+				Args: []*graphql.ArgDef{{Name: "id", Type: nonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					userID, err := parseGraphQLID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					loaders := loadersFromContext(p.Context)
+					if !loaders.viewer.CanSeeUser(userID) {
+						return nil, nil
+					}
+					return loaders.users.Load(p.Context, userID)
+				},
+			},
+			"post": {
+				Type: postType,
+				Args: []*graphql.ArgDef{{Name: "id", Type: nonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					postID, err := parseGraphQLID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					post, err := st.GetPost(p.Context, postID)
+					if err == store.ErrNotFound || (err == nil && !loadersFromContext(p.Context).viewer.CanSee(post)) {
+						return nil, nil
+					} else if err != nil {
+						return nil, err
+					}
+					return &post, nil
+				},
+			},
+		},
+	}
+
+	mutationType := &graphql.Object{
+		Name: "Mutation",
+		Fields: map[string]*graphql.FieldDef{
+			"createUser": {
+				Type: nonNull(userType),
+				Args: []*graphql.ArgDef{
+					{Name: "name", Type: nonNull(graphql.String)},
+					{Name: "email", Type: nonNull(graphql.String)},
+					{Name: "password", Type: nonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					user := models.User{Name: p.Args["name"].(string), Email: p.Args["email"].(string), PwdHash: p.Args["password"].(string)}
+					if user.Name == "" || user.Email == "" || user.PwdHash == "" {
+						return nil, graphql.NewError("name, email and password must not be empty")
+					}
+					// like POST /users, whose limit it shares
+					if !senv.allowSignup(p.Context) {
+						return nil, graphql.NewError("too many users created, try again later")
+					}
+
+					// hash the password of the user
+					user.PwdHash = utils.GetHashed256(user.PwdHash)
+
+					// like HandleUserCreate
+					err := senv.record(p.Context, func(ctx context.Context) ([]events.Event, error) {
+						if err := st.CreateUser(ctx, &user); err != nil {
+							return nil, err
+						}
+						if err := senv.audit(ctx, "users.create", "users", user.UserID, nil, user); err != nil {
+							return nil, err
+						}
+						return []events.Event{{Type: events.SignedUp, Actor: user.UserID}}, nil
+					})
+					if err != nil {
+						return nil, err
+					}
+					return &user, nil
+				},
+			},
+			"createPost": {
+				Type: nonNull(postType),
+				Args: []*graphql.ArgDef{
+					{Name: "postedBy", Type: graphql.ID},
+					{Name: "caption", Type: nonNull(graphql.String)},
+					{Name: "imgUrl", Type: nonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					// the post is posted by the authenticated user, like with POST /posts
+					postedBy, ok := utils.UserID(p.Context)
+					if !ok {
+						return nil, graphql.NewError("createPost needs the credentials of the user")
+					}
+					if id, ok := p.Args["postedBy"].(string); ok {
+						if objID, err := parseGraphQLID(id); err != nil {
+							return nil, err
+						} else if objID != postedBy {
+							return nil, graphql.NewError("postedBy must be the authenticated user")
+						}
+					}
+					post := models.Post{PostedByUID: postedBy, Caption: p.Args["caption"].(string), ImgURL: p.Args["imgUrl"].(string)}
+					if post.Caption == "" || post.ImgURL == "" {
+						return nil, graphql.NewError("caption and imgUrl must not be empty")
+					}
+
+					if err := senv.CreatePost(p.Context, &post); err == store.ErrUserDisabled {
+						return nil, graphql.NewError("user is disabled")
+					} else if err == moderation.ErrRejected {
+						return nil, graphql.NewError("the caption is not allowed")
+					} else if err != nil {
+						return nil, err
+					}
+					return &post, nil
+				},
+			},
+		},
+	}
+
+	return &graphql.Schema{Query: queryType, Mutation: mutationType}
+}
+
+// resolveUserPosts returns a page of the PostConnection of a user,
+// following the Relay cursor connections specification
+func resolveUserPosts(p graphql.ResolveParams, st store.Store) (interface{}, error) {
+	user := p.Source.(*models.User)
+
+	first, _ := p.Args["first"].(int)
+	if first < 0 || first > maxPostsPerPage {
+		return nil, graphql.NewError("first must be between 0 and %d", maxPostsPerPage)
+	}
+
+	// one more post than requested is fetched to know if there is a next page
+	pagInfo := models.PostPaginationInfo{NumberOfNewPosts: int64(first) + 1, FirstRequest: true}
+	if after, ok := p.Args["after"].(string); ok {
+		postedOn, postID, err := decodePostCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		pagInfo.LastPostedOn, pagInfo.LastPostID, pagInfo.FirstRequest = postedOn, postID, false
+	}
+
+	var posts []models.Post
+	if first > 0 {
+		var err error
+		if posts, err = st.ListUserPosts(p.Context, loadersFromContext(p.Context).viewer, user.UserID, pagInfo); err != nil {
+			return nil, err
+		}
+	}
+
+	hasNextPage := len(posts) > first
+	if hasNextPage {
+		posts = posts[:first]
+	}
+
+	edges := make([]interface{}, len(posts))
+	for i := range posts {
+		edges[i] = map[string]interface{}{"cursor": encodePostCursor(&posts[i]), "node": &posts[i]}
+	}
+
+	pageInfo := map[string]interface{}{"hasNextPage": hasNextPage, "hasPreviousPage": false}
+	if len(posts) > 0 {
+		pageInfo["startCursor"] = encodePostCursor(&posts[0])
+		pageInfo["endCursor"] = encodePostCursor(&posts[len(posts)-1])
+	}
+
+	return map[string]interface{}{"edges": edges, "pageInfo": pageInfo}, nil
+}
+
+// POST /graphql
+// The body is a GraphQL request ({"query": ..., "operationName": ..., "variables": ...}).
+// The response is always JSON. Its status is 400 if the query could not be
+// executed at all (for example, if it is invalid), and 200 otherwise, in which
+// case errors of single fields are reported in the "errors" list of the body.
+func (senv *ServerEnv) HandleGraphQL(writer http.ResponseWriter, req *http.Request) {
+	var gqlReq graphql.Request
+
+	if err := utils.DecodeBody(writer, req, &gqlReq); err != nil {
+		utils.WriteBodyError(writer, req, err)
+		return
+	}
+
+	if gqlReq.Query == "" {
+		utils.WriteError(writer, req, "Request body must contain a query", http.StatusBadRequest)
+		return
+	}
+
+	viewer, ok := senv.viewer(writer, req)
+	if !ok {
+		return
+	}
+	st := senv.store()
+	ctx := context.WithValue(req.Context(), graphQLLoadersKey{}, newGraphQLLoaders(st, viewer))
+
+	res := graphql.Execute(ctx, newGraphQLSchema(senv), gqlReq, senv.GraphQLLimits)
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not encode graphql response", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	utils.AddCommonHeaders(&writer)
+	if !res.Executed {
+		writer.WriteHeader(http.StatusBadRequest)
+	}
+	writer.Write(body)
+}
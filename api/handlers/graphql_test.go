@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/moderation"
+	"appyinsta/api/ratelimit"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// graphQL runs a GraphQL request, as a user if userID is not nil
+func graphQL(t *testing.T, senv *ServerEnv, userID *primitive.ObjectID, query string, variables map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	if userID != nil {
+		req = asUser(req, *userID)
+	}
+	w := httptest.NewRecorder()
+	senv.HandleGraphQL(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: expected %v but received %v: %s", http.StatusOK, w.Code, w.Body)
+	}
+	return w
+}
+
+func TestGraphQLCreatePost(t *testing.T) {
+	senv := newTestEnv(t)
+	mutation := `mutation($postedBy: ID) { createPost(postedBy: $postedBy, caption: "hello", imgUrl: "img") { id } }`
+
+	for _, c := range []struct {
+		userID   *primitive.ObjectID
+		postedBy interface{}
+		ok       bool
+	}{
+		{nil, fixtureUserID.Hex(), false},
+		{&adaID, fixtureUserID.Hex(), false},
+		{&fixtureUserID, fixtureUserID.Hex(), true},
+		{&fixtureUserID, nil, true},
+	} {
+		var resp struct {
+			Data   *struct{ CreatePost struct{ ID string } }
+			Errors []interface{}
+		}
+		w := graphQL(t, senv, c.userID, mutation, map[string]interface{}{"postedBy": c.postedBy})
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if ok := len(resp.Errors) == 0; ok != c.ok {
+			t.Errorf("createPost as %v for %v: got %s", c.userID, c.postedBy, w.Body)
+			continue
+		}
+		if !c.ok {
+			continue
+		}
+		postID, _ := primitive.ObjectIDFromHex(resp.Data.CreatePost.ID)
+		if post, err := senv.store().GetPost(context.Background(), postID); err != nil || post.PostedByUID != fixtureUserID {
+			t.Errorf("created post %+v, %v", post, err)
+		}
+	}
+}
+
+func TestGraphQLCreateUserLimit(t *testing.T) {
+	senv := newTestEnv(t)
+	senv.RateLimits, senv.SignupLimit = ratelimit.NewMemoryStore(), ratelimit.Limit{Rate: 0.01, Burst: 1}
+
+	var errs []int
+	for i := 0; i < 2; i++ {
+		var resp struct{ Errors []interface{} }
+		w := graphQL(t, senv, nil, `mutation { createUser(name: "Tia", email: "tia@example.com", password: "secret") { id } }`, nil)
+		json.NewDecoder(w.Body).Decode(&resp)
+		errs = append(errs, len(resp.Errors))
+	}
+	if !reflect.DeepEqual(errs, []int{0, 1}) {
+		t.Errorf("errors of createUser under the signup limit %v, expected [0 1]", errs)
+	}
+}
+
+func TestGraphQLCreatePostRejected(t *testing.T) {
+	senv := newTestEnv(t)
+	senv.CaptionFilter = moderation.NewFilter([]string{"scam"}, nil, 0)
+
+	var resp struct {
+		Data   *struct{ CreatePost struct{ ID string } }
+		Errors []struct{ Message string }
+	}
+	w := graphQL(t, senv, &fixtureUserID, `mutation { createPost(caption: "Not a scam", imgUrl: "img") { id } }`, nil)
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != "the caption is not allowed" {
+		t.Errorf("createPost with a rejected caption returned %s", w.Body)
+	}
+}
+
+func TestGraphQLCreatePostTags(t *testing.T) {
+	senv := newTestEnv(t)
+	ctx := context.Background()
+	tia := models.User{Name: "Tia", Username: "tia", Email: "tia@example.com", PwdHash: "hash"}
+	if err := senv.store().CreateUser(ctx, &tia); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp struct {
+		Data struct{ CreatePost struct{ ID string } }
+	}
+	w := graphQL(t, senv, &fixtureUserID, `mutation { createPost(caption: "Sunset with @tia #beach", imgUrl: "img") { id } }`, nil)
+	json.NewDecoder(w.Body).Decode(&resp)
+	postID, _ := primitive.ObjectIDFromHex(resp.Data.CreatePost.ID)
+	post, err := senv.store().GetPost(ctx, postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(post.Tags, []string{"beach"}) || !reflect.DeepEqual(post.Mentions, []primitive.ObjectID{tia.UserID}) {
+		t.Errorf("post created with tags %q and mentions %v", post.Tags, post.Mentions)
+	}
+}
+
+func TestGraphQLEvents(t *testing.T) {
+	senv := newTestEnv(t)
+	ctx := context.Background()
+	before, _ := senv.store().ReadEvents(ctx, 0, 100)
+
+	var resp struct {
+		Data struct {
+			CreateUser struct{ ID string }
+			CreatePost struct{ ID string }
+		}
+	}
+	w := graphQL(t, senv, nil, `mutation { createUser(name: "Tia", email: "tia@example.com", password: "secret") { id } }`, nil)
+	json.NewDecoder(w.Body).Decode(&resp)
+	w = graphQL(t, senv, &fixtureUserID, `mutation { createPost(caption: "hello", imgUrl: "img") { id } }`, nil)
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	// the webhooks, notifications and streams are sent the writes like with REST
+	recorded, _ := senv.store().ReadEvents(ctx, int64(len(before)), 100)
+	var types []string
+	for _, e := range recorded {
+		types = append(types, e.Type)
+	}
+	if want := []string{events.SignedUp, events.Posted}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("recorded events %q, expected %q", types, want)
+	}
+	if recorded[0].Actor.Hex() != resp.Data.CreateUser.ID || recorded[1].Post.Hex() != resp.Data.CreatePost.ID {
+		t.Errorf("recorded events %+v for %+v", recorded, resp.Data)
+	}
+}
+
+func TestGraphQLUserPostsTiedTimes(t *testing.T) {
+	senv := newTestEnv(t)
+	ctx := context.Background()
+
+	user := models.User{Name: "Tia", Email: "tia@example.com", PwdHash: "hash"}
+	if err := senv.store().CreateUser(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	// posts imported or created in the same millisecond have the same time
+	postedOn := time.Date(2021, 10, 9, 12, 0, 0, 0, time.UTC)
+	ids := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		post := models.Post{PostedByUID: user.UserID, Caption: "post", ImgURL: "img", PostedOn: postedOn}
+		if err := senv.store().CreatePost(ctx, &post); err != nil {
+			t.Fatal(err)
+		}
+		ids[post.PostID.Hex()] = true
+	}
+
+	query := `query($id: ID!, $after: String) {
+		user(id: $id) { posts(first: 2, after: $after) { edges { node { id } } pageInfo { hasNextPage endCursor } } }
+	}`
+	var after interface{}
+	for pages := 0; pages < 5; pages++ {
+		var resp struct {
+			Data struct {
+				User struct {
+					Posts struct {
+						Edges []struct {
+							Node struct{ ID string }
+						}
+						PageInfo struct {
+							HasNextPage bool
+							EndCursor   string
+						}
+					}
+				}
+			}
+		}
+		w := graphQL(t, senv, nil, query, map[string]interface{}{"id": user.UserID.Hex(), "after": after})
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		conn := resp.Data.User.Posts
+		for _, edge := range conn.Edges {
+			if !ids[edge.Node.ID] {
+				t.Fatalf("post %s is unknown or repeated", edge.Node.ID)
+			}
+			delete(ids, edge.Node.ID)
+		}
+		if !conn.PageInfo.HasNextPage {
+			break
+		}
+		after = conn.PageInfo.EndCursor
+	}
+	if len(ids) != 0 {
+		t.Errorf("posts %v were not listed", ids)
+	}
+}
@@ -2,20 +2,24 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"appyinsta/api/audit"
+	"appyinsta/api/caption"
+	"appyinsta/api/events"
+	"appyinsta/api/graphql"
+	"appyinsta/api/logging"
 	"appyinsta/api/models"
+	"appyinsta/api/moderation"
+	"appyinsta/api/ratelimit"
+	"appyinsta/api/store"
+	"appyinsta/api/stream"
 	"appyinsta/api/utils"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // All handlers are defined on this struct so that the DB connection
@@ -25,6 +29,75 @@ import (
 
 type ServerEnv struct {
 	DB *mongo.Database
+
+	// All reads and writes go through the store.
+	// If it is not set, a store.MongoStore on DB is used.
+	Store store.Store
+
+	// Limits of the queries accepted by HandleGraphQL
+	GraphQLLimits graphql.Limits
+
+	// The domain events are recorded with the writes of the handlers, and
+	// delivered by Events, which is woken after each write, if it is set
+	Events *events.Dispatcher
+
+	// The new posts and notifications are streamed to the users from Stream, if it is set
+	Stream *stream.Hub
+
+	// The captions of new posts are checked by CaptionFilter, and posts are
+	// hidden when they have ReportThreshold open reports, never if it is 0
+	CaptionFilter   moderation.Filter
+	ReportThreshold int
+
+	// The changes of the users and the posts, and the admin actions, are
+	// appended to the audit log, hash-chained if AuditHashChain is set
+	AuditHashChain bool
+
+	// The users created by the GraphQL createUser mutation take a token of
+	// SignupLimit from the bucket of POST /users in RateLimits, if it is set
+	RateLimits  ratelimit.Store
+	SignupLimit ratelimit.Limit
+}
+
+func (senv *ServerEnv) store() store.Store {
+	if senv.Store != nil {
+		return senv.Store
+	}
+	return store.NewMongoStore(senv.DB)
+}
+
+// record runs a write and records its events, see store.Record
+func (senv *ServerEnv) record(ctx context.Context, write func(ctx context.Context) ([]events.Event, error)) error {
+	err := store.Record(ctx, senv.store(), write)
+	if err == nil {
+		senv.Events.Wake()
+	}
+	return err
+}
+
+// allowSignup takes a token of the signup limit of the client, from the
+// bucket of the route users.create. If the store fails, the user is let
+// through, like with utils.MakeRateLimitHandler.
+func (senv *ServerEnv) allowSignup(ctx context.Context) bool {
+	if senv.RateLimits == nil {
+		return true
+	}
+	res, err := senv.RateLimits.Take(ctx, "users.create:"+utils.ClientIP(ctx), senv.SignupLimit, time.Now())
+	if err != nil {
+		logging.FromContext(ctx).Warn("rate limiter unavailable", "err", err, "route", "users.create")
+		return true
+	}
+	return res.Allowed
+}
+
+// auditLog is the audit log of the store
+func (senv *ServerEnv) auditLog() audit.Log {
+	return audit.Log{Store: senv.store(), Chain: senv.AuditHashChain}
+}
+
+// audit appends an entry to the audit log, see audit.Log.Record
+func (senv *ServerEnv) audit(ctx context.Context, action, collection string, id primitive.ObjectID, before, after interface{}) error {
+	return senv.auditLog().Record(ctx, action, collection, id, before, after)
 }
 
 // Handlers
@@ -33,34 +106,47 @@ type ServerEnv struct {
 func (senv *ServerEnv) HandleUserCreate(writer http.ResponseWriter, req *http.Request) {
 	var user models.User
 
-	if err := json.NewDecoder(req.Body).Decode(&user); err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+	if err := utils.DecodeBody(writer, req, &user); err != nil {
+		utils.WriteBodyError(writer, req, err)
 		return
 	}
 
 	if user.Email == "" || user.PwdHash == "" || user.Name == "" {
-		http.Error(writer, "Bad Request", http.StatusBadRequest)
+		utils.WriteError(writer, req, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// usernames are case-insensitive, like the mentions in captions
+	user.Username = strings.ToLower(user.Username)
+	if user.Username != "" && !caption.IsUsername(user.Username) {
+		utils.WriteError(writer, req, "Bad username", http.StatusBadRequest)
 		return
 	}
 
 	// hash the password of the user
 	user.PwdHash = utils.GetHashed256(user.PwdHash)
+	user.Disabled = false
+	user.Role = ""
 
-	colln := senv.DB.Collection("users")
-	// ensure that the ID field is empty
-	user.UserID = primitive.NilObjectID
-	res, err := colln.InsertOne(context.TODO(), user)
-
-	if err != nil {
-		log.Println(err.Error())
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+	err := senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		if err := senv.store().CreateUser(ctx, &user); err != nil {
+			return nil, err
+		}
+		if err := senv.audit(ctx, "users.create", "users", user.UserID, nil, user); err != nil {
+			return nil, err
+		}
+		return []events.Event{{Type: events.SignedUp, Actor: user.UserID}}, nil
+	})
+	if err == store.ErrDuplicateUsername {
+		utils.WriteError(writer, req, "Username is taken", http.StatusConflict)
+		return
+	} else if err != nil {
+		logging.FromContext(req.Context()).Error("could not insert user", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	user.UserID = res.InsertedID.(primitive.ObjectID)
-
-	utils.AddCommonHeaders(&writer)
-	fmt.Fprintf(writer, "{\"id\": \"%s\"}", user.UserID.Hex())
+	utils.WriteResponse(writer, req, models.InsertedID{ID: user.UserID})
 }
 
 // GET /users/<userID>
@@ -70,73 +156,125 @@ func (senv *ServerEnv) HandleUserGet(writer http.ResponseWriter, req *http.Reque
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 
 	if err != nil {
-		writer.WriteHeader(http.StatusBadRequest)
-		http.Error(writer, "Bad userID", http.StatusBadRequest)
+		utils.WriteError(writer, req, "Bad userID", http.StatusBadRequest)
 		return
 	}
 
-	colln := senv.DB.Collection("users")
+	viewer, ok := senv.viewer(writer, req)
+	if !ok {
+		return
+	}
 
-	var resultUser models.User
-	err = colln.FindOne(context.TODO(), bson.D{{Key: "_id", Value: userObjectID}}).Decode(&resultUser)
+	resultUser, err := senv.store().GetUser(req.Context(), userObjectID)
 
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			utils.AddCommonHeaders(&writer)
-			fmt.Fprintf(writer, "{}")
+	if err != nil || !viewer.CanSeeUser(userObjectID) {
+		// a blocked user is like a user who does not exist
+		if err == store.ErrNotFound || err == nil {
+			utils.WriteResponse(writer, req, struct{}{})
 			return
 		}
-		log.Println(err.Error())
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		logging.FromContext(req.Context()).Error("could not find user", "err", err, "user_id", userID)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
 	resultUser.PwdHash = "" // set this to empty so that it is not marshalled
-	jsonPost, err := json.Marshal(resultUser)
+	utils.WriteResponse(writer, req, resultUser)
+}
 
+// CreatePost creates a post, as HandlePostCreate, the GraphQL createPost
+// mutation and the gRPC API do: the author must not be disabled, and the
+// caption is checked by the caption filter and parsed for hashtags and
+// mentions. The flagged posts are created and reported. It returns
+// store.ErrUserDisabled or moderation.ErrRejected for the posts which are
+// not created.
+func (senv *ServerEnv) CreatePost(ctx context.Context, post *models.Post) error {
+	if err := store.CheckCanPost(ctx, senv.store(), post); err != nil {
+		return err
+	}
+
+	flags, rejected, err := senv.checkCaption(ctx, *post)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
-		return
+		return err
+	}
+	if rejected {
+		return moderation.ErrRejected
+	}
+
+	if err := store.ParseCaption(ctx, senv.store(), post); err != nil {
+		return err
 	}
 
-	utils.AddCommonHeaders(&writer)
-	fmt.Fprintf(writer, string(jsonPost))
+	// set the PostedOn field of the post as per server time
+	post.PostedOn = time.Now().UTC()
+
+	err = senv.record(ctx, func(ctx context.Context) ([]events.Event, error) {
+		if err := senv.store().CreatePost(ctx, post); err != nil {
+			return nil, err
+		}
+		if err := senv.audit(ctx, "posts.create", "posts", post.PostID, nil, *post); err != nil {
+			return nil, err
+		}
+		return events.PostCreated(*post), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the flagged posts are created, and reported for review
+	for _, m := range flags {
+		report := models.Report{Reason: m.Reason}
+		if err := senv.report(ctx, post, &report, m.Rule); err != nil {
+			logging.FromContext(ctx).Error("could not report flagged post", "err", err, "post_id", post.PostID.Hex(), "rule", m.Rule)
+		}
+	}
+	return nil
 }
 
 // POST /posts
 func (senv *ServerEnv) HandlePostCreate(writer http.ResponseWriter, req *http.Request) {
 	var post models.Post
 
-	if err := json.NewDecoder(req.Body).Decode(&post); err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+	if err := utils.DecodeBody(writer, req, &post); err != nil {
+		utils.WriteBodyError(writer, req, err)
 		return
 	}
 
-	if post.Caption == "" || post.ImgURL == "" || post.PostedByUID == primitive.NilObjectID {
-		http.Error(writer, "Bad Request", http.StatusBadRequest)
+	// the post is posted by the authenticated user, posted_by may be left out
+	userID, _ := utils.UserID(req.Context())
+	if post.PostedByUID.IsZero() {
+		post.PostedByUID = userID
+	} else if post.PostedByUID != userID {
+		utils.WriteError(writer, req, "posted_by must be the authenticated user", http.StatusForbidden)
 		return
 	}
 
-	// set the PostedOn field of the post as per server time
-	post.PostedOn = time.Now().UTC()
-
-	colln := senv.DB.Collection("posts")
-	// ensure that the ID field is empty
-	post.PostID = primitive.NilObjectID
-	res, err := colln.InsertOne(context.TODO(), post)
-
-	if err != nil {
-		log.Println(err.Error())
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+	if post.Caption == "" || post.ImgURL == "" || post.PostedByUID == primitive.NilObjectID {
+		utils.WriteError(writer, req, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if !models.IsVisibility(post.Visibility) {
+		utils.WriteError(writer, req, "visibility must be public, followers or only_me", http.StatusBadRequest)
 		return
 	}
 
-	post.PostID = res.InsertedID.(primitive.ObjectID)
+	if err := senv.CreatePost(req.Context(), &post); err == store.ErrUserDisabled {
+		utils.WriteError(writer, req, "User is disabled", http.StatusForbidden)
+		return
+	} else if err == moderation.ErrRejected {
+		utils.WriteError(writer, req, "The caption is not allowed", http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		logging.FromContext(req.Context()).Error("could not insert post", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
-	utils.AddCommonHeaders(&writer)
-	fmt.Fprintf(writer, "{\"id\": \"%s\"}", post.PostID.Hex())
+	utils.WriteResponse(writer, req, models.InsertedID{ID: post.PostID})
 }
 
 // GET /posts/<postID>
+// Posts which the user cannot see are not found, see store.Viewer.
 func (senv *ServerEnv) HandlePostGet(writer http.ResponseWriter, req *http.Request) {
 	if strings.Contains(req.URL.Path, "/users/") {
 		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -148,100 +286,118 @@ func (senv *ServerEnv) HandlePostGet(writer http.ResponseWriter, req *http.Reque
 	postObjectID, err := primitive.ObjectIDFromHex(postID)
 
 	if err != nil {
-		http.Error(writer, "Bad postID", http.StatusBadRequest)
+		utils.WriteError(writer, req, "Bad postID", http.StatusBadRequest)
 		return
 	}
 
-	colln := senv.DB.Collection("posts")
-
-	var post models.Post
-	err = colln.FindOne(context.TODO(), bson.D{{Key: "_id", Value: postObjectID}}).Decode(&post)
+	post, err := senv.store().GetPost(req.Context(), postObjectID)
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			utils.AddCommonHeaders(&writer)
-			fmt.Fprintf(writer, "{}")
+		if err == store.ErrNotFound {
+			utils.WriteResponse(writer, req, struct{}{})
 			return
 		}
-		log.Println(err.Error())
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		logging.FromContext(req.Context()).Error("could not find post", "err", err, "post_id", postID)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
-	jsonPost, err := json.Marshal(post)
+	viewer, ok := senv.viewer(writer, req)
+	if !ok {
+		return
+	}
+	if !viewer.CanSee(post) {
+		utils.WriteResponse(writer, req, struct{}{})
+		return
+	}
+	utils.WriteResponse(writer, req, post)
+}
 
+// DELETE /posts/<postID>
+// Only the author of a post can delete it.
+func (senv *ServerEnv) HandlePostDelete(writer http.ResponseWriter, req *http.Request) {
+	postID, err := primitive.ObjectIDFromHex(strings.TrimPrefix(req.URL.Path, "/posts/"))
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		utils.WriteError(writer, req, "Bad postID", http.StatusBadRequest)
+		return
+	}
+	logger := logging.FromContext(req.Context())
+
+	post, err := senv.store().GetPost(req.Context(), postID)
+	if err == store.ErrNotFound {
+		utils.WriteError(writer, req, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("could not find post", "err", err, "post_id", postID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if userID, _ := utils.UserID(req.Context()); userID != post.PostedByUID {
+		utils.WriteError(writer, req, "Only the author of a post can delete it", http.StatusForbidden)
 		return
 	}
 
-	utils.AddCommonHeaders(&writer)
-	fmt.Fprintf(writer, string(jsonPost))
+	err = senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		if err := senv.store().DeletePost(ctx, postID); err != nil {
+			return nil, err
+		}
+		if err := senv.audit(ctx, "posts.delete", "posts", postID, post, nil); err != nil {
+			return nil, err
+		}
+		return []events.Event{{Type: events.PostDeleted, Actor: post.PostedByUID, Post: postID}}, nil
+	})
+	if err == store.ErrNotFound {
+		utils.WriteError(writer, req, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("could not delete post", "err", err, "post_id", postID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteResponse(writer, req, models.DeletedID{ID: postID})
 }
 
 // GET /posts/users/<userId>
 // This endpoint implements pagination and sends the posts by a user
-// in the order of most recent first.
+// in the order they were posted, by ID for the posts posted at the same time.
 // If in the body, the first_request param is true, then the first n
 // number of sorted posts are returned.
 // For subsequent requests, the first_request field is either not present or is false
 // and the client supplies the last postId and the timestamp that last post it received.
-// We query the database for posts that were posted earlier than this timestamp received.
+// We query the database for the posts that come after this post in that order.
+// Only the posts which the user can see are sent, see store.Viewer.
 
 func (senv *ServerEnv) HandleUserPostsGet(writer http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+
 	urlParts := strings.Split(req.URL.Path[1:], "/")
 	userID := strings.Join(urlParts[2:], "")
 	userObjID, err := primitive.ObjectIDFromHex(userID)
 
 	if err != nil {
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
-		log.Println(err.Error())
+		utils.WriteError(writer, req, "Bad userID", http.StatusBadRequest)
 		return
 	}
 
 	var pagInfo models.PostPaginationInfo
 
-	if err := json.NewDecoder(req.Body).Decode(&pagInfo); err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+	if err := utils.DecodeBody(writer, req, &pagInfo); err != nil {
+		utils.WriteBodyError(writer, req, err)
 		return
 	}
 
-	var filter bson.D
-
-	if pagInfo.FirstRequest {
-		filter = bson.D{
-			{Key: "posted_by", Value: userObjID},
-		}
-	} else {
-		filter = bson.D{
-			{Key: "posted_by", Value: userObjID},
-			{Key: "posted_on", Value: bson.D{{Key: "$gte", Value: pagInfo.LastPostedOn}}},
-
-			// This condition covers an edge case (very unlikely) when two posts have same timestamp:
-			{Key: "_id", Value: bson.D{{Key: "$ne", Value: pagInfo.LastPostID}}},
-		}
-	}
-
-	descendingSort := bson.D{{Key: "posted_by", Value: -1}}
-	descendingOpts := options.Find().SetSort(descendingSort).SetLimit(pagInfo.NumberOfNewPosts)
-
-	colln := senv.DB.Collection("posts")
-	descendingCursor, descendingErr := colln.Find(context.TODO(), filter, descendingOpts)
-
-	var posts []models.Post
-	if descendingErr = descendingCursor.All(context.TODO(), &posts); descendingErr != nil {
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
-		log.Println(err.Error())
+	viewer, ok := senv.viewer(writer, req)
+	if !ok {
 		return
 	}
-
-	postsJSON, err := json.Marshal(posts)
+	posts, err := senv.store().ListUserPosts(req.Context(), viewer, userObjID, pagInfo)
 
 	if err != nil {
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
-		log.Println(err.Error())
+		logger.Error("could not query posts", "err", err, "user_id", userID)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	utils.AddCommonHeaders(&writer)
-	fmt.Fprintf(writer, string(postsJSON))
+	utils.WriteResponse(writer, req, posts)
 }
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"appyinsta/api/audit"
+	"appyinsta/api/events"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/moderation"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// checkCaption runs the caption filter on a new post, and reports whether
+// it is rejected. The rejections are recorded in the moderation log.
+func (senv *ServerEnv) checkCaption(ctx context.Context, post models.Post) ([]moderation.Match, bool, error) {
+	matches, rejected := senv.CaptionFilter.Check(post.Caption)
+	if !rejected {
+		return matches, false, nil
+	}
+	for _, m := range matches {
+		if m.Action != moderation.Reject {
+			continue
+		}
+		author := post.PostedByUID
+		action := models.ModerationAction{Action: models.ModerationReject, UserID: &author, Rule: m.Rule, Reason: m.Reason, CreatedOn: time.Now().UTC()}
+		if err := senv.store().AddModerationAction(ctx, &action); err != nil {
+			return nil, true, err
+		}
+	}
+	return nil, true, nil
+}
+
+// report files a report of a post, by a user or by the rule of the caption
+// filter, and hides the post when it has ReportThreshold open reports
+func (senv *ServerEnv) report(ctx context.Context, post *models.Post, report *models.Report, rule string) error {
+	report.PostID = post.PostID
+	report.Status = models.ReportOpen
+	report.CreatedOn = time.Now().UTC()
+	report.ClosedOn = nil
+	if err := senv.store().CreateReport(ctx, report); err != nil {
+		return err
+	}
+
+	postID, reportID := post.PostID, report.ID
+	action := models.ModerationAction{Action: models.ModerationReport, PostID: &postID, ReportID: &reportID, UserID: report.ReporterID, Reason: report.Reason, CreatedOn: report.CreatedOn}
+	if rule != "" {
+		action.Action, action.Rule = models.ModerationFlag, rule
+	}
+	if err := senv.store().AddModerationAction(ctx, &action); err != nil {
+		return err
+	}
+
+	if senv.ReportThreshold <= 0 || post.Hidden {
+		return nil
+	}
+	open, err := senv.store().CountReports(ctx, post.PostID, models.ReportOpen)
+	if err != nil || open < int64(senv.ReportThreshold) {
+		return err
+	}
+	// the post is hidden by the report of a user, or by the flag of a new post
+	route := "posts.report"
+	if rule != "" {
+		route = "posts.create"
+	}
+	if err := senv.setPostHidden(ctx, route, post.PostID, true); err != nil {
+		return err
+	}
+	post.Hidden = true
+	hide := models.ModerationAction{Action: models.ModerationHide, PostID: &postID, CreatedOn: time.Now().UTC()}
+	return senv.store().AddModerationAction(ctx, &hide)
+}
+
+// setPostHidden hides a post or shows it again, and records the change in
+// the audit log as a part of an action
+func (senv *ServerEnv) setPostHidden(ctx context.Context, action string, postID primitive.ObjectID, hidden bool) error {
+	return senv.record(ctx, func(ctx context.Context) ([]events.Event, error) {
+		return nil, senv.writePostHidden(ctx, action, postID, hidden)
+	})
+}
+
+// writePostHidden is setPostHidden within a transaction of the caller
+func (senv *ServerEnv) writePostHidden(ctx context.Context, action string, postID primitive.ObjectID, hidden bool) error {
+	post, err := senv.store().GetPost(ctx, postID)
+	if err != nil || post.Hidden == hidden {
+		return err
+	}
+	if err := senv.store().SetPostHidden(ctx, postID, hidden); err != nil {
+		return err
+	}
+	updated := post
+	updated.Hidden = hidden
+	return senv.audit(ctx, action, "posts", postID, post, updated)
+}
+
+// POST /posts/<postID>/report
+// Users report the posts they see, other than theirs, once each.
+func (senv *ServerEnv) HandleReport(writer http.ResponseWriter, req *http.Request) {
+	postID, err := primitive.ObjectIDFromHex(strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/posts/"), "/report"))
+	if err != nil {
+		utils.WriteError(writer, req, "Bad postID", http.StatusBadRequest)
+		return
+	}
+	var report models.Report
+	if err := utils.DecodeBody(writer, req, &report); err != nil {
+		utils.WriteBodyError(writer, req, err)
+		return
+	}
+	if !models.IsReportReason(report.Reason) {
+		utils.WriteError(writer, req, "reason must be one of "+strings.Join(models.ReportReasons, ", "), http.StatusBadRequest)
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+	logger := logging.FromContext(req.Context())
+
+	post, err := senv.store().GetPost(req.Context(), postID)
+	if err != nil && err != store.ErrNotFound {
+		logger.Error("could not find post", "err", err, "post_id", postID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	viewer, ok := senv.viewer(writer, req)
+	if !ok {
+		return
+	}
+	if err == store.ErrNotFound || !viewer.CanSee(post) {
+		utils.WriteError(writer, req, "Post not found", http.StatusNotFound)
+		return
+	}
+	if post.PostedByUID == userID {
+		utils.WriteError(writer, req, "Users cannot report their own posts", http.StatusBadRequest)
+		return
+	}
+
+	report.ReporterID = &userID
+	if err := senv.report(req.Context(), &post, &report, ""); err == store.ErrDuplicateReport {
+		utils.WriteError(writer, req, "You already reported this post", http.StatusConflict)
+		return
+	} else if err != nil {
+		logger.Error("could not report post", "err", err, "post_id", postID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, report)
+}
+
+// GET /admin/reports?status=<open|resolved|dismissed>&limit=<n>
+func (senv *ServerEnv) HandleReportList(writer http.ResponseWriter, req *http.Request) {
+	status := req.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.ReportOpen
+	case models.ReportOpen, models.ReportResolved, models.ReportDismissed:
+	default:
+		utils.WriteError(writer, req, "status must be open, resolved or dismissed", http.StatusBadRequest)
+		return
+	}
+	limit, ok := pageLimit(writer, req, DefaultPageLimit, MaxPageLimit)
+	if !ok {
+		return
+	}
+
+	list, err := senv.store().ListReports(req.Context(), status, limit)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not list reports", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []models.Report{}
+	}
+	utils.WriteResponse(writer, req, models.ReportList{Reports: list})
+}
+
+// POST /admin/reports/<reportID>/resolve
+// The post is hidden, and all its open reports are resolved.
+func (senv *ServerEnv) HandleReportResolve(writer http.ResponseWriter, req *http.Request) {
+	senv.closeReport(writer, req, "/resolve", models.ReportResolved, models.ModerationResolve, true)
+}
+
+// POST /admin/reports/<reportID>/dismiss
+// The post is shown again, and all its open reports are dismissed.
+func (senv *ServerEnv) HandleReportDismiss(writer http.ResponseWriter, req *http.Request) {
+	senv.closeReport(writer, req, "/dismiss", models.ReportDismissed, models.ModerationDismiss, false)
+}
+
+// closeReport closes the open reports of the post of a report with a
+// status, and hides or shows the post
+func (senv *ServerEnv) closeReport(writer http.ResponseWriter, req *http.Request, suffix, status, action string, hidden bool) {
+	id, err := primitive.ObjectIDFromHex(strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/admin/reports/"), suffix))
+	if err != nil {
+		utils.WriteError(writer, req, "Bad report ID", http.StatusBadRequest)
+		return
+	}
+	logger := logging.FromContext(req.Context())
+	// like admin.reports.resolve, the name of the route
+	name := "admin.reports." + strings.TrimPrefix(suffix, "/")
+
+	report, err := senv.store().GetReport(req.Context(), id)
+	if err == nil && report.Status != models.ReportOpen {
+		err = store.ErrNotFound
+	}
+	if err == store.ErrNotFound {
+		utils.WriteError(writer, req, "There is no open report with this ID", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("could not find report", "err", err, "report_id", id.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// the reports are closed, the post hidden or shown and the action logged
+	// all together, by the moderator or the admin token
+	actor, moderator := audit.Actor(req.Context())
+	closed := report
+	err = senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		now := time.Now().UTC()
+		if _, err := senv.store().CloseReports(ctx, report.PostID, status, now); err != nil {
+			return nil, err
+		}
+		// the post may have been deleted since it was reported
+		if err := senv.writePostHidden(ctx, name, report.PostID, hidden); err != nil && err != store.ErrNotFound {
+			return nil, err
+		}
+		entry := models.ModerationAction{Action: action, PostID: &report.PostID, ReportID: &report.ID, UserID: moderator, Actor: actor, CreatedOn: now}
+		if err := senv.store().AddModerationAction(ctx, &entry); err != nil {
+			return nil, err
+		}
+		var err error
+		if closed, err = senv.store().GetReport(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, senv.audit(ctx, name, "reports", id, report, closed)
+	})
+	if err != nil {
+		logger.Error("could not close reports", "err", err, "report_id", id.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, closed)
+}
+
+// GET /admin/moderation-log?post_id=<postID>&limit=<n>
+func (senv *ServerEnv) HandleModerationLog(writer http.ResponseWriter, req *http.Request) {
+	var postID *primitive.ObjectID
+	if hex := req.URL.Query().Get("post_id"); hex != "" {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			utils.WriteError(writer, req, "Bad post_id", http.StatusBadRequest)
+			return
+		}
+		postID = &id
+	}
+	limit, ok := pageLimit(writer, req, DefaultPageLimit, MaxPageLimit)
+	if !ok {
+		return
+	}
+
+	list, err := senv.store().ListModerationActions(req.Context(), postID, limit)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not list moderation actions", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []models.ModerationAction{}
+	}
+	utils.WriteResponse(writer, req, models.ModerationLog{Actions: list})
+}
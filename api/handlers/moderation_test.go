@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"appyinsta/api/models"
+	"appyinsta/api/moderation"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestModeration(t *testing.T) {
+	senv := newTestEnv(t)
+	senv.ReportThreshold = 2
+	senv.CaptionFilter = moderation.NewFilter([]string{"scam"}, []string{"casino"}, 0)
+	ctx := context.Background()
+
+	body, _ := json.Marshal(models.Post{PostedByUID: fixtureUserID, Caption: "Not a scam", ImgURL: "img"})
+	w := httptest.NewRecorder()
+	senv.HandlePostCreate(w, asUser(httptest.NewRequest("POST", "/posts", bytes.NewReader(body)), fixtureUserID))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("creating a rejected post returned %v", w.Code)
+	}
+
+	post := createPost(t, senv, "Sunset #beach")
+	report := func(userID primitive.ObjectID, reason string) (int, models.Report) {
+		w := httptest.NewRecorder()
+		senv.HandleReport(w, asUser(httptest.NewRequest("POST", "/posts/"+post.Hex()+"/report", strings.NewReader(`{"reason": "`+reason+`"}`)), userID))
+		var r models.Report
+		json.NewDecoder(w.Body).Decode(&r)
+		return w.Code, r
+	}
+	getPost := func(userID primitive.ObjectID) models.Post {
+		w := httptest.NewRecorder()
+		senv.HandlePostGet(w, asUser(httptest.NewRequest("GET", "/posts/"+post.Hex(), nil), userID))
+		var p models.Post
+		json.NewDecoder(w.Body).Decode(&p)
+		return p
+	}
+
+	other := models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "hash"}
+	senv.store().CreateUser(ctx, &other)
+	if status, _ := report(fixtureUserID, models.ReportSpam); status != http.StatusBadRequest {
+		t.Errorf("reporting your own post returned %v", status)
+	}
+	if status, _ := report(adaID, "rude"); status != http.StatusBadRequest {
+		t.Errorf("reporting with an unknown reason returned %v", status)
+	}
+	status, first := report(adaID, models.ReportSpam)
+	if status != http.StatusOK || first.Status != models.ReportOpen || first.ReporterID == nil || *first.ReporterID != adaID {
+		t.Fatalf("reporting a post returned %v, %+v", status, first)
+	}
+	if status, _ := report(adaID, models.ReportHate); status != http.StatusConflict {
+		t.Errorf("reporting a post twice returned %v", status)
+	}
+	if p := getPost(adaID); p.PostID != post {
+		t.Errorf("a post was hidden below the threshold")
+	}
+	report(other.UserID, models.ReportHate)
+	if p := getPost(adaID); !p.PostID.IsZero() {
+		t.Errorf("a post reported twice is not hidden: %+v", p)
+	}
+	if p := getPost(fixtureUserID); p.PostID != post || !p.Hidden {
+		t.Errorf("the author got their hidden post as %+v", p)
+	}
+
+	admin := func(method, path string, handler http.HandlerFunc, out interface{}) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		utils.MakeAdminHandler("token", handler)(w, req)
+		json.NewDecoder(w.Body).Decode(out)
+		return w.Code
+	}
+	var queue models.ReportList
+	if admin("GET", "/admin/reports", senv.HandleReportList, &queue); len(queue.Reports) != 2 || queue.Reports[0].ID != first.ID {
+		t.Fatalf("moderation queue %+v", queue)
+	}
+	var dismissed models.Report
+	if status := admin("POST", "/admin/reports/"+first.ID.Hex()+"/dismiss", senv.HandleReportDismiss, &dismissed); status != http.StatusOK || dismissed.Status != models.ReportDismissed {
+		t.Errorf("dismissing a report returned %v, %+v", status, dismissed)
+	}
+	if p := getPost(adaID); p.PostID != post {
+		t.Errorf("a post is still hidden after its reports were dismissed")
+	}
+	if status := admin("POST", "/admin/reports/"+first.ID.Hex()+"/resolve", senv.HandleReportResolve, &models.Report{}); status != http.StatusNotFound {
+		t.Errorf("resolving a dismissed report returned %v", status)
+	}
+
+	// a flagged post is reported by the filter, and a resolved report hides it
+	flagged := createPost(t, senv, "Casino night")
+	queue = models.ReportList{}
+	if admin("GET", "/admin/reports", senv.HandleReportList, &queue); len(queue.Reports) != 1 || queue.Reports[0].PostID != flagged || queue.Reports[0].ReporterID != nil {
+		t.Fatalf("moderation queue with a flagged post %+v", queue)
+	}
+	// by a moderator this time
+	w = httptest.NewRecorder()
+	senv.HandleReportResolve(w, asUser(httptest.NewRequest("POST", "/admin/reports/"+queue.Reports[0].ID.Hex()+"/resolve", nil), adaID))
+	if w.Code != http.StatusOK {
+		t.Errorf("resolving a report as a moderator returned %v", w.Code)
+	}
+	if p, _ := senv.store().GetPost(ctx, flagged); !p.Hidden {
+		t.Errorf("a post is not hidden after its report was resolved")
+	}
+
+	var log models.ModerationLog
+	admin("GET", "/admin/moderation-log?post_id="+post.Hex(), senv.HandleModerationLog, &log)
+	var actions []string
+	for _, a := range log.Actions {
+		actions = append(actions, a.Action)
+	}
+	if want := []string{"dismiss", "hide", "report", "report"}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("moderation log of the post %q, expected %q", actions, want)
+	} else if dismiss := log.Actions[0]; dismiss.Actor != models.ActorAdmin || dismiss.UserID != nil {
+		t.Errorf("a report dismissed with the admin token is logged as %+v", dismiss)
+	}
+	log = models.ModerationLog{}
+	if admin("GET", "/admin/moderation-log?limit=3", senv.HandleModerationLog, &log); len(log.Actions) != 3 || log.Actions[0].Action != "resolve" || log.Actions[1].Action != "flag" {
+		t.Errorf("moderation log %+v", log)
+	} else if resolve := log.Actions[0]; resolve.Actor != models.ActorUser || resolve.UserID == nil || *resolve.UserID != adaID {
+		t.Errorf("a report resolved by a moderator is logged as %+v", resolve)
+	}
+}
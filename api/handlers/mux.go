@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// NewMux registers routes on a new mux. wrap returns the handler of a route
+// with its middleware, or nil to leave the route out.
+//
+// Routes can share a pattern, like the routes under /users/. A request then
+// goes to the route with its method and a path matching the path of its Spec,
+// or else to a route with a matching path, or else to the first route of the
+// pattern, which rejects it.
+func NewMux(routes []Route, wrap func(Route) http.HandlerFunc) *http.ServeMux {
+	type entry struct {
+		route   Route
+		handler http.HandlerFunc
+	}
+	var patterns []string
+	byPattern := map[string][]entry{}
+	for _, route := range routes {
+		handler := wrap(route)
+		if handler == nil {
+			continue
+		}
+		if _, ok := byPattern[route.Pattern]; !ok {
+			patterns = append(patterns, route.Pattern)
+		}
+		byPattern[route.Pattern] = append(byPattern[route.Pattern], entry{route, handler})
+	}
+
+	mux := http.NewServeMux()
+	for _, pattern := range patterns {
+		entries := byPattern[pattern]
+		if len(entries) == 1 {
+			mux.HandleFunc(pattern, entries[0].handler)
+			continue
+		}
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, req *http.Request) {
+			handler := entries[0].handler
+			pathMatched := false
+			for _, e := range entries {
+				if !pathMatches(e.route.Spec.Path, req.URL.Path) {
+					continue
+				}
+				if e.route.Method == req.Method {
+					e.handler(w, req)
+					return
+				}
+				if !pathMatched {
+					handler, pathMatched = e.handler, true
+				}
+			}
+			handler(w, req)
+		})
+	}
+	return mux
+}
+
+// pathMatches reports whether a path matches a path template like
+// /users/{id}/follow, where a parameter matches one non-empty segment
+func pathMatches(template, path string) bool {
+	want := strings.Split(template, "/")
+	got := strings.Split(path, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if strings.HasPrefix(want[i], "{") && strings.HasSuffix(want[i], "}") {
+			if got[i] == "" {
+				return false
+			}
+		} else if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"appyinsta/api/openapi"
+)
+
+func TestNewMux(t *testing.T) {
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) { w.Write([]byte(name)) }
+	}
+	routes := []Route{
+		{Name: "get", Method: "GET", Pattern: "/users/", Spec: openapi.Operation{Path: "/users/{id}"}},
+		{Name: "follow", Method: "POST", Pattern: "/users/", Spec: openapi.Operation{Path: "/users/{id}/follow"}},
+		{Name: "unfollow", Method: "DELETE", Pattern: "/users/", Spec: openapi.Operation{Path: "/users/{id}/follow"}},
+		{Name: "skipped", Method: "GET", Pattern: "/skipped"},
+	}
+	mux := NewMux(routes, func(route Route) http.HandlerFunc {
+		if route.Name == "skipped" {
+			return nil
+		}
+		return handler(route.Name)
+	})
+
+	cases := []struct {
+		method, path, want string
+	}{
+		{"GET", "/users/1", "get"},
+		{"POST", "/users/1/follow", "follow"},
+		{"DELETE", "/users/1/follow", "unfollow"},
+		{"GET", "/users/1/follow", "follow"}, // the first route of the path rejects the method
+		{"GET", "/users/1/2/3", "get"},       // the first route of the pattern rejects the path
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if got := w.Body.String(); got != c.want {
+			t.Errorf("%s %s went to %q, expected %q", c.method, c.path, got, c.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/skipped", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("skipped route returned %v", w.Code)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/notifications"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The cursors of the notifications are the update time and the ID of the
+// last notification of a page
+
+func encodeNotificationCursor(n models.Notification) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(n.UpdatedOn.UTC().Format(time.RFC3339Nano) + "/" + n.ID.Hex()))
+}
+
+func decodeNotificationCursor(s string) (*store.NotificationCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	updatedOn, id, _ := strings.Cut(string(b), "/")
+	var cursor store.NotificationCursor
+	if cursor.UpdatedOn, err = time.Parse(time.RFC3339Nano, updatedOn); err != nil {
+		return nil, err
+	}
+	if cursor.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// GET /notifications?limit=<n>&after=<cursor>
+// The notifications of the authenticated user, the most recently updated first.
+func (senv *ServerEnv) HandleNotifications(writer http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	userID, _ := utils.UserID(req.Context())
+
+	limit, ok := pageLimit(writer, req, DefaultPageLimit, MaxPageLimit)
+	if !ok {
+		return
+	}
+	var before *store.NotificationCursor
+	if after := req.URL.Query().Get("after"); after != "" {
+		var err error
+		if before, err = decodeNotificationCursor(after); err != nil {
+			utils.WriteError(writer, req, "Bad cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	list, err := senv.store().ListNotifications(req.Context(), userID, before, limit)
+	if err != nil {
+		logger.Error("could not list notifications", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	unread, err := senv.store().CountUnreadNotifications(req.Context(), userID)
+	if err != nil {
+		logger.Error("could not count notifications", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := notifications.Summarize(req.Context(), senv.store(), list); err != nil {
+		logger.Error("could not find users", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	page := models.NotificationPage{Notifications: list, Unread: unread}
+	if page.Notifications == nil {
+		page.Notifications = []models.Notification{}
+	}
+	if n := len(list); int64(n) == limit {
+		page.Next = encodeNotificationCursor(list[n-1])
+	}
+	utils.WriteResponse(writer, req, page)
+}
+
+// POST /notifications/read
+// Marks notifications of the authenticated user as read, and sends the
+// number of unread notifications left.
+func (senv *ServerEnv) HandleNotificationsRead(writer http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	userID, _ := utils.UserID(req.Context())
+
+	var body models.MarkRead
+	if err := utils.DecodeBody(writer, req, &body); err != nil {
+		utils.WriteBodyError(writer, req, err)
+		return
+	}
+	if body.All == (len(body.IDs) > 0) {
+		utils.WriteError(writer, req, "Either ids or all must be set", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := senv.store().MarkNotificationsRead(req.Context(), userID, body.IDs); err != nil {
+		logger.Error("could not mark notifications", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	unread, err := senv.store().CountUnreadNotifications(req.Context(), userID)
+	if err != nil {
+		logger.Error("could not count notifications", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, models.UnreadCount{Unread: unread})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/notifications"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var adaID, _ = primitive.ObjectIDFromHex("616156d49ab2934adcee255e")
+
+// subscribe makes the handlers receive the events of senv, which are delivered by dispatch
+func subscribe(senv *ServerEnv, handlers ...events.Handler) {
+	bus := events.NewBus()
+	for _, handler := range handlers {
+		bus.Subscribe(handler)
+	}
+	senv.Events = events.NewDispatcher(senv.store(), bus, "test")
+}
+
+// dispatch delivers the events recorded by the handlers so far
+func dispatch(t *testing.T, senv *ServerEnv) {
+	t.Helper()
+	if _, err := senv.Events.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newNotifyingTestEnv is like newTestEnv, with the notifications subscribed to the events
+func newNotifyingTestEnv(t *testing.T) *ServerEnv {
+	senv := newTestEnv(t)
+	subscribe(senv, (&notifications.Notifier{Store: senv.store()}).Handle)
+	return senv
+}
+
+// asUser returns a request authenticated as a user, like with utils.MakeUserAuthHandler
+func asUser(req *http.Request, userID primitive.ObjectID) *http.Request {
+	return req.WithContext(utils.ContextWithUserID(req.Context(), userID))
+}
+
+func TestAuthenticate(t *testing.T) {
+	senv := newTestEnv(t)
+	cases := []struct {
+		login, password string
+		ok              bool
+	}{
+		{"616156d49ab2934adcee255e", "password", true},
+		{"ADA", "password", true},
+		{"ada", "nope", false},
+		{"6160ff9757a258c6bdc94086", "password", false},
+		{"nobody", "password", false},
+	}
+	for _, c := range cases {
+		id, ok, err := senv.Authenticate(context.Background(), c.login, c.password)
+		if err != nil || ok != c.ok || (ok && id != adaID) {
+			t.Errorf("login %q, password %q: got %v, %v, %v", c.login, c.password, id, ok, err)
+		}
+	}
+
+	senv.store().SetUserDisabled(context.Background(), adaID, true)
+	if _, ok, err := senv.Authenticate(context.Background(), "ada", "password"); ok || err != nil {
+		t.Errorf("a disabled user logged in: %v, %v", ok, err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	senv := newNotifyingTestEnv(t)
+
+	cases := []struct {
+		method, path string
+		status       int
+	}{
+		{"POST", "/users/616156d49ab2934adcee255e/follow", http.StatusOK},
+		{"POST", "/users/616156d49ab2934adcee255e/follow", http.StatusOK}, // not notified again
+		{"POST", "/users/6160fe9757a258c6bdc94056/follow", http.StatusBadRequest},
+		{"POST", "/users/6160ff9757a258c6bdc94086/follow", http.StatusNotFound},
+		{"POST", "/users/nope/follow", http.StatusBadRequest},
+		{"DELETE", "/users/616156d49ab2934adcee255e/follow", http.StatusOK},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		req := asUser(httptest.NewRequest(c.method, c.path, nil), fixtureUserID)
+		if c.method == "POST" {
+			senv.HandleFollow(w, req)
+		} else {
+			senv.HandleUnfollow(w, req)
+		}
+		if w.Code != c.status {
+			t.Errorf("%s %s: expected status %v, received %v: %s", c.method, c.path, c.status, w.Code, w.Body)
+		}
+	}
+
+	dispatch(t, senv)
+	if unread, _ := senv.store().CountUnreadNotifications(context.Background(), adaID); unread != 1 {
+		t.Errorf("ada has %d unread notifications, expected 1", unread)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	senv := newNotifyingTestEnv(t)
+	ctx := context.Background()
+
+	// Souris follows Ada and mentions her twice
+	senv.HandleFollow(httptest.NewRecorder(), asUser(httptest.NewRequest("POST", "/users/616156d49ab2934adcee255e/follow", nil), fixtureUserID))
+	createPost(t, senv, "Hello @ada")
+	createPost(t, senv, "Bye @ada")
+	other := models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "hash"}
+	senv.store().CreateUser(ctx, &other)
+	senv.HandleFollow(httptest.NewRecorder(), asUser(httptest.NewRequest("POST", "/users/616156d49ab2934adcee255e/follow", nil), other.UserID))
+	dispatch(t, senv)
+
+	get := func(query string) models.NotificationPage {
+		w := httptest.NewRecorder()
+		senv.HandleNotifications(w, asUser(httptest.NewRequest("GET", "/notifications"+query, nil), adaID))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Handler returned wrong status code: expected %v but received %v: %s", http.StatusOK, w.Code, w.Body)
+		}
+		var page models.NotificationPage
+		json.NewDecoder(w.Result().Body).Decode(&page)
+		return page
+	}
+
+	page := get("?limit=2")
+	if page.Unread != 3 || len(page.Notifications) != 2 || page.Next == "" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	if got := page.Notifications[0].Summary; got != "Ann and 1 other started following you" {
+		t.Errorf("summary of the follows is %q", got)
+	}
+	if got := page.Notifications[1].Summary; got != "Souris Ash mentioned you in a post" {
+		t.Errorf("summary of the last mention is %q", got)
+	}
+	last := get("?limit=2&after=" + page.Next)
+	if len(last.Notifications) != 1 || last.Next != "" || last.Notifications[0].Type != events.Mentioned {
+		t.Errorf("unexpected last page %+v", last)
+	}
+
+	read := func(body string) (int, models.UnreadCount) {
+		w := httptest.NewRecorder()
+		senv.HandleNotificationsRead(w, asUser(httptest.NewRequest("POST", "/notifications/read", bytes.NewBufferString(body)), adaID))
+		var count models.UnreadCount
+		json.NewDecoder(w.Result().Body).Decode(&count)
+		return w.Code, count
+	}
+	if status, count := read(`{"ids":["` + page.Notifications[0].ID.Hex() + `"]}`); status != http.StatusOK || count.Unread != 2 {
+		t.Errorf("marking one notification returned %v, %+v", status, count)
+	}
+	if status, _ := read(`{}`); status != http.StatusBadRequest {
+		t.Errorf("marking nothing returned %v", status)
+	}
+	if status, count := read(`{"all":true}`); status != http.StatusOK || count.Unread != 0 {
+		t.Errorf("marking all the notifications returned %v, %+v", status, count)
+	}
+}
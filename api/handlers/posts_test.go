@@ -2,26 +2,20 @@ package handlers
 
 import (
 	"bytes"
-	"context"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"appyinsta/api/fixtures"
 )
 
 func TestGetPost(t *testing.T) {
 	req := httptest.NewRequest("GET", "/posts/6161578d7ca34c010e0f21d8", nil)
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
 	senv.HandlePostGet(w, req)
 
@@ -36,24 +30,14 @@ func TestGetPost(t *testing.T) {
 		t.Errorf(err.Error())
 	}
 
-	expectedBody := `{"id":"6161578d7ca34c010e0f21d8","posted_by":"616156d49ab2934adcee255e","caption":"Another caption","img_url":"some.url.here","posted_on":"2021-10-09T08:49:17.482Z"}`
-
-	if string(body) != expectedBody {
-		t.Errorf("Unexpected body returned. Expected %s and got %s", expectedBody, string(body))
-	}
+	fixtures.GoldenJSON(t, "testdata/get_post.json", body)
 }
 
 func TestGetPostBadID(t *testing.T) {
 	req := httptest.NewRequest("GET", "/posts/616157e0f21d8", nil)
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
 	senv.HandlePostGet(w, req)
 
@@ -64,7 +48,7 @@ func TestGetPostBadID(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: expected %v but received %v.", http.StatusOK, resp.StatusCode)
 	}
 
-	expectedBody := "Bad postID"
+	expectedBody := `{"error":"Bad postID"}`
 
 	if strings.TrimRight(string(body), "\n") != expectedBody {
 		t.Errorf("Unexpected body returned. Expected %s and got %s", expectedBody, strings.TrimRight(string(body), "\n"))
@@ -75,13 +59,7 @@ func TestGetNonExistentPostID(t *testing.T) {
 	req := httptest.NewRequest("GET", "/posts/6160578d7ca34c010e0f21d8", nil)
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
 	senv.HandlePostGet(w, req)
 
@@ -110,15 +88,9 @@ func TestCreatePost(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
-	senv.HandlePostCreate(w, req)
+	senv.HandlePostCreate(w, asUser(req, adaID))
 
 	resp := w.Result()
 	body, _ := ioutil.ReadAll(resp.Body)
@@ -143,15 +115,9 @@ func TestCreatePostEmptyFields(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
-	senv.HandlePostCreate(w, req)
+	senv.HandlePostCreate(w, asUser(req, adaID))
 
 	resp := w.Result()
 	body, _ := ioutil.ReadAll(resp.Body)
@@ -160,7 +126,23 @@ func TestCreatePostEmptyFields(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: expected %v but received %v.", http.StatusOK, resp.StatusCode)
 	}
 
-	if strings.TrimRight(string(body), "\n") != "Bad Request" {
+	if string(body) != `{"error":"Bad Request"}` {
 		t.Errorf("Expected Bad Request in body. Body received: %s", string(body))
 	}
 }
+
+func TestCreatePostForOtherUser(t *testing.T) {
+	jsonStr := []byte(`{"posted_by":"616156d49ab2934adcee255e","caption":"Caption 14","img_url":"sample.url.here"}`)
+
+	req := httptest.NewRequest("POST", "/posts", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	senv := newTestEnv(t)
+
+	senv.HandlePostCreate(w, asUser(req, fixtureUserID))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: expected %v but received %v.", http.StatusForbidden, w.Code)
+	}
+}
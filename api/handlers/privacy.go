@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"appyinsta/api/events"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+)
+
+// viewer returns the user of a request who reads posts, who is anonymous
+// without credentials, or writes an error
+func (senv *ServerEnv) viewer(writer http.ResponseWriter, req *http.Request) (*store.Viewer, bool) {
+	userID, _ := utils.UserID(req.Context())
+	viewer, err := store.NewViewer(req.Context(), senv.store(), userID)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not list followed users", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return viewer, true
+}
+
+// PUT /privacy
+// Only the followers of a private user see their posts. The requests to
+// follow them which are pending when they become public can still be accepted.
+func (senv *ServerEnv) HandlePrivacy(writer http.ResponseWriter, req *http.Request) {
+	var privacy models.Privacy
+	if err := utils.DecodeBody(writer, req, &privacy); err != nil {
+		utils.WriteBodyError(writer, req, err)
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+
+	err := senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		user, err := senv.store().GetUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := senv.store().SetUserPrivate(ctx, userID, privacy.Private); err != nil {
+			return nil, err
+		}
+		updated := user
+		updated.Private = privacy.Private
+		return nil, senv.audit(ctx, "users.privacy", "users", userID, user, updated)
+	})
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not update user", "err", err, "user_id", userID.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, privacy)
+}
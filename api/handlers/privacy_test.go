@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPrivacy(t *testing.T) {
+	senv := newNotifyingTestEnv(t)
+
+	w := httptest.NewRecorder()
+	senv.HandlePrivacy(w, asUser(httptest.NewRequest("PUT", "/privacy", strings.NewReader(`{"private": true}`)), fixtureUserID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("making Souris private returned %v", w.Code)
+	}
+
+	create := func(caption, visibility string) (int, primitive.ObjectID) {
+		body, _ := json.Marshal(models.Post{PostedByUID: fixtureUserID, Caption: caption, ImgURL: "img", Visibility: visibility})
+		w := httptest.NewRecorder()
+		senv.HandlePostCreate(w, asUser(httptest.NewRequest("POST", "/posts", bytes.NewReader(body)), fixtureUserID))
+		var id models.InsertedID
+		json.NewDecoder(w.Body).Decode(&id)
+		return w.Code, id.ID
+	}
+	if status, _ := create("Windy #beach", "friends"); status != http.StatusBadRequest {
+		t.Errorf("creating a post for friends returned %v", status)
+	}
+	_, sunny := create("Sunny #beach", "")
+	create("Cloudy #beach", models.VisibilityFollowers)
+	create("Rainy #beach", models.VisibilityOnlyMe)
+
+	// the captions of the posts with #beach seen by a user, or anonymously
+	seen := func(userID *primitive.ObjectID) []string {
+		req := httptest.NewRequest("GET", "/tags/beach/posts", nil)
+		if userID != nil {
+			req = asUser(req, *userID)
+		}
+		w := httptest.NewRecorder()
+		senv.HandleTagPosts(w, req)
+		var page models.PostPage
+		json.NewDecoder(w.Body).Decode(&page)
+		captions := []string{}
+		for _, post := range page.Posts {
+			captions = append(captions, post.Caption)
+		}
+		return captions
+	}
+	getSunny := func(userID *primitive.ObjectID) models.Post {
+		req := httptest.NewRequest("GET", "/posts/"+sunny.Hex(), nil)
+		if userID != nil {
+			req = asUser(req, *userID)
+		}
+		w := httptest.NewRecorder()
+		senv.HandlePostGet(w, req)
+		var post models.Post
+		json.NewDecoder(w.Body).Decode(&post)
+		return post
+	}
+	check := func(when string, userID *primitive.ObjectID, want ...string) {
+		t.Helper()
+		if want == nil {
+			want = []string{}
+		}
+		if got := seen(userID); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: saw %q, expected %q", when, got, want)
+		}
+	}
+
+	check("anonymous", nil)
+	check("author", &fixtureUserID, "Rainy #beach", "Cloudy #beach", "Sunny #beach")
+	if post := getSunny(nil); !post.PostID.IsZero() {
+		t.Errorf("an anonymous user got the post of a private user: %+v", post)
+	}
+
+	// following a private user is a request
+	w = httptest.NewRecorder()
+	senv.HandleFollow(w, asUser(httptest.NewRequest("POST", "/users/6160fe9757a258c6bdc94056/follow", nil), adaID))
+	if body := strings.TrimSpace(w.Body.String()); body != `{"following":false,"requested":true}` {
+		t.Errorf("following a private user returned %s", body)
+	}
+	check("requested", &adaID)
+
+	w = httptest.NewRecorder()
+	senv.HandleFollowRequests(w, asUser(httptest.NewRequest("GET", "/follow-requests", nil), fixtureUserID))
+	var requests models.FollowRequests
+	json.NewDecoder(w.Body).Decode(&requests)
+	if len(requests.Users) != 1 || requests.Users[0].UserID != adaID || requests.Users[0].PwdHash != "" {
+		t.Errorf("follow requests %+v", requests)
+	}
+
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		senv.HandleFollowAccept(w, asUser(httptest.NewRequest("POST", "/follow-requests/"+adaID.Hex(), nil), fixtureUserID))
+		if w.Code != status {
+			t.Errorf("accepting the request returned %v, expected %v", w.Code, status)
+		}
+	}
+	check("follower", &adaID, "Cloudy #beach", "Sunny #beach")
+	if post := getSunny(&adaID); post.PostID != sunny {
+		t.Errorf("a follower got %+v", post)
+	}
+
+	dispatch(t, senv)
+	for userID, want := range map[primitive.ObjectID]string{fixtureUserID: "follow_request", adaID: "follow_accept"} {
+		list, _ := senv.store().ListNotifications(context.Background(), userID, nil, 10)
+		if len(list) != 1 || list[0].Type != want {
+			t.Errorf("notifications of %s: %+v", userID.Hex(), list)
+		}
+	}
+
+	// the public posts of a public user are public
+	w = httptest.NewRecorder()
+	senv.HandlePrivacy(w, asUser(httptest.NewRequest("PUT", "/privacy", strings.NewReader(`{"private": false}`)), fixtureUserID))
+	check("public", nil, "Sunny #beach")
+
+	w = httptest.NewRecorder()
+	senv.HandleFollowDecline(w, asUser(httptest.NewRequest("DELETE", "/follow-requests/"+adaID.Hex(), nil), fixtureUserID))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("declining an accepted request returned %v", w.Code)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"appyinsta/api/events"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Authorize is the utils.Authorizer of the admin routes: the role of a user
+// gives them permissions, which disabled users lose
+func (senv *ServerEnv) Authorize(ctx context.Context, userID primitive.ObjectID, permission string) (bool, error) {
+	user, err := senv.store().GetUser(ctx, userID)
+	if err == store.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !user.Disabled && models.HasPermission(user.Role, permission), nil
+}
+
+// PUT /admin/users/<userID>/role
+func (senv *ServerEnv) HandleUserRole(writer http.ResponseWriter, req *http.Request) {
+	id, err := primitive.ObjectIDFromHex(strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/admin/users/"), "/role"))
+	if err != nil {
+		utils.WriteError(writer, req, "Bad userID", http.StatusBadRequest)
+		return
+	}
+	var role models.UserRole
+	if err := utils.DecodeBody(writer, req, &role); err != nil {
+		utils.WriteBodyError(writer, req, err)
+		return
+	}
+	if role.Role == "" || !models.IsRole(role.Role) {
+		utils.WriteError(writer, req, "role must be user, moderator or admin", http.StatusBadRequest)
+		return
+	}
+
+	err = senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		user, err := senv.store().GetUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := senv.store().SetUserRole(ctx, id, role.Role); err != nil {
+			return nil, err
+		}
+		updated := user
+		if updated.Role = role.Role; role.Role == models.RoleUser {
+			updated.Role = ""
+		}
+		return nil, senv.audit(ctx, "admin.users.role", "users", id, user, updated)
+	})
+	if err == store.ErrNotFound {
+		utils.WriteError(writer, req, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.FromContext(req.Context()).Error("could not update user", "err", err, "user_id", id.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(req.Context()).Info("role changed", "user_id", id.Hex(), "role", role.Role)
+	utils.WriteResponse(writer, req, role)
+}
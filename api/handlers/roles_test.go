@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appyinsta/api/models"
+)
+
+func TestUserRole(t *testing.T) {
+	senv := newTestEnv(t)
+	ctx := context.Background()
+
+	setRole := func(id, body string) int {
+		w := httptest.NewRecorder()
+		senv.HandleUserRole(w, httptest.NewRequest("PUT", "/admin/users/"+id+"/role", strings.NewReader(body)))
+		return w.Code
+	}
+	can := func(permission string) bool {
+		ok, err := senv.Authorize(ctx, adaID, permission)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if can(models.PermissionModerate) {
+		t.Error("a user can moderate")
+	}
+	if status := setRole(adaID.Hex(), `{"role": "owner"}`); status != http.StatusBadRequest {
+		t.Errorf("setting an unknown role returned %v", status)
+	}
+	if status := setRole("6160fe9757a258c6bdc94000", `{"role": "admin"}`); status != http.StatusNotFound {
+		t.Errorf("setting the role of an unknown user returned %v", status)
+	}
+
+	if status := setRole(adaID.Hex(), `{"role": "moderator"}`); status != http.StatusOK {
+		t.Fatalf("setting a role returned %v", status)
+	}
+	if !can(models.PermissionModerate) || can(models.PermissionManageRoles) {
+		t.Error("a moderator does not have the permissions of their role")
+	}
+	setRole(adaID.Hex(), `{"role": "admin"}`)
+	if !can(models.PermissionManageRoles) {
+		t.Error("an admin cannot manage roles")
+	}
+	senv.store().SetUserDisabled(ctx, adaID, true)
+	if can(models.PermissionManageRoles) {
+		t.Error("a disabled admin still has permissions")
+	}
+}
@@ -0,0 +1,773 @@
+package handlers
+
+import (
+	"net/http"
+
+	"appyinsta/api/graphql"
+	"appyinsta/api/models"
+	"appyinsta/api/openapi"
+	"appyinsta/api/transfer"
+	"appyinsta/api/utils"
+)
+
+// The route table of the API. main registers the routes on the mux,
+// and the OpenAPI document served at /openapi.json is built from it.
+
+// Rate limit classes of the routes, see config.RateLimits
+const (
+	LimitRead   = "read"
+	LimitWrite  = "write"
+	LimitSignup = "signup"
+)
+
+type Route struct {
+	// the name is used for the rate limit buckets and as the operation ID
+	Name    string
+	Method  string
+	Pattern string // the pattern registered on the mux
+	Limit   string
+	Handler http.HandlerFunc
+	// admin routes need the admin token, see utils.MakeAdminHandler, or a
+	// user with their Permission, see utils.MakeCheckPermissionHandler
+	Admin      bool
+	Permission string
+	// routes with Auth are for a user, with HTTP Basic authentication,
+	// see utils.MakeUserAuthHandler
+	Auth bool
+	// routes with OptionalAuth authenticate the user if the request has
+	// credentials, like the reads of posts which depend on the user, see
+	// utils.MakeOptionalUserAuthHandler
+	OptionalAuth bool
+
+	// the description of the route in the OpenAPI document
+	Spec openapi.Operation
+}
+
+func (senv *ServerEnv) Routes() []Route {
+	return []Route{
+		{
+			Name: "users.create", Method: "POST", Pattern: "/users", Limit: LimitSignup, Handler: senv.HandleUserCreate,
+			Spec: openapi.Operation{
+				Path:                "/users",
+				Summary:             "Create a user",
+				Description:         "The password is hashed at the server. All fields are compulsory.",
+				Tags:                []string{"users"},
+				Request:             models.User{},
+				Response:            models.InsertedID{},
+				ResponseDescription: "The ID of the new user",
+			},
+		},
+		{
+			Name: "users.get", Method: "GET", Pattern: "/users/", Limit: LimitRead, Handler: senv.HandleUserGet, OptionalAuth: true,
+			Spec: openapi.Operation{
+				Path:                "/users/{id}",
+				Summary:             "Retrieve information about a user",
+				Tags:                []string{"users"},
+				Response:            models.User{},
+				ResponseDescription: "The user, or an empty object if there is no user with this ID or if one of the users blocks the other",
+				EmptyIfNotFound:     true,
+				Security:            userSecurity,
+				SecurityOptional:    true,
+				Errors:              optionalUserErrors,
+			},
+		},
+		{
+			Name: "users.follow", Method: "POST", Pattern: "/users/", Limit: LimitWrite, Handler: senv.HandleFollow, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/users/{id}/follow",
+				Summary:             "Follow a user",
+				Description:         "The user is notified, unless they were already followed. Following a private user is a request, until they accept it.",
+				Tags:                []string{"users"},
+				Response:            models.FollowStatus{},
+				ResponseDescription: "Whether the authenticated user follows the user, or asked to",
+				Security:            userSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   followErrors[http.StatusBadRequest],
+					http.StatusUnauthorized: followErrors[http.StatusUnauthorized],
+					http.StatusForbidden:    "One of the users blocks the other",
+					http.StatusNotFound:     followErrors[http.StatusNotFound],
+				},
+			},
+		},
+		{
+			Name: "users.unfollow", Method: "DELETE", Pattern: "/users/", Limit: LimitWrite, Handler: senv.HandleUnfollow, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/users/{id}/follow",
+				Summary:             "Stop following a user",
+				Description:         "This also cancels a request to follow a private user.",
+				Tags:                []string{"users"},
+				Response:            models.FollowStatus{},
+				ResponseDescription: "The authenticated user does not follow the user",
+				Security:            userSecurity,
+				Errors:              followErrors,
+			},
+		},
+		{
+			Name: "users.block", Method: "POST", Pattern: "/users/", Limit: LimitWrite, Handler: senv.HandleBlock, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/users/{id}/block",
+				Summary:             "Block a user",
+				Description:         "Users who block each other do not see the posts and the profile of the other one, and do not follow each other anymore.",
+				Tags:                []string{"users"},
+				Response:            models.BlockStatus{},
+				ResponseDescription: "The authenticated user blocks the user",
+				Security:            userSecurity,
+				Errors:              followErrors,
+			},
+		},
+		{
+			Name: "users.unblock", Method: "DELETE", Pattern: "/users/", Limit: LimitWrite, Handler: senv.HandleUnblock, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/users/{id}/block",
+				Summary:             "Stop blocking a user",
+				Description:         "The follows deleted by the block are not restored.",
+				Tags:                []string{"users"},
+				Response:            models.BlockStatus{},
+				ResponseDescription: "The authenticated user does not block the user",
+				Security:            userSecurity,
+				Errors:              followErrors,
+			},
+		},
+		{
+			Name: "users.mute", Method: "POST", Pattern: "/users/", Limit: LimitWrite, Handler: senv.HandleMute, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/users/{id}/mute",
+				Summary:             "Mute a user",
+				Description:         "The new posts of a muted user are not streamed to the authenticated user, who is not notified of what they do either.",
+				Tags:                []string{"users"},
+				Response:            models.MuteStatus{},
+				ResponseDescription: "The authenticated user mutes the user",
+				Security:            userSecurity,
+				Errors:              followErrors,
+			},
+		},
+		{
+			Name: "users.unmute", Method: "DELETE", Pattern: "/users/", Limit: LimitWrite, Handler: senv.HandleUnmute, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/users/{id}/mute",
+				Summary:             "Stop muting a user",
+				Tags:                []string{"users"},
+				Response:            models.MuteStatus{},
+				ResponseDescription: "The authenticated user does not mute the user",
+				Security:            userSecurity,
+				Errors:              followErrors,
+			},
+		},
+		{
+			Name: "follows.requests", Method: "GET", Pattern: "/follow-requests", Limit: LimitRead, Handler: senv.HandleFollowRequests, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/follow-requests",
+				Summary:             "List the requests to follow the authenticated user",
+				Description:         "Following a private user is a request, until they accept it.",
+				Tags:                []string{"users"},
+				Response:            models.FollowRequests{},
+				ResponseDescription: "The users who asked to follow the authenticated user, oldest first",
+				Security:            userSecurity,
+				Errors:              userErrors,
+			},
+		},
+		{
+			Name: "follows.accept", Method: "POST", Pattern: "/follow-requests/", Limit: LimitWrite, Handler: senv.HandleFollowAccept, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/follow-requests/{id}",
+				Summary:             "Accept a request to follow the authenticated user",
+				Description:         "The user is notified.",
+				Tags:                []string{"users"},
+				Response:            models.FollowStatus{},
+				ResponseDescription: "The user follows the authenticated user",
+				Security:            userSecurity,
+				Errors:              followRequestErrors,
+			},
+		},
+		{
+			Name: "follows.decline", Method: "DELETE", Pattern: "/follow-requests/", Limit: LimitWrite, Handler: senv.HandleFollowDecline, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/follow-requests/{id}",
+				Summary:             "Decline a request to follow the authenticated user",
+				Tags:                []string{"users"},
+				Response:            models.FollowStatus{},
+				ResponseDescription: "The user does not follow the authenticated user",
+				Security:            userSecurity,
+				Errors:              followRequestErrors,
+			},
+		},
+		{
+			Name: "users.privacy", Method: "PUT", Pattern: "/privacy", Limit: LimitWrite, Handler: senv.HandlePrivacy, Auth: true,
+			Spec: openapi.Operation{
+				Path:    "/privacy",
+				Summary: "Make the authenticated user private or public",
+				Description: "Only the followers of a private user see their posts, and following them needs their approval. " +
+					"Pending requests can still be accepted after they become public.",
+				Tags:                []string{"users"},
+				Request:             models.Privacy{},
+				Response:            models.Privacy{},
+				ResponseDescription: "Whether the user is private",
+				Security:            userSecurity,
+				Errors:              userErrors,
+			},
+		},
+		{
+			Name: "posts.create", Method: "POST", Pattern: "/posts", Limit: LimitWrite, Handler: senv.HandlePostCreate, Auth: true,
+			Spec: openapi.Operation{
+				Path:    "/posts",
+				Summary: "Create a post",
+				Description: "The post is posted by the authenticated user; posted_by may be left out. " +
+					"The time of creation of the post is recorded at the server. The visibility is public by default.",
+				Tags:                []string{"posts"},
+				Request:             models.Post{},
+				Response:            models.InsertedID{},
+				ResponseDescription: "The ID of the new post",
+				Security:            userSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:          "A field is missing, or the visibility is invalid",
+					http.StatusUnauthorized:        userErrors[http.StatusUnauthorized],
+					http.StatusForbidden:           "The user is disabled, or posted_by is not the authenticated user",
+					http.StatusUnprocessableEntity: "The caption is rejected by the caption filter",
+				},
+			},
+		},
+		{
+			Name: "posts.get", Method: "GET", Pattern: "/posts/", Limit: LimitRead, Handler: senv.HandlePostGet, OptionalAuth: true,
+			Spec: openapi.Operation{
+				Path:                "/posts/{id}",
+				Summary:             "Retrieve information about a post",
+				Description:         visibilityDescription,
+				Tags:                []string{"posts"},
+				Response:            models.Post{},
+				ResponseDescription: "The post, or an empty object if there is no post with this ID which the user can see",
+				EmptyIfNotFound:     true,
+				Security:            userSecurity,
+				SecurityOptional:    true,
+				Errors:              optionalUserErrors,
+			},
+		},
+		{
+			Name: "posts.delete", Method: "DELETE", Pattern: "/posts/", Limit: LimitWrite, Handler: senv.HandlePostDelete, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/posts/{id}",
+				Summary:             "Delete a post",
+				Description:         "Only the author of a post can delete it.",
+				Tags:                []string{"posts"},
+				Response:            models.DeletedID{},
+				ResponseDescription: "The ID of the deleted post",
+				Security:            userSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The ID is invalid",
+					http.StatusUnauthorized: userErrors[http.StatusUnauthorized],
+					http.StatusForbidden:    "The authenticated user is not the author of the post",
+					http.StatusNotFound:     "There is no post with this ID",
+				},
+			},
+		},
+		{
+			Name: "posts.report", Method: "POST", Pattern: "/posts/", Limit: LimitWrite, Handler: senv.HandleReport, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/posts/{id}/report",
+				Summary:             "Report a post",
+				Description:         "Users report the posts they see, other than theirs, once each. A post is hidden when it has too many open reports, until a moderator reviews them.",
+				Tags:                []string{"posts", "moderation"},
+				Request:             models.Report{},
+				Response:            models.Report{},
+				ResponseDescription: "The open report",
+				Security:            userSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The ID or the reason is invalid, or the post is the authenticated user's",
+					http.StatusUnauthorized: userErrors[http.StatusUnauthorized],
+					http.StatusNotFound:     "There is no post with this ID which the user can see",
+					http.StatusConflict:     "The authenticated user already reported the post",
+				},
+			},
+		},
+		{
+			Name: "posts.list", Method: "GET", Pattern: "/posts/users/", Limit: LimitRead, Handler: senv.HandleUserPostsGet, OptionalAuth: true,
+			Spec: openapi.Operation{
+				Path:    "/posts/users/{id}",
+				Summary: "Retrieve the posts created by a user",
+				Description: "The posts are paginated using the request body. For the first page, set first_request to true. " +
+					"For the next pages, set last_id and last_posted_on to the id and posted_on of the last post received: " +
+					"the page starts with the post which comes strictly after it. " + visibilityDescription,
+				Tags:                []string{"posts"},
+				Request:             models.PostPaginationInfo{},
+				Response:            []models.Post{},
+				ResponseDescription: "At most n_new posts, oldest first, by ID for the posts posted at the same time",
+				Security:            userSecurity,
+				SecurityOptional:    true,
+				Errors:              optionalUserErrors,
+			},
+		},
+		{
+			Name: "search.posts", Method: "GET", Pattern: "/search/posts", Limit: LimitRead, Handler: senv.HandleSearchPosts, OptionalAuth: true,
+			Spec: openapi.Operation{
+				Path:    "/search/posts",
+				Summary: "Search posts by caption",
+				Description: "Posts match if their caption contains a word of the query, or another form of it (post, posts, posted...). " +
+					"For the next page, send the next cursor of a page in the after parameter. " + visibilityDescription,
+				Tags:                []string{"posts", "search"},
+				Params:              searchParams,
+				Response:            models.PostSearchResults{},
+				ResponseDescription: "The matching posts, the most relevant first, with the matching words of their caption highlighted",
+				Security:            userSecurity,
+				SecurityOptional:    true,
+				Errors: map[int]string{
+					http.StatusBadRequest:   searchErrors[http.StatusBadRequest],
+					http.StatusUnauthorized: optionalUserErrors[http.StatusUnauthorized],
+				},
+			},
+		},
+		{
+			Name: "search.users", Method: "GET", Pattern: "/search/users", Limit: LimitRead, Handler: senv.HandleSearchUsers, OptionalAuth: true,
+			Spec: openapi.Operation{
+				Path:                "/search/users",
+				Summary:             "Search users by name",
+				Description:         "Like the search of posts, for the names of the users. Users do not find the users they block or who block them.",
+				Tags:                []string{"users", "search"},
+				Params:              searchParams,
+				Response:            models.UserSearchResults{},
+				ResponseDescription: "The matching users, the most relevant first, with the matching words of their name highlighted",
+				Security:            userSecurity,
+				SecurityOptional:    true,
+				Errors: map[int]string{
+					http.StatusBadRequest:   searchErrors[http.StatusBadRequest],
+					http.StatusUnauthorized: optionalUserErrors[http.StatusUnauthorized],
+				},
+			},
+		},
+		{
+			Name: "tags.posts", Method: "GET", Pattern: "/tags/", Limit: LimitRead, Handler: senv.HandleTagPosts, OptionalAuth: true,
+			Spec: openapi.Operation{
+				Path:        "/tags/{tag}/posts",
+				Summary:     "Retrieve the posts with a hashtag",
+				Description: "Hashtags are case-insensitive. For the next page, send the next cursor of a page in the after parameter. " + visibilityDescription,
+				Tags:        []string{"posts", "tags"},
+				Params: []openapi.Parameter{
+					{Name: "tag", In: "path", Required: true, Description: "The hashtag, without #", Schema: &openapi.Schema{Type: "string"}},
+					limitParam,
+					afterParam,
+				},
+				Response:            models.PostPage{},
+				ResponseDescription: "The posts with the hashtag, newest first",
+				Security:            userSecurity,
+				SecurityOptional:    true,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The limit or the cursor is invalid",
+					http.StatusUnauthorized: optionalUserErrors[http.StatusUnauthorized],
+				},
+			},
+		},
+		{
+			Name: "tags.trending", Method: "GET", Pattern: "/tags/trending", Limit: LimitRead, Handler: senv.HandleTrendingTags,
+			Spec: openapi.Operation{
+				Path:        "/tags/trending",
+				Summary:     "Retrieve the trending hashtags",
+				Description: "The hashtags are counted in the posts posted during the window before the request which everyone sees.",
+				Tags:        []string{"tags"},
+				Params: []openapi.Parameter{
+					{Name: "window", In: "query", Description: "The duration of the window, like 1h or 30m, 24h by default and at most 720h", Schema: &openapi.Schema{Type: "string"}},
+					{Name: "limit", In: "query", Description: "The maximum number of hashtags, 10 by default and at most 100", Schema: &openapi.Schema{Type: "integer"}},
+				},
+				Response:            models.TrendingTags{},
+				ResponseDescription: "The hashtags of the most posts, with their number of posts",
+				Errors:              map[int]string{http.StatusBadRequest: "The window or the limit is invalid"},
+			},
+		},
+		{
+			Name: "notifications.list", Method: "GET", Pattern: "/notifications", Limit: LimitRead, Handler: senv.HandleNotifications, Auth: true,
+			Spec: openapi.Operation{
+				Path:    "/notifications",
+				Summary: "Retrieve the notifications of the authenticated user",
+				Description: "Users are notified when they are followed or mentioned. Similar unread notifications are grouped, " +
+					"such as all the new followers. For the next page, send the next cursor of a page in the after parameter.",
+				Tags:                []string{"notifications"},
+				Params:              []openapi.Parameter{limitParam, afterParam},
+				Response:            models.NotificationPage{},
+				ResponseDescription: "The notifications, the most recently updated first, and the number of unread notifications",
+				Security:            userSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The limit or the cursor is invalid",
+					http.StatusUnauthorized: userErrors[http.StatusUnauthorized],
+				},
+			},
+		},
+		{
+			Name: "notifications.read", Method: "POST", Pattern: "/notifications/read", Limit: LimitWrite, Handler: senv.HandleNotificationsRead, Auth: true,
+			Spec: openapi.Operation{
+				Path:                "/notifications/read",
+				Summary:             "Mark notifications as read",
+				Description:         "Set ids to the IDs of the notifications to mark, or all to true to mark all of them.",
+				Tags:                []string{"notifications"},
+				Request:             models.MarkRead{},
+				Response:            models.UnreadCount{},
+				ResponseDescription: "The number of unread notifications left",
+				Security:            userSecurity,
+				Errors:              userErrors,
+			},
+		},
+		{
+			Name: "stream", Method: "GET", Pattern: "/stream", Limit: LimitRead, Handler: senv.HandleStream, Auth: true,
+			Spec: openapi.Operation{
+				Path:    "/stream",
+				Summary: "Stream the new posts and notifications of the authenticated user",
+				Description: "A stream of Server-Sent Events: post events with the new posts of the user and of the users they follow, " +
+					"and notification events with their new and updated notifications. The data of an event is the post or the notification. " +
+					"A client which does not keep up receives a dropped event and is disconnected.",
+				Tags:                []string{"notifications"},
+				Response:            &openapi.Schema{Type: "string", Description: "Server-Sent Events"},
+				ResponseMediaType:   eventStreamMediaType,
+				ResponseDescription: "The events, as they happen",
+				Security:            userSecurity,
+				Errors: map[int]string{
+					http.StatusUnauthorized:   userErrors[http.StatusUnauthorized],
+					http.StatusNotImplemented: "Streaming is not available on this server",
+				},
+			},
+		},
+		{
+			Name: "graphql", Method: "POST", Pattern: "/graphql", Limit: LimitRead, Handler: senv.HandleGraphQL, OptionalAuth: true,
+			Spec: openapi.Operation{
+				Path:        "/graphql",
+				Summary:     "Execute a GraphQL query or mutation",
+				Description: "See the GraphQL section of the README for the schema. " + visibilityDescription,
+				Tags:        []string{"graphql"},
+				Request:     graphql.Request{},
+				Response: &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"data":   {Description: "The result of the operation"},
+						"errors": {Type: "array", Items: &openapi.Schema{Type: "object"}},
+					},
+				},
+				ResponseDescription: "The result of the operation, with the errors of the fields which failed",
+				JSONOnly:            true,
+				Security:            userSecurity,
+				SecurityOptional:    true,
+				Errors:              optionalUserErrors,
+			},
+		},
+		{
+			Name: "admin.export", Method: "GET", Pattern: "/admin/export/", Limit: LimitRead, Handler: senv.HandleExport, Admin: true, Permission: models.PermissionTransfer,
+			Spec: openapi.Operation{
+				Path:                "/admin/export/{collection}",
+				Summary:             "Export a collection",
+				Description:         "The documents are streamed in the order of their IDs, one JSON object per line. Users are exported with their password hash.",
+				Tags:                []string{"admin"},
+				Params:              []openapi.Parameter{collectionParam},
+				Response:            &openapi.Schema{Type: "string", Description: "One document per line"},
+				ResponseMediaType:   ndjsonMediaType,
+				ResponseDescription: "The documents of the collection",
+				Security:            adminSecurity,
+				Errors:              adminErrors,
+			},
+		},
+		{
+			Name: "admin.import", Method: "POST", Pattern: "/admin/import/", Limit: LimitWrite, Handler: senv.HandleImport, Admin: true, Permission: models.PermissionTransfer,
+			Spec: openapi.Operation{
+				Path:    "/admin/import/{collection}",
+				Summary: "Import documents into a collection",
+				Description: "The body is in the format sent by the export route. The documents are inserted in batches, " +
+					"and the ones in the batches before an error stay inserted.",
+				Tags: []string{"admin"},
+				Params: []openapi.Parameter{
+					collectionParam,
+					{Name: "on_conflict", In: "query", Description: "What to do with documents with an existing ID", Schema: &openapi.Schema{Type: "string", Enum: []string{"error", "skip", "upsert"}}},
+					{Name: "dry_run", In: "query", Description: "Only check the documents, without inserting them", Schema: &openapi.Schema{Type: "boolean"}},
+				},
+				Request:             &openapi.Schema{Type: "string", Description: "One document per line"},
+				RequestMediaType:    ndjsonMediaType,
+				Response:            transfer.Result{},
+				ResponseDescription: "The number of documents written, or checked in a dry run",
+				JSONOnly:            true,
+				Security:            adminSecurity,
+				Errors: map[int]string{
+					http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+					http.StatusNotFound:     adminErrors[http.StatusNotFound],
+					http.StatusConflict:     "A document has the ID of an existing one, and on_conflict is error",
+				},
+			},
+		},
+		{
+			Name: "admin.webhooks.create", Method: "POST", Pattern: "/admin/webhooks", Limit: LimitWrite, Handler: senv.HandleWebhookCreate, Admin: true, Permission: models.PermissionManageWebhooks,
+			Spec: openapi.Operation{
+				Path:    "/admin/webhooks",
+				Summary: "Create a webhook",
+				Description: "The events are any of post.created, post.deleted and user.created. The secret of the signatures is generated " +
+					"if it is not set, and is only sent in this response. See the Webhooks section of the README for the deliveries.",
+				Tags:                []string{"admin"},
+				Request:             models.Webhook{},
+				Response:            models.Webhook{},
+				ResponseDescription: "The webhook, with its secret",
+				Security:            adminSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The URL or an event type is invalid",
+					http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+				},
+			},
+		},
+		{
+			Name: "admin.webhooks.list", Method: "GET", Pattern: "/admin/webhooks", Limit: LimitRead, Handler: senv.HandleWebhookList, Admin: true, Permission: models.PermissionManageWebhooks,
+			Spec: openapi.Operation{
+				Path:                "/admin/webhooks",
+				Summary:             "List the webhooks",
+				Tags:                []string{"admin"},
+				Response:            models.WebhookList{},
+				ResponseDescription: "The webhooks, without their secrets, in the order they were created",
+				Security:            adminSecurity,
+				Errors:              map[int]string{http.StatusUnauthorized: adminErrors[http.StatusUnauthorized]},
+			},
+		},
+		{
+			Name: "admin.webhooks.delete", Method: "DELETE", Pattern: "/admin/webhooks/", Limit: LimitWrite, Handler: senv.HandleWebhookDelete, Admin: true, Permission: models.PermissionManageWebhooks,
+			Spec: openapi.Operation{
+				Path:                "/admin/webhooks/{id}",
+				Summary:             "Delete a webhook",
+				Description:         "Its pending deliveries become dead letters.",
+				Tags:                []string{"admin"},
+				Response:            models.DeletedID{},
+				ResponseDescription: "The ID of the deleted webhook",
+				Security:            adminSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The ID is invalid",
+					http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+					http.StatusNotFound:     "There is no webhook with this ID",
+				},
+			},
+		},
+		{
+			Name: "admin.webhooks.deliveries", Method: "GET", Pattern: "/admin/webhooks/", Limit: LimitRead, Handler: senv.HandleDeliveryList, Admin: true, Permission: models.PermissionManageWebhooks,
+			Spec: openapi.Operation{
+				Path:    "/admin/webhooks/deliveries",
+				Summary: "List the deliveries of the webhooks",
+				Tags:    []string{"admin"},
+				Params: []openapi.Parameter{
+					{Name: "status", In: "query", Description: "The status of the deliveries, dead (the dead letters) by default", Schema: &openapi.Schema{Type: "string", Enum: []string{models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead}}},
+					limitParam,
+				},
+				Response:            models.DeliveryList{},
+				ResponseDescription: "The deliveries, the newest first",
+				Security:            adminSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The status or the limit is invalid",
+					http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+				},
+			},
+		},
+		{
+			Name: "admin.webhooks.retry", Method: "POST", Pattern: "/admin/webhooks/", Limit: LimitWrite, Handler: senv.HandleDeliveryRetry, Admin: true, Permission: models.PermissionManageWebhooks,
+			Spec: openapi.Operation{
+				Path:                "/admin/webhooks/deliveries/{id}/retry",
+				Summary:             "Retry a dead delivery",
+				Description:         "The delivery is attempted again, as many times as a new one.",
+				Tags:                []string{"admin"},
+				Response:            models.Delivery{},
+				ResponseDescription: "The delivery, which is pending again",
+				Security:            adminSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The ID is invalid",
+					http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+					http.StatusNotFound:     "There is no dead delivery with this ID",
+				},
+			},
+		},
+		{
+			Name: "admin.reports.list", Method: "GET", Pattern: "/admin/reports", Limit: LimitRead, Handler: senv.HandleReportList, Admin: true, Permission: models.PermissionModerate,
+			Spec: openapi.Operation{
+				Path:    "/admin/reports",
+				Summary: "List the reports of posts",
+				Tags:    []string{"admin", "moderation"},
+				Params: []openapi.Parameter{
+					{Name: "status", In: "query", Description: "The status of the reports, open (the moderation queue) by default", Schema: &openapi.Schema{Type: "string", Enum: []string{models.ReportOpen, models.ReportResolved, models.ReportDismissed}}},
+					limitParam,
+				},
+				Response:            models.ReportList{},
+				ResponseDescription: "The reports, the oldest first",
+				Security:            adminSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The status or the limit is invalid",
+					http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+				},
+			},
+		},
+		{
+			Name: "admin.reports.resolve", Method: "POST", Pattern: "/admin/reports/", Limit: LimitWrite, Handler: senv.HandleReportResolve, Admin: true, Permission: models.PermissionModerate,
+			Spec: openapi.Operation{
+				Path:                "/admin/reports/{id}/resolve",
+				Summary:             "Resolve a report",
+				Description:         "The post is hidden, and all its open reports are resolved.",
+				Tags:                []string{"admin", "moderation"},
+				Response:            models.Report{},
+				ResponseDescription: "The resolved report",
+				Security:            adminSecurity,
+				Errors:              reportErrors,
+			},
+		},
+		{
+			Name: "admin.reports.dismiss", Method: "POST", Pattern: "/admin/reports/", Limit: LimitWrite, Handler: senv.HandleReportDismiss, Admin: true, Permission: models.PermissionModerate,
+			Spec: openapi.Operation{
+				Path:                "/admin/reports/{id}/dismiss",
+				Summary:             "Dismiss a report",
+				Description:         "The post is shown again, and all its open reports are dismissed.",
+				Tags:                []string{"admin", "moderation"},
+				Response:            models.Report{},
+				ResponseDescription: "The dismissed report",
+				Security:            adminSecurity,
+				Errors:              reportErrors,
+			},
+		},
+		{
+			Name: "admin.moderation.log", Method: "GET", Pattern: "/admin/moderation-log", Limit: LimitRead, Handler: senv.HandleModerationLog, Admin: true, Permission: models.PermissionModerate,
+			Spec: openapi.Operation{
+				Path:        "/admin/moderation-log",
+				Summary:     "List the moderation actions",
+				Description: "Every report, flag and rejection of the caption filter, hidden post, resolution and dismissal is recorded.",
+				Tags:        []string{"admin", "moderation"},
+				Params: []openapi.Parameter{
+					{Name: "post_id", In: "query", Description: "Only the actions about this post", Schema: &openapi.Schema{Type: "string"}},
+					limitParam,
+				},
+				Response:            models.ModerationLog{},
+				ResponseDescription: "The actions, the newest first",
+				Security:            adminSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The post ID or the limit is invalid",
+					http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+				},
+			},
+		},
+		{
+			Name: "admin.users.role", Method: "PUT", Pattern: "/admin/users/", Limit: LimitWrite, Handler: senv.HandleUserRole, Admin: true, Permission: models.PermissionManageRoles,
+			Spec: openapi.Operation{
+				Path:                "/admin/users/{id}/role",
+				Summary:             "Change the role of a user",
+				Description:         "Moderators review the reports of posts, and admins can also call all the admin routes.",
+				Tags:                []string{"admin", "users"},
+				Request:             models.UserRole{},
+				Response:            models.UserRole{},
+				ResponseDescription: "The new role of the user",
+				Security:            adminSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "The ID or the role is invalid",
+					http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+					http.StatusNotFound:     "There is no user with this ID",
+				},
+			},
+		},
+		{
+			Name: "admin.audit", Method: "GET", Pattern: "/admin/audit", Limit: LimitRead, Handler: senv.HandleAudit, Admin: true, Permission: models.PermissionReadAudit,
+			Spec: openapi.Operation{
+				Path:    "/admin/audit",
+				Summary: "Query the audit log",
+				Description: "Every create, update and delete of the users and the posts, and every admin action which writes, is recorded with who made it, " +
+					"from which request, and the fields it changed. The entries match all the filters. " +
+					"When APPYINSTA_AUDIT_HASH_CHAIN is set, each entry has the hash of the previous one, and \"appyinsta audit verify\" checks the chain.",
+				Tags: []string{"admin", "audit"},
+				Params: []openapi.Parameter{
+					{Name: "action", In: "query", Description: "Only the entries of this action, like users.create or admin.import", Schema: &openapi.Schema{Type: "string"}},
+					{Name: "collection", In: "query", Description: "Only the changes of this collection, like users or posts", Schema: &openapi.Schema{Type: "string"}},
+					{Name: "target_id", In: "query", Description: "Only the changes of this document", Schema: &openapi.Schema{Type: "string"}},
+					{Name: "actor", In: "query", Description: "Only the entries of this kind of actor", Schema: &openapi.Schema{Type: "string", Enum: []string{models.ActorUser, models.ActorAdmin, models.ActorCLI, models.ActorSystem, models.ActorAnonymous}}},
+					{Name: "actor_id", In: "query", Description: "Only the changes made by this user", Schema: &openapi.Schema{Type: "string"}},
+					{Name: "request_id", In: "query", Description: "Only the changes made by this request", Schema: &openapi.Schema{Type: "string"}},
+					{Name: "since", In: "query", Description: "Only the entries created at or after this RFC 3339 time", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+					{Name: "until", In: "query", Description: "Only the entries created before this RFC 3339 time", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+					limitParam,
+					afterParam,
+				},
+				Response:            models.AuditLog{},
+				ResponseDescription: "The entries, the newest first",
+				Security:            adminSecurity,
+				Errors: map[int]string{
+					http.StatusBadRequest:   "A filter, the limit or the cursor is invalid",
+					http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+				},
+			},
+		},
+	}
+}
+
+// the parameters of the paginated routes
+var (
+	limitParam = openapi.Parameter{Name: "limit", In: "query", Description: "The maximum number of results, 20 by default and at most 100", Schema: &openapi.Schema{Type: "integer"}}
+	afterParam = openapi.Parameter{Name: "after", In: "query", Description: "The next cursor of the previous page", Schema: &openapi.Schema{Type: "string"}}
+)
+
+var searchParams = []openapi.Parameter{
+	{Name: "q", In: "query", Required: true, Description: "The words to search for", Schema: &openapi.Schema{Type: "string"}},
+	limitParam,
+	afterParam,
+}
+
+var searchErrors = map[int]string{
+	http.StatusBadRequest: "The query is empty, or the limit or the cursor is invalid",
+}
+
+const (
+	adminSecurity = "adminToken"
+	userSecurity  = "userBasic"
+)
+
+var userErrors = map[int]string{
+	http.StatusUnauthorized: "The credentials of the user are missing or wrong",
+}
+
+// the routes with OptionalAuth reject wrong credentials
+var optionalUserErrors = map[int]string{
+	http.StatusUnauthorized: "The credentials of the user are wrong",
+}
+
+const visibilityDescription = "Anonymous users only see the public posts of the users who are not private; " +
+	"authenticated users also see their own posts, and the posts of the users they follow which are not only for their author. " +
+	"Nobody sees the posts of the users they block or who block them."
+
+var followRequestErrors = map[int]string{
+	http.StatusBadRequest:   followErrors[http.StatusBadRequest],
+	http.StatusUnauthorized: userErrors[http.StatusUnauthorized],
+	http.StatusNotFound:     "The user does not exist, or did not ask to follow the authenticated user",
+}
+
+var followErrors = map[int]string{
+	http.StatusBadRequest:   "The user ID is invalid, or is the ID of the authenticated user",
+	http.StatusUnauthorized: userErrors[http.StatusUnauthorized],
+	http.StatusNotFound:     "The user does not exist",
+}
+
+var collectionParam = openapi.Parameter{Name: "collection", In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Enum: transfer.Collections}}
+
+var adminErrors = map[int]string{
+	http.StatusUnauthorized: "The admin token or the credentials of the user are missing or wrong",
+	http.StatusNotFound:     "The collection does not exist",
+}
+
+var reportErrors = map[int]string{
+	http.StatusBadRequest:   "The ID is invalid",
+	http.StatusUnauthorized: adminErrors[http.StatusUnauthorized],
+	http.StatusNotFound:     "There is no open report with this ID",
+}
+
+// OpenAPI builds the OpenAPI document of the routes
+func OpenAPI(routes []Route) *openapi.Document {
+	ops := make([]openapi.Operation, len(routes))
+	for i, route := range routes {
+		ops[i] = route.Spec
+		ops[i].ID = route.Name
+		ops[i].Method = route.Method
+		if route.Permission != "" {
+			ops[i].AltSecurity = userSecurity
+			errors := map[int]string{http.StatusForbidden: "The user does not have the " + route.Permission + " permission"}
+			for status, description := range route.Spec.Errors {
+				errors[status] = description
+			}
+			ops[i].Errors = errors
+		}
+	}
+
+	info := openapi.Info{
+		Title:       "AppyInsta API",
+		Version:     "1.0.0",
+		Description: "An API for users and their posts. Errors are sent as JSON objects with an error message.",
+	}
+	doc := openapi.Build(info, ops, utils.ErrorResponse{})
+	doc.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+		adminSecurity: {Type: "http", Scheme: "bearer", Description: "The admin token set in APPYINSTA_ADMIN_TOKEN. The admin routes also accept the credentials of the users with the permission of the route."},
+		userSecurity:  {Type: "http", Scheme: "basic", Description: "The ID or the username of a user, and their password"},
+	}
+	return doc
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/search"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Number of results of the pages of search results and of the posts of a
+// hashtag, if not set with the limit parameter, and its maximum
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// pageLimit reads the limit parameter of a request, or writes an error
+func pageLimit(writer http.ResponseWriter, req *http.Request, defaultLimit, maxLimit int64) (int64, bool) {
+	limit := req.URL.Query().Get("limit")
+	if limit == "" {
+		return defaultLimit, true
+	}
+	n, err := strconv.ParseInt(limit, 10, 64)
+	if err != nil || n < 1 || n > maxLimit {
+		utils.WriteError(writer, req, "limit must be between 1 and "+strconv.FormatInt(maxLimit, 10), http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// searchOptions reads the limit and after parameters of a search request,
+// or writes an error
+func searchOptions(writer http.ResponseWriter, req *http.Request) (string, store.SearchOptions, bool) {
+	query := req.URL.Query()
+	var opts store.SearchOptions
+
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		utils.WriteError(writer, req, "The q parameter is required", http.StatusBadRequest)
+		return "", opts, false
+	}
+
+	var ok bool
+	if opts.Limit, ok = pageLimit(writer, req, DefaultPageLimit, MaxPageLimit); !ok {
+		return "", opts, false
+	}
+
+	if after := query.Get("after"); after != "" {
+		cursor, err := decodeSearchCursor(after)
+		if err != nil {
+			utils.WriteError(writer, req, "Bad cursor", http.StatusBadRequest)
+			return "", opts, false
+		}
+		opts.After = cursor
+	}
+	return q, opts, true
+}
+
+// Cursors are the score and the ID of the last result of a page, encoded
+// so that clients treat them as opaque strings. The score is formatted
+// with the fewest digits which parse back to the same number.
+
+func encodeSearchCursor(score float64, id primitive.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatFloat(score, 'g', -1, 64) + ":" + id.Hex()))
+}
+
+func decodeSearchCursor(s string) (*store.SearchCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	score, id, _ := strings.Cut(string(b), ":")
+	var cursor store.SearchCursor
+	if cursor.Score, err = strconv.ParseFloat(score, 64); err != nil {
+		return nil, err
+	}
+	if cursor.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// GET /search/posts?q=<query>&limit=<n>&after=<cursor>
+// Only the posts which the user can see are found, see store.Viewer.
+func (senv *ServerEnv) HandleSearchPosts(writer http.ResponseWriter, req *http.Request) {
+	q, opts, ok := searchOptions(writer, req)
+	if !ok {
+		return
+	}
+	if opts.Viewer, ok = senv.viewer(writer, req); !ok {
+		return
+	}
+
+	hits, err := senv.store().SearchPosts(req.Context(), q, opts)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not search posts", "err", err, "q", q)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	results := models.PostSearchResults{Results: make([]models.PostSearchResult, len(hits))}
+	for i, hit := range hits {
+		results.Results[i] = models.PostSearchResult{Post: hit.Post, Score: hit.Score, Highlight: search.Highlight(hit.Post.Caption, q)}
+	}
+	if n := len(hits); int64(n) == opts.Limit {
+		results.Next = encodeSearchCursor(hits[n-1].Score, hits[n-1].Post.PostID)
+	}
+	utils.WriteResponse(writer, req, results)
+}
+
+// GET /search/users?q=<query>&limit=<n>&after=<cursor>
+func (senv *ServerEnv) HandleSearchUsers(writer http.ResponseWriter, req *http.Request) {
+	q, opts, ok := searchOptions(writer, req)
+	if !ok {
+		return
+	}
+	if opts.Viewer, ok = senv.viewer(writer, req); !ok {
+		return
+	}
+
+	hits, err := senv.store().SearchUsers(req.Context(), q, opts)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not search users", "err", err, "q", q)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	results := models.UserSearchResults{Results: make([]models.UserSearchResult, len(hits))}
+	for i, hit := range hits {
+		hit.User.PwdHash = "" // set this to empty so that it is not marshalled
+		results.Results[i] = models.UserSearchResult{User: hit.User, Score: hit.Score, Highlight: search.Highlight(hit.User.Name, q)}
+	}
+	if n := len(hits); int64(n) == opts.Limit {
+		results.Next = encodeSearchCursor(hits[n-1].Score, hits[n-1].User.UserID)
+	}
+	utils.WriteResponse(writer, req, results)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"appyinsta/api/fixtures"
+	"appyinsta/api/models"
+)
+
+// The scores depend on the store, so the golden files are the results of
+// the in-memory store, even when MONGODB_URI is set.
+func newSearchTestEnv(t *testing.T) *ServerEnv {
+	return &ServerEnv{Store: fixtures.NewMemoryStore(t, fixtures.Default())}
+}
+
+func TestSearchPosts(t *testing.T) {
+	senv := newSearchTestEnv(t)
+
+	w := httptest.NewRecorder()
+	senv.HandleSearchPosts(w, httptest.NewRequest("GET", "/search/posts?q=another+captions&limit=2", nil))
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: expected %v but received %v: %s", http.StatusOK, resp.StatusCode, body)
+	}
+	if err := checkResponseHeaders(resp); err != nil {
+		t.Errorf(err.Error())
+	}
+	fixtures.GoldenJSON(t, "testdata/search_posts.json", body)
+
+	// the pages cover all the posts once
+	seen := map[string]bool{}
+	var page models.PostSearchResults
+	json.Unmarshal(body, &page)
+	for pages := 1; ; pages++ {
+		for _, result := range page.Results {
+			if seen[result.Post.PostID.Hex()] {
+				t.Errorf("post %s is in two pages", result.Post.PostID.Hex())
+			}
+			seen[result.Post.PostID.Hex()] = true
+		}
+		if page.Next == "" || pages > 10 {
+			break
+		}
+		w := httptest.NewRecorder()
+		senv.HandleSearchPosts(w, httptest.NewRequest("GET", "/search/posts?q=another+captions&limit=2&after="+url.QueryEscape(page.Next), nil))
+		page = models.PostSearchResults{}
+		if err := json.NewDecoder(w.Result().Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seen) != 9 {
+		t.Errorf("the pages have %d posts, expected 9", len(seen))
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	w := httptest.NewRecorder()
+	newSearchTestEnv(t).HandleSearchUsers(w, httptest.NewRequest("GET", "/search/users?q=ada", nil))
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: expected %v but received %v: %s", http.StatusOK, resp.StatusCode, body)
+	}
+	fixtures.GoldenJSON(t, "testdata/search_users.json", body)
+}
+
+func TestSearchBadRequest(t *testing.T) {
+	senv := newSearchTestEnv(t)
+	for _, query := range []string{"", "?q=+", "?q=ada&limit=0", "?q=ada&limit=101", "?q=ada&after=bad"} {
+		w := httptest.NewRecorder()
+		senv.HandleSearchUsers(w, httptest.NewRequest("GET", "/search/users"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %v, received %v", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"appyinsta/api/utils"
+)
+
+const eventStreamMediaType = "text/event-stream"
+
+// StreamHeartbeat is the interval of the comments sent on idle streams, so
+// that proxies do not close them
+var StreamHeartbeat = 15 * time.Second
+
+// the delay before clients reconnect, in milliseconds
+const streamRetry = 3000
+
+// GET /stream
+func (senv *ServerEnv) HandleStream(writer http.ResponseWriter, req *http.Request) {
+	flusher, ok := writer.(http.Flusher)
+	if senv.Stream == nil || !ok {
+		utils.WriteError(writer, req, "Streaming is not available", http.StatusNotImplemented)
+		return
+	}
+	userID, _ := utils.UserID(req.Context())
+
+	sub := senv.Stream.Subscribe(userID)
+	defer sub.Close()
+
+	writer.Header().Set("Content-Type", eventStreamMediaType)
+	writer.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers responses by default
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	fmt.Fprintf(writer, "retry: %d\n\n", streamRetry)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(StreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for id := 1; ; id++ {
+		select {
+		case <-req.Context().Done():
+			return
+		case msg, ok := <-sub.C:
+			if !ok {
+				// the client did not keep up, and reconnects
+				if sub.Dropped() {
+					fmt.Fprint(writer, "event: dropped\ndata: {}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", id, msg.Type, msg.Data)
+		case <-heartbeat.C:
+			fmt.Fprint(writer, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appyinsta/api/notifications"
+	"appyinsta/api/stream"
+)
+
+func TestStream(t *testing.T) {
+	senv := newTestEnv(t)
+	senv.Stream = stream.NewHub(stream.DefaultBufferSize)
+	publisher := &stream.Publisher{Hub: senv.Stream, Store: senv.store()}
+	subscribe(senv, (&notifications.Notifier{Store: senv.store(), OnNotify: publisher.Notify}).Handle, publisher.HandleEvent)
+
+	// Ada follows Souris, and streams her updates
+	senv.HandleFollow(httptest.NewRecorder(), asUser(httptest.NewRequest("POST", "/users/6160fe9757a258c6bdc94056/follow", nil), adaID))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		senv.HandleStream(w, asUser(req, adaID))
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ctype := resp.Header.Get("Content-Type"); ctype != "text/event-stream" {
+		t.Fatalf("Content-Type is %q", ctype)
+	}
+	body := bufio.NewReader(resp.Body)
+	// the subscription exists once the retry delay is sent
+	if line, _ := body.ReadString('\n'); !strings.HasPrefix(line, "retry: ") {
+		t.Fatalf("the stream starts with %q", line)
+	}
+
+	senv.HandleFollow(httptest.NewRecorder(), asUser(httptest.NewRequest("POST", "/users/616156d49ab2934adcee255e/follow", nil), fixtureUserID))
+	createPost(t, senv, "Hello @ada")
+	dispatch(t, senv)
+
+	var got []string
+	for len(got) < 3 {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("the stream ended after %q: %v", got, err)
+		}
+		if strings.HasPrefix(line, "event: ") {
+			got = append(got, strings.TrimSpace(strings.TrimPrefix(line, "event: ")))
+		}
+	}
+	if want := "notification post notification"; strings.Join(got, " ") != want {
+		t.Errorf("received the events %q, expected %q", got, want)
+	}
+}
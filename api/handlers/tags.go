@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"appyinsta/api/caption"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Window over which the trending hashtags are counted if not set with the
+// window parameter, and its maximum
+const (
+	DefaultTrendingWindow = 24 * time.Hour
+	MaxTrendingWindow     = 30 * 24 * time.Hour
+)
+
+// Number of trending hashtags sent if not set with the limit parameter
+const DefaultTrendingLimit = 10
+
+// GET /tags/<tag>/posts?limit=<n>&after=<cursor>
+// The posts are sent newest first. The cursor is the ID of the last post of
+// the previous page.
+func (senv *ServerEnv) HandleTagPosts(writer http.ResponseWriter, req *http.Request) {
+	tag := strings.TrimPrefix(req.URL.Path, "/tags/")
+	if !strings.HasSuffix(tag, "/posts") {
+		utils.WriteError(writer, req, "Not Found", http.StatusNotFound)
+		return
+	}
+	tag = caption.NormalizeTag(strings.TrimSuffix(tag, "/posts"))
+	if tag == "" || strings.Contains(tag, "/") {
+		utils.WriteError(writer, req, "Bad tag", http.StatusBadRequest)
+		return
+	}
+
+	limit, ok := pageLimit(writer, req, DefaultPageLimit, MaxPageLimit)
+	if !ok {
+		return
+	}
+	var before primitive.ObjectID
+	if after := req.URL.Query().Get("after"); after != "" {
+		var err error
+		if before, err = primitive.ObjectIDFromHex(after); err != nil {
+			utils.WriteError(writer, req, "Bad cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	viewer, ok := senv.viewer(writer, req)
+	if !ok {
+		return
+	}
+	posts, err := senv.store().ListTagPosts(req.Context(), viewer, tag, before, limit)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not query posts", "err", err, "tag", tag)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	page := models.PostPage{Posts: posts}
+	if page.Posts == nil {
+		page.Posts = []models.Post{}
+	}
+	if n := len(posts); int64(n) == limit {
+		page.Next = posts[n-1].PostID.Hex()
+	}
+	utils.WriteResponse(writer, req, page)
+}
+
+// GET /tags/trending?window=<duration>&limit=<n>
+// The hashtags are counted in the posts posted during the window before now.
+func (senv *ServerEnv) HandleTrendingTags(writer http.ResponseWriter, req *http.Request) {
+	window := DefaultTrendingWindow
+	if w := req.URL.Query().Get("window"); w != "" {
+		var err error
+		if window, err = time.ParseDuration(w); err != nil || window <= 0 || window > MaxTrendingWindow {
+			utils.WriteError(writer, req, "window must be a duration like 1h or 30m, of at most "+MaxTrendingWindow.String(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit, ok := pageLimit(writer, req, DefaultTrendingLimit, MaxPageLimit)
+	if !ok {
+		return
+	}
+
+	since := time.Now().UTC().Add(-window)
+	tags, err := senv.store().TrendingTags(req.Context(), since, limit)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not count tags", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, models.TrendingTags{Since: since, Tags: tags})
+}
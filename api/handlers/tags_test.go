@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func createPost(t *testing.T, senv *ServerEnv, caption string) primitive.ObjectID {
+	t.Helper()
+	body, _ := json.Marshal(models.Post{PostedByUID: fixtureUserID, Caption: caption, ImgURL: "img"})
+	w := httptest.NewRecorder()
+	senv.HandlePostCreate(w, asUser(httptest.NewRequest("POST", "/posts", bytes.NewReader(body)), fixtureUserID))
+	var id models.InsertedID
+	if err := json.NewDecoder(w.Result().Body).Decode(&id); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("could not create a post: %v, status %v", err, w.Code)
+	}
+	return id.ID
+}
+
+var fixtureUserID, _ = primitive.ObjectIDFromHex("6160fe9757a258c6bdc94056")
+
+func TestCreatePostTagsAndMentions(t *testing.T) {
+	senv := newTestEnv(t)
+	id := createPost(t, senv, "Hello @Ada and @nobody, #Go #news #go")
+
+	post, err := senv.store().GetPost(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"go", "news"}; !reflect.DeepEqual(post.Tags, want) {
+		t.Errorf("tags are %q, expected %q", post.Tags, want)
+	}
+	if ada, _ := primitive.ObjectIDFromHex("616156d49ab2934adcee255e"); !reflect.DeepEqual(post.Mentions, []primitive.ObjectID{ada}) {
+		t.Errorf("mentions are %v, expected ada", post.Mentions)
+	}
+}
+
+func TestTagPosts(t *testing.T) {
+	senv := newTestEnv(t)
+	var ids []primitive.ObjectID
+	for _, caption := range []string{"#go 1", "#news", "#Go 2", "#go 3"} {
+		ids = append(ids, createPost(t, senv, caption))
+	}
+
+	var got []primitive.ObjectID
+	after := ""
+	for pages := 0; pages < 5; pages++ {
+		w := httptest.NewRecorder()
+		senv.HandleTagPosts(w, httptest.NewRequest("GET", "/tags/GO/posts?limit=2&after="+after, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Handler returned wrong status code: expected %v but received %v: %s", http.StatusOK, w.Code, w.Body)
+		}
+		var page models.PostPage
+		json.NewDecoder(w.Result().Body).Decode(&page)
+		for _, post := range page.Posts {
+			got = append(got, post.PostID)
+		}
+		if after = page.Next; after == "" {
+			break
+		}
+	}
+	if want := []primitive.ObjectID{ids[3], ids[2], ids[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("posts are %v, expected %v", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	senv.HandleTagPosts(w, httptest.NewRequest("GET", "/tags/go/comments", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %v for an unknown path, received %v", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestTrendingTags(t *testing.T) {
+	senv := newTestEnv(t)
+	for _, caption := range []string{"#go #news", "#news", "#go #news #food"} {
+		createPost(t, senv, caption)
+	}
+	// the posts which anonymous users do not see are not counted
+	for _, post := range []models.Post{
+		{Visibility: models.VisibilityOnlyMe},
+		{Visibility: models.VisibilityFollowers},
+		{AuthorPrivate: true},
+		{Hidden: true},
+	} {
+		post.PostedByUID, post.Caption, post.ImgURL = fixtureUserID, "#food", "img"
+		post.PostedOn, post.Tags = time.Now().UTC(), []string{"food"}
+		if err := senv.store().CreatePost(context.Background(), &post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	senv.HandleTrendingTags(w, httptest.NewRequest("GET", "/tags/trending?window=1h&limit=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: expected %v but received %v: %s", http.StatusOK, w.Code, w.Body)
+	}
+	var trending models.TrendingTags
+	json.NewDecoder(w.Result().Body).Decode(&trending)
+	// the posts of the fixtures are older than the window
+	if want := []models.TagCount{{Tag: "news", Count: 3}, {Tag: "go", Count: 2}}; !reflect.DeepEqual(trending.Tags, want) {
+		t.Errorf("trending tags are %v, expected %v", trending.Tags, want)
+	}
+
+	for _, query := range []string{"?window=1x", "?window=-1h", "?window=1000h", "?limit=0"} {
+		w := httptest.NewRecorder()
+		senv.HandleTrendingTags(w, httptest.NewRequest("GET", "/tags/trending"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %v, received %v", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -1,34 +1,17 @@
 package handlers
 
 import (
-	"context"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
+	"testing"
 
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"appyinsta/api/fixtures"
 )
 
-func openDBCon() (*ServerEnv, *mongo.Client) {
-	uri := os.Getenv("MONGODB_URI")
-	dbname := os.Getenv("MONGODB_DBNAME")
-
-	if uri == "" || dbname == "" {
-		log.Fatal("You must set the MONGODB_URI and MONGODB_DBNAME environment variables.")
-	}
-
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
-	if err != nil {
-		panic(err)
-	}
-
-	log.Println("Connected to MongoDB Atlas database.")
-	log.Println(fmt.Sprintf("Selecting database: %s", dbname))
-
-	senv := &ServerEnv{DB: client.Database(dbname)}
-	return senv, client
+// newTestEnv returns a ServerEnv on a store with the default fixtures,
+// which is in memory unless MONGODB_URI is set (see fixtures.NewStore)
+func newTestEnv(t *testing.T) *ServerEnv {
+	return &ServerEnv{Store: fixtures.NewStore(t, fixtures.Default())}
 }
 
 func checkResponseHeaders(resp *http.Response) error {
@@ -2,26 +2,20 @@ package handlers
 
 import (
 	"bytes"
-	"context"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"appyinsta/api/fixtures"
 )
 
 func TestGetUser(t *testing.T) {
 	req := httptest.NewRequest("GET", "/users/6160fe9757a258c6bdc94056", nil)
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
 	senv.HandleUserGet(w, req)
 
@@ -36,24 +30,14 @@ func TestGetUser(t *testing.T) {
 		t.Errorf(err.Error())
 	}
 
-	expectedBody := `{"id":"6160fe9757a258c6bdc94056","name":"Souris Ash","email":"sasa@lele.com"}`
-
-	if string(body) != expectedBody {
-		t.Errorf("Unexpected body returned. Expected %s and got %s", expectedBody, string(body))
-	}
+	fixtures.GoldenJSON(t, "testdata/get_user.json", body)
 }
 
 func TestGetUserBadUserID(t *testing.T) {
 	req := httptest.NewRequest("GET", "/users/6160fe9757a258c6bd", nil)
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
 	senv.HandleUserGet(w, req)
 
@@ -64,7 +48,7 @@ func TestGetUserBadUserID(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: expected %v but received %v.", http.StatusOK, resp.StatusCode)
 	}
 
-	expectedBody := "Bad userID"
+	expectedBody := `{"error":"Bad userID"}`
 
 	if strings.TrimRight(string(body), "\n") != expectedBody {
 		t.Errorf("Unexpected body returned. got %s, expected %s", strings.TrimRight(string(body), "\n"), expectedBody)
@@ -75,13 +59,7 @@ func TestGetNonExistentUserID(t *testing.T) {
 	req := httptest.NewRequest("GET", "/users/6160ff9757a258c6bdc94086", nil)
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
 	senv.HandleUserGet(w, req)
 
@@ -110,13 +88,7 @@ func TestCreateUser(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
 	senv.HandleUserCreate(w, req)
 
@@ -143,13 +115,7 @@ func TestCreateUserEmptyFields(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	senv, client := openDBCon()
-	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
+	senv := newTestEnv(t)
 
 	senv.HandleUserCreate(w, req)
 
@@ -160,7 +126,28 @@ func TestCreateUserEmptyFields(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: expected %v but received %v.", http.StatusOK, resp.StatusCode)
 	}
 
-	if strings.TrimRight(string(body), "\n") != "Bad Request" {
+	if string(body) != `{"error":"Bad Request"}` {
 		t.Errorf("Expected Bad Request in body. Body received: %s", string(body))
 	}
 }
+
+func TestCreateUserUsername(t *testing.T) {
+	senv := newTestEnv(t)
+	tests := []struct {
+		username string
+		status   int
+	}{
+		{"Ann_B", http.StatusOK},
+		{"ann_b", http.StatusConflict}, // usernames are case-insensitive
+		{"ada", http.StatusConflict},
+		{"ann.b", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		jsonStr := []byte(`{"name":"Ann","email":"ann@example.com","password":"pwd","username":"` + test.username + `"}`)
+		w := httptest.NewRecorder()
+		senv.HandleUserCreate(w, httptest.NewRequest("POST", "/users", bytes.NewBuffer(jsonStr)))
+		if w.Code != test.status {
+			t.Errorf("username %q: expected status %v, received %v: %s", test.username, test.status, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+	"appyinsta/api/webhooks"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// POST /admin/webhooks
+func (senv *ServerEnv) HandleWebhookCreate(writer http.ResponseWriter, req *http.Request) {
+	var webhook models.Webhook
+	if err := utils.DecodeBody(writer, req, &webhook); err != nil {
+		utils.WriteBodyError(writer, req, err)
+		return
+	}
+
+	if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		utils.WriteError(writer, req, "url must be an http or https URL", http.StatusBadRequest)
+		return
+	}
+	if len(webhook.Events) == 0 {
+		utils.WriteError(writer, req, "events must not be empty", http.StatusBadRequest)
+		return
+	}
+	for _, t := range webhook.Events {
+		if !webhooks.IsEventType(t) {
+			utils.WriteError(writer, req, "Unknown event type "+t+", expected one of "+strings.Join(webhooks.EventTypes, ", "), http.StatusBadRequest)
+			return
+		}
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = webhooks.NewSecret()
+	}
+	webhook.CreatedOn = time.Now().UTC()
+
+	err := senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		if err := senv.store().CreateWebhook(ctx, &webhook); err != nil {
+			return nil, err
+		}
+		return nil, senv.audit(ctx, "admin.webhooks.create", "webhooks", webhook.ID, nil, webhook)
+	})
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not insert webhook", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(req.Context()).Info("webhook created", "webhook_id", webhook.ID.Hex(), "url", webhook.URL)
+	utils.WriteResponse(writer, req, webhook)
+}
+
+// GET /admin/webhooks
+func (senv *ServerEnv) HandleWebhookList(writer http.ResponseWriter, req *http.Request) {
+	list, err := senv.store().ListWebhooks(req.Context())
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not list webhooks", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// the secrets are only sent when the webhooks are created
+	for i := range list {
+		list[i].Secret = ""
+	}
+	if list == nil {
+		list = []models.Webhook{}
+	}
+	utils.WriteResponse(writer, req, models.WebhookList{Webhooks: list})
+}
+
+// DELETE /admin/webhooks/<webhookID>
+// The pending deliveries of the webhook become dead letters.
+func (senv *ServerEnv) HandleWebhookDelete(writer http.ResponseWriter, req *http.Request) {
+	id, err := primitive.ObjectIDFromHex(strings.TrimPrefix(req.URL.Path, "/admin/webhooks/"))
+	if err != nil {
+		utils.WriteError(writer, req, "Bad webhook ID", http.StatusBadRequest)
+		return
+	}
+	err = senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		if err := senv.store().DeleteWebhook(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, senv.audit(ctx, "admin.webhooks.delete", "webhooks", id, nil, nil)
+	})
+	if err == store.ErrNotFound {
+		utils.WriteError(writer, req, "Webhook not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.FromContext(req.Context()).Error("could not delete webhook", "err", err, "webhook_id", id.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, models.DeletedID{ID: id})
+}
+
+// GET /admin/webhooks/deliveries?status=<pending|delivered|dead>&limit=<n>
+func (senv *ServerEnv) HandleDeliveryList(writer http.ResponseWriter, req *http.Request) {
+	status := req.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.DeliveryDead
+	case models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		utils.WriteError(writer, req, "status must be pending, delivered or dead", http.StatusBadRequest)
+		return
+	}
+	limit, ok := pageLimit(writer, req, DefaultPageLimit, MaxPageLimit)
+	if !ok {
+		return
+	}
+
+	list, err := senv.store().ListDeliveries(req.Context(), status, limit)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not list deliveries", "err", err)
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []models.Delivery{}
+	}
+	utils.WriteResponse(writer, req, models.DeliveryList{Deliveries: list})
+}
+
+// POST /admin/webhooks/deliveries/<deliveryID>/retry
+// A dead delivery is attempted again, as many times as a new one.
+func (senv *ServerEnv) HandleDeliveryRetry(writer http.ResponseWriter, req *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/admin/webhooks/deliveries/"), "/retry")
+	id, err := primitive.ObjectIDFromHex(path)
+	if err != nil {
+		utils.WriteError(writer, req, "Bad delivery ID", http.StatusBadRequest)
+		return
+	}
+	var delivery models.Delivery
+	err = senv.record(req.Context(), func(ctx context.Context) ([]events.Event, error) {
+		if delivery, err = senv.store().RetryDelivery(ctx, id, time.Now().UTC()); err != nil {
+			return nil, err
+		}
+		return nil, senv.audit(ctx, "admin.webhooks.retry", "webhook_deliveries", id, nil, nil)
+	})
+	if err == store.ErrNotFound {
+		utils.WriteError(writer, req, "There is no dead delivery with this ID", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.FromContext(req.Context()).Error("could not retry delivery", "err", err, "delivery_id", id.Hex())
+		utils.WriteError(writer, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.WriteResponse(writer, req, delivery)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appyinsta/api/models"
+	"appyinsta/api/webhooks"
+)
+
+func TestWebhooks(t *testing.T) {
+	senv := newTestEnv(t)
+	subscribe(senv, (&webhooks.Outbox{Store: senv.store()}).Handle)
+
+	create := func(body string) (int, models.Webhook) {
+		w := httptest.NewRecorder()
+		senv.HandleWebhookCreate(w, httptest.NewRequest("POST", "/admin/webhooks", strings.NewReader(body)))
+		var webhook models.Webhook
+		json.NewDecoder(w.Body).Decode(&webhook)
+		return w.Code, webhook
+	}
+	for _, body := range []string{
+		`{"url": "ftp://example.com", "events": ["post.created"]}`,
+		`{"url": "https://example.com/hook", "events": []}`,
+		`{"url": "https://example.com/hook", "events": ["post.liked"]}`,
+	} {
+		if status, _ := create(body); status != http.StatusBadRequest {
+			t.Errorf("creating %s returned %v", body, status)
+		}
+	}
+	status, webhook := create(`{"url": "https://example.com/hook", "events": ["post.deleted"]}`)
+	if status != http.StatusOK || len(webhook.Secret) != 64 {
+		t.Fatalf("creating a webhook returned %v %+v", status, webhook)
+	}
+
+	w := httptest.NewRecorder()
+	senv.HandleWebhookList(w, httptest.NewRequest("GET", "/admin/webhooks", nil))
+	var list models.WebhookList
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Webhooks) != 1 || list.Webhooks[0].ID != webhook.ID || list.Webhooks[0].Secret != "" {
+		t.Errorf("listed %+v", list)
+	}
+
+	// only the author of a post can delete it, which is sent to the webhook
+	postID := createPost(t, senv, "Bye")
+	cases := []struct {
+		path   string
+		status int
+	}{
+		{"/posts/nope", http.StatusBadRequest},
+		{"/posts/" + postID.Hex(), http.StatusForbidden},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		senv.HandlePostDelete(w, asUser(httptest.NewRequest("DELETE", c.path, nil), adaID))
+		if w.Code != c.status {
+			t.Errorf("DELETE %s returned %v, expected %v", c.path, w.Code, c.status)
+		}
+	}
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		senv.HandlePostDelete(w, asUser(httptest.NewRequest("DELETE", "/posts/"+postID.Hex(), nil), fixtureUserID))
+		if w.Code != status {
+			t.Errorf("deleting the post returned %v, expected %v", w.Code, status)
+		}
+	}
+
+	dispatch(t, senv)
+
+	deliveries := func(query string) (int, models.DeliveryList) {
+		w := httptest.NewRecorder()
+		senv.HandleDeliveryList(w, httptest.NewRequest("GET", "/admin/webhooks/deliveries"+query, nil))
+		var list models.DeliveryList
+		json.NewDecoder(w.Body).Decode(&list)
+		return w.Code, list
+	}
+	if status, _ := deliveries("?status=lost"); status != http.StatusBadRequest {
+		t.Errorf("listing an unknown status returned %v", status)
+	}
+	if _, dead := deliveries(""); len(dead.Deliveries) != 0 {
+		t.Errorf("dead letters %+v", dead)
+	}
+	_, pending := deliveries("?status=pending")
+	if len(pending.Deliveries) != 1 || pending.Deliveries[0].Event != webhooks.PostDeleted || pending.Deliveries[0].WebhookID != webhook.ID {
+		t.Fatalf("pending deliveries %+v", pending)
+	}
+
+	// only dead deliveries can be retried
+	w = httptest.NewRecorder()
+	senv.HandleDeliveryRetry(w, httptest.NewRequest("POST", "/admin/webhooks/deliveries/"+pending.Deliveries[0].ID.Hex()+"/retry", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("retrying a pending delivery returned %v", w.Code)
+	}
+
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		senv.HandleWebhookDelete(w, httptest.NewRequest("DELETE", "/admin/webhooks/"+webhook.ID.Hex(), nil))
+		if w.Code != status {
+			t.Errorf("deleting the webhook returned %v, expected %v", w.Code, status)
+		}
+	}
+}
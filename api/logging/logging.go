@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A small leveled logger which writes one JSON object per line.
+// Each line contains the time, the level and the message, followed by
+// any key-value pairs attached to the logger (see With) and to the call.
+// Keys and values are passed as alternating arguments, for example:
+//
+//	logger.Error("could not insert post", "err", err, "user_id", uid)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel converts a level name (as used in the APPYINSTA_LOG_LEVEL
+// environment variable) to a Level. Unknown names map to LevelInfo.
+func ParseLevel(name string) Level {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+// output is shared between a logger and all the loggers derived from it
+// so that concurrent writes of lines do not interleave
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+type Logger struct {
+	out    *output
+	level  Level
+	fields []interface{}
+}
+
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w}, level: level}
+}
+
+// With returns a logger that adds the given key-value pairs to every line it writes
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{out: l.out, level: l.level, fields: fields}
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeValue(&buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeValue(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeValue(&buf, msg)
+	writeFields(&buf, l.fields)
+	writeFields(&buf, kv)
+	buf.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+func writeFields(buf *bytes.Buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = "!badkey"
+		}
+
+		var val interface{} = "!missing"
+		if i+1 < len(kv) {
+			val = kv[i+1]
+		}
+
+		buf.WriteByte(',')
+		writeValue(buf, key)
+		buf.WriteByte(':')
+		writeValue(buf, val)
+	}
+}
+
+func writeValue(buf *bytes.Buffer, val interface{}) {
+	switch v := val.(type) {
+	case error:
+		val = v.Error()
+	case time.Duration:
+		// durations are logged in milliseconds so that they can be aggregated
+		val = float64(v) / float64(time.Millisecond)
+	}
+
+	encoded, err := json.Marshal(val)
+	if err != nil {
+		encoded, _ = json.Marshal(err.Error())
+	}
+	buf.Write(encoded)
+}
+
+// The default logger writes to stderr at the info level.
+// main replaces it after reading the configuration.
+
+var defaultLogger = New(os.Stderr, LevelInfo)
+
+func Default() *Logger {
+	return defaultLogger
+}
+
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying the given logger
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx by NewContext,
+// or the default logger if there is none.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+		return l
+	}
+	return defaultLogger
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoggerWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo).With("request_id", "abc")
+
+	logger.Debug("not written")
+	logger.Error("could not insert post", "err", errors.New("boom"), "n", 3)
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line to be logged, got %d: %q", len(lines), buf.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Log line is not valid JSON: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"level":      "error",
+		"msg":        "could not insert post",
+		"request_id": "abc",
+		"err":        "boom",
+		"n":          float64(3),
+	}
+	for key, val := range expected {
+		if entry[key] != val {
+			t.Errorf("Unexpected value for %s. Expected %v and got %v", key, val, entry[key])
+		}
+	}
+
+	if _, ok := entry["time"]; !ok {
+		t.Errorf("Log line does not contain the time: %s", lines[0])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]Level{"debug": LevelDebug, "WARN": LevelWarn, "error": LevelError, "": LevelInfo, "bogus": LevelInfo}
+
+	for name, expected := range cases {
+		if got := ParseLevel(name); got != expected {
+			t.Errorf("ParseLevel(%q) returned %v, expected %v", name, got, expected)
+		}
+	}
+}
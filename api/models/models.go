@@ -8,28 +8,127 @@ import (
 
 // the struct tags (other than the first one) below are not really required
 // but kept here to ease connection between the frontend and backend
-// in case the fields in JSON have a different name
+// in case the fields in JSON have a different name.
+// The openapi tags are used in the OpenAPI document (see api/openapi).
 
 type User struct {
 	// JSON unmarshalling should skip this field
 	// UserID is an objectID provided by mongodb on insertion
-	UserID primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name   string             `json:"name" bson:"name"`
-	Email  string             `json:"email" bson:"email"`
+	UserID primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty" openapi:"readOnly"`
+	Name   string             `json:"name" bson:"name" openapi:"required"`
+	Email  string             `json:"email" bson:"email" openapi:"required"`
+
+	// The optional username is unique, and is how the user is mentioned in
+	// captions (@username). See caption.IsUsername for the allowed characters.
+	Username string `json:"username,omitempty" bson:"username,omitempty"`
 
 	// The following field initially contains the original password just after
 	// JSON unmarshalling of the request body, after which it is hashed and updated for storage.
 	// Since we do not have a control over the frontend, we're assuming
 	// that we are getting the password as plaintext.
-	PwdHash string `json:"password,omitempty" bson:"p_hash"`
+	PwdHash string `json:"password,omitempty" bson:"p_hash" openapi:"required,writeOnly"`
+
+	// Disabled users cannot create posts. Users are disabled with the CLI.
+	Disabled bool `json:"disabled,omitempty" bson:"disabled,omitempty" openapi:"readOnly"`
+
+	// Only the followers of a private user see their posts, and following
+	// them needs their approval
+	Private bool `json:"private,omitempty" bson:"private,omitempty"`
+
+	// The role of the user, which gives them permissions, RoleUser if empty.
+	// Roles are changed by the admins, or with the CLI.
+	Role string `json:"role,omitempty" bson:"role,omitempty" openapi:"readOnly,enum=user|moderator|admin"`
+}
+
+// Roles of users
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// IsRole reports whether r is a role, or empty
+func IsRole(r string) bool {
+	switch r {
+	case "", RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// Permissions of the admin routes
+const (
+	PermissionModerate       = "moderate"
+	PermissionManageWebhooks = "manage_webhooks"
+	PermissionTransfer       = "transfer"
+	PermissionManageRoles    = "manage_roles"
+	PermissionReadAudit      = "read_audit"
+)
+
+// the permissions of each role; users have none
+var rolePermissions = map[string][]string{
+	RoleModerator: {PermissionModerate},
+	RoleAdmin:     {PermissionModerate, PermissionManageWebhooks, PermissionTransfer, PermissionManageRoles, PermissionReadAudit},
+}
+
+// HasPermission reports whether a role has a permission
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
 }
 
 type Post struct {
-	PostID      primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	PostedByUID primitive.ObjectID `json:"posted_by" bson:"posted_by"`
-	Caption     string             `json:"caption" bson:"caption"`
-	ImgURL      string             `json:"img_url" bson:"img_url"`
-	PostedOn    time.Time          `json:"posted_on,omitempty" bson:"posted_on"` // filled at the server
+	PostID      primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty" openapi:"readOnly"`
+	PostedByUID primitive.ObjectID `json:"posted_by" bson:"posted_by" openapi:"required"`
+	Caption     string             `json:"caption" bson:"caption" openapi:"required"`
+	ImgURL      string             `json:"img_url" bson:"img_url" openapi:"required"`
+	PostedOn    time.Time          `json:"posted_on,omitempty" bson:"posted_on" openapi:"readOnly"` // filled at the server
+
+	// The hashtags of the caption, and the IDs of the users it mentions,
+	// filled at the server (see store.ParseCaption)
+	Tags     []string             `json:"tags,omitempty" bson:"tags,omitempty" openapi:"readOnly"`
+	Mentions []primitive.ObjectID `json:"mentions,omitempty" bson:"mentions,omitempty" openapi:"readOnly"`
+
+	// Who sees the post, public if empty, see store.Viewer
+	Visibility string `json:"visibility,omitempty" bson:"visibility,omitempty" openapi:"enum=public|followers|only_me"`
+	// whether the author is private, which makes public posts visible to
+	// their followers only. It is kept up to date by store.SetUserPrivate.
+	AuthorPrivate bool `json:"-" bson:"author_private,omitempty"`
+
+	// Hidden posts are only seen by their author, until a moderator
+	// dismisses their reports. Posts are hidden when they are reported too
+	// many times, or when a moderator resolves one of their reports.
+	Hidden bool `json:"hidden,omitempty" bson:"hidden,omitempty" openapi:"readOnly"`
+}
+
+// Visibilities of posts
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityOnlyMe    = "only_me"
+)
+
+// IsVisibility reports whether v is a visibility of posts, or empty
+func IsVisibility(v string) bool {
+	switch v {
+	case "", VisibilityPublic, VisibilityFollowers, VisibilityOnlyMe:
+		return true
+	}
+	return false
+}
+
+// Response body sent after a user or a post is created
+type InsertedID struct {
+	ID primitive.ObjectID `json:"id" openapi:"required"`
+}
+
+// Response body sent after a post is deleted
+type DeletedID struct {
+	ID primitive.ObjectID `json:"id" openapi:"required"`
 }
 
 // See api/handlers/handlers.go for the pagination logic.
@@ -38,6 +137,302 @@ type Post struct {
 type PostPaginationInfo struct {
 	LastPostID       primitive.ObjectID `json:"last_id"`
 	LastPostedOn     time.Time          `json:"last_posted_on"`
-	NumberOfNewPosts int64              `json:"n_new"`
+	NumberOfNewPosts int64              `json:"n_new" openapi:"required"`
 	FirstRequest     bool               `json:"first_request,omitempty"`
 }
+
+// Search results are sent in pages, most relevant first. To get the next
+// page, send the next cursor of a page in the after parameter; it is empty
+// on the last page. Highlight is the caption of a post or the name of a user,
+// split into the words which match the query and the text between them.
+
+type TextSegment struct {
+	Text  string `json:"text" openapi:"required"`
+	Match bool   `json:"match,omitempty"`
+}
+
+type PostSearchResult struct {
+	Post      Post          `json:"post" openapi:"required"`
+	Score     float64       `json:"score" openapi:"required"`
+	Highlight []TextSegment `json:"highlight" openapi:"required"`
+}
+
+type PostSearchResults struct {
+	Results []PostSearchResult `json:"results" openapi:"required"`
+	Next    string             `json:"next,omitempty"`
+}
+
+type UserSearchResult struct {
+	User      User          `json:"user" openapi:"required"`
+	Score     float64       `json:"score" openapi:"required"`
+	Highlight []TextSegment `json:"highlight" openapi:"required"`
+}
+
+type UserSearchResults struct {
+	Results []UserSearchResult `json:"results" openapi:"required"`
+	Next    string             `json:"next,omitempty"`
+}
+
+// A page of posts, newest first. To get the next page, send the next
+// cursor in the after parameter; it is empty on the last page.
+type PostPage struct {
+	Posts []Post `json:"posts" openapi:"required"`
+	Next  string `json:"next,omitempty"`
+}
+
+// The number of posts with a hashtag
+type TagCount struct {
+	Tag   string `json:"tag" bson:"_id" openapi:"required"`
+	Count int64  `json:"count" bson:"count" openapi:"required"`
+}
+
+// The hashtags used the most in the posts posted since a time
+type TrendingTags struct {
+	Since time.Time  `json:"since" openapi:"required"`
+	Tags  []TagCount `json:"tags" openapi:"required"`
+}
+
+// A notification of a user. Similar notifications are grouped while they
+// are unread: the actors of a group are the users who did the same thing,
+// such as following the user, in the order they first did it.
+type Notification struct {
+	ID     primitive.ObjectID   `json:"id" bson:"_id,omitempty" openapi:"required"`
+	UserID primitive.ObjectID   `json:"-" bson:"user_id"`
+	Type   string               `json:"type" bson:"type" openapi:"required"`
+	Actors []primitive.ObjectID `json:"actors" bson:"actors" openapi:"required"`
+	PostID *primitive.ObjectID  `json:"post_id,omitempty" bson:"post_id,omitempty"`
+	// notifications with the same key are grouped
+	GroupKey  string    `json:"-" bson:"group_key"`
+	Read      bool      `json:"read" bson:"read"`
+	CreatedOn time.Time `json:"created_on" bson:"created_on" openapi:"required"`
+	UpdatedOn time.Time `json:"updated_on" bson:"updated_on" openapi:"required"`
+
+	// like "Ada Poster and 3 others started following you", filled when sent
+	Summary string `json:"summary" bson:"-" openapi:"required"`
+}
+
+// A page of notifications, the most recently updated first
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications" openapi:"required"`
+	Unread        int64          `json:"unread" openapi:"required"`
+	Next          string         `json:"next,omitempty"`
+}
+
+// The notifications to mark as read, or all of them
+type MarkRead struct {
+	IDs []primitive.ObjectID `json:"ids"`
+	All bool                 `json:"all,omitempty"`
+}
+
+type UnreadCount struct {
+	Unread int64 `json:"unread" openapi:"required"`
+}
+
+// Whether the authenticated user follows a user, or asked to follow a
+// private user who has not approved it yet
+type FollowStatus struct {
+	Following bool `json:"following"`
+	Requested bool `json:"requested,omitempty"`
+}
+
+// The users who asked to follow the authenticated user, oldest first
+type FollowRequests struct {
+	Users []User `json:"users" openapi:"required"`
+}
+
+// Whether the authenticated user blocks a user
+type BlockStatus struct {
+	Blocking bool `json:"blocking"`
+}
+
+// Whether the authenticated user mutes a user
+type MuteStatus struct {
+	Muting bool `json:"muting"`
+}
+
+// The role of a user
+type UserRole struct {
+	Role string `json:"role" openapi:"required,enum=user|moderator|admin"`
+}
+
+// Whether the authenticated user is private
+type Privacy struct {
+	Private bool `json:"private"`
+}
+
+// A webhook receives the events of its types, see the webhooks package for
+// the payloads and their signature
+type Webhook struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty" openapi:"readOnly"`
+	URL    string             `json:"url" bson:"url" openapi:"required"`
+	Events []string           `json:"events" bson:"events" openapi:"required"`
+	// the key of the signatures, generated if it is empty. It is only sent
+	// when the webhook is created.
+	Secret    string    `json:"secret,omitempty" bson:"secret"`
+	CreatedOn time.Time `json:"created_on" bson:"created_on" openapi:"readOnly"`
+}
+
+type WebhookList struct {
+	Webhooks []Webhook `json:"webhooks" openapi:"required"`
+}
+
+// Statuses of deliveries
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// the delivery failed too many times, and is not retried
+	DeliveryDead = "dead"
+)
+
+// A delivery of an event to a webhook, in the outbox of the webhooks
+type Delivery struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty" openapi:"required"`
+	WebhookID primitive.ObjectID `json:"webhook_id" bson:"webhook_id" openapi:"required"`
+	// the ID of the event, which is the id of the payload
+	EventID primitive.ObjectID `json:"event_id" bson:"event_id" openapi:"required"`
+	Event   string             `json:"event" bson:"event" openapi:"required"`
+	// the body of the requests
+	Payload     string    `json:"payload" bson:"payload" openapi:"required"`
+	Status      string    `json:"status" bson:"status" openapi:"required"`
+	Attempts    int       `json:"attempts" bson:"attempts" openapi:"required"`
+	NextAttempt time.Time `json:"next_attempt" bson:"next_attempt" openapi:"required"`
+	LastError   string    `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedOn   time.Time `json:"created_on" bson:"created_on" openapi:"required"`
+}
+
+type DeliveryList struct {
+	Deliveries []Delivery `json:"deliveries" openapi:"required"`
+}
+
+// Reasons of reports
+const (
+	ReportSpam       = "spam"
+	ReportHarassment = "harassment"
+	ReportHate       = "hate"
+	ReportNudity     = "nudity"
+	ReportViolence   = "violence"
+	ReportOther      = "other"
+)
+
+var ReportReasons = []string{ReportSpam, ReportHarassment, ReportHate, ReportNudity, ReportViolence, ReportOther}
+
+// IsReportReason reports whether r is one of ReportReasons
+func IsReportReason(r string) bool {
+	for _, reason := range ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Statuses of reports
+const (
+	ReportOpen = "open"
+	// a moderator agreed with the report, and hid the post
+	ReportResolved = "resolved"
+	// a moderator disagreed with the report
+	ReportDismissed = "dismissed"
+)
+
+// A report of a post, by a user or by the caption filter (see the
+// moderation package), reviewed by the moderators
+type Report struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty" openapi:"readOnly"`
+	PostID primitive.ObjectID `json:"post_id" bson:"post_id" openapi:"readOnly"`
+	// nil for the reports of the caption filter
+	ReporterID *primitive.ObjectID `json:"reporter_id,omitempty" bson:"reporter_id,omitempty" openapi:"readOnly"`
+	Reason     string              `json:"reason" bson:"reason" openapi:"required,enum=spam|harassment|hate|nudity|violence|other"`
+	Details    string              `json:"details,omitempty" bson:"details,omitempty"`
+	Status     string              `json:"status" bson:"status" openapi:"readOnly"`
+	CreatedOn  time.Time           `json:"created_on" bson:"created_on" openapi:"readOnly"`
+	ClosedOn   *time.Time          `json:"closed_on,omitempty" bson:"closed_on,omitempty" openapi:"readOnly"`
+}
+
+type ReportList struct {
+	Reports []Report `json:"reports" openapi:"required"`
+}
+
+// Actions of the moderation log
+const (
+	ModerationReport  = "report"
+	ModerationFlag    = "flag"
+	ModerationReject  = "reject"
+	ModerationHide    = "hide"
+	ModerationResolve = "resolve"
+	ModerationDismiss = "dismiss"
+)
+
+// An entry of the moderation log, which records every moderation action
+type ModerationAction struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty" openapi:"required"`
+	Action string             `json:"action" bson:"action" openapi:"required"`
+	// nil for the rejected posts, which are not created
+	PostID   *primitive.ObjectID `json:"post_id,omitempty" bson:"post_id,omitempty"`
+	ReportID *primitive.ObjectID `json:"report_id,omitempty" bson:"report_id,omitempty"`
+	// the user who reported the post, the author of a rejected post, or the
+	// moderator who resolved or dismissed a report
+	UserID *primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	// who resolved or dismissed a report: a moderator (user) or the admin token
+	Actor string `json:"actor,omitempty" bson:"actor,omitempty" openapi:"enum=user|admin"`
+	// the rule of the caption filter which flagged or rejected the post
+	Rule      string    `json:"rule,omitempty" bson:"rule,omitempty"`
+	Reason    string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	CreatedOn time.Time `json:"created_on" bson:"created_on" openapi:"required"`
+}
+
+// The moderation log, newest first
+type ModerationLog struct {
+	Actions []ModerationAction `json:"actions" openapi:"required"`
+}
+
+// Who made the change of an entry of the audit log
+const (
+	// a user, authenticated with their credentials
+	ActorUser = "user"
+	// a request with the admin token
+	ActorAdmin = "admin"
+	// a command of the CLI
+	ActorCLI = "cli"
+	// the server itself, like the bootstrap of the first admin
+	ActorSystem = "system"
+	// a request without credentials, like the creation of a user
+	ActorAnonymous = "anonymous"
+)
+
+// An entry of the audit log, which records every change of the users and
+// the posts, and every admin action. The entries are numbered from 1.
+type AuditEntry struct {
+	Seq int64 `json:"seq" bson:"_id" openapi:"required"`
+	// like users.create, posts.delete or admin.webhooks.create
+	Action string `json:"action" bson:"action" openapi:"required"`
+	// the collection and the ID of the changed document, if any
+	Collection string              `json:"collection,omitempty" bson:"collection,omitempty"`
+	TargetID   *primitive.ObjectID `json:"target_id,omitempty" bson:"target_id,omitempty"`
+
+	Actor     string              `json:"actor" bson:"actor" openapi:"required,enum=user|admin|cli|system|anonymous"`
+	ActorID   *primitive.ObjectID `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	RequestID string              `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	IP        string              `json:"ip,omitempty" bson:"ip,omitempty"`
+
+	// the changed fields, by their JSON names, see audit.Diff
+	Changes   map[string]AuditChange `json:"changes,omitempty" bson:"changes,omitempty"`
+	CreatedOn time.Time              `json:"created_on" bson:"created_on" openapi:"required"`
+
+	// the hashes of the previous entry and of this one, when the entries
+	// are hash-chained, see store.HashAuditEntry
+	PrevHash string `json:"prev_hash,omitempty" bson:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty" bson:"hash,omitempty"`
+}
+
+// The value of a field before and after a change, null if it was not set
+type AuditChange struct {
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// A page of the audit log, newest first
+type AuditLog struct {
+	Entries []AuditEntry `json:"entries" openapi:"required"`
+	Next    string       `json:"next,omitempty"`
+}
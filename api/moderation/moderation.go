@@ -0,0 +1,123 @@
+// Package moderation checks the captions of new posts with rules. A rule
+// which matches a caption either rejects the post, or flags it: the post is
+// created, and reported to the moderators like a post reported by a user.
+package moderation
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"appyinsta/api/models"
+)
+
+// What happens to a post whose caption matches a rule
+const (
+	Flag   = "flag"
+	Reject = "reject"
+)
+
+// ErrRejected is returned for a new post whose caption matches a rule which
+// rejects it
+var ErrRejected = errors.New("the caption is not allowed")
+
+// A Match is the result of a rule which matched a caption
+type Match struct {
+	// the name of the rule, kept in the moderation log
+	Rule   string
+	Action string
+	// the reason of the report of a flagged post, see models.ReportReasons
+	Reason string
+}
+
+// Rule checks captions. Rules are pluggable: the server uses the rules
+// built from its configuration, and others can be added to its Filter.
+type Rule interface {
+	Check(caption string) (Match, bool)
+}
+
+// Filter runs rules on captions
+type Filter []Rule
+
+// Check returns the matches of the rules on a caption, in the order of the
+// rules. The post is rejected if one of them rejects it.
+func (f Filter) Check(caption string) (matches []Match, rejected bool) {
+	for _, rule := range f {
+		if m, ok := rule.Check(caption); ok {
+			matches = append(matches, m)
+			rejected = rejected || m.Action == Reject
+		}
+	}
+	return matches, rejected
+}
+
+// WordRule matches the captions with one of its words, whole and ignoring case
+type WordRule struct {
+	Name   string
+	Words  []string
+	Action string
+	Reason string
+}
+
+func (r WordRule) Check(caption string) (Match, bool) {
+	words := map[string]bool{}
+	for _, w := range r.Words {
+		words[strings.ToLower(w)] = true
+	}
+	for _, w := range strings.FieldsFunc(strings.ToLower(caption), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_'
+	}) {
+		if words[w] {
+			return Match{Rule: r.Name, Action: r.Action, Reason: r.Reason}, true
+		}
+	}
+	return Match{}, false
+}
+
+// RegexpRule matches the captions matching its pattern
+type RegexpRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Action  string
+	Reason  string
+}
+
+func (r RegexpRule) Check(caption string) (Match, bool) {
+	if !r.Pattern.MatchString(caption) {
+		return Match{}, false
+	}
+	return Match{Rule: r.Name, Action: r.Action, Reason: r.Reason}, true
+}
+
+// NewFilter returns the filter of the configuration of the server: the
+// captions with a rejected word are rejected, the ones with a flagged word
+// are flagged, and the ones with more than maxLinks links are flagged as
+// spam, unless maxLinks is 0
+func NewFilter(rejectedWords, flaggedWords []string, maxLinks int) Filter {
+	var f Filter
+	if len(rejectedWords) > 0 {
+		f = append(f, WordRule{Name: "rejected_words", Words: rejectedWords, Action: Reject, Reason: models.ReportOther})
+	}
+	if len(flaggedWords) > 0 {
+		f = append(f, WordRule{Name: "flagged_words", Words: flaggedWords, Action: Flag, Reason: models.ReportOther})
+	}
+	if maxLinks > 0 {
+		f = append(f, linkRule{max: maxLinks})
+	}
+	return f
+}
+
+var link = regexp.MustCompile(`(?i)\bhttps?://`)
+
+// linkRule flags the captions with more than max links as spam
+type linkRule struct {
+	max int
+}
+
+func (r linkRule) Check(caption string) (Match, bool) {
+	if len(link.FindAllStringIndex(caption, -1)) <= r.max {
+		return Match{}, false
+	}
+	return Match{Rule: "too_many_links", Action: Flag, Reason: models.ReportSpam}, true
+}
@@ -0,0 +1,35 @@
+package moderation
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := append(NewFilter([]string{"Scam"}, []string{"casino"}, 1),
+		RegexpRule{Name: "phone", Pattern: regexp.MustCompile(`\d{3}-\d{4}`), Action: Flag, Reason: "spam"})
+
+	tests := []struct {
+		caption  string
+		rules    []string
+		rejected bool
+	}{
+		{"Sunset at the #beach", nil, false},
+		{"Not a SCAM!", []string{"rejected_words"}, true},
+		{"scammer, casinos", nil, false},
+		{"#casino night, call 555-0100", []string{"flagged_words", "phone"}, false},
+		{"https://a.example and http://b.example", []string{"too_many_links"}, false},
+		{"casino scam https://a.example", []string{"rejected_words", "flagged_words"}, true},
+	}
+	for _, test := range tests {
+		matches, rejected := f.Check(test.caption)
+		var rules []string
+		for _, m := range matches {
+			rules = append(rules, m.Rule)
+		}
+		if !reflect.DeepEqual(rules, test.rules) || rejected != test.rejected {
+			t.Errorf("Check(%q) matched %q (rejected: %v), expected %q (%v)", test.caption, rules, rejected, test.rules, test.rejected)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package notifications turns the domain events into the notifications of
+// the users they are about, and describes notifications in words.
+package notifications
+
+import (
+	"context"
+	"fmt"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notifier stores a notification for the events which concern another user
+type Notifier struct {
+	Store store.Store
+	// if set, OnNotify is called with the stored notifications
+	OnNotify func(ctx context.Context, n models.Notification) error
+}
+
+// Handle is an events.Handler
+func (n *Notifier) Handle(ctx context.Context, event events.Event) error {
+	notification, ok := fromEvent(event)
+	if !ok {
+		return nil
+	}
+	// users are not notified of what the users they mute or block do
+	if ok, err := n.ignores(ctx, event.User, event.Actor); err != nil || ok {
+		return err
+	}
+	if event.Type == events.Mentioned {
+		// users are not told about the posts they cannot see
+		if ok, err := n.canSee(ctx, event.User, event.Post); err != nil || !ok {
+			return err
+		}
+	}
+	stored, err := n.Store.AddNotification(ctx, notification)
+	if err != nil || n.OnNotify == nil {
+		return err
+	}
+	return n.OnNotify(ctx, stored)
+}
+
+// ignores reports whether a user mutes another one, or if one of them blocks the other
+func (n *Notifier) ignores(ctx context.Context, userID, otherID primitive.ObjectID) (bool, error) {
+	muted, err := n.Store.ListMuted(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	blocked, err := n.Store.ListBlocks(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range append(muted, blocked...) {
+		if id == otherID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// canSee reports whether a user sees a post, which was not deleted
+func (n *Notifier) canSee(ctx context.Context, userID, postID primitive.ObjectID) (bool, error) {
+	post, err := n.Store.GetPost(ctx, postID)
+	if err == store.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	viewer, err := store.NewViewer(ctx, n.Store, userID)
+	if err != nil {
+		return false, err
+	}
+	return viewer.CanSee(post), nil
+}
+
+// fromEvent returns the notification of an event, if it has one.
+// Users are not notified of what they do themselves.
+func fromEvent(event events.Event) (models.Notification, bool) {
+	if event.User.IsZero() || event.User == event.Actor {
+		return models.Notification{}, false
+	}
+	n := models.Notification{
+		UserID:    event.User,
+		Type:      event.Type,
+		Actors:    []primitive.ObjectID{event.Actor},
+		CreatedOn: event.Time,
+		UpdatedOn: event.Time,
+	}
+
+	switch event.Type {
+	case events.Followed, events.FollowRequested, events.FollowAccepted:
+		// all the new followers are grouped, and the requests
+		n.GroupKey = event.Type
+	case events.Mentioned:
+		post := event.Post
+		n.PostID = &post
+		n.GroupKey = events.Mentioned + ":" + post.Hex()
+	default:
+		return models.Notification{}, false
+	}
+	return n, true
+}
+
+// Summarize sets the summaries of notifications, with the names of their last actors
+func Summarize(ctx context.Context, st store.Store, list []models.Notification) error {
+	var actorIDs []primitive.ObjectID
+	for _, n := range list {
+		if len(n.Actors) > 0 {
+			actorIDs = append(actorIDs, n.Actors[len(n.Actors)-1])
+		}
+	}
+	names := map[primitive.ObjectID]string{}
+	if len(actorIDs) > 0 {
+		actors, err := st.GetUsers(ctx, actorIDs)
+		if err != nil {
+			return err
+		}
+		for _, actor := range actors {
+			names[actor.UserID] = actor.Name
+		}
+	}
+
+	for i := range list {
+		list[i].Summary = Summary(list[i], names)
+	}
+	return nil
+}
+
+// what the actors of each type of notification did
+var verbs = map[string]string{
+	events.Followed:        "started following you",
+	events.FollowRequested: "asked to follow you",
+	events.FollowAccepted:  "accepted your follow request",
+	events.Mentioned:       "mentioned you in a post",
+}
+
+// Summary describes a notification, like "Ada and 3 others started following
+// you", with the name of the last actor. names maps the IDs of the users to
+// their names; unknown users are "Someone".
+func Summary(n models.Notification, names map[primitive.ObjectID]string) string {
+	if len(n.Actors) == 0 {
+		return ""
+	}
+	name, ok := names[n.Actors[len(n.Actors)-1]]
+	if !ok {
+		name = "Someone"
+	}
+
+	switch others := len(n.Actors) - 1; others {
+	case 0:
+		return fmt.Sprintf("%s %s", name, verbs[n.Type])
+	case 1:
+		return fmt.Sprintf("%s and 1 other %s", name, verbs[n.Type])
+	default:
+		return fmt.Sprintf("%s and %d others %s", name, others, verbs[n.Type])
+	}
+}
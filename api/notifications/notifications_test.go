@@ -0,0 +1,81 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNotifier(t *testing.T) {
+	st := store.NewMemoryStore()
+	ctx := context.Background()
+	n := &Notifier{Store: st}
+	ann, bob, cat, dan := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	start := time.Date(2021, 10, 9, 12, 0, 0, 0, time.UTC)
+	public := models.Post{PostedByUID: dan, Caption: "Hi @ann"}
+	hidden := models.Post{PostedByUID: dan, Caption: "Hi @ann", Visibility: models.VisibilityFollowers}
+	st.CreatePost(ctx, &public)
+	st.CreatePost(ctx, &hidden)
+	post := public.PostID
+
+	bus := events.NewBus()
+	bus.Subscribe(n.Handle)
+	bus.Publish(ctx,
+		events.Event{Type: events.Followed, Actor: bob, User: ann, Time: start},
+		events.Event{Type: events.Followed, Actor: cat, User: ann, Time: start.Add(time.Minute)},
+		events.Event{Type: events.Followed, Actor: bob, User: ann, Time: start.Add(2 * time.Minute)},
+		events.Event{Type: events.Mentioned, Actor: dan, User: ann, Post: post, Time: start.Add(3 * time.Minute)},
+		// not notified
+		events.Event{Type: events.Mentioned, Actor: ann, User: ann, Post: post},
+		events.Event{Type: events.Mentioned, Actor: dan, User: ann, Post: hidden.PostID},
+		events.Event{Type: "unknown", Actor: bob, User: ann},
+	)
+
+	list, err := st.ListNotifications(ctx, ann, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("ann has %d notifications, expected 2: %+v", len(list), list)
+	}
+	mention, follow := list[0], list[1]
+	if mention.Type != events.Mentioned || mention.PostID == nil || *mention.PostID != post {
+		t.Errorf("unexpected mention %+v", mention)
+	}
+	if follow.Type != events.Followed || len(follow.Actors) != 2 || !follow.UpdatedOn.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("unexpected follow %+v", follow)
+	}
+
+	// a read group is not added to
+	st.MarkNotificationsRead(ctx, ann, []primitive.ObjectID{follow.ID})
+	bus.Publish(ctx, events.Event{Type: events.Followed, Actor: dan, User: ann})
+	if unread, _ := st.CountUnreadNotifications(ctx, ann); unread != 2 {
+		t.Errorf("ann has %d unread notifications, expected 2", unread)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	ann, bob, cat := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	names := map[primitive.ObjectID]string{ann: "Ann", bob: "Bob"}
+
+	tests := []struct {
+		n    models.Notification
+		want string
+	}{
+		{models.Notification{Type: events.Followed, Actors: []primitive.ObjectID{ann}}, "Ann started following you"},
+		{models.Notification{Type: events.Followed, Actors: []primitive.ObjectID{ann, bob}}, "Bob and 1 other started following you"},
+		{models.Notification{Type: events.Mentioned, Actors: []primitive.ObjectID{bob, ann, cat, ann}}, "Ann and 3 others mentioned you in a post"},
+		{models.Notification{Type: events.Followed, Actors: []primitive.ObjectID{cat}}, "Someone started following you"},
+	}
+	for _, test := range tests {
+		if got := Summary(test.n, names); got != test.want {
+			t.Errorf("Summary = %q, expected %q", got, test.want)
+		}
+	}
+}
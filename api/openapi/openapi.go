@@ -0,0 +1,445 @@
+package openapi
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// An OpenAPI 3.1 document built from the route table of the server
+// (see handlers.Routes) and the models it sends and receives.
+//
+// Schemas are derived from the json struct tags of the models, in the same
+// way as encoding/json would encode them. A field can also carry an openapi
+// tag with a comma-separated list of:
+//
+//	required   the field must be sent
+//	readOnly   the field is only sent by the server
+//	writeOnly  the field is only sent by the client
+
+const Version = "3.1.0"
+
+// Operation describes one route of the API
+type Operation struct {
+	ID          string
+	Method      string
+	Path        string // path template, such as /users/{id}; path parameters are object IDs
+	Summary     string
+	Description string
+	Tags        []string
+
+	// Request is a value of the type of the request body, if there is one.
+	// Response is a value of the type of the response body,
+	// or a *Schema for responses which do not map to a model.
+	Request  interface{}
+	Response interface{}
+
+	ResponseDescription string
+	// the response is an empty object when the requested document does not exist
+	EmptyIfNotFound bool
+	// the request and response bodies are always JSON
+	JSONOnly bool
+	// Errors are the error responses specific to the route, by status code,
+	// with their description
+	Errors map[int]string
+
+	// Params are the query parameters, and the path parameters which are not object IDs
+	Params []Parameter
+	// the media types of bodies which are not in one of the negotiated formats
+	RequestMediaType  string
+	ResponseMediaType string
+	// the name of the security scheme required by the route, if any
+	Security string
+	// the security scheme is optional, like for the reads of posts
+	SecurityOptional bool
+	// another security scheme accepted instead of Security, if any
+	AltSecurity string
+}
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lowercase methods to operations
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	Responses       map[string]*Response       `json:"responses"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	MaxProperties        *int               `json:"maxProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	WriteOnly            bool               `json:"writeOnly,omitempty"`
+}
+
+// bodyMediaTypes are the formats accepted and sent by DecodeBody and WriteResponse
+var bodyMediaTypes = []string{"application/json", "application/msgpack", "application/cbor"}
+
+var objectIDRef = &Schema{Ref: "#/components/schemas/ObjectID"}
+
+// errorResponses are sent by every route, see utils.WriteError and the middleware
+var errorResponses = map[string]string{
+	"400": "BadRequest",
+	"429": "TooManyRequests",
+	"500": "InternalServerError",
+}
+
+// errorResponses of routes which negotiate the format of the response
+var negotiatedErrorResponses = map[string]string{
+	"406": "NotAcceptable",
+}
+
+// errorResponses of routes with a request body, see utils.DecodeBody
+var bodyErrorResponses = map[string]string{
+	"413": "RequestEntityTooLarge",
+	"415": "UnsupportedMediaType",
+}
+
+var errorDescriptions = map[string]string{
+	"BadRequest":            "The request is invalid",
+	"NotAcceptable":         "None of the formats in the Accept header can be sent",
+	"RequestEntityTooLarge": "The request body is too large",
+	"UnsupportedMediaType":  "The format of the request body is not supported",
+	"TooManyRequests":       "The rate limit of the route was exceeded",
+	"InternalServerError":   "The request could not be served",
+}
+
+// Build creates the document of the given operations. errorModel is a value
+// of the type of the error responses.
+func Build(info Info, ops []Operation, errorModel interface{}) *Document {
+	g := &generator{schemas: map[string]*Schema{
+		"ObjectID": {Type: "string", Pattern: "^[0-9a-f]{24}$", Description: "MongoDB object ID"},
+	}}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:   g.schemas,
+			Responses: map[string]*Response{},
+		},
+	}
+
+	g.errorSchema = g.schema(reflect.TypeOf(errorModel))
+	for name, description := range errorDescriptions {
+		doc.Components.Responses[name] = g.errorResponse(description)
+	}
+
+	for _, op := range ops {
+		item, ok := doc.Paths[op.Path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = g.operation(op)
+	}
+
+	return doc
+}
+
+func (g *generator) operation(op Operation) *OperationObject {
+	obj := &OperationObject{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Responses:   map[string]*Response{},
+	}
+
+	for _, name := range pathParams(op.Path) {
+		param := Parameter{Name: name, In: "path", Required: true, Schema: objectIDRef}
+		for _, p := range op.Params {
+			if p.In == "path" && p.Name == name {
+				param = p
+			}
+		}
+		obj.Parameters = append(obj.Parameters, param)
+	}
+	for _, p := range op.Params {
+		if p.In != "path" {
+			obj.Parameters = append(obj.Parameters, p)
+		}
+	}
+	if op.Security != "" {
+		obj.Security = []map[string][]string{{op.Security: {}}}
+		if op.AltSecurity != "" {
+			obj.Security = append(obj.Security, map[string][]string{op.AltSecurity: {}})
+		}
+		if op.SecurityOptional {
+			// an empty requirement allows anonymous requests
+			obj.Security = append([]map[string][]string{{}}, obj.Security...)
+		}
+	}
+
+	mediaTypes := bodyMediaTypes
+	if op.JSONOnly {
+		mediaTypes = bodyMediaTypes[:1]
+	}
+	content := func(s *Schema) map[string]MediaType {
+		c := map[string]MediaType{}
+		for _, mt := range mediaTypes {
+			c[mt] = MediaType{Schema: s}
+		}
+		return c
+	}
+
+	if op.Request != nil {
+		obj.RequestBody = &RequestBody{Required: true, Content: content(g.model(op.Request))}
+		if op.RequestMediaType != "" {
+			obj.RequestBody.Content = map[string]MediaType{op.RequestMediaType: {Schema: g.model(op.Request)}}
+		}
+	}
+
+	responseSchema := g.model(op.Response)
+	if op.EmptyIfNotFound {
+		empty := 0
+		responseSchema = &Schema{AnyOf: []*Schema{responseSchema, {Type: "object", MaxProperties: &empty}}}
+	}
+	obj.Responses["200"] = &Response{Description: op.ResponseDescription, Content: content(responseSchema)}
+	if op.ResponseMediaType != "" {
+		obj.Responses["200"].Content = map[string]MediaType{op.ResponseMediaType: {Schema: responseSchema}}
+	}
+
+	addRefs := func(refs map[string]string) {
+		for status, name := range refs {
+			obj.Responses[status] = &Response{Ref: "#/components/responses/" + name}
+		}
+	}
+	addRefs(errorResponses)
+	if !op.JSONOnly {
+		addRefs(negotiatedErrorResponses)
+	}
+	if op.Request != nil {
+		addRefs(bodyErrorResponses)
+	}
+	for status, description := range op.Errors {
+		obj.Responses[strconv.Itoa(status)] = g.errorResponse(description)
+	}
+
+	return obj
+}
+
+func (g *generator) errorResponse(description string) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]MediaType{"application/json": {Schema: g.errorSchema}},
+	}
+}
+
+// pathParams returns the names of the parameters of a path template
+func pathParams(path string) []string {
+	var names []string
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			names = append(names, part[1:len(part)-1])
+		}
+	}
+	return names
+}
+
+type generator struct {
+	schemas     map[string]*Schema
+	errorSchema *Schema
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+)
+
+func (g *generator) model(v interface{}) *Schema {
+	if s, ok := v.(*Schema); ok {
+		return s
+	}
+	return g.schema(reflect.TypeOf(v))
+}
+
+// schema returns the schema of a type. Named structs are added to the
+// components of the document and referenced.
+func (g *generator) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case objectIDType:
+		return objectIDRef
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // placeholder for recursive types
+			g.schemas[name] = g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	return &Schema{}
+}
+
+// schemaName is the name of the type, prefixed with its package
+// unless it is one of the models
+func schemaName(t reflect.Type) string {
+	pkg := path.Base(t.PkgPath())
+	if pkg == "models" {
+		return t.Name()
+	}
+	return pkg + "." + t.Name()
+}
+
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			// embedded structs are flattened like in JSON
+			embedded := g.structSchema(f.Type)
+			for prop, ps := range embedded.Properties {
+				s.Properties[prop] = ps
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := g.schema(f.Type)
+		for _, opt := range strings.Split(f.Tag.Get("openapi"), ",") {
+			switch opt {
+			case "required":
+				s.Required = append(s.Required, name)
+			case "readOnly", "writeOnly":
+				// in 3.1, keywords can be set next to a $ref
+				annotated := *prop
+				annotated.ReadOnly = opt == "readOnly"
+				annotated.WriteOnly = opt == "writeOnly"
+				prop = &annotated
+			default:
+				// the values of strings, like enum=public|followers
+				if strings.HasPrefix(opt, "enum=") {
+					annotated := *prop
+					annotated.Enum = strings.Split(strings.TrimPrefix(opt, "enum="), "|")
+					prop = &annotated
+				}
+			}
+		}
+		s.Properties[name] = prop
+	}
+
+	sort.Strings(s.Required)
+	return s
+}
+
+// JSON returns the indented JSON encoding of the document
+func (doc *Document) JSON() ([]byte, error) {
+	body, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
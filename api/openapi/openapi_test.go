@@ -0,0 +1,89 @@
+package openapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appyinsta/api/fixtures"
+	"appyinsta/api/handlers"
+	"appyinsta/api/openapi"
+)
+
+// The document built from the route table is compared with openapi.json,
+// so that changes to the routes or models are reflected in the committed
+// document. Run `go test ./api/openapi -update` to update it.
+func TestSpecIsUpToDate(t *testing.T) {
+	doc := handlers.OpenAPI((&handlers.ServerEnv{}).Routes())
+	body, err := doc.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures.Golden(t, "openapi.json", body)
+}
+
+func TestSpec(t *testing.T) {
+	routes := (&handlers.ServerEnv{}).Routes()
+	doc := handlers.OpenAPI(routes)
+
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi version %q", doc.OpenAPI)
+	}
+	for _, route := range routes {
+		op := doc.Paths[route.Spec.Path][strings.ToLower(route.Method)]
+		if op == nil {
+			t.Fatalf("no operation for route %s", route.Name)
+		}
+		if op.OperationID != route.Name {
+			t.Errorf("operation ID %q, expected %q", op.OperationID, route.Name)
+		}
+		if op.Responses["200"] == nil || op.Responses["429"] == nil {
+			t.Errorf("%s: missing responses: %v", route.Name, op.Responses)
+		}
+	}
+
+	user := doc.Components.Schemas["User"]
+	if user == nil {
+		t.Fatal("no User schema")
+	}
+	if !user.Properties["id"].ReadOnly || !user.Properties["password"].WriteOnly {
+		t.Errorf("User: id must be read-only and password write-only: %+v", user.Properties)
+	}
+	if got := user.Required; len(got) != 3 || got[0] != "email" || got[1] != "name" || got[2] != "password" {
+		t.Errorf("User: required fields %v", got)
+	}
+	if posted := doc.Components.Schemas["Post"].Properties["posted_on"]; posted.Type != "string" || posted.Format != "date-time" {
+		t.Errorf("Post.posted_on: %+v", posted)
+	}
+	if visibility := doc.Components.Schemas["Post"].Properties["visibility"]; len(visibility.Enum) != 3 || visibility.Enum[2] != "only_me" {
+		t.Errorf("Post.visibility: %+v", visibility)
+	}
+
+	params := doc.Paths["/users/{id}"]["get"].Parameters
+	if len(params) != 1 || params[0].Name != "id" || params[0].In != "path" {
+		t.Errorf("GET /users/{id} parameters: %+v", params)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	serve, err := openapi.MakeJSONHandler(handlers.OpenAPI((&handlers.ServerEnv{}).Routes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	serve(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil || doc["openapi"] != "3.1.0" {
+		t.Errorf("/openapi.json returned %s (%v)", w.Body.String(), err)
+	}
+
+	w = httptest.NewRecorder()
+	openapi.HandleDocs(w, httptest.NewRequest("GET", "/docs", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" || !bytes.Contains(w.Body.Bytes(), []byte("/openapi.json")) {
+		t.Errorf("/docs returned %s", ct)
+	}
+}
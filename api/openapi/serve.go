@@ -0,0 +1,30 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// MakeJSONHandler serves the document as JSON. The document is encoded once.
+func MakeJSONHandler(doc *Document) (http.HandlerFunc, error) {
+	body, err := doc.JSON()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(body)
+	}, nil
+}
+
+// HandleDocs serves a page which renders the document served at /openapi.json,
+// and from which requests can be sent to the API
+func HandleDocs(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Write(docsPage)
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// KeyFunc identifies the client which made a request
+type KeyFunc func(req *http.Request) string
+
+// ClientIP identifies clients by the IP address of the connection
+func ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// ForwardedClientIP identifies clients by the first address in the
+// X-Forwarded-For header. It must only be used behind a proxy which
+// sets that header, since clients can send any value in it.
+func ForwardedClientIP(req *http.Request) string {
+	if fwd := req.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	return ClientIP(req)
+}
+
+type Limiter struct {
+	Store Store
+	Key   KeyFunc
+}
+
+func NewLimiter(store Store, key KeyFunc) *Limiter {
+	if key == nil {
+		key = ClientIP
+	}
+	return &Limiter{Store: store, Key: key}
+}
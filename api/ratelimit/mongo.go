@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the buckets in a MongoDB collection so that the limits
+// are shared by all the replicas of the server. Each bucket is updated
+// atomically with an update pipeline (requires MongoDB 4.2 or later).
+type MongoStore struct {
+	colln *mongo.Collection
+}
+
+// NewMongoStore creates the store and the TTL index which removes idle buckets
+func NewMongoStore(ctx context.Context, db *mongo.Database) (*MongoStore, error) {
+	colln := db.Collection("rate_limits")
+
+	_, err := colln.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MongoStore{colln: colln}, nil
+}
+
+type bucketDoc struct {
+	Tokens    float64   `bson:"tokens"`
+	Allowed   bool      `bson:"allowed"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func (s *MongoStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	burst := float64(limit.Burst)
+
+	// refill the bucket according to the time elapsed since the last update
+	// (date subtraction gives milliseconds), then take a token if there is one
+	refill := bson.D{{Key: "$min", Value: bson.A{
+		burst,
+		bson.D{{Key: "$add", Value: bson.A{
+			bson.D{{Key: "$ifNull", Value: bson.A{"$tokens", burst}}},
+			bson.D{{Key: "$multiply", Value: bson.A{
+				bson.D{{Key: "$divide", Value: bson.A{
+					bson.D{{Key: "$subtract", Value: bson.A{now, bson.D{{Key: "$ifNull", Value: bson.A{"$updated_at", now}}}}}},
+					1000,
+				}}},
+				limit.Rate,
+			}}},
+		}}},
+	}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "tokens", Value: refill}, {Key: "updated_at", Value: now}}}},
+		{{Key: "$set", Value: bson.D{{Key: "allowed", Value: bson.D{{Key: "$gte", Value: bson.A{"$tokens", 1}}}}}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "tokens", Value: bson.D{{Key: "$cond", Value: bson.A{"$allowed", bson.D{{Key: "$subtract", Value: bson.A{"$tokens", 1}}}, "$tokens"}}}},
+			{Key: "expires_at", Value: now.Add(limit.Window())},
+		}}},
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var doc bucketDoc
+	if err := s.colln.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: key}}, pipeline, opts).Decode(&doc); err != nil {
+		return Result{}, err
+	}
+
+	return result(doc.Allowed, doc.Tokens, limit), nil
+}
+
+func (s *MongoStore) Peek(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	var doc bucketDoc
+	err := s.colln.FindOne(ctx, bson.D{{Key: "_id", Value: key}}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return result(true, float64(limit.Burst), limit), nil
+	} else if err != nil {
+		return Result{}, err
+	}
+
+	tokens := refill(doc.Tokens, doc.UpdatedAt, limit, now)
+	return result(tokens >= 1, tokens, limit), nil
+}
@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limiting uses token buckets: every key has a bucket holding up to
+// Burst tokens, which refills at Rate tokens per second. Each request takes
+// one token and is rejected if the bucket is empty.
+
+type Limit struct {
+	Rate  float64 // tokens added per second
+	Burst int     // capacity of the bucket
+}
+
+// Window is the time it takes for an empty bucket to fill up again
+func (l Limit) Window() time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// ParseLimit parses limits of the form "<n>/<unit>", where unit is one of
+// s, m or h, for example "5/m" for 5 requests per minute. The burst is n.
+func ParseLimit(spec string) (Limit, error) {
+	parts := strings.Split(strings.TrimSpace(spec), "/")
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("rate limit must be of the form <n>/<s|m|h>, found %q", spec)
+	}
+
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid number of requests in rate limit %q", spec)
+	}
+
+	var per time.Duration
+	switch parts[1] {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("invalid unit in rate limit %q", spec)
+	}
+
+	return Limit{Rate: float64(n) / per.Seconds(), Burst: n}, nil
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// time until the bucket is full again
+	Reset time.Duration
+	// time until the next token is available, only set if not allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of the buckets. Take removes a token from the bucket
+// of the given key (if one is available) and reports the outcome. Peek
+// reports the outcome Take would have, without taking a token.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	Peek(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// refill returns the tokens of a bucket which had tokens at updated
+func refill(tokens float64, updated time.Time, limit Limit, now time.Time) float64 {
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		return math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+	}
+	return tokens
+}
+
+// result computes the outcome from the number of tokens left in a bucket
+func result(allowed bool, tokens float64, limit Limit) Result {
+	res := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	}
+	return res
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps the buckets in memory. It is only suitable when a
+// single replica of the server is running.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+const sweepInterval = time.Minute
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	if now.After(b.updated) {
+		b.tokens = refill(b.tokens, b.updated, limit, now)
+		b.updated = now
+	}
+
+	if b.tokens < 1 {
+		return result(false, b.tokens, limit), nil
+	}
+	b.tokens--
+	return result(true, b.tokens, limit), nil
+}
+
+func (s *MemoryStore) Peek(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := float64(limit.Burst)
+	if b, ok := s.buckets[key]; ok {
+		tokens = refill(b.tokens, b.updated, limit, now)
+	}
+	return result(tokens >= 1, tokens, limit), nil
+}
+
+// sweep drops the buckets that have not been used for a while, so that
+// the map does not grow with every client that ever made a request.
+// A bucket unused for longer than its window is full, which is the same
+// as having no bucket.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > time.Hour {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("5/m")
+	if err != nil {
+		t.Fatalf("Could not parse a valid limit: %s", err)
+	}
+	if limit.Burst != 5 || limit.Window() != time.Minute {
+		t.Errorf("Unexpected limit parsed: %+v", limit)
+	}
+
+	for _, spec := range []string{"", "5", "0/m", "-1/s", "5/d", "a/m"} {
+		if _, err := ParseLimit(spec); err == nil {
+			t.Errorf("Expected an error when parsing %q", spec)
+		}
+	}
+}
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 2} // 1 request per second, bursts of 2
+	now := time.Now()
+	ctx := context.Background()
+
+	for i := 1; i >= 0; i-- {
+		res, _ := store.Take(ctx, "client", limit, now)
+		if !res.Allowed || res.Remaining != i {
+			t.Errorf("Expected request to be allowed with %d remaining, got %+v", i, res)
+		}
+	}
+
+	res, _ := store.Take(ctx, "client", limit, now)
+	if res.Allowed || res.RetryAfter != time.Second {
+		t.Errorf("Expected request to be rejected for a second, got %+v", res)
+	}
+
+	// other clients have their own bucket
+	if res, _ := store.Take(ctx, "other", limit, now); !res.Allowed {
+		t.Errorf("Expected request of another client to be allowed, got %+v", res)
+	}
+
+	// half a token is not enough
+	if res, _ := store.Take(ctx, "client", limit, now.Add(500*time.Millisecond)); res.Allowed {
+		t.Errorf("Expected request to be rejected after half a second, got %+v", res)
+	}
+
+	if res, _ := store.Take(ctx, "client", limit, now.Add(time.Second)); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("Expected request to be allowed after a second, got %+v", res)
+	}
+}
+
+func TestMemoryStorePeek(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.Now()
+	ctx := context.Background()
+
+	// peeking takes no token
+	for i := 0; i < 2; i++ {
+		if res, _ := store.Peek(ctx, "client", limit, now); !res.Allowed || res.Remaining != 1 {
+			t.Errorf("Expected a full bucket, got %+v", res)
+		}
+	}
+	store.Take(ctx, "client", limit, now)
+	if res, _ := store.Peek(ctx, "client", limit, now); res.Allowed || res.RetryAfter != time.Second {
+		t.Errorf("Expected an empty bucket for a second, got %+v", res)
+	}
+	if res, _ := store.Peek(ctx, "client", limit, now.Add(time.Second)); !res.Allowed {
+		t.Errorf("Expected the bucket to be refilled after a second, got %+v", res)
+	}
+}
@@ -0,0 +1,36 @@
+package search
+
+import "appyinsta/api/models"
+
+// Highlight splits a text into the words which match a term of the query
+// and the text between them. Adjacent segments are merged.
+func Highlight(text, query string) []models.TextSegment {
+	terms := map[string]bool{}
+	for _, term := range Terms(query) {
+		terms[term] = true
+	}
+
+	var segments []models.TextSegment
+	add := func(s string, match bool) {
+		if s == "" {
+			return
+		}
+		if n := len(segments); n > 0 && segments[n-1].Match == match {
+			segments[n-1].Text += s
+			return
+		}
+		segments = append(segments, models.TextSegment{Text: s, Match: match})
+	}
+
+	last := 0
+	for _, token := range Tokenize(text) {
+		if !terms[token.Term] {
+			continue
+		}
+		add(text[last:token.Start], false)
+		add(text[token.Start:token.End], true)
+		last = token.End
+	}
+	add(text[last:], false)
+	return segments
+}
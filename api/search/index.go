@@ -0,0 +1,103 @@
+package search
+
+import (
+	"math"
+	"sort"
+)
+
+// BM25 parameters, with their usual values
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Index is an inverted index of documents identified by strings.
+// It is not safe for concurrent use.
+type Index struct {
+	// postings maps each term to the number of times it appears in each document
+	postings map[string]map[string]int
+	// lengths are the numbers of terms of the documents
+	lengths     map[string]int
+	totalLength int
+}
+
+// Hit is a document matching a query
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+func NewIndex() *Index {
+	return &Index{postings: map[string]map[string]int{}, lengths: map[string]int{}}
+}
+
+// Add indexes the text of a document, replacing its previous text if any
+func (idx *Index) Add(id string, text string) {
+	idx.Remove(id)
+
+	tokens := Tokenize(text)
+	for _, token := range tokens {
+		docs := idx.postings[token.Term]
+		if docs == nil {
+			docs = map[string]int{}
+			idx.postings[token.Term] = docs
+		}
+		docs[id]++
+	}
+	idx.lengths[id] = len(tokens)
+	idx.totalLength += len(tokens)
+}
+
+// Remove removes a document from the index
+func (idx *Index) Remove(id string) {
+	length, ok := idx.lengths[id]
+	if !ok {
+		return
+	}
+	for term, docs := range idx.postings {
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.lengths, id)
+	idx.totalLength -= length
+}
+
+// Search returns the documents which contain at least one of the terms of
+// the query, the most relevant first (and in the order of their IDs for
+// equal scores). Documents are scored with BM25.
+func (idx *Index) Search(query string) []Hit {
+	n := float64(len(idx.lengths))
+	if n == 0 {
+		return nil
+	}
+	avgLength := float64(idx.totalLength) / n
+
+	scores := map[string]float64{}
+	for _, term := range Terms(query) {
+		docs := idx.postings[term]
+		if len(docs) == 0 {
+			continue
+		}
+		df := float64(len(docs))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range docs {
+			f := float64(tf)
+			norm := 1 - bm25B + bm25B*float64(idx.lengths[id])/avgLength
+			scores[id] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
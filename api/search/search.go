@@ -0,0 +1,77 @@
+// Package search implements the text search of the in-memory store:
+// tokenization and stemming of English text, an inverted index ranked with
+// BM25, and the highlighting of the words of a text which match a query.
+// The MongoDB store uses text indexes instead, but highlights the results
+// with Highlight too.
+package search
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is a word of a text. Start and End are the byte offsets of the word
+// in the text, and Term is the stem of the word in lowercase.
+type Token struct {
+	Term       string
+	Start, End int
+}
+
+// stopWords are not indexed, as they match almost every text
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"but": true, "by": true, "for": true, "if": true, "in": true, "into": true, "is": true,
+	"it": true, "no": true, "not": true, "of": true, "on": true, "or": true, "so": true,
+	"such": true, "that": true, "the": true, "their": true, "then": true, "there": true,
+	"these": true, "they": true, "this": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+// Tokenize splits a text into words, which are sequences of letters and
+// digits. Stop words are skipped.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	for i := 0; i <= len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if i < len(text) && (unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)) {
+			if start < 0 {
+				start = i
+			}
+			i += size
+			continue
+		}
+
+		if start >= 0 {
+			if term := normalize(text[start:i]); !stopWords[term] {
+				tokens = append(tokens, Token{Term: Stem(term), Start: start, End: i})
+			}
+			start = -1
+		}
+		if i == len(text) {
+			break
+		}
+		i += size
+	}
+	return tokens
+}
+
+// Terms returns the distinct terms of a query, in the order they appear
+func Terms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, token := range Tokenize(query) {
+		if !seen[token.Term] {
+			seen[token.Term] = true
+			terms = append(terms, token.Term)
+		}
+	}
+	return terms
+}
+
+func normalize(word string) string {
+	runes := []rune(word)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return string(runes)
+}
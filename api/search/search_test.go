@@ -0,0 +1,91 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"appyinsta/api/models"
+)
+
+func TestStem(t *testing.T) {
+	// examples of the definition of the algorithm
+	words := map[string]string{
+		"caresses": "caress", "ponies": "poni", "cats": "cat", "feed": "feed",
+		"agreed": "agre", "plastered": "plaster", "motoring": "motor", "sing": "sing",
+		"hopping": "hop", "falling": "fall", "filing": "file", "happy": "happi",
+		"relational": "relat", "conditional": "condit", "rational": "ration",
+		"hopeful": "hope", "goodness": "good", "adjustment": "adjust", "adoption": "adopt",
+		"generalizations": "gener", "controlling": "control", "posting": "post", "posted": "post",
+		"é": "é", "café": "café",
+	}
+	for word, want := range words {
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, expected %q", word, got, want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("The Sunsets, of Ça-Va 2021!")
+	want := []Token{{"sunset", 4, 11}, {"ça", 16, 19}, {"va", 20, 22}, {"2021", 23, 27}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize returned %v, expected %v", got, want)
+	}
+
+	if terms := Terms("posts and posting, POSTED"); !reflect.DeepEqual(terms, []string{"post"}) {
+		t.Errorf("Terms returned %v", terms)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("1", "A walk on the beach")
+	idx.Add("2", "Beach, beaches and more beaches")
+	idx.Add("3", "Walking in the city at night")
+	idx.Add("4", "Nothing to see here")
+
+	ids := func(hits []Hit) []string {
+		var ids []string
+		for _, hit := range hits {
+			ids = append(ids, hit.ID)
+		}
+		return ids
+	}
+
+	if got := ids(idx.Search("beach")); !reflect.DeepEqual(got, []string{"2", "1"}) {
+		t.Errorf("search of beach returned %v", got)
+	}
+	if got := ids(idx.Search("walks on beaches")); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Errorf("search of walks on beaches returned %v", got)
+	}
+	if got := idx.Search("the"); len(got) != 0 {
+		t.Errorf("search of a stop word returned %v", got)
+	}
+
+	idx.Add("2", "Mountains")
+	idx.Remove("1")
+	if got := idx.Search("beach"); len(got) != 0 {
+		t.Errorf("search after the documents changed returned %v", got)
+	}
+	if got := ids(idx.Search("mountain")); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Errorf("search of mountain returned %v", got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := Highlight("Posting the posts of Ada", "post ada")
+	want := []models.TextSegment{
+		{Text: "Posting", Match: true},
+		{Text: " the "},
+		{Text: "posts", Match: true},
+		{Text: " of "},
+		{Text: "Ada", Match: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Highlight returned %v, expected %v", got, want)
+	}
+
+	if got := Highlight("Nothing", "post"); !reflect.DeepEqual(got, []models.TextSegment{{Text: "Nothing"}}) {
+		t.Errorf("Highlight without matches returned %v", got)
+	}
+}
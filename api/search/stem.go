@@ -0,0 +1,239 @@
+package search
+
+import "strings"
+
+// Stem reduces an English word in lowercase to its stem with the Porter
+// stemming algorithm (https://tartarus.org/martin/PorterStemmer/def.txt),
+// so that "posting", "posted" and "posts" all match "post".
+// Words of one or two letters and words with non-ASCII letters are not changed.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	s := &stemmer{b: []byte(word)}
+	s.step1a()
+	s.step1b()
+	s.step1c()
+	s.step2()
+	s.step3()
+	s.step4()
+	s.step5()
+	return string(s.b)
+}
+
+type stemmer struct {
+	b []byte
+}
+
+// cons reports whether b[i] is a consonant. y is a consonant at the start
+// of a word or after a vowel.
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	}
+	return true
+}
+
+// measure returns the number of vowel-consonant sequences in b[:end]
+func (s *stemmer) measure(end int) int {
+	m := 0
+	i := 0
+	// skip the initial consonants
+	for i < end && s.cons(i) {
+		i++
+	}
+	for i < end {
+		for i < end && !s.cons(i) {
+			i++
+		}
+		if i >= end {
+			break
+		}
+		for i < end && s.cons(i) {
+			i++
+		}
+		m++
+	}
+	return m
+}
+
+// hasVowel reports whether b[:end] contains a vowel
+func (s *stemmer) hasVowel(end int) bool {
+	for i := 0; i < end; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleCons reports whether b[:end] ends with a double consonant
+func (s *stemmer) doubleCons(end int) bool {
+	return end >= 2 && s.b[end-1] == s.b[end-2] && s.cons(end-1)
+}
+
+// cvc reports whether b[:end] ends with consonant-vowel-consonant,
+// where the last consonant is not w, x or y
+func (s *stemmer) cvc(end int) bool {
+	if end < 3 || !s.cons(end-1) || s.cons(end-2) || !s.cons(end-3) {
+		return false
+	}
+	c := s.b[end-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
+
+func (s *stemmer) ends(suffix string) bool {
+	return strings.HasSuffix(string(s.b), suffix)
+}
+
+// stemLen is the length of the word without the suffix
+func (s *stemmer) stemLen(suffix string) int {
+	return len(s.b) - len(suffix)
+}
+
+func (s *stemmer) replace(suffix, with string) {
+	s.b = append(s.b[:s.stemLen(suffix)], with...)
+}
+
+// replaceIfMeasure replaces the suffix if the measure of the stem is greater than m.
+// It reports whether the word ends with the suffix.
+func (s *stemmer) replaceIfMeasure(suffix, with string, m int) bool {
+	if !s.ends(suffix) {
+		return false
+	}
+	if s.measure(s.stemLen(suffix)) > m {
+		s.replace(suffix, with)
+	}
+	return true
+}
+
+// step1a removes plurals: caresses -> caress, ponies -> poni, cats -> cat
+func (s *stemmer) step1a() {
+	switch {
+	case s.ends("sses"):
+		s.replace("sses", "ss")
+	case s.ends("ies"):
+		s.replace("ies", "i")
+	case s.ends("ss"):
+	case s.ends("s"):
+		s.replace("s", "")
+	}
+}
+
+// step1b removes -ed and -ing: agreed -> agree, plastered -> plaster, hopping -> hop
+func (s *stemmer) step1b() {
+	if s.ends("eed") {
+		if s.measure(s.stemLen("eed")) > 0 {
+			s.replace("eed", "ee")
+		}
+		return
+	}
+
+	removed := false
+	for _, suffix := range []string{"ed", "ing"} {
+		if s.ends(suffix) && s.hasVowel(s.stemLen(suffix)) {
+			s.replace(suffix, "")
+			removed = true
+			break
+		}
+	}
+	if !removed {
+		return
+	}
+
+	switch {
+	case s.ends("at"), s.ends("bl"), s.ends("iz"):
+		s.b = append(s.b, 'e')
+	case s.doubleCons(len(s.b)):
+		if c := s.b[len(s.b)-1]; c != 'l' && c != 's' && c != 'z' {
+			s.b = s.b[:len(s.b)-1]
+		}
+	case s.measure(len(s.b)) == 1 && s.cvc(len(s.b)):
+		s.b = append(s.b, 'e')
+	}
+}
+
+// step1c turns a final y into i when there is a vowel before it: happy -> happi
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.hasVowel(s.stemLen("y")) {
+		s.replace("y", "i")
+	}
+}
+
+var step2Suffixes = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"abli", "able"}, {"alli", "al"}, {"entli", "ent"},
+	{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+	{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+}
+
+// step2 maps double suffixes to single ones: relational -> relate
+func (s *stemmer) step2() {
+	for _, r := range step2Suffixes {
+		if s.replaceIfMeasure(r[0], r[1], 0) {
+			return
+		}
+	}
+}
+
+var step3Suffixes = [][2]string{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+// step3 handles -ic-, -full, -ness: hopeful -> hope, goodness -> good
+func (s *stemmer) step3() {
+	for _, r := range step3Suffixes {
+		if s.replaceIfMeasure(r[0], r[1], 0) {
+			return
+		}
+	}
+}
+
+var step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+// step4 removes the remaining suffixes of longer stems: adjustment -> adjust.
+// Only the first suffix of the list which the word ends with is considered,
+// so ement and ment come before ent.
+func (s *stemmer) step4() {
+	for _, suffix := range step4Suffixes {
+		if !s.ends(suffix) {
+			continue
+		}
+		end := s.stemLen(suffix)
+		if s.measure(end) <= 1 {
+			return
+		}
+		if suffix == "ion" && (end == 0 || (s.b[end-1] != 's' && s.b[end-1] != 't')) {
+			return
+		}
+		s.b = s.b[:end]
+		return
+	}
+}
+
+// step5 removes a final e and reduces a final ll: probate -> probat, controll -> control
+func (s *stemmer) step5() {
+	if s.ends("e") {
+		end := s.stemLen("e")
+		if m := s.measure(end); m > 1 || (m == 1 && !s.cvc(end)) {
+			s.b = s.b[:end]
+		}
+	}
+	if s.ends("ll") && s.measure(len(s.b)) > 1 {
+		s.b = s.b[:len(s.b)-1]
+	}
+}
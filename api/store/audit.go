@@ -0,0 +1,301 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The audit log is kept in the "audit_log" collection, which is only
+// appended to. Its entries have increasing sequence numbers as IDs, and the
+// last one and its hash are kept apart, see AuditHead. An entry is inserted
+// before the head is moved to it, so the head may lag behind the log, but
+// never runs ahead of it.
+
+// ErrAuditTampered is returned by VerifyAuditLog when an entry of the log
+// was changed or deleted
+var ErrAuditTampered = errors.New("store: the audit log was tampered with")
+
+// AuditFilter selects the entries of the audit log. The zero values match
+// every entry.
+type AuditFilter struct {
+	Action     string
+	Collection string
+	TargetID   *primitive.ObjectID
+	Actor      string
+	ActorID    *primitive.ObjectID
+	RequestID  string
+	// the entries created in [Since, Until)
+	Since, Until time.Time
+	// the entries with a lower sequence number, for the pagination
+	Before int64
+}
+
+func (f AuditFilter) match(e models.AuditEntry) bool {
+	return (f.Action == "" || e.Action == f.Action) &&
+		(f.Collection == "" || e.Collection == f.Collection) &&
+		(f.TargetID == nil || (e.TargetID != nil && *e.TargetID == *f.TargetID)) &&
+		(f.Actor == "" || e.Actor == f.Actor) &&
+		(f.ActorID == nil || (e.ActorID != nil && *e.ActorID == *f.ActorID)) &&
+		(f.RequestID == "" || e.RequestID == f.RequestID) &&
+		(f.Since.IsZero() || !e.CreatedOn.Before(f.Since)) &&
+		(f.Until.IsZero() || e.CreatedOn.Before(f.Until)) &&
+		(f.Before == 0 || e.Seq < f.Before)
+}
+
+func (f AuditFilter) bson() bson.D {
+	filter := bson.D{}
+	for _, field := range []struct{ key, value string }{
+		{"action", f.Action}, {"collection", f.Collection}, {"actor", f.Actor}, {"request_id", f.RequestID},
+	} {
+		if field.value != "" {
+			filter = append(filter, bson.E{Key: field.key, Value: field.value})
+		}
+	}
+	if f.TargetID != nil {
+		filter = append(filter, bson.E{Key: "target_id", Value: *f.TargetID})
+	}
+	if f.ActorID != nil {
+		filter = append(filter, bson.E{Key: "actor_id", Value: *f.ActorID})
+	}
+	createdOn := bson.D{}
+	if !f.Since.IsZero() {
+		createdOn = append(createdOn, bson.E{Key: "$gte", Value: f.Since})
+	}
+	if !f.Until.IsZero() {
+		createdOn = append(createdOn, bson.E{Key: "$lt", Value: f.Until})
+	}
+	if len(createdOn) > 0 {
+		filter = append(filter, bson.E{Key: "created_on", Value: createdOn})
+	}
+	if f.Before != 0 {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$lt", Value: f.Before}}})
+	}
+	return filter
+}
+
+// HashAuditEntry returns the hash of an entry, which covers all its fields
+// but the hash itself, including the hash of the previous entry
+func HashAuditEntry(entry models.AuditEntry) string {
+	entry.Hash = ""
+	// the keys of the changes are sorted by the encoding
+	b, err := json.Marshal(entry)
+	if err != nil {
+		// the changes are decoded JSON values, see audit.Diff
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// nextAuditEntry numbers an entry after the head of the log, and chains it
+// to the head if chain is set or the head is chained: once the log is
+// chained, all the entries after are, see VerifyAuditLog
+func nextAuditEntry(entry *models.AuditEntry, head AuditHead, chain bool) {
+	// the times are stored in milliseconds, and must be hashed like they are read
+	if entry.CreatedOn.IsZero() {
+		entry.CreatedOn = time.Now()
+	}
+	entry.CreatedOn = entry.CreatedOn.UTC().Truncate(time.Millisecond)
+	entry.Seq = head.Seq + 1
+	entry.PrevHash, entry.Hash = "", ""
+	if chain || head.Hash != "" {
+		entry.PrevHash = head.Hash
+		entry.Hash = HashAuditEntry(*entry)
+	}
+}
+
+// VerifyAuditLog checks the hashes of the chained entries of the audit log,
+// that the entries after the first chained one are all chained, that no
+// the entries after it were inserted, but the head was not moved yet. It
+// the entries after it were appended before the head was moved. It
+// returns the number of entries. The error wraps ErrAuditTampered if the
+// log was tampered with.
+func VerifyAuditLog(ctx context.Context, st Store) (int64, error) {
+	// the head is read first: the entries appended meanwhile come after it
+	stored, err := st.GetAuditHead(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var head AuditHead
+	for {
+		entries, err := st.ReadAuditEntries(ctx, head.Seq, 500)
+		if err != nil {
+			return head.Seq, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		for _, e := range entries {
+			switch {
+			case e.Seq != head.Seq+1:
+				return head.Seq, fmt.Errorf("%w: the entries after %d are missing", ErrAuditTampered, head.Seq)
+			case e.Hash == "" && head.Hash != "":
+				return head.Seq, fmt.Errorf("%w: entry %d is not chained", ErrAuditTampered, e.Seq)
+			case e.Hash != "" && (e.PrevHash != head.Hash || e.Hash != HashAuditEntry(e)):
+				return head.Seq, fmt.Errorf("%w: the hash of entry %d does not match", ErrAuditTampered, e.Seq)
+			case e.Seq == stored.Seq && e.Hash != stored.Hash:
+				return head.Seq, fmt.Errorf("%w: entry %d is not the head of the log", ErrAuditTampered, e.Seq)
+			}
+			head = AuditHead{Seq: e.Seq, Hash: e.Hash}
+		}
+	}
+	if head.Seq < stored.Seq {
+		return head.Seq, fmt.Errorf("%w: the entries after %d are missing", ErrAuditTampered, head.Seq)
+	}
+	return head.Seq, nil
+}
+
+// AuditHead is the sequence number and the hash of the last entry of the
+// audit log, kept in the "audit_log" document of the "counters" collection
+type AuditHead struct {
+	Seq  int64  `bson:"seq"`
+	Hash string `bson:"hash"`
+}
+
+// the number of times an entry is numbered again when other entries are
+// appended at the same time
+const maxAuditAttempts = 10
+
+func (s *MongoStore) GetAuditHead(ctx context.Context) (AuditHead, error) {
+	var head AuditHead
+	err := s.DB.Collection("counters").FindOne(ctx, bson.D{{Key: "_id", Value: "audit_log"}}).Decode(&head)
+	if err == mongo.ErrNoDocuments {
+		return head, nil
+	}
+	return head, err
+}
+
+func (s *MongoStore) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry, chain bool) error {
+	for attempt := 1; ; attempt++ {
+		head, err := s.lastAuditEntry(ctx)
+		if err != nil {
+			return err
+		}
+		nextAuditEntry(entry, head, chain)
+
+		// the sequence number is the ID of the entry, so the insert fails on
+		// the duplicate ID if another entry was appended since the head was
+		// read. A failed insert leaves neither an entry nor a gap behind it.
+		_, err = s.DB.Collection("audit_log").InsertOne(ctx, entry)
+		if mongo.IsDuplicateKeyError(err) && attempt < maxAuditAttempts {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return s.moveAuditHead(ctx, AuditHead{Seq: entry.Seq, Hash: entry.Hash})
+	}
+}
+
+// lastAuditEntry returns the head of the log, or the last entry after it:
+// the head is moved after the entry is inserted, and may not have been yet
+func (s *MongoStore) lastAuditEntry(ctx context.Context) (AuditHead, error) {
+	head, err := s.GetAuditHead(ctx)
+	if err != nil {
+		return head, err
+	}
+	var last models.AuditEntry
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: head.Seq}}}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})
+	err = s.DB.Collection("audit_log").FindOne(ctx, filter, opts).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return head, nil
+	}
+	if err != nil {
+		return head, err
+	}
+	return AuditHead{Seq: last.Seq, Hash: last.Hash}, nil
+}
+
+// moveAuditHead moves the head of the log forward to an entry, unless a
+// later entry already moved it further
+func (s *MongoStore) moveAuditHead(ctx context.Context, head AuditHead) error {
+	filter := bson.D{{Key: "_id", Value: "audit_log"}, {Key: "seq", Value: bson.D{{Key: "$lt", Value: head.Seq}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "seq", Value: head.Seq}, {Key: "hash", Value: head.Hash}}}}
+	_, err := s.DB.Collection("counters").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// the head is already at or after the entry
+		return nil
+	}
+	return err
+}
+
+func (s *MongoStore) ListAuditEntries(ctx context.Context, filter AuditFilter, limit int64) ([]models.AuditEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+	return s.findAuditEntries(ctx, filter.bson(), opts)
+}
+
+func (s *MongoStore) ReadAuditEntries(ctx context.Context, afterSeq int64, limit int64) ([]models.AuditEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit)
+	return s.findAuditEntries(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: afterSeq}}}}, opts)
+}
+
+func (s *MongoStore) findAuditEntries(ctx context.Context, filter bson.D, opts *options.FindOptions) ([]models.AuditEntry, error) {
+	cursor, err := s.DB.Collection("audit_log").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.AuditEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry, chain bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nextAuditEntry(entry, s.auditHead, chain)
+	s.auditLog = append(s.auditLog, *entry)
+	s.auditHead = AuditHead{Seq: entry.Seq, Hash: entry.Hash}
+	return nil
+}
+
+func (s *MemoryStore) GetAuditHead(ctx context.Context) (AuditHead, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.auditHead, nil
+}
+
+func (s *MemoryStore) ListAuditEntries(ctx context.Context, filter AuditFilter, limit int64) ([]models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []models.AuditEntry
+	for i := len(s.auditLog) - 1; i >= 0 && int64(len(entries)) < limit; i-- {
+		if filter.match(s.auditLog[i]) {
+			entries = append(entries, s.auditLog[i])
+		}
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) ReadAuditEntries(ctx context.Context, afterSeq int64, limit int64) ([]models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []models.AuditEntry
+	for _, e := range s.auditLog {
+		if int64(len(entries)) == limit {
+			break
+		}
+		if e.Seq > afterSeq {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
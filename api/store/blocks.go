@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// relation is a document of the "blocks" and "mutes" collections: the
+// user From blocks or mutes the user To
+type relation struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	From      primitive.ObjectID `bson:"from"`
+	To        primitive.ObjectID `bson:"to"`
+	CreatedOn time.Time          `bson:"created_on"`
+}
+
+func (s *MongoStore) Block(ctx context.Context, blockerID, blockedID primitive.ObjectID) (bool, error) {
+	created, err := s.addRelation(ctx, "blocks", blockerID, blockedID)
+	if err != nil {
+		return false, err
+	}
+	_, err = s.DB.Collection("follows").DeleteMany(ctx, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "follower", Value: blockerID}, {Key: "followee", Value: blockedID}},
+		bson.D{{Key: "follower", Value: blockedID}, {Key: "followee", Value: blockerID}},
+	}}})
+	return created, err
+}
+
+func (s *MongoStore) Unblock(ctx context.Context, blockerID, blockedID primitive.ObjectID) (bool, error) {
+	return s.deleteRelation(ctx, "blocks", blockerID, blockedID)
+}
+
+func (s *MongoStore) ListBlocks(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	relations, err := s.findRelations(ctx, "blocks", bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "from", Value: userID}},
+		bson.D{{Key: "to", Value: userID}},
+	}}})
+	ids := make([]primitive.ObjectID, len(relations))
+	for i, r := range relations {
+		ids[i] = r.To
+		if r.To == userID {
+			ids[i] = r.From
+		}
+	}
+	return ids, err
+}
+
+func (s *MongoStore) Mute(ctx context.Context, muterID, mutedID primitive.ObjectID) (bool, error) {
+	return s.addRelation(ctx, "mutes", muterID, mutedID)
+}
+
+func (s *MongoStore) Unmute(ctx context.Context, muterID, mutedID primitive.ObjectID) (bool, error) {
+	return s.deleteRelation(ctx, "mutes", muterID, mutedID)
+}
+
+func (s *MongoStore) ListMuted(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	relations, err := s.findRelations(ctx, "mutes", bson.D{{Key: "from", Value: userID}})
+	ids := make([]primitive.ObjectID, len(relations))
+	for i, r := range relations {
+		ids[i] = r.To
+	}
+	return ids, err
+}
+
+func (s *MongoStore) ListMutedBy(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	relations, err := s.findRelations(ctx, "mutes", bson.D{{Key: "to", Value: userID}})
+	ids := make([]primitive.ObjectID, len(relations))
+	for i, r := range relations {
+		ids[i] = r.From
+	}
+	return ids, err
+}
+
+// addRelation reports whether the relation did not exist
+func (s *MongoStore) addRelation(ctx context.Context, collection string, from, to primitive.ObjectID) (bool, error) {
+	_, err := s.DB.Collection(collection).InsertOne(ctx, relation{From: from, To: to, CreatedOn: time.Now().UTC()})
+	// the unique index on from and to
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *MongoStore) deleteRelation(ctx context.Context, collection string, from, to primitive.ObjectID) (bool, error) {
+	res, err := s.DB.Collection(collection).DeleteOne(ctx, bson.D{{Key: "from", Value: from}, {Key: "to", Value: to}})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+func (s *MongoStore) findRelations(ctx context.Context, collection string, filter bson.D) ([]relation, error) {
+	cursor, err := s.DB.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var relations []relation
+	if err := cursor.All(ctx, &relations); err != nil {
+		return nil, err
+	}
+	return relations, nil
+}
+
+// relationKey is the key of the blocks and mutes of a MemoryStore
+type relationKey struct {
+	from, to primitive.ObjectID
+}
+
+func (s *MemoryStore) Block(ctx context.Context, blockerID, blockedID primitive.ObjectID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.follows, followKey{blockerID, blockedID})
+	delete(s.follows, followKey{blockedID, blockerID})
+	return addRelation(s.blocks, blockerID, blockedID), nil
+}
+
+func (s *MemoryStore) Unblock(ctx context.Context, blockerID, blockedID primitive.ObjectID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return deleteRelation(s.blocks, blockerID, blockedID), nil
+}
+
+func (s *MemoryStore) ListBlocks(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []primitive.ObjectID
+	for key := range s.blocks {
+		if key.from == userID {
+			ids = append(ids, key.to)
+		} else if key.to == userID {
+			ids = append(ids, key.from)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) Mute(ctx context.Context, muterID, mutedID primitive.ObjectID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return addRelation(s.mutes, muterID, mutedID), nil
+}
+
+func (s *MemoryStore) Unmute(ctx context.Context, muterID, mutedID primitive.ObjectID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return deleteRelation(s.mutes, muterID, mutedID), nil
+}
+
+func (s *MemoryStore) ListMuted(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []primitive.ObjectID
+	for key := range s.mutes {
+		if key.from == userID {
+			ids = append(ids, key.to)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) ListMutedBy(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []primitive.ObjectID
+	for key := range s.mutes {
+		if key.to == userID {
+			ids = append(ids, key.from)
+		}
+	}
+	return ids, nil
+}
+
+func addRelation(relations map[relationKey]time.Time, from, to primitive.ObjectID) bool {
+	key := relationKey{from, to}
+	if _, ok := relations[key]; ok {
+		return false
+	}
+	relations[key] = time.Now().UTC()
+	return true
+}
+
+func deleteRelation(relations map[relationKey]time.Time, from, to primitive.ObjectID) bool {
+	key := relationKey{from, to}
+	_, ok := relations[key]
+	delete(relations, key)
+	return ok
+}
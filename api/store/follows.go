@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// follow is a document of the "follows" collection. A pending follow is a
+// request to follow a private user, who has not accepted it yet.
+type follow struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	FollowerID primitive.ObjectID `bson:"follower"`
+	FolloweeID primitive.ObjectID `bson:"followee"`
+	Pending    bool               `bson:"pending,omitempty"`
+	CreatedOn  time.Time          `bson:"created_on"`
+}
+
+// the follows which are not pending, which did not have the field before the requests
+var accepted = bson.E{Key: "pending", Value: bson.D{{Key: "$ne", Value: true}}}
+
+func (s *MongoStore) Follow(ctx context.Context, followerID, followeeID primitive.ObjectID, pending bool) (bool, error) {
+	_, err := s.DB.Collection("follows").InsertOne(ctx, follow{FollowerID: followerID, FolloweeID: followeeID, Pending: pending, CreatedOn: time.Now().UTC()})
+	// the unique index on follower and followee
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *MongoStore) AcceptFollow(ctx context.Context, followerID, followeeID primitive.ObjectID) (bool, error) {
+	filter := bson.D{{Key: "follower", Value: followerID}, {Key: "followee", Value: followeeID}, {Key: "pending", Value: true}}
+	res, err := s.DB.Collection("follows").UpdateOne(ctx, filter, bson.D{{Key: "$unset", Value: bson.D{{Key: "pending", Value: ""}}}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+func (s *MongoStore) Unfollow(ctx context.Context, followerID, followeeID primitive.ObjectID) (bool, error) {
+	res, err := s.DB.Collection("follows").DeleteOne(ctx, bson.D{{Key: "follower", Value: followerID}, {Key: "followee", Value: followeeID}})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+func (s *MongoStore) GetFollowStatus(ctx context.Context, followerID, followeeID primitive.ObjectID) (models.FollowStatus, error) {
+	var f follow
+	err := s.DB.Collection("follows").FindOne(ctx, bson.D{{Key: "follower", Value: followerID}, {Key: "followee", Value: followeeID}}).Decode(&f)
+	if err == mongo.ErrNoDocuments {
+		return models.FollowStatus{}, nil
+	} else if err != nil {
+		return models.FollowStatus{}, err
+	}
+	return models.FollowStatus{Following: !f.Pending, Requested: f.Pending}, nil
+}
+
+func (s *MongoStore) ListFollowers(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	follows, err := s.findFollows(ctx, bson.D{{Key: "followee", Value: userID}, accepted})
+	ids := make([]primitive.ObjectID, len(follows))
+	for i, f := range follows {
+		ids[i] = f.FollowerID
+	}
+	return ids, err
+}
+
+func (s *MongoStore) ListFollowing(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	follows, err := s.findFollows(ctx, bson.D{{Key: "follower", Value: userID}, accepted})
+	ids := make([]primitive.ObjectID, len(follows))
+	for i, f := range follows {
+		ids[i] = f.FolloweeID
+	}
+	return ids, err
+}
+
+func (s *MongoStore) ListFollowRequests(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	follows, err := s.findFollows(ctx, bson.D{{Key: "followee", Value: userID}, {Key: "pending", Value: true}}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	ids := make([]primitive.ObjectID, len(follows))
+	for i, f := range follows {
+		ids[i] = f.FollowerID
+	}
+	return ids, err
+}
+
+func (s *MongoStore) findFollows(ctx context.Context, filter bson.D, opts ...*options.FindOptions) ([]follow, error) {
+	cursor, err := s.DB.Collection("follows").Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var follows []follow
+	if err := cursor.All(ctx, &follows); err != nil {
+		return nil, err
+	}
+	return follows, nil
+}
+
+type followKey struct {
+	follower, followee primitive.ObjectID
+}
+
+func (s *MemoryStore) Follow(ctx context.Context, followerID, followeeID primitive.ObjectID, pending bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := followKey{followerID, followeeID}
+	if _, ok := s.follows[key]; ok {
+		return false, nil
+	}
+	s.follows[key] = follow{FollowerID: followerID, FolloweeID: followeeID, Pending: pending, CreatedOn: time.Now().UTC()}
+	return true, nil
+}
+
+func (s *MemoryStore) AcceptFollow(ctx context.Context, followerID, followeeID primitive.ObjectID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := followKey{followerID, followeeID}
+	f, ok := s.follows[key]
+	if !ok || !f.Pending {
+		return false, nil
+	}
+	f.Pending = false
+	s.follows[key] = f
+	return true, nil
+}
+
+func (s *MemoryStore) GetFollowStatus(ctx context.Context, followerID, followeeID primitive.ObjectID) (models.FollowStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.follows[followKey{followerID, followeeID}]
+	if !ok {
+		return models.FollowStatus{}, nil
+	}
+	return models.FollowStatus{Following: !f.Pending, Requested: f.Pending}, nil
+}
+
+func (s *MemoryStore) ListFollowers(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var ids []primitive.ObjectID
+	for _, f := range s.findFollows(func(f follow) bool { return f.FolloweeID == userID && !f.Pending }) {
+		ids = append(ids, f.FollowerID)
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) ListFollowing(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var ids []primitive.ObjectID
+	for _, f := range s.findFollows(func(f follow) bool { return f.FollowerID == userID && !f.Pending }) {
+		ids = append(ids, f.FolloweeID)
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) ListFollowRequests(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	requests := s.findFollows(func(f follow) bool { return f.FolloweeID == userID && f.Pending })
+	sort.Slice(requests, func(i, j int) bool { return requests[i].CreatedOn.Before(requests[j].CreatedOn) })
+	var ids []primitive.ObjectID
+	for _, f := range requests {
+		ids = append(ids, f.FollowerID)
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) findFollows(match func(follow) bool) []follow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var follows []follow
+	for _, f := range s.follows {
+		if match(f) {
+			follows = append(follows, f)
+		}
+	}
+	return follows
+}
+
+func (s *MemoryStore) Unfollow(ctx context.Context, followerID, followeeID primitive.ObjectID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := followKey{followerID, followeeID}
+	_, ok := s.follows[key]
+	delete(s.follows, key)
+	return ok, nil
+}
@@ -0,0 +1,295 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/search"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps users and posts in memory. It behaves like MongoStore
+// (posts are listed in the order they were inserted) and is used in tests.
+// User names and post captions are searched with inverted indexes,
+// keyed by the IDs in hexadecimal.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]models.User
+	posts []models.Post
+
+	userIndex *search.Index
+	postIndex *search.Index
+
+	follows       map[followKey]follow
+	blocks        map[relationKey]time.Time
+	mutes         map[relationKey]time.Time
+	notifications []models.Notification
+
+	webhooks   []models.Webhook
+	deliveries []models.Delivery
+
+	reports       []models.Report
+	moderationLog []models.ModerationAction
+	auditLog      []models.AuditEntry
+	auditHead     AuditHead
+
+	outbox       []events.Event
+	eventOffsets map[string]eventOffset
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:     map[primitive.ObjectID]models.User{},
+		userIndex: search.NewIndex(),
+		postIndex: search.NewIndex(),
+		follows:   map[followKey]follow{},
+		blocks:    map[relationKey]time.Time{},
+		mutes:     map[relationKey]time.Time{},
+
+		eventOffsets: map[string]eventOffset{},
+	}
+}
+
+func (s *MemoryStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usernameTaken(user.Username, primitive.NilObjectID) {
+		return ErrDuplicateUsername
+	}
+	user.UserID = primitive.NewObjectID()
+	s.users[user.UserID] = *user
+	s.userIndex.Add(user.UserID.Hex(), user.Name)
+	return nil
+}
+
+func (s *MemoryStore) GetUser(ctx context.Context, userID primitive.ObjectID) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryStore) GetUsers(ctx context.Context, userIDs []primitive.ObjectID) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []models.User
+	for _, id := range userIDs {
+		if user, ok := s.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) ListUsers(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []models.User
+	for _, user := range s.users {
+		if bytes.Compare(user.UserID[:], afterID[:]) > 0 {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return bytes.Compare(users[i].UserID[:], users[j].UserID[:]) < 0 })
+	if limit > 0 && int64(len(users)) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) SetUserDisabled(ctx context.Context, userID primitive.ObjectID, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Disabled = disabled
+	s.users[userID] = user
+	return nil
+}
+
+func (s *MemoryStore) InsertUsers(ctx context.Context, users []models.User, onConflict OnConflict) (InsertResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res InsertResult
+	for _, user := range users {
+		if s.usernameTaken(user.Username, user.UserID) {
+			return res, fmt.Errorf("%w: user %s", ErrDuplicateUsername, user.UserID.Hex())
+		}
+		if _, ok := s.users[user.UserID]; ok {
+			switch onConflict {
+			case ConflictSkip:
+				res.Skipped++
+				continue
+			case ConflictUpsert:
+				res.Replaced++
+			default:
+				return res, fmt.Errorf("%w: user %s", ErrDuplicateID, user.UserID.Hex())
+			}
+		} else {
+			res.Inserted++
+		}
+		s.users[user.UserID] = user
+		s.userIndex.Add(user.UserID.Hex(), user.Name)
+	}
+	return res, nil
+}
+
+// usernameTaken reports whether a user other than userID has the username,
+// like the unique index of MongoStore
+func (s *MemoryStore) usernameTaken(username string, userID primitive.ObjectID) bool {
+	if username == "" {
+		return false
+	}
+	for _, user := range s.users {
+		if user.Username == username && user.UserID != userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) CreatePost(ctx context.Context, post *models.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post.PostID = primitive.NewObjectID()
+	s.posts = append(s.posts, *post)
+	s.postIndex.Add(post.PostID.Hex(), post.Caption)
+	return nil
+}
+
+func (s *MemoryStore) GetPost(ctx context.Context, postID primitive.ObjectID) (models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, post := range s.posts {
+		if post.PostID == postID {
+			return post, nil
+		}
+	}
+	return models.Post{}, ErrNotFound
+}
+
+func (s *MemoryStore) GetPosts(ctx context.Context, postIDs []primitive.ObjectID) ([]models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := map[primitive.ObjectID]bool{}
+	for _, id := range postIDs {
+		wanted[id] = true
+	}
+	var posts []models.Post
+	for _, post := range s.posts {
+		if wanted[post.PostID] {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+func (s *MemoryStore) ListPosts(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var posts []models.Post
+	for _, post := range s.posts {
+		if bytes.Compare(post.PostID[:], afterID[:]) > 0 {
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return bytes.Compare(posts[i].PostID[:], posts[j].PostID[:]) < 0 })
+	if limit > 0 && int64(len(posts)) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+func (s *MemoryStore) DeletePost(ctx context.Context, postID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, post := range s.posts {
+		if post.PostID == postID {
+			s.posts = append(s.posts[:i], s.posts[i+1:]...)
+			s.postIndex.Remove(postID.Hex())
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) InsertPosts(ctx context.Context, posts []models.Post, onConflict OnConflict) (InsertResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res InsertResult
+posts:
+	for _, post := range posts {
+		for i, existing := range s.posts {
+			if existing.PostID != post.PostID {
+				continue
+			}
+			switch onConflict {
+			case ConflictSkip:
+				res.Skipped++
+			case ConflictUpsert:
+				res.Replaced++
+				s.posts[i] = post
+				s.postIndex.Add(post.PostID.Hex(), post.Caption)
+			default:
+				return res, fmt.Errorf("%w: post %s", ErrDuplicateID, post.PostID.Hex())
+			}
+			continue posts
+		}
+		res.Inserted++
+		s.posts = append(s.posts, post)
+		s.postIndex.Add(post.PostID.Hex(), post.Caption)
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) ListUserPosts(ctx context.Context, viewer *Viewer, userID primitive.ObjectID, pagInfo models.PostPaginationInfo) ([]models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var posts []models.Post
+	for _, post := range s.posts {
+		if post.PostedByUID != userID || !viewer.CanSee(post) {
+			continue
+		}
+		if !pagInfo.FirstRequest && !postAfter(pagInfo.LastPostedOn, pagInfo.LastPostID, post) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+	sort.Slice(posts, func(i, j int) bool { return postAfter(posts[i].PostedOn, posts[i].PostID, posts[j]) })
+	// like in MongoDB, a limit of 0 means no limit
+	if pagInfo.NumberOfNewPosts > 0 && int64(len(posts)) > pagInfo.NumberOfNewPosts {
+		posts = posts[:pagInfo.NumberOfNewPosts]
+	}
+	return posts, nil
+}
+
+// postAfter reports whether a post comes after the (posted_on, _id) of
+// another one in the order of ListUserPosts
+func postAfter(postedOn time.Time, postID primitive.ObjectID, post models.Post) bool {
+	return post.PostedOn.After(postedOn) || (post.PostedOn.Equal(postedOn) && bytes.Compare(post.PostID[:], postID[:]) > 0)
+}
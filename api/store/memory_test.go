@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryStoreUsers(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+
+	user := models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "hash"}
+	if err := s.CreateUser(ctx, &user); err != nil || user.UserID.IsZero() {
+		t.Fatalf("CreateUser: %v, id %v", err, user.UserID)
+	}
+
+	got, err := s.GetUser(ctx, user.UserID)
+	if err != nil || got != user {
+		t.Errorf("GetUser returned %v, %v", got, err)
+	}
+	if _, err := s.GetUser(ctx, primitive.NewObjectID()); err != ErrNotFound {
+		t.Errorf("GetUser of an unknown user returned %v", err)
+	}
+
+	users, err := s.GetUsers(ctx, []primitive.ObjectID{primitive.NewObjectID(), user.UserID})
+	if err != nil || len(users) != 1 || users[0] != user {
+		t.Errorf("GetUsers returned %v, %v", users, err)
+	}
+}
+
+func TestMemoryStorePosts(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	start := time.Date(2021, 10, 9, 12, 0, 0, 0, time.UTC)
+
+	var ids []primitive.ObjectID
+	for i := 0; i < 5; i++ {
+		post := models.Post{PostedByUID: userID, Caption: "post", ImgURL: "img", PostedOn: start.Add(time.Duration(i) * time.Minute)}
+		s.CreatePost(ctx, &post)
+		ids = append(ids, post.PostID)
+	}
+	s.CreatePost(ctx, &models.Post{PostedByUID: primitive.NewObjectID(), PostedOn: start})
+
+	if post, err := s.GetPost(ctx, ids[2]); err != nil || post.PostID != ids[2] {
+		t.Errorf("GetPost returned %v, %v", post, err)
+	}
+
+	first, _ := s.ListUserPosts(ctx, nil, userID, models.PostPaginationInfo{NumberOfNewPosts: 2, FirstRequest: true})
+	if len(first) != 2 || first[0].PostID != ids[0] || first[1].PostID != ids[1] {
+		t.Fatalf("first page: %v", first)
+	}
+
+	next, _ := s.ListUserPosts(ctx, nil, userID, models.PostPaginationInfo{LastPostID: ids[1], LastPostedOn: first[1].PostedOn, NumberOfNewPosts: 10})
+	if len(next) != 3 || next[0].PostID != ids[2] {
+		t.Errorf("next page: %v", next)
+	}
+}
+
+func TestMemoryStoreSearch(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+
+	var ids []primitive.ObjectID
+	for _, caption := range []string{"Sunset at the beach", "Beaches", "A city", "Walking on the beach at sunset"} {
+		post := models.Post{Caption: caption}
+		s.CreatePost(ctx, &post)
+		ids = append(ids, post.PostID)
+	}
+	s.InsertUsers(ctx, []models.User{{UserID: primitive.NewObjectID(), Name: "Ada Beach"}}, ConflictError)
+
+	var got []primitive.ObjectID
+	opts := SearchOptions{Limit: 2}
+	for {
+		hits, err := s.SearchPosts(ctx, "beach sunsets", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, hit := range hits {
+			got = append(got, hit.Post.PostID)
+		}
+		if int64(len(hits)) < opts.Limit {
+			break
+		}
+		last := hits[len(hits)-1]
+		opts.After = &SearchCursor{Score: last.Score, ID: last.Post.PostID}
+	}
+	if want := []primitive.ObjectID{ids[0], ids[3], ids[1]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchPosts returned %v, expected %v", got, want)
+	}
+
+	s.DeletePost(ctx, ids[0])
+	if hits, _ := s.SearchPosts(ctx, "sunset", SearchOptions{}); len(hits) != 1 || hits[0].Post.PostID != ids[3] {
+		t.Errorf("SearchPosts after a deletion returned %v", hits)
+	}
+	if hits, _ := s.SearchUsers(ctx, "beach", SearchOptions{}); len(hits) != 1 || hits[0].User.Name != "Ada Beach" {
+		t.Errorf("SearchUsers returned %v", hits)
+	}
+}
+
+func TestMemoryStoreOutbox(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	postID := primitive.NewObjectID()
+
+	failed := errors.New("failed")
+	if err := Record(ctx, s, func(ctx context.Context) ([]events.Event, error) {
+		return nil, failed
+	}); err != failed {
+		t.Errorf("Record returned %v", err)
+	}
+	for _, eventType := range []string{events.Posted, events.PostDeleted} {
+		if err := Record(ctx, s, func(ctx context.Context) ([]events.Event, error) {
+			return []events.Event{{Type: eventType, Post: postID}}, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first delivery of the post fails, and it is delivered again
+	var got []string
+	bus := events.NewBus()
+	bus.Subscribe(func(ctx context.Context, event events.Event) error {
+		got = append(got, event.Type)
+		if len(got) == 1 {
+			return failed
+		}
+		return nil
+	})
+	dispatcher := events.NewDispatcher(s, bus, "test")
+	if n, err := dispatcher.RunOnce(ctx); n != 0 || err == nil {
+		t.Errorf("the failed run delivered %d events, %v", n, err)
+	}
+	if n, err := dispatcher.RunOnce(ctx); n != 2 || err != nil {
+		t.Errorf("the run delivered %d events, %v", n, err)
+	}
+	if want := []string{events.Posted, events.Posted, events.PostDeleted}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %q, expected %q", got, want)
+	}
+
+	// another dispatcher waits for the lease, and then starts from the offset
+	other := events.NewDispatcher(s, bus, "test")
+	if n, err := other.RunOnce(ctx); n != 0 || err != nil {
+		t.Errorf("the dispatcher without the lease delivered %d events, %v", n, err)
+	}
+	now := time.Now().Add(time.Minute)
+	offset, ok, err := s.AcquireEventLease(ctx, "test", "other", now, now.Add(time.Minute))
+	if offset != 2 || !ok || err != nil {
+		t.Errorf("AcquireEventLease after the lease returned %d, %v, %v", offset, ok, err)
+	}
+	if err := s.SetEventOffset(ctx, "test", "owner", 2, now); err != ErrLeaseLost {
+		t.Errorf("SetEventOffset without the lease returned %v", err)
+	}
+}
+
+func TestMemoryStoreAuditLog(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+
+	// the first entry is not chained, like the ones before the chain was enabled
+	for i, action := range []string{"users.create", "users.privacy", "posts.create", "posts.delete"} {
+		entry := models.AuditEntry{Action: action, Actor: models.ActorUser, ActorID: &userID,
+			Changes: map[string]models.AuditChange{"caption": {Before: nil, After: "hello"}}}
+		if err := s.AppendAuditEntry(ctx, &entry, i > 0); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Seq != int64(i+1) || (i > 0) != (entry.Hash != "") {
+			t.Fatalf("appended entry %+v", entry)
+		}
+	}
+	if n, err := VerifyAuditLog(ctx, s); n != 4 || err != nil {
+		t.Errorf("VerifyAuditLog returned %d, %v", n, err)
+	}
+
+	list, _ := s.ListAuditEntries(ctx, AuditFilter{ActorID: &userID, Before: 4}, 2)
+	if len(list) != 2 || list[0].Action != "posts.create" || list[1].Action != "users.privacy" {
+		t.Errorf("ListAuditEntries returned %+v", list)
+	}
+
+	// an unchained entry is chained once the log is
+	entry := models.AuditEntry{Action: "users.role", Actor: models.ActorCLI}
+	if err := s.AppendAuditEntry(ctx, &entry, false); err != nil || entry.Hash == "" {
+		t.Fatalf("appended entry %+v, %v", entry, err)
+	}
+
+	// the last entries are stripped of their hashes and rewritten
+	stripped := append([]models.AuditEntry(nil), s.auditLog...)
+	for i := 3; i < len(stripped); i++ {
+		stripped[i].Hash, stripped[i].PrevHash, stripped[i].Action = "", "", "users.create"
+	}
+	s.auditLog, stripped = stripped, s.auditLog
+	if _, err := VerifyAuditLog(ctx, s); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("VerifyAuditLog of unchained entries returned %v", err)
+	}
+	// the last entry is deleted
+	s.auditLog = stripped[:4]
+	if n, err := VerifyAuditLog(ctx, s); n != 4 || !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("VerifyAuditLog without the last entry returned %d, %v", n, err)
+	}
+	s.auditLog = stripped
+	if n, err := VerifyAuditLog(ctx, s); n != 5 || err != nil {
+		t.Errorf("VerifyAuditLog returned %d, %v", n, err)
+	}
+	// the head was not moved to the last entry
+	s.auditHead = AuditHead{Seq: 4, Hash: s.auditLog[3].Hash}
+	if n, err := VerifyAuditLog(ctx, s); n != 5 || err != nil {
+		t.Errorf("VerifyAuditLog with the head behind returned %d, %v", n, err)
+	}
+
+	s.auditLog[2].Changes["caption"] = models.AuditChange{After: "bye"}
+	if _, err := VerifyAuditLog(ctx, s); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("VerifyAuditLog of a changed entry returned %v", err)
+	}
+	s.auditLog = append(s.auditLog[:2], s.auditLog[3:]...)
+	if n, err := VerifyAuditLog(ctx, s); n != 2 || !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("VerifyAuditLog without an entry returned %d, %v", n, err)
+	}
+}
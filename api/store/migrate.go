@@ -0,0 +1,302 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Changes to the database are made by migrations, which are applied in
+// order by "appyinsta migrate up". The applied migrations are recorded
+// in the "migrations" collection. New migrations are appended to the list
+// and never edited once released.
+
+// Migrator is implemented by the stores with migrations and indexes (MongoStore)
+type Migrator interface {
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+	Migrate(ctx context.Context) ([]MigrationStatus, error)
+	Reindex(ctx context.Context) error
+}
+
+type Migration struct {
+	Version     int
+	Description string
+	// the indexes which the migration creates, after Up if it is set
+	Indexes map[string][]mongo.IndexModel
+	Up      func(ctx context.Context, db *mongo.Database) error
+}
+
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create the indexes of users and posts",
+		Indexes: map[string][]mongo.IndexModel{
+			"users": {
+				{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("email")},
+			},
+			"posts": {
+				{Keys: bson.D{{Key: "posted_by", Value: 1}, {Key: "posted_on", Value: 1}}, Options: options.Index().SetName("posted_by_posted_on")},
+			},
+		},
+	},
+	{
+		Version:     2,
+		Description: "create the text indexes of user names and post captions",
+		Indexes: map[string][]mongo.IndexModel{
+			"users": {
+				{Keys: bson.D{{Key: "name", Value: "text"}}, Options: options.Index().SetName("name_text")},
+			},
+			"posts": {
+				{Keys: bson.D{{Key: "caption", Value: "text"}}, Options: options.Index().SetName("caption_text")},
+			},
+		},
+	},
+	{
+		Version:     3,
+		Description: "create the indexes of usernames and hashtags",
+		Indexes: map[string][]mongo.IndexModel{
+			"users": {
+				// sparse, as users without a username do not have the field
+				{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetName("username").SetUnique(true).SetSparse(true)},
+			},
+			"posts": {
+				{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("tags__id")},
+				{Keys: bson.D{{Key: "posted_on", Value: 1}}, Options: options.Index().SetName("posted_on")},
+			},
+		},
+	},
+	{
+		Version:     4,
+		Description: "create the indexes of follows and notifications",
+		Indexes: map[string][]mongo.IndexModel{
+			"follows": {
+				{Keys: bson.D{{Key: "follower", Value: 1}, {Key: "followee", Value: 1}}, Options: options.Index().SetName("follower_followee").SetUnique(true)},
+				{Keys: bson.D{{Key: "followee", Value: 1}}, Options: options.Index().SetName("followee")},
+			},
+			"notifications": {
+				{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_on", Value: -1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("user_id_updated_on__id")},
+				{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "group_key", Value: 1}, {Key: "read", Value: 1}}, Options: options.Index().SetName("user_id_group_key_read")},
+			},
+		},
+	},
+	{
+		Version:     5,
+		Description: "create the indexes of the webhook outbox",
+		Indexes: map[string][]mongo.IndexModel{
+			"webhook_deliveries": {
+				{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt", Value: 1}}, Options: options.Index().SetName("status_next_attempt")},
+				{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("status__id")},
+			},
+		},
+	},
+	{
+		Version:     6,
+		Description: "create the collections of the outbox of the events",
+		Indexes: map[string][]mongo.IndexModel{
+			"webhook_deliveries": {
+				// an event delivered again to the outbox of the webhooks is not sent again
+				{Keys: bson.D{{Key: "event_id", Value: 1}, {Key: "webhook_id", Value: 1}}, Options: options.Index().SetName("event_id_webhook_id").SetUnique(true).
+					SetPartialFilterExpression(bson.D{{Key: "event_id", Value: bson.D{{Key: "$exists", Value: true}}}})},
+			},
+			// the events are kept for a week after they are recorded
+			"outbox": {
+				{Keys: bson.D{{Key: "time", Value: 1}}, Options: options.Index().SetName("time").SetExpireAfterSeconds(7 * 24 * 3600)},
+			},
+		},
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// collections cannot be created in transactions before MongoDB 4.4
+			return createCollections(ctx, db, "outbox", "counters", "event_offsets")
+		},
+	},
+	{
+		Version:     7,
+		Description: "create the indexes of blocks and mutes",
+		Indexes: map[string][]mongo.IndexModel{
+			"blocks": {
+				{Keys: bson.D{{Key: "from", Value: 1}, {Key: "to", Value: 1}}, Options: options.Index().SetName("from_to").SetUnique(true)},
+				{Keys: bson.D{{Key: "to", Value: 1}}, Options: options.Index().SetName("to")},
+			},
+			"mutes": {
+				{Keys: bson.D{{Key: "from", Value: 1}, {Key: "to", Value: 1}}, Options: options.Index().SetName("from_to").SetUnique(true)},
+				{Keys: bson.D{{Key: "to", Value: 1}}, Options: options.Index().SetName("to")},
+			},
+		},
+	},
+	{
+		Version:     8,
+		Description: "create the indexes of reports and of the moderation log",
+		Indexes: map[string][]mongo.IndexModel{
+			"reports": {
+				// the reports of the caption filter have no reporter
+				{Keys: bson.D{{Key: "post_id", Value: 1}, {Key: "reporter_id", Value: 1}}, Options: options.Index().SetName("post_id_reporter_id").SetUnique(true).
+					SetPartialFilterExpression(bson.D{{Key: "reporter_id", Value: bson.D{{Key: "$exists", Value: true}}}})},
+				{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("status_id")},
+			},
+			"moderation_log": {
+				{Keys: bson.D{{Key: "post_id", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("post_id_id")},
+			},
+		},
+	},
+	{
+		Version:     9,
+		Description: "create the audit log and its indexes",
+		Indexes: map[string][]mongo.IndexModel{
+			"audit_log": {
+				{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("target_id__id").SetSparse(true)},
+				{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("actor_id__id").SetSparse(true)},
+				{Keys: bson.D{{Key: "action", Value: 1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("action__id")},
+				{Keys: bson.D{{Key: "request_id", Value: 1}}, Options: options.Index().SetName("request_id").SetSparse(true)},
+				{Keys: bson.D{{Key: "created_on", Value: 1}}, Options: options.Index().SetName("created_on")},
+			},
+		},
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// the entries are appended in the transactions of the writes
+			return createCollections(ctx, db, "audit_log")
+		},
+	},
+}
+
+// Indexes are the indexes of each collection other than the one on _id, as
+// created by all the migrations. They are recreated by Reindex.
+var Indexes = migrationIndexes(Migrations)
+
+// migrationIndexes gathers the indexes created by migrations
+func migrationIndexes(migrations []Migration) map[string][]mongo.IndexModel {
+	indexes := map[string][]mongo.IndexModel{}
+	for _, m := range migrations {
+		for collection, models := range m.Indexes {
+			indexes[collection] = append(indexes[collection], models...)
+		}
+	}
+	return indexes
+}
+
+// createCollections creates collections which may already exist
+func createCollections(ctx context.Context, db *mongo.Database, names ...string) error {
+	for _, name := range names {
+		err := db.CreateCollection(ctx, name)
+		if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Name == "NamespaceExists" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrationStatus is a migration and when it was applied, if it was
+type MigrationStatus struct {
+	Version     int        `json:"version" bson:"_id"`
+	Description string     `json:"description" bson:"description"`
+	AppliedOn   *time.Time `json:"applied_on,omitempty" bson:"applied_on"`
+}
+
+// MigrationStatus returns the status of every migration
+func (s *MongoStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	cursor, err := s.DB.Collection("migrations").Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var applied []MigrationStatus
+	if err := cursor.All(ctx, &applied); err != nil {
+		return nil, err
+	}
+	appliedOn := map[int]*time.Time{}
+	for _, m := range applied {
+		appliedOn[m.Version] = m.AppliedOn
+	}
+
+	statuses := make([]MigrationStatus, len(Migrations))
+	for i, m := range Migrations {
+		statuses[i] = MigrationStatus{Version: m.Version, Description: m.Description, AppliedOn: appliedOn[m.Version]}
+	}
+	return statuses, nil
+}
+
+// ErrSchemaBehind is returned by CheckMigrations when some migrations have
+// not been applied
+var ErrSchemaBehind = errors.New("the database schema is behind, run appyinsta migrate up")
+
+// CheckMigrations returns an error wrapping ErrSchemaBehind, with the
+// pending versions, if some migrations have not been applied
+func CheckMigrations(ctx context.Context, m Migrator) error {
+	statuses, err := m.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, status := range statuses {
+		if status.AppliedOn == nil {
+			pending = append(pending, strconv.Itoa(status.Version))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w (pending migrations: %s)", ErrSchemaBehind, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Migrate applies the migrations which have not been applied yet,
+// and returns the ones it applied
+func (s *MongoStore) Migrate(ctx context.Context) ([]MigrationStatus, error) {
+	statuses, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []MigrationStatus
+	for i, status := range statuses {
+		if status.AppliedOn != nil {
+			continue
+		}
+		m := Migrations[i]
+		if m.Up != nil {
+			if err := m.Up(ctx, s.DB); err != nil {
+				return applied, err
+			}
+		}
+		if err := createIndexes(ctx, s.DB, m.Indexes); err != nil {
+			return applied, err
+		}
+
+		now := time.Now().UTC()
+		status.AppliedOn = &now
+		if _, err := s.DB.Collection("migrations").InsertOne(ctx, status); err != nil {
+			return applied, err
+		}
+		applied = append(applied, status)
+	}
+	return applied, nil
+}
+
+// Reindex drops the indexes of the collections in Indexes and creates them again
+func (s *MongoStore) Reindex(ctx context.Context) error {
+	for collection := range Indexes {
+		_, err := s.DB.Collection(collection).Indexes().DropAll(ctx)
+		// there is nothing to drop if the collection does not exist yet
+		if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Name == "NamespaceNotFound" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return createIndexes(ctx, s.DB, Indexes)
+}
+
+func createIndexes(ctx context.Context, db *mongo.Database, indexes map[string][]mongo.IndexModel) error {
+	for collection, indexes := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package store
+
+import "testing"
+
+func TestMigrationIndexes(t *testing.T) {
+	// every index is created by one migration only, so that applying a
+	// migration never creates the indexes of the later ones
+	created := map[string]int{}
+	for _, m := range Migrations {
+		for collection, models := range m.Indexes {
+			for _, model := range models {
+				name := collection + "." + *model.Options.Name
+				if version, ok := created[name]; ok {
+					t.Errorf("index %s is created by migrations %d and %d", name, version, m.Version)
+				}
+				created[name] = m.Version
+			}
+		}
+	}
+
+	n := 0
+	for _, models := range Indexes {
+		n += len(models)
+	}
+	if n != len(created) {
+		t.Errorf("Indexes has %d indexes, the migrations create %d", n, len(created))
+	}
+	if created["users.username"] != 3 || created["audit_log.created_on"] != 9 {
+		t.Errorf("indexes created by the wrong migrations: %v", created)
+	}
+}
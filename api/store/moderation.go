@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The reports are kept in the "reports" collection, and the moderation log
+// in the "moderation_log" collection, which is only appended to
+
+func (s *MongoStore) CreateReport(ctx context.Context, report *models.Report) error {
+	report.ID = primitive.NewObjectID()
+	_, err := s.DB.Collection("reports").InsertOne(ctx, report)
+	// the unique index on the post and the reporter
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateReport
+	}
+	return err
+}
+
+func (s *MongoStore) GetReport(ctx context.Context, id primitive.ObjectID) (models.Report, error) {
+	var report models.Report
+	err := s.DB.Collection("reports").FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&report)
+	if err == mongo.ErrNoDocuments {
+		return report, ErrNotFound
+	}
+	return report, err
+}
+
+func (s *MongoStore) ListReports(ctx context.Context, status string, limit int64) ([]models.Report, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit)
+	cursor, err := s.DB.Collection("reports").Find(ctx, bson.D{{Key: "status", Value: status}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var reports []models.Report
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (s *MongoStore) CountReports(ctx context.Context, postID primitive.ObjectID, status string) (int64, error) {
+	return s.DB.Collection("reports").CountDocuments(ctx, bson.D{{Key: "post_id", Value: postID}, {Key: "status", Value: status}})
+}
+
+func (s *MongoStore) CloseReports(ctx context.Context, postID primitive.ObjectID, status string, now time.Time) (int64, error) {
+	filter := bson.D{{Key: "post_id", Value: postID}, {Key: "status", Value: models.ReportOpen}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: status}, {Key: "closed_on", Value: now}}}}
+	res, err := s.DB.Collection("reports").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+func (s *MongoStore) SetPostHidden(ctx context.Context, postID primitive.ObjectID, hidden bool) error {
+	res, err := s.DB.Collection("posts").UpdateByID(ctx, postID, bson.D{{Key: "$set", Value: bson.D{{Key: "hidden", Value: hidden}}}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) AddModerationAction(ctx context.Context, action *models.ModerationAction) error {
+	action.ID = primitive.NewObjectID()
+	_, err := s.DB.Collection("moderation_log").InsertOne(ctx, action)
+	return err
+}
+
+func (s *MongoStore) ListModerationActions(ctx context.Context, postID *primitive.ObjectID, limit int64) ([]models.ModerationAction, error) {
+	filter := bson.D{}
+	if postID != nil {
+		filter = bson.D{{Key: "post_id", Value: *postID}}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+	cursor, err := s.DB.Collection("moderation_log").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var actions []models.ModerationAction
+	if err := cursor.All(ctx, &actions); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+func (s *MemoryStore) CreateReport(ctx context.Context, report *models.Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if report.ReporterID != nil {
+		for _, r := range s.reports {
+			if r.PostID == report.PostID && r.ReporterID != nil && *r.ReporterID == *report.ReporterID {
+				return ErrDuplicateReport
+			}
+		}
+	}
+	report.ID = primitive.NewObjectID()
+	s.reports = append(s.reports, *report)
+	return nil
+}
+
+func (s *MemoryStore) GetReport(ctx context.Context, id primitive.ObjectID) (models.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.reports {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return models.Report{}, ErrNotFound
+}
+
+func (s *MemoryStore) ListReports(ctx context.Context, status string, limit int64) ([]models.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reports []models.Report
+	for _, r := range s.reports {
+		if int64(len(reports)) == limit {
+			break
+		}
+		if r.Status == status {
+			reports = append(reports, r)
+		}
+	}
+	return reports, nil
+}
+
+func (s *MemoryStore) CountReports(ctx context.Context, postID primitive.ObjectID, status string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n int64
+	for _, r := range s.reports {
+		if r.PostID == postID && r.Status == status {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) CloseReports(ctx context.Context, postID primitive.ObjectID, status string, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for i, r := range s.reports {
+		if r.PostID == postID && r.Status == models.ReportOpen {
+			s.reports[i].Status = status
+			s.reports[i].ClosedOn = &now
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) SetPostHidden(ctx context.Context, postID primitive.ObjectID, hidden bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.posts {
+		if s.posts[i].PostID == postID {
+			s.posts[i].Hidden = hidden
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) AddModerationAction(ctx context.Context, action *models.ModerationAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	action.ID = primitive.NewObjectID()
+	s.moderationLog = append(s.moderationLog, *action)
+	return nil
+}
+
+func (s *MemoryStore) ListModerationActions(ctx context.Context, postID *primitive.ObjectID, limit int64) ([]models.ModerationAction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var actions []models.ModerationAction
+	for i := len(s.moderationLog) - 1; i >= 0 && int64(len(actions)) < limit; i-- {
+		a := s.moderationLog[i]
+		if postID == nil || (a.PostID != nil && *a.PostID == *postID) {
+			actions = append(actions, a)
+		}
+	}
+	return actions, nil
+}
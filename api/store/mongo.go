@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the code of the errors of MongoDB for duplicate keys
+const duplicateKeyCode = 11000
+
+// MongoStore keeps users and posts in the "users" and "posts" collections
+type MongoStore struct {
+	DB *mongo.Database
+
+	mu sync.Mutex
+	// whether the server supports transactions, once it is known
+	transactions *bool
+}
+
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{DB: db}
+}
+
+func (s *MongoStore) CreateUser(ctx context.Context, user *models.User) error {
+	// ensure that the ID field is empty
+	user.UserID = primitive.NilObjectID
+	res, err := s.DB.Collection("users").InsertOne(ctx, user)
+	// the ID is new, so the duplicate key can only be the username
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateUsername
+	}
+	if err != nil {
+		return err
+	}
+
+	user.UserID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *MongoStore) GetUser(ctx context.Context, userID primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := s.DB.Collection("users").FindOne(ctx, bson.D{{Key: "_id", Value: userID}}).Decode(&user)
+	return user, notFound(err)
+}
+
+func (s *MongoStore) GetUsers(ctx context.Context, userIDs []primitive.ObjectID) ([]models.User, error) {
+	cursor, err := s.DB.Collection("users").Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: userIDs}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *MongoStore) ListUsers(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]models.User, error) {
+	var users []models.User
+	return users, s.listByID(ctx, "users", afterID, limit, &users)
+}
+
+func (s *MongoStore) SetUserDisabled(ctx context.Context, userID primitive.ObjectID, disabled bool) error {
+	res, err := s.DB.Collection("users").UpdateByID(ctx, userID, bson.D{{Key: "$set", Value: bson.D{{Key: "disabled", Value: disabled}}}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) InsertUsers(ctx context.Context, users []models.User, onConflict OnConflict) (InsertResult, error) {
+	docs := make([]interface{}, len(users))
+	ids := make([]primitive.ObjectID, len(users))
+	for i := range users {
+		docs[i], ids[i] = users[i], users[i].UserID
+	}
+	return s.insertMany(ctx, "users", docs, ids, onConflict)
+}
+
+func (s *MongoStore) CreatePost(ctx context.Context, post *models.Post) error {
+	// ensure that the ID field is empty
+	post.PostID = primitive.NilObjectID
+	res, err := s.DB.Collection("posts").InsertOne(ctx, post)
+	if err != nil {
+		return err
+	}
+
+	post.PostID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *MongoStore) GetPost(ctx context.Context, postID primitive.ObjectID) (models.Post, error) {
+	var post models.Post
+	err := s.DB.Collection("posts").FindOne(ctx, bson.D{{Key: "_id", Value: postID}}).Decode(&post)
+	return post, notFound(err)
+}
+
+func (s *MongoStore) GetPosts(ctx context.Context, postIDs []primitive.ObjectID) ([]models.Post, error) {
+	cursor, err := s.DB.Collection("posts").Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: postIDs}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []models.Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (s *MongoStore) ListPosts(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]models.Post, error) {
+	var posts []models.Post
+	return posts, s.listByID(ctx, "posts", afterID, limit, &posts)
+}
+
+func (s *MongoStore) DeletePost(ctx context.Context, postID primitive.ObjectID) error {
+	res, err := s.DB.Collection("posts").DeleteOne(ctx, bson.D{{Key: "_id", Value: postID}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) InsertPosts(ctx context.Context, posts []models.Post, onConflict OnConflict) (InsertResult, error) {
+	docs := make([]interface{}, len(posts))
+	ids := make([]primitive.ObjectID, len(posts))
+	for i := range posts {
+		docs[i], ids[i] = posts[i], posts[i].PostID
+	}
+	return s.insertMany(ctx, "posts", docs, ids, onConflict)
+}
+
+func (s *MongoStore) ListUserPosts(ctx context.Context, viewer *Viewer, userID primitive.ObjectID, pagInfo models.PostPaginationInfo) ([]models.Post, error) {
+	var filter bson.D
+
+	if pagInfo.FirstRequest {
+		filter = bson.D{
+			{Key: "posted_by", Value: userID},
+		}
+	} else {
+		// the posts after the last one in the order of (posted_on, _id), so
+		// that the posts posted at the same time are neither repeated nor skipped
+		filter = bson.D{
+			{Key: "posted_by", Value: userID},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "posted_on", Value: bson.D{{Key: "$gt", Value: pagInfo.LastPostedOn}}}},
+				bson.D{{Key: "posted_on", Value: pagInfo.LastPostedOn}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: pagInfo.LastPostID}}}},
+			}},
+		}
+	}
+	filter = viewer.and(filter)
+
+	sort := bson.D{{Key: "posted_on", Value: 1}, {Key: "_id", Value: 1}}
+	opts := options.Find().SetSort(sort).SetLimit(pagInfo.NumberOfNewPosts)
+
+	cursor, err := s.DB.Collection("posts").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []models.Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// listByID decodes into results at most limit documents of a collection
+// with an ID greater than afterID, in the order of their IDs
+func (s *MongoStore) listByID(ctx context.Context, collection string, afterID primitive.ObjectID, limit int64, results interface{}) error {
+	filter := bson.D{}
+	if !afterID.IsZero() {
+		filter = bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: afterID}}}}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit)
+
+	cursor, err := s.DB.Collection(collection).Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+// insertMany inserts documents with the given IDs in one request
+func (s *MongoStore) insertMany(ctx context.Context, collection string, docs []interface{}, ids []primitive.ObjectID, onConflict OnConflict) (InsertResult, error) {
+	var res InsertResult
+	if len(docs) == 0 {
+		return res, nil
+	}
+	coll := s.DB.Collection(collection)
+
+	switch onConflict {
+	case ConflictUpsert:
+		writes := make([]mongo.WriteModel, len(docs))
+		for i, doc := range docs {
+			writes[i] = mongo.NewReplaceOneModel().SetFilter(bson.D{{Key: "_id", Value: ids[i]}}).SetReplacement(doc).SetUpsert(true)
+		}
+		bulkRes, err := coll.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if bulkRes != nil {
+			res.Inserted, res.Replaced = int(bulkRes.UpsertedCount), int(bulkRes.MatchedCount)
+		}
+		return res, err
+
+	case ConflictSkip:
+		// unordered, so that the documents after a duplicate are inserted
+		_, err := coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		if err == nil {
+			res.Inserted = len(docs)
+			return res, nil
+		}
+		if bulkErr, ok := err.(mongo.BulkWriteException); ok && bulkErr.WriteConcernError == nil {
+			for _, writeErr := range bulkErr.WriteErrors {
+				if writeErr.Code != duplicateKeyCode {
+					return res, err
+				}
+			}
+			res.Skipped = len(bulkErr.WriteErrors)
+			res.Inserted = len(docs) - res.Skipped
+			return res, nil
+		}
+		return res, err
+	}
+
+	_, err := coll.InsertMany(ctx, docs)
+	if err == nil {
+		res.Inserted = len(docs)
+		return res, nil
+	}
+	// the documents before the first error were inserted
+	if bulkErr, ok := err.(mongo.BulkWriteException); ok && len(bulkErr.WriteErrors) > 0 {
+		res.Inserted = bulkErr.WriteErrors[0].Index
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return res, fmt.Errorf("%w: %v", ErrDuplicateID, err)
+	}
+	return res, err
+}
+
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
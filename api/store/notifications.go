@@ -0,0 +1,170 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Notifications are listed by decreasing update time, and by decreasing ID
+// for equal times, so that a page starts before the (time, ID) of the last
+// notification of the previous page.
+type NotificationCursor struct {
+	UpdatedOn time.Time
+	ID        primitive.ObjectID
+}
+
+// before reports whether a notification comes after the cursor in the list
+func (c *NotificationCursor) before(n models.Notification) bool {
+	if c == nil {
+		return true
+	}
+	return n.UpdatedOn.Before(c.UpdatedOn) || (n.UpdatedOn.Equal(c.UpdatedOn) && bytes.Compare(n.ID[:], c.ID[:]) < 0)
+}
+
+func (s *MongoStore) AddNotification(ctx context.Context, n models.Notification) (models.Notification, error) {
+	// the fields of the filter are set when the notification is inserted
+	filter := bson.D{{Key: "user_id", Value: n.UserID}, {Key: "group_key", Value: n.GroupKey}, {Key: "read", Value: false}}
+	onInsert := bson.D{{Key: "type", Value: n.Type}, {Key: "created_on", Value: n.CreatedOn}}
+	if n.PostID != nil {
+		onInsert = append(onInsert, bson.E{Key: "post_id", Value: *n.PostID})
+	}
+	update := bson.D{
+		{Key: "$addToSet", Value: bson.D{{Key: "actors", Value: bson.D{{Key: "$each", Value: n.Actors}}}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_on", Value: n.UpdatedOn}}},
+		{Key: "$setOnInsert", Value: onInsert},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var stored models.Notification
+	err := s.DB.Collection("notifications").FindOneAndUpdate(ctx, filter, update, opts).Decode(&stored)
+	return stored, err
+}
+
+func (s *MongoStore) ListNotifications(ctx context.Context, userID primitive.ObjectID, before *NotificationCursor, limit int64) ([]models.Notification, error) {
+	filter := bson.D{{Key: "user_id", Value: userID}}
+	if before != nil {
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "updated_on", Value: bson.D{{Key: "$lt", Value: before.UpdatedOn}}}},
+			bson.D{{Key: "updated_on", Value: before.UpdatedOn}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: before.ID}}}},
+		}})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "updated_on", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
+
+	cursor, err := s.DB.Collection("notifications").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var notifications []models.Notification
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (s *MongoStore) CountUnreadNotifications(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return s.DB.Collection("notifications").CountDocuments(ctx, bson.D{{Key: "user_id", Value: userID}, {Key: "read", Value: false}})
+}
+
+func (s *MongoStore) MarkNotificationsRead(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID) (int64, error) {
+	filter := bson.D{{Key: "user_id", Value: userID}, {Key: "read", Value: false}}
+	if len(ids) > 0 {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}})
+	}
+	res, err := s.DB.Collection("notifications").UpdateMany(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "read", Value: true}}}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+func (s *MemoryStore) AddNotification(ctx context.Context, n models.Notification) (models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.notifications {
+		if existing.UserID != n.UserID || existing.GroupKey != n.GroupKey || existing.Read {
+			continue
+		}
+	actors:
+		for _, actor := range n.Actors {
+			for _, a := range existing.Actors {
+				if a == actor {
+					continue actors
+				}
+			}
+			existing.Actors = append(existing.Actors, actor)
+		}
+		existing.UpdatedOn = n.UpdatedOn
+		s.notifications[i] = existing
+		existing.Actors = append([]primitive.ObjectID(nil), existing.Actors...)
+		return existing, nil
+	}
+
+	n.ID = primitive.NewObjectID()
+	n.Actors = append([]primitive.ObjectID(nil), n.Actors...)
+	s.notifications = append(s.notifications, n)
+	n.Actors = append([]primitive.ObjectID(nil), n.Actors...)
+	return n, nil
+}
+
+func (s *MemoryStore) ListNotifications(ctx context.Context, userID primitive.ObjectID, before *NotificationCursor, limit int64) ([]models.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notifications []models.Notification
+	for _, n := range s.notifications {
+		if n.UserID == userID && before.before(n) {
+			n.Actors = append([]primitive.ObjectID(nil), n.Actors...)
+			notifications = append(notifications, n)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		a, b := notifications[i], notifications[j]
+		if !a.UpdatedOn.Equal(b.UpdatedOn) {
+			return a.UpdatedOn.After(b.UpdatedOn)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) > 0
+	})
+	if limit > 0 && int64(len(notifications)) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+func (s *MemoryStore) CountUnreadNotifications(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n int64
+	for _, notification := range s.notifications {
+		if notification.UserID == userID && !notification.Read {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) MarkNotificationsRead(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	marked := map[primitive.ObjectID]bool{}
+	for _, id := range ids {
+		marked[id] = true
+	}
+	var n int64
+	for i, notification := range s.notifications {
+		if notification.UserID == userID && !notification.Read && (len(ids) == 0 || marked[notification.ID]) {
+			s.notifications[i].Read = true
+			n++
+		}
+	}
+	return n, nil
+}
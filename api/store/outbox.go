@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"appyinsta/api/events"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The domain events are recorded in the "outbox" collection, with
+// increasing sequence numbers as IDs, which are taken from the "counters"
+// collection in the transaction of the write. Since the counter is written
+// by every transaction which records events, they are serialized, and the
+// events are in the outbox in the order of their sequence numbers. The
+// offsets of the dispatchers are in the "event_offsets" collection.
+
+// Record runs a write, and records the events it returns in the outbox, in
+// one transaction: either the write and its events are stored, or neither.
+// The write must use the context it is given.
+func Record(ctx context.Context, st Store, write func(ctx context.Context) ([]events.Event, error)) error {
+	return st.RunInTransaction(ctx, func(ctx context.Context) error {
+		recorded, err := write(ctx)
+		if err != nil {
+			return err
+		}
+		return st.AppendEvents(ctx, recorded...)
+	})
+}
+
+// newEvents sets the IDs and the times of new events
+func newEvents(recorded []events.Event) {
+	now := time.Now().UTC()
+	for i := range recorded {
+		recorded[i].ID = primitive.NewObjectID()
+		if recorded[i].Time.IsZero() {
+			recorded[i].Time = now
+		}
+	}
+}
+
+// eventOffset is a document of the "event_offsets" collection
+type eventOffset struct {
+	Name       string    `bson:"_id"`
+	Seq        int64     `bson:"seq"`
+	Owner      string    `bson:"owner"`
+	LeaseUntil time.Time `bson:"lease_until"`
+}
+
+// RunInTransaction runs fn in a transaction when the server supports them
+// (replica sets and sharded clusters), or else in a session, without the
+// guarantee that all or none of the writes are applied
+func (s *MongoStore) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	supported, err := s.transactionsSupported(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fn(ctx)
+	}
+
+	session, err := s.DB.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// transactionsSupported reports whether the server is a member of a replica set or a mongos
+func (s *MongoStore) transactionsSupported(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transactions != nil {
+		return *s.transactions, nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := s.DB.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello); err != nil {
+		return false, err
+	}
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	s.transactions = &supported
+	return supported, nil
+}
+
+func (s *MongoStore) AppendEvents(ctx context.Context, recorded ...events.Event) error {
+	if len(recorded) == 0 {
+		return nil
+	}
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "seq", Value: int64(len(recorded))}}}}
+	if err := s.DB.Collection("counters").FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: "outbox"}}, update, opts).Decode(&counter); err != nil {
+		return err
+	}
+
+	newEvents(recorded)
+	docs := make([]interface{}, len(recorded))
+	for i := range recorded {
+		recorded[i].Seq = counter.Seq - int64(len(recorded)-1-i)
+		docs[i] = recorded[i]
+	}
+	_, err := s.DB.Collection("outbox").InsertMany(ctx, docs)
+	return err
+}
+
+func (s *MongoStore) ReadEvents(ctx context.Context, afterSeq int64, limit int64) ([]events.Event, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit)
+	cursor, err := s.DB.Collection("outbox").Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: afterSeq}}}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []events.Event
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoStore) AcquireEventLease(ctx context.Context, name, owner string, now, until time.Time) (int64, bool, error) {
+	// the offset is inserted if it does not exist, and the insertion fails
+	// on the duplicate ID if it exists but is leased to another owner
+	filter := bson.D{{Key: "_id", Value: name}, {Key: "$or", Value: bson.A{
+		bson.D{{Key: "owner", Value: owner}},
+		bson.D{{Key: "lease_until", Value: bson.D{{Key: "$lt", Value: now}}}},
+	}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "owner", Value: owner}, {Key: "lease_until", Value: until}}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "seq", Value: int64(0)}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var offset eventOffset
+	err := s.DB.Collection("event_offsets").FindOneAndUpdate(ctx, filter, update, opts).Decode(&offset)
+	if mongo.IsDuplicateKeyError(err) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return offset.Seq, true, nil
+}
+
+func (s *MongoStore) SetEventOffset(ctx context.Context, name, owner string, seq int64, until time.Time) error {
+	filter := bson.D{{Key: "_id", Value: name}, {Key: "owner", Value: owner}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "seq", Value: seq}, {Key: "lease_until", Value: until}}}}
+	res, err := s.DB.Collection("event_offsets").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// RunInTransaction runs fn. The writes of a MemoryStore are not undone when fn fails.
+func (s *MemoryStore) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (s *MemoryStore) AppendEvents(ctx context.Context, recorded ...events.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newEvents(recorded)
+	for i := range recorded {
+		recorded[i].Seq = int64(len(s.outbox)) + 1
+		s.outbox = append(s.outbox, recorded[i])
+	}
+	return nil
+}
+
+func (s *MemoryStore) ReadEvents(ctx context.Context, afterSeq int64, limit int64) ([]events.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// the sequence numbers are the positions in the outbox, from 1
+	if afterSeq >= int64(len(s.outbox)) {
+		return nil, nil
+	}
+	end := afterSeq + limit
+	if end > int64(len(s.outbox)) {
+		end = int64(len(s.outbox))
+	}
+	return append([]events.Event(nil), s.outbox[afterSeq:end]...), nil
+}
+
+func (s *MemoryStore) AcquireEventLease(ctx context.Context, name, owner string, now, until time.Time) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset, ok := s.eventOffsets[name]
+	if ok && offset.Owner != owner && !offset.LeaseUntil.Before(now) {
+		return 0, false, nil
+	}
+	offset.Name, offset.Owner, offset.LeaseUntil = name, owner, until
+	s.eventOffsets[name] = offset
+	return offset.Seq, true, nil
+}
+
+func (s *MemoryStore) SetEventOffset(ctx context.Context, name, owner string, seq int64, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset, ok := s.eventOffsets[name]
+	if !ok || offset.Owner != owner {
+		return ErrLeaseLost
+	}
+	offset.Seq, offset.LeaseUntil = seq, until
+	s.eventOffsets[name] = offset
+	return nil
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BootstrapAdmin creates the first admin, and reports whether there was
+// none. If a user has the username of admin and its password, they become
+// the admin instead; with another password, the error wraps
+// ErrDuplicateUsername, and only SetUserRole can make them admin. The
+// password of admin is already hashed.
+func BootstrapAdmin(ctx context.Context, st Store, admin *models.User) (bool, error) {
+	if n, err := st.CountUsersWithRole(ctx, models.RoleAdmin); err != nil || n > 0 {
+		return false, err
+	}
+	if admin.Username != "" {
+		users, err := st.GetUsersByUsername(ctx, []string{admin.Username})
+		if err != nil {
+			return false, err
+		}
+		if len(users) > 0 {
+			// anyone could have registered the username
+			if subtle.ConstantTimeCompare([]byte(users[0].PwdHash), []byte(admin.PwdHash)) != 1 {
+				return false, fmt.Errorf("%w: %s has another password than the admin", ErrDuplicateUsername, admin.Username)
+			}
+			*admin = users[0]
+			admin.Role = models.RoleAdmin
+			return true, st.SetUserRole(ctx, admin.UserID, models.RoleAdmin)
+		}
+	}
+	admin.Role = models.RoleAdmin
+	return true, st.CreateUser(ctx, admin)
+}
+
+func (s *MongoStore) SetUserRole(ctx context.Context, userID primitive.ObjectID, role string) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "role", Value: role}}}}
+	if role == "" || role == models.RoleUser {
+		update = bson.D{{Key: "$unset", Value: bson.D{{Key: "role", Value: ""}}}}
+	}
+	res, err := s.DB.Collection("users").UpdateByID(ctx, userID, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	return s.DB.Collection("users").CountDocuments(ctx, bson.D{{Key: "role", Value: role}})
+}
+
+func (s *MemoryStore) SetUserRole(ctx context.Context, userID primitive.ObjectID, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if role == models.RoleUser {
+		role = ""
+	}
+	user.Role = role
+	s.users[userID] = user
+	return nil
+}
+
+func (s *MemoryStore) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n int64
+	for _, user := range s.users {
+		if user.Role == role {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"bytes"
+	"context"
+
+	"appyinsta/api/models"
+	"appyinsta/api/search"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Search results are sorted by decreasing score, and by ID for equal scores,
+// so that a page starts after the (score, ID) of the last result of the
+// previous page. Scores are only comparable within a store: MongoStore uses
+// the scores of its text indexes, and MemoryStore ranks with BM25.
+
+type SearchOptions struct {
+	// the maximum number of results, 0 for no limit
+	Limit int64
+	// if set, only the results after this one are returned
+	After *SearchCursor
+	// the user who searches, see ListUserPosts and Viewer.CanSeeUser
+	Viewer *Viewer
+}
+
+type SearchCursor struct {
+	Score float64
+	ID    primitive.ObjectID
+}
+
+type PostHit struct {
+	Post  models.Post
+	Score float64
+}
+
+type UserHit struct {
+	User  models.User
+	Score float64
+}
+
+// after reports whether a result comes after the cursor
+func (c *SearchCursor) after(score float64, id primitive.ObjectID) bool {
+	if c == nil {
+		return true
+	}
+	return score < c.Score || (score == c.Score && bytes.Compare(id[:], c.ID[:]) > 0)
+}
+
+func (s *MongoStore) SearchPosts(ctx context.Context, query string, opts SearchOptions) ([]PostHit, error) {
+	var docs []struct {
+		models.Post `bson:",inline"`
+		Score       float64 `bson:"score"`
+	}
+	if err := s.search(ctx, "posts", query, opts.Viewer.filter(), opts, &docs); err != nil {
+		return nil, err
+	}
+	hits := make([]PostHit, len(docs))
+	for i, doc := range docs {
+		hits[i] = PostHit{Post: doc.Post, Score: doc.Score}
+	}
+	return hits, nil
+}
+
+func (s *MongoStore) SearchUsers(ctx context.Context, query string, opts SearchOptions) ([]UserHit, error) {
+	var docs []struct {
+		models.User `bson:",inline"`
+		Score       float64 `bson:"score"`
+	}
+	if err := s.search(ctx, "users", query, opts.Viewer.userFilter(), opts, &docs); err != nil {
+		return nil, err
+	}
+	hits := make([]UserHit, len(docs))
+	for i, doc := range docs {
+		hits[i] = UserHit{User: doc.User, Score: doc.Score}
+	}
+	return hits, nil
+}
+
+// search decodes into results the documents of a collection matching the
+// query with its text index and the filter, with their score in a score field
+func (s *MongoStore) search(ctx context.Context, collection string, query string, filter bson.D, opts SearchOptions, results interface{}) error {
+	match := bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: query}}}}
+	if filter != nil {
+		match = append(match, bson.E{Key: "$and", Value: bson.A{filter}})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}}}},
+	}
+	if c := opts.After; c != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "score", Value: bson.D{{Key: "$lt", Value: c.Score}}}},
+			bson.D{{Key: "score", Value: c.Score}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: c.ID}}}},
+		}}}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}}})
+	if opts.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: opts.Limit}})
+	}
+
+	cursor, err := s.DB.Collection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+func (s *MemoryStore) SearchPosts(ctx context.Context, query string, opts SearchOptions) ([]PostHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	posts := make(map[primitive.ObjectID]models.Post, len(s.posts))
+	for _, post := range s.posts {
+		posts[post.PostID] = post
+	}
+
+	visible := func(id primitive.ObjectID) bool { return opts.Viewer.CanSee(posts[id]) }
+	var hits []PostHit
+	for _, hit := range s.searchIndex(s.postIndex, query, visible, opts) {
+		hits = append(hits, PostHit{Post: posts[hit.id], Score: hit.score})
+	}
+	return hits, nil
+}
+
+func (s *MemoryStore) SearchUsers(ctx context.Context, query string, opts SearchOptions) ([]UserHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hits []UserHit
+	for _, hit := range s.searchIndex(s.userIndex, query, opts.Viewer.CanSeeUser, opts) {
+		hits = append(hits, UserHit{User: s.users[hit.id], Score: hit.score})
+	}
+	return hits, nil
+}
+
+type memoryHit struct {
+	id    primitive.ObjectID
+	score float64
+}
+
+// searchIndex returns the page of the hits of an index selected by opts,
+// and by keep if it is not nil. The IDs of the index are in hexadecimal, so
+// they sort like the ObjectIDs.
+func (s *MemoryStore) searchIndex(idx *search.Index, query string, keep func(id primitive.ObjectID) bool, opts SearchOptions) []memoryHit {
+	var hits []memoryHit
+	for _, hit := range idx.Search(query) {
+		id, err := primitive.ObjectIDFromHex(hit.ID)
+		if err != nil || !opts.After.after(hit.Score, id) || (keep != nil && !keep(id)) {
+			continue
+		}
+		if opts.Limit > 0 && int64(len(hits)) == opts.Limit {
+			break
+		}
+		hits = append(hits, memoryHit{id: id, score: hit.Score})
+	}
+	return hits
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The storage layer shared by the REST handlers and the gRPC server.
+// Validation of the input (required fields, hashing of passwords) is left
+// to the callers; a Store only reads and writes documents.
+
+var ErrNotFound = errors.New("store: document not found")
+
+// ErrUserDisabled is returned by CheckCanPost for disabled users
+var ErrUserDisabled = errors.New("store: user is disabled")
+
+// ErrDuplicateID is returned when inserting a document with an existing ID
+var ErrDuplicateID = errors.New("store: duplicate ID")
+
+// ErrDuplicateUsername is returned by CreateUser when the username is taken
+var ErrDuplicateUsername = errors.New("store: duplicate username")
+
+// ErrDuplicateReport is returned by CreateReport when the user already reported the post
+var ErrDuplicateReport = errors.New("store: duplicate report")
+
+// ErrLeaseLost is returned by SetEventOffset when another dispatcher took the lease of the offset
+var ErrLeaseLost = errors.New("store: the lease of the event offset was lost")
+
+type Store interface {
+	// CreateUser inserts a user and sets its UserID
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, userID primitive.ObjectID) (models.User, error)
+	// GetUsers returns the users with the given IDs which exist, in no particular order
+	GetUsers(ctx context.Context, userIDs []primitive.ObjectID) ([]models.User, error)
+	// GetUsersByUsername is like GetUsers, for usernames
+	GetUsersByUsername(ctx context.Context, usernames []string) ([]models.User, error)
+	// ListUsers returns at most limit users with an ID greater than afterID,
+	// in the order of their IDs. A zero afterID starts from the first user.
+	ListUsers(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]models.User, error)
+	// SetUserDisabled disables or enables a user, or returns ErrNotFound
+	SetUserDisabled(ctx context.Context, userID primitive.ObjectID, disabled bool) error
+	// SetUserRole changes the role of a user, or returns ErrNotFound
+	SetUserRole(ctx context.Context, userID primitive.ObjectID, role string) error
+	// CountUsersWithRole returns the number of users with a role other than RoleUser
+	CountUsersWithRole(ctx context.Context, role string) (int64, error)
+	// SetUserPrivate makes a user private or public, with their posts, or returns ErrNotFound
+	SetUserPrivate(ctx context.Context, userID primitive.ObjectID, private bool) error
+	// InsertUsers inserts users keeping their IDs. Users with an existing ID
+	// are handled according to onConflict.
+	InsertUsers(ctx context.Context, users []models.User, onConflict OnConflict) (InsertResult, error)
+
+	// CreatePost inserts a post and sets its PostID
+	CreatePost(ctx context.Context, post *models.Post) error
+	GetPost(ctx context.Context, postID primitive.ObjectID) (models.Post, error)
+	// GetPosts is like GetUsers, for posts
+	GetPosts(ctx context.Context, postIDs []primitive.ObjectID) ([]models.Post, error)
+	// ListPosts is like ListUsers, for the posts of all the users
+	ListPosts(ctx context.Context, afterID primitive.ObjectID, limit int64) ([]models.Post, error)
+	// DeletePost deletes a post, or returns ErrNotFound
+	DeletePost(ctx context.Context, postID primitive.ObjectID) error
+	// InsertPosts inserts posts keeping their IDs and timestamps, like InsertUsers
+	InsertPosts(ctx context.Context, posts []models.Post, onConflict OnConflict) (InsertResult, error)
+
+	// ListUserPosts returns a page of the posts of a user visible to viewer,
+	// see handlers.HandleUserPostsGet for the pagination logic
+	ListUserPosts(ctx context.Context, viewer *Viewer, userID primitive.ObjectID, pagInfo models.PostPaginationInfo) ([]models.Post, error)
+
+	// ListTagPosts returns at most limit posts with a hashtag visible to
+	// viewer, newest (by ID) first. A zero beforeID starts from the newest post.
+	ListTagPosts(ctx context.Context, viewer *Viewer, tag string, beforeID primitive.ObjectID, limit int64) ([]models.Post, error)
+	// TrendingTags returns the limit hashtags of the most posts posted since
+	// a time which everyone sees, with their number of posts, the most used first
+	TrendingTags(ctx context.Context, since time.Time, limit int64) ([]models.TagCount, error)
+
+	// Follow records that a user follows another one, or asked to if
+	// pending, until AcceptFollow. It reports whether the user did not follow
+	// them or ask to already.
+	Follow(ctx context.Context, followerID, followeeID primitive.ObjectID, pending bool) (bool, error)
+	// AcceptFollow turns a request to follow into a follow, and reports whether there was one
+	AcceptFollow(ctx context.Context, followerID, followeeID primitive.ObjectID) (bool, error)
+	// Unfollow deletes a follow or a request to follow, and reports whether there was one
+	Unfollow(ctx context.Context, followerID, followeeID primitive.ObjectID) (bool, error)
+	GetFollowStatus(ctx context.Context, followerID, followeeID primitive.ObjectID) (models.FollowStatus, error)
+
+	// ListFollowers returns the IDs of the users who follow a user
+	ListFollowers(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error)
+	// ListFollowing returns the IDs of the users a user follows
+	ListFollowing(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error)
+	// ListFollowRequests returns the IDs of the users who asked to follow a user, oldest first
+	ListFollowRequests(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error)
+
+	// Block records that a user blocks another one, and deletes the follows
+	// and requests to follow between them. It reports whether the user did
+	// not block them already.
+	Block(ctx context.Context, blockerID, blockedID primitive.ObjectID) (bool, error)
+	// Unblock reports whether the user blocked the other one
+	Unblock(ctx context.Context, blockerID, blockedID primitive.ObjectID) (bool, error)
+	// ListBlocks returns the IDs of the users whom a user blocks, and of the users who block them
+	ListBlocks(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error)
+	// Mute and Unmute are like Block and Unblock, without changing the follows
+	Mute(ctx context.Context, muterID, mutedID primitive.ObjectID) (bool, error)
+	Unmute(ctx context.Context, muterID, mutedID primitive.ObjectID) (bool, error)
+	// ListMuted returns the IDs of the users muted by a user
+	ListMuted(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error)
+	// ListMutedBy returns the IDs of the users who muted a user
+	ListMutedBy(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error)
+
+	// AddNotification inserts a notification, or adds its actors to the
+	// unread notification of the same user with the same group key.
+	// It returns the notification as stored.
+	AddNotification(ctx context.Context, n models.Notification) (models.Notification, error)
+	// ListNotifications returns at most limit notifications of a user, see
+	// NotificationCursor for the order. A nil cursor starts from the first one.
+	ListNotifications(ctx context.Context, userID primitive.ObjectID, before *NotificationCursor, limit int64) ([]models.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	// MarkNotificationsRead marks the given notifications of a user as read,
+	// or all of them if ids is empty, and returns how many were unread
+	MarkNotificationsRead(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID) (int64, error)
+
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhook(ctx context.Context, id primitive.ObjectID) (models.Webhook, error)
+	// ListWebhooks returns the webhooks in the order they were created
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	// DeleteWebhook deletes a webhook, or returns ErrNotFound
+	DeleteWebhook(ctx context.Context, id primitive.ObjectID) error
+
+	// AddDeliveries inserts deliveries into the outbox of the webhooks and
+	// sets their IDs. Deliveries of an event to a webhook which already has
+	// one are skipped.
+	AddDeliveries(ctx context.Context, deliveries []models.Delivery) error
+	// ClaimDeliveries returns at most limit pending deliveries due at now,
+	// and postpones their next attempt to until, so that other dispatchers
+	// do not send them meanwhile
+	ClaimDeliveries(ctx context.Context, now, until time.Time, limit int64) ([]models.Delivery, error)
+	// UpdateDelivery replaces a delivery, or returns ErrNotFound
+	UpdateDelivery(ctx context.Context, delivery models.Delivery) error
+	// ListDeliveries returns at most limit deliveries with a status, the newest first
+	ListDeliveries(ctx context.Context, status string, limit int64) ([]models.Delivery, error)
+	// RetryDelivery makes a dead delivery pending again, due at now, and
+	// returns it, or returns ErrNotFound
+	RetryDelivery(ctx context.Context, id primitive.ObjectID, now time.Time) (models.Delivery, error)
+
+	// RunInTransaction runs fn in a transaction if the store supports them,
+	// see Record. The writes of fn must use the context it is given.
+	RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	// AppendEvents records events in the outbox, and sets their IDs and
+	// sequence numbers, and their times if they are not set
+	AppendEvents(ctx context.Context, recorded ...events.Event) error
+	// CreateReport inserts a report and sets its ID, or returns
+	// ErrDuplicateReport if its reporter already reported the post
+	CreateReport(ctx context.Context, report *models.Report) error
+	// GetReport returns a report, or ErrNotFound
+	GetReport(ctx context.Context, id primitive.ObjectID) (models.Report, error)
+	// ListReports returns at most limit reports with a status, the oldest first
+	ListReports(ctx context.Context, status string, limit int64) ([]models.Report, error)
+	// CountReports returns the number of reports of a post with a status
+	CountReports(ctx context.Context, postID primitive.ObjectID, status string) (int64, error)
+	// CloseReports sets the status of the open reports of a post, closed at
+	// now, and returns their number
+	CloseReports(ctx context.Context, postID primitive.ObjectID, status string, now time.Time) (int64, error)
+	// SetPostHidden hides a post or shows it again, or returns ErrNotFound
+	SetPostHidden(ctx context.Context, postID primitive.ObjectID, hidden bool) error
+	// AddModerationAction appends an action to the moderation log and sets its ID
+	AddModerationAction(ctx context.Context, action *models.ModerationAction) error
+	// ListModerationActions returns at most limit actions of the moderation
+	// log, the newest first, only the actions about a post if postID is set
+	ListModerationActions(ctx context.Context, postID *primitive.ObjectID, limit int64) ([]models.ModerationAction, error)
+	// AppendAuditEntry appends an entry to the audit log and sets its
+	// sequence number, and its hashes if chain is set or the log is chained,
+	// see HashAuditEntry
+	AppendAuditEntry(ctx context.Context, entry *models.AuditEntry, chain bool) error
+	// GetAuditHead returns the head of the audit log, zero if it is empty
+	GetAuditHead(ctx context.Context) (AuditHead, error)
+	// ListAuditEntries returns at most limit entries of the audit log
+	// matching a filter, the newest first
+	ListAuditEntries(ctx context.Context, filter AuditFilter, limit int64) ([]models.AuditEntry, error)
+	// ReadAuditEntries returns at most limit entries of the audit log after
+	// a sequence number, in order
+	ReadAuditEntries(ctx context.Context, afterSeq int64, limit int64) ([]models.AuditEntry, error)
+
+	// the dispatchers read the outbox through events.Log
+	events.Log
+
+	// SearchPosts returns the posts with a caption matching the words of the
+	// query visible to opts.Viewer, the most relevant first, see SearchOptions
+	// for the pagination
+	SearchPosts(ctx context.Context, query string, opts SearchOptions) ([]PostHit, error)
+	// SearchUsers is like SearchPosts, for the names of the users
+	SearchUsers(ctx context.Context, query string, opts SearchOptions) ([]UserHit, error)
+}
+
+// OnConflict is what InsertUsers and InsertPosts do with documents
+// which have the ID of an existing document
+type OnConflict int
+
+const (
+	// stop at the first conflict, and return an error wrapping ErrDuplicateID
+	ConflictError OnConflict = iota
+	// keep the existing document
+	ConflictSkip
+	// replace the existing document
+	ConflictUpsert
+)
+
+type InsertResult struct {
+	Inserted int `json:"inserted"`
+	Replaced int `json:"replaced"`
+	Skipped  int `json:"skipped"`
+}
+
+// CheckCanPost returns ErrUserDisabled if the author of a new post is
+// disabled, and sets AuthorPrivate. Posts by users which do not exist are
+// not rejected here, as they never have been.
+func CheckCanPost(ctx context.Context, st Store, post *models.Post) error {
+	user, err := st.GetUser(ctx, post.PostedByUID)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.Disabled {
+		return ErrUserDisabled
+	}
+	post.AuthorPrivate = user.Private
+	return nil
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"appyinsta/api/caption"
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ParseCaption sets the hashtags and the mentions of a post from its caption.
+// Mentions of usernames which do not exist are ignored.
+func ParseCaption(ctx context.Context, st Store, post *models.Post) error {
+	tags, usernames := caption.Parse(post.Caption)
+	post.Tags, post.Mentions = tags, nil
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	users, err := st.GetUsersByUsername(ctx, usernames)
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]primitive.ObjectID, len(users))
+	for _, user := range users {
+		ids[user.Username] = user.UserID
+	}
+	// in the order of the caption
+	for _, username := range usernames {
+		if id, ok := ids[username]; ok {
+			post.Mentions = append(post.Mentions, id)
+		}
+	}
+	return nil
+}
+
+func (s *MongoStore) GetUsersByUsername(ctx context.Context, usernames []string) ([]models.User, error) {
+	cursor, err := s.DB.Collection("users").Find(ctx, bson.D{{Key: "username", Value: bson.D{{Key: "$in", Value: usernames}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *MongoStore) ListTagPosts(ctx context.Context, viewer *Viewer, tag string, beforeID primitive.ObjectID, limit int64) ([]models.Post, error) {
+	filter := bson.D{{Key: "tags", Value: tag}}
+	if !beforeID.IsZero() {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$lt", Value: beforeID}}})
+	}
+	filter = viewer.and(filter)
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+
+	cursor, err := s.DB.Collection("posts").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var posts []models.Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// the trending hashtags are the same for everyone, so they only count the
+// posts which anonymous users see
+var anonymous = &Viewer{}
+
+func (s *MongoStore) TrendingTags(ctx context.Context, since time.Time, limit int64) ([]models.TagCount, error) {
+	match := anonymous.and(bson.D{{Key: "posted_on", Value: bson.D{{Key: "$gte", Value: since}}}, {Key: "tags.0", Value: bson.D{{Key: "$exists", Value: true}}}})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$tags"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	cursor, err := s.DB.Collection("posts").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	tags := []models.TagCount{}
+	if err := cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (s *MemoryStore) GetUsersByUsername(ctx context.Context, usernames []string) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := map[string]bool{}
+	for _, username := range usernames {
+		wanted[username] = true
+	}
+	var users []models.User
+	for _, user := range s.users {
+		if user.Username != "" && wanted[user.Username] {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) ListTagPosts(ctx context.Context, viewer *Viewer, tag string, beforeID primitive.ObjectID, limit int64) ([]models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var posts []models.Post
+	for _, post := range s.posts {
+		if hasTag(post, tag) && viewer.CanSee(post) && (beforeID.IsZero() || bytes.Compare(post.PostID[:], beforeID[:]) < 0) {
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return bytes.Compare(posts[i].PostID[:], posts[j].PostID[:]) > 0 })
+	if limit > 0 && int64(len(posts)) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+func (s *MemoryStore) TrendingTags(ctx context.Context, since time.Time, limit int64) ([]models.TagCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := map[string]int64{}
+	for _, post := range s.posts {
+		if post.PostedOn.Before(since) || !anonymous.CanSee(post) {
+			continue
+		}
+		for _, tag := range post.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := []models.TagCount{}
+	for tag, count := range counts {
+		tags = append(tags, models.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if limit > 0 && int64(len(tags)) > limit {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+func hasTag(post models.Post, tag string) bool {
+	for _, t := range post.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
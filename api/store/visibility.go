@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Viewer is the user who reads posts. The author of a post always sees it.
+// The other users see the posts of the users they follow, unless they are
+// only for their author, and the public posts of users who are not private.
+// Nobody sees the posts of the users they block or who block them, and
+// the posts hidden by the moderation are only seen by their author. The
+// methods which list posts return the posts visible to their viewer; a nil
+// Viewer sees all the posts, for the CLI and the admin routes.
+type Viewer struct {
+	// zero for anonymous requests
+	UserID primitive.ObjectID
+	// the users the viewer follows, without the pending requests
+	Following map[primitive.ObjectID]bool
+	// the users the viewer blocks or who block them
+	Blocked map[primitive.ObjectID]bool
+}
+
+// NewViewer returns the viewer of a user, or an anonymous viewer for a zero ID
+func NewViewer(ctx context.Context, st Store, userID primitive.ObjectID) (*Viewer, error) {
+	v := &Viewer{UserID: userID, Following: map[primitive.ObjectID]bool{}, Blocked: map[primitive.ObjectID]bool{}}
+	if userID.IsZero() {
+		return v, nil
+	}
+	following, err := st.ListFollowing(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range following {
+		v.Following[id] = true
+	}
+	blocked, err := st.ListBlocks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range blocked {
+		v.Blocked[id] = true
+	}
+	return v, nil
+}
+
+// CanSeeUser reports whether the viewer sees the profile of a user
+func (v *Viewer) CanSeeUser(userID primitive.ObjectID) bool {
+	return v == nil || !v.Blocked[userID]
+}
+
+// CanSee reports whether the viewer sees a post
+func (v *Viewer) CanSee(post models.Post) bool {
+	switch {
+	case v == nil || (!v.UserID.IsZero() && post.PostedByUID == v.UserID):
+		return true
+	case v.Blocked[post.PostedByUID] || post.Hidden:
+		return false
+	case post.Visibility == models.VisibilityOnlyMe:
+		return false
+	case v.Following[post.PostedByUID]:
+		return true
+	}
+	return post.Visibility != models.VisibilityFollowers && !post.AuthorPrivate
+}
+
+// filter returns the MongoDB filter of the posts the viewer sees, nil for all of them
+func (v *Viewer) filter() bson.D {
+	if v == nil {
+		return nil
+	}
+	notHidden := bson.E{Key: "hidden", Value: bson.D{{Key: "$ne", Value: true}}}
+	// posts without a visibility are public
+	public := bson.D{
+		{Key: "visibility", Value: bson.D{{Key: "$nin", Value: bson.A{models.VisibilityFollowers, models.VisibilityOnlyMe}}}},
+		{Key: "author_private", Value: bson.D{{Key: "$ne", Value: true}}},
+		notHidden,
+	}
+	visible := bson.A{public}
+	if !v.UserID.IsZero() {
+		visible = append(visible, bson.D{{Key: "posted_by", Value: v.UserID}})
+	}
+	if len(v.Following) > 0 {
+		following := make(bson.A, 0, len(v.Following))
+		for id := range v.Following {
+			following = append(following, id)
+		}
+		visible = append(visible, bson.D{
+			{Key: "posted_by", Value: bson.D{{Key: "$in", Value: following}}},
+			{Key: "visibility", Value: bson.D{{Key: "$ne", Value: models.VisibilityOnlyMe}}},
+			notHidden,
+		})
+	}
+	filter := bson.D{{Key: "$or", Value: visible}}
+	if len(v.Blocked) > 0 {
+		blocked := make(bson.A, 0, len(v.Blocked))
+		for id := range v.Blocked {
+			blocked = append(blocked, id)
+		}
+		filter = append(filter, bson.E{Key: "posted_by", Value: bson.D{{Key: "$nin", Value: blocked}}})
+	}
+	return filter
+}
+
+// userFilter returns the MongoDB filter of the users whose profile the viewer
+// sees, nil for all of them
+func (v *Viewer) userFilter() bson.D {
+	if v == nil || len(v.Blocked) == 0 {
+		return nil
+	}
+	blocked := make(bson.A, 0, len(v.Blocked))
+	for id := range v.Blocked {
+		blocked = append(blocked, id)
+	}
+	return bson.D{{Key: "_id", Value: bson.D{{Key: "$nin", Value: blocked}}}}
+}
+
+// and adds the filter of the posts the viewer sees to a filter
+func (v *Viewer) and(filter bson.D) bson.D {
+	if visible := v.filter(); visible != nil {
+		return append(filter, bson.E{Key: "$and", Value: bson.A{visible}})
+	}
+	return filter
+}
+
+func (s *MongoStore) SetUserPrivate(ctx context.Context, userID primitive.ObjectID, private bool) error {
+	res, err := s.DB.Collection("users").UpdateByID(ctx, userID, bson.D{{Key: "$set", Value: bson.D{{Key: "private", Value: private}}}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = s.DB.Collection("posts").UpdateMany(ctx, bson.D{{Key: "posted_by", Value: userID}}, bson.D{{Key: "$set", Value: bson.D{{Key: "author_private", Value: private}}}})
+	return err
+}
+
+func (s *MemoryStore) SetUserPrivate(ctx context.Context, userID primitive.ObjectID, private bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Private = private
+	s.users[userID] = user
+	for i := range s.posts {
+		if s.posts[i].PostedByUID == userID {
+			s.posts[i].AuthorPrivate = private
+		}
+	}
+	return nil
+}
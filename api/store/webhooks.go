@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The deliveries of the webhooks are kept in the "webhook_deliveries"
+// collection, which is the outbox read by webhooks.Dispatcher
+
+func (s *MongoStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	webhook.ID = primitive.NewObjectID()
+	_, err := s.DB.Collection("webhooks").InsertOne(ctx, webhook)
+	return err
+}
+
+func (s *MongoStore) GetWebhook(ctx context.Context, id primitive.ObjectID) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := s.DB.Collection("webhooks").FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return webhook, ErrNotFound
+	}
+	return webhook, err
+}
+
+func (s *MongoStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	cursor, err := s.DB.Collection("webhooks").Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var webhooks []models.Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *MongoStore) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	res, err := s.DB.Collection("webhooks").DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) AddDeliveries(ctx context.Context, deliveries []models.Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(deliveries))
+	for i := range deliveries {
+		deliveries[i].ID = primitive.NewObjectID()
+		docs[i] = deliveries[i]
+	}
+	// the other deliveries are inserted when one is a duplicate
+	_, err := s.DB.Collection("webhook_deliveries").InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *MongoStore) ClaimDeliveries(ctx context.Context, now, until time.Time, limit int64) ([]models.Delivery, error) {
+	coll := s.DB.Collection("webhook_deliveries")
+	filter := bson.D{{Key: "status", Value: models.DeliveryPending}, {Key: "next_attempt", Value: bson.D{{Key: "$lte", Value: now}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "next_attempt", Value: until}}}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt", Value: 1}}).SetReturnDocument(options.After)
+
+	// each delivery is claimed atomically, so that dispatchers on several
+	// replicas never claim the same one
+	var deliveries []models.Delivery
+	for int64(len(deliveries)) < limit {
+		var d models.Delivery
+		err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&d)
+		if err == mongo.ErrNoDocuments {
+			break
+		} else if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+func (s *MongoStore) UpdateDelivery(ctx context.Context, delivery models.Delivery) error {
+	res, err := s.DB.Collection("webhook_deliveries").ReplaceOne(ctx, bson.D{{Key: "_id", Value: delivery.ID}}, delivery)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) ListDeliveries(ctx context.Context, status string, limit int64) ([]models.Delivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+	cursor, err := s.DB.Collection("webhook_deliveries").Find(ctx, bson.D{{Key: "status", Value: status}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []models.Delivery
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *MongoStore) RetryDelivery(ctx context.Context, id primitive.ObjectID, now time.Time) (models.Delivery, error) {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "status", Value: models.DeliveryDead}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: models.DeliveryPending},
+		{Key: "attempts", Value: 0},
+		{Key: "next_attempt", Value: now},
+	}}}
+	var delivery models.Delivery
+	err := s.DB.Collection("webhook_deliveries").FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return delivery, ErrNotFound
+	}
+	return delivery, err
+}
+
+func (s *MemoryStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook.ID = primitive.NewObjectID()
+	w := *webhook
+	w.Events = append([]string(nil), webhook.Events...)
+	s.webhooks = append(s.webhooks, w)
+	return nil
+}
+
+func (s *MemoryStore) GetWebhook(ctx context.Context, id primitive.ObjectID) (models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, w := range s.webhooks {
+		if w.ID == id {
+			w.Events = append([]string(nil), w.Events...)
+			return w, nil
+		}
+	}
+	return models.Webhook{}, ErrNotFound
+}
+
+func (s *MemoryStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]models.Webhook, len(s.webhooks))
+	for i, w := range s.webhooks {
+		w.Events = append([]string(nil), w.Events...)
+		webhooks[i] = w
+	}
+	return webhooks, nil
+}
+
+func (s *MemoryStore) DeleteWebhook(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, w := range s.webhooks {
+		if w.ID == id {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) AddDeliveries(ctx context.Context, deliveries []models.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+deliveries:
+	for i := range deliveries {
+		deliveries[i].ID = primitive.NewObjectID()
+		for _, d := range s.deliveries {
+			if d.EventID == deliveries[i].EventID && d.WebhookID == deliveries[i].WebhookID {
+				continue deliveries
+			}
+		}
+		s.deliveries = append(s.deliveries, deliveries[i])
+	}
+	return nil
+}
+
+func (s *MemoryStore) ClaimDeliveries(ctx context.Context, now, until time.Time, limit int64) ([]models.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deliveries []models.Delivery
+	for i, d := range s.deliveries {
+		if int64(len(deliveries)) == limit {
+			break
+		}
+		if d.Status == models.DeliveryPending && !d.NextAttempt.After(now) {
+			s.deliveries[i].NextAttempt = until
+			d.NextAttempt = until
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *MemoryStore) UpdateDelivery(ctx context.Context, delivery models.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, d := range s.deliveries {
+		if d.ID == delivery.ID {
+			s.deliveries[i] = delivery
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) ListDeliveries(ctx context.Context, status string, limit int64) ([]models.Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var deliveries []models.Delivery
+	for i := len(s.deliveries) - 1; i >= 0 && int64(len(deliveries)) < limit; i-- {
+		if s.deliveries[i].Status == status {
+			deliveries = append(deliveries, s.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *MemoryStore) RetryDelivery(ctx context.Context, id primitive.ObjectID, now time.Time) (models.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, d := range s.deliveries {
+		if d.ID == id && d.Status == models.DeliveryDead {
+			s.deliveries[i].Status = models.DeliveryPending
+			s.deliveries[i].Attempts = 0
+			s.deliveries[i].NextAttempt = now
+			return s.deliveries[i], nil
+		}
+	}
+	return models.Delivery{}, ErrNotFound
+}
@@ -0,0 +1,150 @@
+// Package stream delivers the new posts and notifications to the users who
+// are connected to the streaming endpoint, as they happen.
+//
+// A Hub routes messages to the subscriptions of their users. Each
+// subscription has a buffer of its own, and a subscriber which does not keep
+// up is disconnected when its buffer is full, instead of slowing down the
+// publishers and the other subscribers: clients reconnect, and fetch what
+// they missed with the list routes.
+//
+// Messages come from a Publisher, either from the domain events of this
+// server, or from a change stream of the database, so that the subscribers
+// of every replica receive the messages of all of them.
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Types of messages, which are the names of the events of the stream
+const (
+	PostMessage         = "post"
+	NotificationMessage = "notification"
+)
+
+// DefaultBufferSize is the number of messages buffered for each subscription
+const DefaultBufferSize = 64
+
+type Message struct {
+	Type string
+	// the users the message is for
+	Users []primitive.ObjectID
+	// the JSON form of the post or notification
+	Data json.RawMessage
+}
+
+// Hub delivers messages to the subscriptions of their users. It is safe for concurrent use.
+type Hub struct {
+	bufferSize int
+
+	mu   sync.Mutex
+	subs map[primitive.ObjectID]map[*Subscription]bool
+}
+
+// NewHub returns a hub which buffers bufferSize messages for each subscription,
+// or DefaultBufferSize if it is not positive
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{bufferSize: bufferSize, subs: map[primitive.ObjectID]map[*Subscription]bool{}}
+}
+
+// Subscription receives the messages of a user on C, which is closed when
+// the subscription is closed, by Close or because its buffer was full
+type Subscription struct {
+	C <-chan Message
+
+	c      chan Message
+	hub    *Hub
+	user   primitive.ObjectID
+	closed bool
+	// whether the hub closed the subscription because its buffer was full
+	dropped bool
+}
+
+// Subscribe returns a new subscription to the messages of a user.
+// It must be closed when it is not used anymore.
+func (h *Hub) Subscribe(userID primitive.ObjectID) *Subscription {
+	c := make(chan Message, h.bufferSize)
+	sub := &Subscription{C: c, c: c, hub: h, user: userID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[*Subscription]bool{}
+	}
+	h.subs[userID][sub] = true
+	return sub
+}
+
+// Publish delivers a message to the subscriptions of its users, without
+// waiting: the subscriptions whose buffer is full are closed
+func (h *Hub) Publish(msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, userID := range distinct(msg.Users) {
+		for sub := range h.subs[userID] {
+			select {
+			case sub.c <- msg:
+			default:
+				sub.dropped = true
+				h.remove(sub)
+			}
+		}
+	}
+}
+
+// Subscribers returns the number of open subscriptions
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, subs := range h.subs {
+		n += len(subs)
+	}
+	return n
+}
+
+// remove closes a subscription. h.mu must be held.
+func (h *Hub) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.c)
+	delete(h.subs[sub.user], sub)
+	if len(h.subs[sub.user]) == 0 {
+		delete(h.subs, sub.user)
+	}
+}
+
+// Close closes the subscription. It can be called more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Dropped reports whether the hub closed the subscription because its buffer was full
+func (s *Subscription) Dropped() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.dropped
+}
+
+func distinct(ids []primitive.ObjectID) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool, len(ids))
+	var list []primitive.ObjectID
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			list = append(list, id)
+		}
+	}
+	return list
+}
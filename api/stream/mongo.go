@@ -0,0 +1,103 @@
+package stream
+
+import (
+	"context"
+	"time"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the delays before opening the change stream again after an error
+const (
+	minWatchBackoff = time.Second
+	maxWatchBackoff = time.Minute
+)
+
+// change is a document of the change stream
+type change struct {
+	NS struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	FullDocument bson.Raw `bson:"fullDocument"`
+}
+
+// WatchMongo publishes the posts and notifications written to a database by
+// any replica, until ctx is done. It needs a replica set, since it reads a
+// change stream. When the stream fails, it is opened again after the last
+// change which was read, so that no change is missed.
+func (p *Publisher) WatchMongo(ctx context.Context, db *mongo.Database) {
+	logger := logging.FromContext(ctx)
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "ns.coll", Value: "posts"}, {Key: "operationType", Value: "insert"}},
+		bson.D{
+			{Key: "ns.coll", Value: "notifications"},
+			{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"insert", "update", "replace"}}}},
+		},
+	}}}}}}
+
+	var resumeToken bson.Raw
+	backoff := minWatchBackoff
+	for {
+		opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+		cs, err := db.Watch(ctx, pipeline, opts)
+		if err == nil {
+			backoff = minWatchBackoff
+			for cs.Next(ctx) {
+				resumeToken = cs.ResumeToken()
+				if err := p.publishChange(ctx, cs); err != nil {
+					logger.Error("could not publish change", "err", err)
+				}
+			}
+			err = cs.Err()
+			cs.Close(context.Background())
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Error("change stream failed", "err", err, "retry_in", backoff.String())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
+
+func (p *Publisher) publishChange(ctx context.Context, cs *mongo.ChangeStream) error {
+	var c change
+	if err := cs.Decode(&c); err != nil {
+		return err
+	}
+	// the document was deleted since the change
+	if c.FullDocument == nil {
+		return nil
+	}
+
+	switch c.NS.Coll {
+	case "posts":
+		var post models.Post
+		if err := bson.Unmarshal(c.FullDocument, &post); err != nil {
+			return err
+		}
+		return p.PublishPost(ctx, post)
+	case "notifications":
+		var n models.Notification
+		if err := bson.Unmarshal(c.FullDocument, &n); err != nil {
+			return err
+		}
+		return p.Notify(ctx, n)
+	}
+	return nil
+}
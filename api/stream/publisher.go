@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/notifications"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Publisher turns new posts and notifications into the messages of a hub
+type Publisher struct {
+	Hub   *Hub
+	Store store.Store
+}
+
+// HandleEvent is an events.Handler which publishes the new posts of this server.
+// The notifications are published by Notify, after they are stored.
+func (p *Publisher) HandleEvent(ctx context.Context, event events.Event) error {
+	if event.Type != events.Posted {
+		return nil
+	}
+	post, err := p.Store.GetPost(ctx, event.Post)
+	if err == store.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return p.PublishPost(ctx, post)
+}
+
+// PublishPost publishes a post to its author and to their followers who
+// did not mute them, unless it is only for its author or hidden
+func (p *Publisher) PublishPost(ctx context.Context, post models.Post) error {
+	users := []primitive.ObjectID{post.PostedByUID}
+	if post.Visibility != models.VisibilityOnlyMe && !post.Hidden {
+		followers, err := p.Store.ListFollowers(ctx, post.PostedByUID)
+		if err != nil {
+			return err
+		}
+		mutedBy, err := p.Store.ListMutedBy(ctx, post.PostedByUID)
+		if err != nil {
+			return err
+		}
+		muting := make(map[primitive.ObjectID]bool, len(mutedBy))
+		for _, id := range mutedBy {
+			muting[id] = true
+		}
+		for _, id := range followers {
+			if !muting[id] {
+				users = append(users, id)
+			}
+		}
+	}
+	data, err := json.Marshal(post)
+	if err != nil {
+		return err
+	}
+	p.Hub.Publish(Message{Type: PostMessage, Users: users, Data: data})
+	return nil
+}
+
+// Notify publishes a notification to its user, with its summary.
+// It can be the OnNotify of a notifications.Notifier.
+// Notifications which are already read are not published.
+func (p *Publisher) Notify(ctx context.Context, n models.Notification) error {
+	if n.Read {
+		return nil
+	}
+	list := []models.Notification{n}
+	if err := notifications.Summarize(ctx, p.Store, list); err != nil {
+		return err
+	}
+	data, err := json.Marshal(list[0])
+	if err != nil {
+		return err
+	}
+	p.Hub.Publish(Message{Type: NotificationMessage, Users: []primitive.ObjectID{n.UserID}, Data: data})
+	return nil
+}
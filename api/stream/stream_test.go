@@ -0,0 +1,130 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub(2)
+	ada, bob := primitive.NewObjectID(), primitive.NewObjectID()
+	adaSub := hub.Subscribe(ada)
+	bobSub := hub.Subscribe(bob)
+
+	hub.Publish(Message{Type: PostMessage, Users: []primitive.ObjectID{ada, ada}, Data: json.RawMessage(`1`)})
+	if msg := <-adaSub.C; string(msg.Data) != "1" {
+		t.Errorf("ada received %s, expected 1", msg.Data)
+	}
+	select {
+	case msg := <-adaSub.C:
+		t.Errorf("ada received %s twice", msg.Data)
+	case msg := <-bobSub.C:
+		t.Errorf("bob received %s", msg.Data)
+	default:
+	}
+
+	// bob does not read, and is dropped when his buffer is full
+	for i := 0; i < 3; i++ {
+		hub.Publish(Message{Type: PostMessage, Users: []primitive.ObjectID{ada, bob}})
+		<-adaSub.C
+	}
+	if !bobSub.Dropped() || adaSub.Dropped() {
+		t.Errorf("dropped: bob %v, ada %v, expected only bob", bobSub.Dropped(), adaSub.Dropped())
+	}
+	n := 0
+	for range bobSub.C {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("bob received %d messages before being dropped, expected 2", n)
+	}
+
+	bobSub.Close()
+	adaSub.Close()
+	adaSub.Close()
+	if _, ok := <-adaSub.C; ok {
+		t.Error("the channel of a closed subscription is open")
+	}
+	if n := hub.Subscribers(); n != 0 {
+		t.Errorf("%d subscribers left", n)
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	author := models.User{Name: "Ada", Email: "ada@example.com", PwdHash: "x"}
+	follower := models.User{Name: "Bob", Email: "bob@example.com", PwdHash: "x"}
+	other := models.User{Name: "Eve", Email: "eve@example.com", PwdHash: "x"}
+	for _, u := range []*models.User{&author, &follower, &other} {
+		if err := st.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := st.Follow(ctx, follower.UserID, author.UserID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := NewHub(4)
+	p := &Publisher{Hub: hub, Store: st}
+	authorSub, followerSub, otherSub := hub.Subscribe(author.UserID), hub.Subscribe(follower.UserID), hub.Subscribe(other.UserID)
+
+	post := models.Post{PostID: primitive.NewObjectID(), PostedByUID: author.UserID, Caption: "hello", PostedOn: time.Now().UTC()}
+	if err := p.PublishPost(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range []*Subscription{authorSub, followerSub} {
+		msg := <-sub.C
+		var got models.Post
+		if err := json.Unmarshal(msg.Data, &got); err != nil || msg.Type != PostMessage || got.PostID != post.PostID {
+			t.Errorf("received %s %s, expected the post (%v)", msg.Type, msg.Data, err)
+		}
+	}
+
+	n := models.Notification{ID: primitive.NewObjectID(), UserID: other.UserID, Type: "follow", Actors: []primitive.ObjectID{follower.UserID}}
+	if err := p.Notify(ctx, n); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-otherSub.C
+	var got models.Notification
+	if err := json.Unmarshal(msg.Data, &got); err != nil || msg.Type != NotificationMessage || got.Summary != "Bob started following you" {
+		t.Errorf("received %s %s, expected the notification with its summary (%v)", msg.Type, msg.Data, err)
+	}
+
+	n.Read = true
+	if err := p.Notify(ctx, n); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-otherSub.C:
+		t.Errorf("a read notification was published: %s", msg.Data)
+	default:
+	}
+}
+
+func TestPublisherMute(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	author, follower := primitive.NewObjectID(), primitive.NewObjectID()
+	st.Follow(ctx, follower, author, false)
+	st.Mute(ctx, follower, author)
+
+	hub := NewHub(4)
+	p := &Publisher{Hub: hub, Store: st}
+	sub := hub.Subscribe(follower)
+	if err := p.PublishPost(ctx, models.Post{PostID: primitive.NewObjectID(), PostedByUID: author, Caption: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-sub.C:
+		t.Errorf("a post was published to a user who muted its author: %s", msg.Data)
+	default:
+	}
+}
@@ -0,0 +1,228 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spans are exported in the JSON encoding of the OTLP protocol
+// (an ExportTraceServiceRequest), see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// Only one of the fields is set. Integers are encoded as strings as per
+// the JSON mapping of int64 in protobuf.
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func toOTLPValue(v interface{}) otlpValue {
+	switch val := v.(type) {
+	case string:
+		return otlpValue{StringValue: &val}
+	case bool:
+		return otlpValue{BoolValue: &val}
+	case int:
+		s := strconv.FormatInt(int64(val), 10)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(val, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &val}
+	default:
+		s := fmt.Sprint(val)
+		return otlpValue{StringValue: &s}
+	}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func buildRequest(serviceName string, spans []*Span) otlpRequest {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+
+	for _, s := range spans {
+		s.mu.Lock()
+		out := otlpSpan{
+			TraceID:           s.context.TraceID.String(),
+			SpanID:            s.context.SpanID.String(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Status:            otlpStatus{Code: s.statusCode, Message: s.statusMessage},
+		}
+		if s.parentSpanID.IsValid() {
+			out.ParentSpanID = s.parentSpanID.String()
+		}
+		for _, attr := range s.attributes {
+			out.Attributes = append(out.Attributes, otlpKeyValue{Key: attr.Key, Value: toOTLPValue(attr.Value)})
+		}
+		s.mu.Unlock()
+
+		otlpSpans = append(otlpSpans, out)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: toOTLPValue(serviceName)},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "appyinsta/api/tracing"},
+			Spans: otlpSpans,
+		}},
+	}}}
+}
+
+// WriterExporter writes each batch as one line of OTLP/JSON, which is the
+// format of the OpenTelemetry collector's file exporter and receiver
+type WriterExporter struct {
+	serviceName string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterExporter(serviceName string, w io.Writer) *WriterExporter {
+	return &WriterExporter{serviceName: serviceName, w: w}
+}
+
+func (e *WriterExporter) Export(ctx context.Context, spans []*Span) error {
+	line, err := json.Marshal(buildRequest(e.serviceName, spans))
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	if c, ok := e.w.(io.Closer); ok && e.w != os.Stdout && e.w != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+// HTTPExporter posts each batch to an OTLP/HTTP endpoint,
+// for example http://localhost:4318/v1/traces for a local collector
+type HTTPExporter struct {
+	serviceName string
+	endpoint    string
+	client      *http.Client
+}
+
+func NewHTTPExporter(serviceName string, endpoint string) *HTTPExporter {
+	return &HTTPExporter{
+		serviceName: serviceName,
+		endpoint:    endpoint,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *HTTPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(buildRequest(e.serviceName, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (e *HTTPExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// NewExporter creates an exporter from the value of the APPYINSTA_TRACES
+// environment variable: "stdout", an http(s) URL of a collector endpoint,
+// or otherwise the path of a file to which spans are appended.
+func NewExporter(serviceName string, target string) (Exporter, error) {
+	switch {
+	case target == "stdout":
+		return NewWriterExporter(serviceName, os.Stdout), nil
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		return NewHTTPExporter(serviceName, target), nil
+	default:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return NewWriterExporter(serviceName, f), nil
+	}
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// NewCommandMonitor returns a command monitor for the MongoDB driver which
+// records every command as a child span of the span in the context of the
+// operation. Command documents are not recorded since they contain user data.
+func NewCommandMonitor(t *Tracer) *event.CommandMonitor {
+	if t == nil {
+		return nil
+	}
+
+	var inFlight sync.Map // driver request ID -> *Span
+
+	finish := func(requestID int64, failure string) {
+		v, ok := inFlight.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+		span := v.(*Span)
+		if failure != "" {
+			span.SetStatus(StatusError, failure)
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			_, span := t.Start(ctx, "mongodb."+evt.CommandName, SpanKindClient)
+			span.SetAttribute("db.system", "mongodb")
+			span.SetAttribute("db.name", evt.DatabaseName)
+			span.SetAttribute("db.operation", evt.CommandName)
+			span.SetAttribute("db.mongodb.connection_id", evt.ConnectionID)
+
+			// for most commands the collection is the value of the command name field
+			if coll, ok := evt.Command.Lookup(evt.CommandName).StringValueOK(); ok {
+				span.SetAttribute("db.mongodb.collection", coll)
+			}
+
+			inFlight.Store(evt.RequestID, span)
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			finish(evt.RequestID, "")
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			finish(evt.RequestID, evt.Failure)
+		},
+	}
+}
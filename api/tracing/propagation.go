@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Propagation of span contexts using the W3C Trace Context format:
+// https://www.w3.org/TR/trace-context/#traceparent-header
+
+const TraceparentHeader = "traceparent"
+
+const sampledFlag = 0x01
+
+// ParseTraceparent parses the value of a traceparent header
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, fmt.Errorf("traceparent must have 4 fields, found %d", len(parts))
+	}
+
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 || version[0] == 0xff {
+		return sc, fmt.Errorf("invalid traceparent version: %q", parts[0])
+	}
+	// version 00 has exactly 4 fields, later versions may append more
+	if version[0] == 0 && len(parts) != 4 {
+		return sc, fmt.Errorf("traceparent version 00 must have 4 fields, found %d", len(parts))
+	}
+
+	if err := decodeHexID(sc.TraceID[:], parts[1]); err != nil {
+		return sc, fmt.Errorf("invalid trace ID: %s", err)
+	}
+	if err := decodeHexID(sc.SpanID[:], parts[2]); err != nil {
+		return sc, fmt.Errorf("invalid parent ID: %s", err)
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, fmt.Errorf("invalid trace flags: %q", parts[3])
+	}
+	sc.Sampled = flags[0]&sampledFlag != 0
+
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("trace ID and parent ID must not be all zeroes")
+	}
+	return sc, nil
+}
+
+// FormatTraceparent returns the traceparent header value for a span context
+func FormatTraceparent(sc SpanContext) string {
+	var flags byte
+	if sc.Sampled {
+		flags = sampledFlag
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, flags)
+}
+
+func decodeHexID(dst []byte, s string) error {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return fmt.Errorf("expected %d lowercase hex characters, found %q", 2*len(dst), s)
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
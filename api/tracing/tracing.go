@@ -0,0 +1,285 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// A minimal tracer modelled after OpenTelemetry. Spans are started from a
+// context (which may carry a parent span, or a remote parent received in a
+// traceparent header), and are handed to an Exporter in batches once they end.
+// A nil *Tracer is valid and does nothing, so that tracing can be disabled
+// without checks at every call site.
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+func (id SpanID) IsValid() bool  { return id != SpanID{} }
+
+// SpanContext is the part of a span that is propagated across process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// The values match the SpanKind enum of the OTLP protocol
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// The values match the Status.StatusCode enum of the OTLP protocol
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+type Span struct {
+	tracer *Tracer
+
+	mu            sync.Mutex
+	context       SpanContext
+	parentSpanID  SpanID
+	name          string
+	kind          SpanKind
+	start         time.Time
+	end           time.Time
+	attributes    []Attribute
+	statusCode    StatusCode
+	statusMessage string
+	ended         bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, Attribute{Key: key, Value: value})
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusCode = code
+	s.statusMessage = message
+}
+
+// End records the end time of the span and queues it for export.
+// Calling End more than once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.context.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+// Exporter sends a batch of ended spans to their destination
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+type Tracer struct {
+	serviceName string
+	exporter    Exporter
+	onError     func(error)
+
+	mu      sync.Mutex
+	pending []*Span
+	flushCh chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+const (
+	maxBatchSize  = 256
+	flushInterval = 5 * time.Second
+)
+
+// NewTracer creates a tracer which exports spans in the background.
+// onError is called with export errors; it may be nil.
+func NewTracer(serviceName string, exporter Exporter, onError func(error)) *Tracer {
+	t := &Tracer{
+		serviceName: serviceName,
+		exporter:    exporter,
+		onError:     onError,
+		flushCh:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+func (t *Tracer) ServiceName() string {
+	if t == nil {
+		return ""
+	}
+	return t.serviceName
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying the given span,
+// which becomes the parent of spans started from that context
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemoteParent returns a copy of ctx carrying a span context
+// received from another process, see ParseTraceparent
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Start starts a new span. Its parent is the span in ctx if there is one,
+// otherwise the remote parent in ctx if there is one, otherwise the span
+// becomes the root of a new trace.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	var parent SpanContext
+	if s := SpanFromContext(ctx); s != nil {
+		parent = s.context
+	} else if sc, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		parent = sc
+	}
+
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	span.context.SpanID = newSpanID()
+
+	if parent.IsValid() {
+		span.context.TraceID = parent.TraceID
+		span.context.Sampled = parent.Sampled
+		span.parentSpanID = parent.SpanID
+	} else {
+		span.context.TraceID = newTraceID()
+		span.context.Sampled = true
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	t.mu.Lock()
+	t.pending = append(t.pending, s)
+	full := len(t.pending) >= maxBatchSize
+	t.mu.Unlock()
+
+	if full {
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.flush(context.Background())
+		case <-t.flushCh:
+			t.flush(context.Background())
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *Tracer) flush(ctx context.Context) {
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := t.exporter.Export(ctx, batch); err != nil && t.onError != nil {
+		t.onError(err)
+	}
+}
+
+// Shutdown exports the remaining spans and shuts down the exporter
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	close(t.done)
+	<-t.stopped
+	t.flush(ctx)
+	return t.exporter.Shutdown(ctx)
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
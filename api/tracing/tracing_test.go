@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceparent(header)
+	if err != nil {
+		t.Fatalf("Could not parse a valid traceparent: %s", err)
+	}
+
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected span context parsed: %+v", sc)
+	}
+
+	if got := FormatTraceparent(sc); got != header {
+		t.Errorf("Unexpected traceparent formatted. Expected %s and got %s", header, got)
+	}
+}
+
+func TestParseTraceparentInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+
+	for _, header := range invalid {
+		if _, err := ParseTraceparent(header); err == nil {
+			t.Errorf("Expected an error when parsing %q", header)
+		}
+	}
+}
+
+func TestCommandSpansAreChildrenOfRequestSpan(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("appyinsta-test", NewWriterExporter("appyinsta-test", &buf), nil)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, reqSpan := tracer.Start(ContextWithRemoteParent(context.Background(), remote), "GET /posts/users/", SpanKindServer)
+
+	monitor := NewCommandMonitor(tracer)
+	command, _ := bson.Marshal(bson.D{{Key: "find", Value: "posts"}})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "appyinsta", CommandName: "find", RequestID: 7})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 7}})
+	reqSpan.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Could not shut down the tracer: %s", err)
+	}
+
+	var exported otlpRequest
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatalf("Exported spans are not valid JSON: %s", err)
+	}
+
+	spans := exported.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans to be exported, got %d", len(spans))
+	}
+
+	cmdSpan, srvSpan := spans[0], spans[1]
+	if srvSpan.TraceID != remote.TraceID.String() || srvSpan.ParentSpanID != remote.SpanID.String() {
+		t.Errorf("Request span did not join the remote trace: %+v", srvSpan)
+	}
+	if cmdSpan.TraceID != srvSpan.TraceID || cmdSpan.ParentSpanID != srvSpan.SpanID {
+		t.Errorf("Command span is not a child of the request span: %+v", cmdSpan)
+	}
+	if cmdSpan.Name != "mongodb.find" || cmdSpan.Kind != SpanKindClient {
+		t.Errorf("Unexpected command span: %+v", cmdSpan)
+	}
+
+	found := false
+	for _, attr := range cmdSpan.Attributes {
+		if attr.Key == "db.mongodb.collection" && attr.Value.StringValue != nil && *attr.Value.StringValue == "posts" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Command span does not record the collection: %+v", cmdSpan.Attributes)
+	}
+}
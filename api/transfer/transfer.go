@@ -0,0 +1,326 @@
+// Package transfer exports and imports the users and posts collections as
+// NDJSON: one document per line, in the JSON form of models.User and
+// models.Post. IDs and timestamps are kept, and users are exported with
+// their password hash in the password field (which is not hashed again
+// when importing), so that a database can be copied to another one.
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"appyinsta/api/caption"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Collections that can be exported and imported
+var Collections = []string{"users", "posts"}
+
+// BatchSize is the number of documents read or inserted at a time
+const BatchSize = 500
+
+// maxLineSize is the size of the longest line accepted by Import
+const maxLineSize = 1 << 20
+
+func checkCollection(collection string) error {
+	for _, c := range Collections {
+		if c == collection {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown collection %q, expected users or posts", collection)
+}
+
+// Export writes every document of the collection to w, in the order of their
+// IDs, and returns the number of documents written
+func Export(ctx context.Context, st store.Store, collection string, w io.Writer) (int, error) {
+	if err := checkCollection(collection); err != nil {
+		return 0, err
+	}
+
+	enc := json.NewEncoder(w)
+	n := 0
+	after := primitive.NilObjectID
+	for {
+		var docs []interface{}
+		if collection == "users" {
+			users, err := st.ListUsers(ctx, after, BatchSize)
+			if err != nil {
+				return n, err
+			}
+			for _, user := range users {
+				docs = append(docs, user)
+				after = user.UserID
+			}
+		} else {
+			posts, err := st.ListPosts(ctx, after, BatchSize)
+			if err != nil {
+				return n, err
+			}
+			for _, post := range posts {
+				docs = append(docs, post)
+				after = post.PostID
+			}
+		}
+
+		for _, doc := range docs {
+			if err := enc.Encode(doc); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(docs) < BatchSize {
+			return n, nil
+		}
+	}
+}
+
+// Options of Import
+type Options struct {
+	// what to do with documents which have the ID of an existing one
+	OnConflict store.OnConflict
+	// only check the documents, without inserting them
+	DryRun bool
+	// if not nil, records every document inserted or replaced, see Recorder
+	Audit Recorder
+}
+
+// Recorder records the writes of Import, like audit.Log: one entry with
+// the action "admin.import" for every document inserted or replaced, with
+// the document it replaced as before
+type Recorder interface {
+	Record(ctx context.Context, action, collection string, id primitive.ObjectID, before, after interface{}) error
+}
+
+// ParseOnConflict parses the names of the store.OnConflict values used by
+// the CLI and the admin endpoints: error, skip and upsert
+func ParseOnConflict(name string) (store.OnConflict, error) {
+	switch name {
+	case "", "error":
+		return store.ConflictError, nil
+	case "skip":
+		return store.ConflictSkip, nil
+	case "upsert":
+		return store.ConflictUpsert, nil
+	}
+	return 0, fmt.Errorf("unknown conflict mode %q, expected error, skip or upsert", name)
+}
+
+// Result of Import
+type Result struct {
+	store.InsertResult
+	// the numbers of valid and invalid documents found in a dry run
+	Valid   int `json:"valid"`
+	Invalid int `json:"invalid"`
+	// the first maxDryRunErrors invalid lines found in a dry run
+	Errors []string `json:"errors,omitempty"`
+}
+
+// maxDryRunErrors is the number of invalid lines reported by a dry run
+const maxDryRunErrors = 100
+
+// LineError is returned by Import for an invalid line
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Import reads documents from r and inserts them in batches of BatchSize.
+// It stops at the first invalid line, or at the first conflict if
+// opts.OnConflict is store.ConflictError, and returns the counts of the
+// documents written before it. In a dry run, every line is checked and
+// nothing is written.
+func Import(ctx context.Context, st store.Store, collection string, r io.Reader, opts Options) (Result, error) {
+	var res Result
+	if err := checkCollection(collection); err != nil {
+		return res, err
+	}
+
+	var users []models.User
+	var posts []models.Post
+	flush := func() error {
+		defer func() { users, posts = users[:0], posts[:0] }()
+
+		var existing map[primitive.ObjectID]interface{}
+		if opts.Audit != nil {
+			var err error
+			if existing, err = getExisting(ctx, st, users, posts); err != nil {
+				return err
+			}
+		}
+
+		var batch store.InsertResult
+		var err error
+		if collection == "users" {
+			batch, err = st.InsertUsers(ctx, users, opts.OnConflict)
+		} else {
+			batch, err = st.InsertPosts(ctx, posts, opts.OnConflict)
+		}
+		res.Inserted += batch.Inserted
+		res.Replaced += batch.Replaced
+		res.Skipped += batch.Skipped
+
+		if opts.Audit != nil {
+			// the documents are written in order, and an error stops the batch
+			written := len(users) + len(posts)
+			if err != nil {
+				written = batch.Inserted + batch.Replaced + batch.Skipped
+			}
+			if auditErr := record(ctx, opts, collection, users, posts, existing, written); err == nil {
+				err = auditErr
+			}
+		}
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var err error
+		if collection == "users" {
+			var user models.User
+			if err = decodeLine(scanner.Bytes(), &user); err == nil {
+				err = validateUser(user)
+			}
+			users = append(users, user)
+		} else {
+			var post models.Post
+			if err = decodeLine(scanner.Bytes(), &post); err == nil {
+				err = validatePost(post)
+			}
+			posts = append(posts, post)
+		}
+
+		if opts.DryRun {
+			// nothing is inserted, so the documents are not kept
+			users, posts = users[:0], posts[:0]
+			if err == nil {
+				res.Valid++
+				continue
+			}
+			res.Invalid++
+			if len(res.Errors) < maxDryRunErrors {
+				res.Errors = append(res.Errors, (&LineError{Line: line, Err: err}).Error())
+			}
+			continue
+		}
+		if err != nil {
+			return res, &LineError{Line: line, Err: err}
+		}
+
+		if len(users)+len(posts) == BatchSize {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+	if opts.DryRun {
+		return res, nil
+	}
+	return res, flush()
+}
+
+// getExisting returns the documents with the IDs of a batch of users or
+// posts, by ID
+func getExisting(ctx context.Context, st store.Store, users []models.User, posts []models.Post) (map[primitive.ObjectID]interface{}, error) {
+	existing := map[primitive.ObjectID]interface{}{}
+	if len(users) > 0 {
+		ids := make([]primitive.ObjectID, len(users))
+		for i, user := range users {
+			ids[i] = user.UserID
+		}
+		found, err := st.GetUsers(ctx, ids)
+		for _, user := range found {
+			existing[user.UserID] = user
+		}
+		return existing, err
+	}
+	ids := make([]primitive.ObjectID, len(posts))
+	for i, post := range posts {
+		ids[i] = post.PostID
+	}
+	found, err := st.GetPosts(ctx, ids)
+	for _, post := range found {
+		existing[post.PostID] = post
+	}
+	return existing, err
+}
+
+// record records the first n documents of a batch which were inserted, or
+// replaced an existing one
+func record(ctx context.Context, opts Options, collection string, users []models.User, posts []models.Post, existing map[primitive.ObjectID]interface{}, n int) error {
+	for i := 0; i < n; i++ {
+		var id primitive.ObjectID
+		var doc interface{}
+		if collection == "users" {
+			id, doc = users[i].UserID, users[i]
+		} else {
+			id, doc = posts[i].PostID, posts[i]
+		}
+		before, ok := existing[id]
+		if ok && opts.OnConflict != store.ConflictUpsert {
+			// skipped
+			continue
+		}
+		if err := opts.Audit.Record(ctx, "admin.import", collection, id, before, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The documents are checked like the API checks the documents it creates,
+// and must also have the fields which are set at the server
+
+func validateUser(user models.User) error {
+	if user.UserID.IsZero() {
+		return errors.New("missing id")
+	}
+	if user.Name == "" || user.Email == "" || user.PwdHash == "" {
+		return errors.New("name, email and password must not be empty")
+	}
+	if user.Username != "" && !caption.IsUsername(user.Username) {
+		return errors.New("bad username")
+	}
+	return nil
+}
+
+func validatePost(post models.Post) error {
+	if post.PostID.IsZero() {
+		return errors.New("missing id")
+	}
+	if post.PostedByUID.IsZero() || post.Caption == "" || post.ImgURL == "" || post.PostedOn.IsZero() {
+		return errors.New("posted_by, caption, img_url and posted_on must not be empty")
+	}
+	return nil
+}
+
+// decodeLine decodes a document, rejecting unknown fields like the API does
+func decodeLine(line []byte, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	return dec.Decode(dst)
+}
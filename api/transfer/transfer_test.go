@@ -0,0 +1,184 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// seed creates n users with a post each
+func seed(t *testing.T, st store.Store, n int) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		user := models.User{Name: fmt.Sprint("user", i), Email: fmt.Sprintf("user%d@example.com", i), PwdHash: "hash"}
+		if err := st.CreateUser(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+		post := models.Post{PostedByUID: user.UserID, Caption: "post", ImgURL: "img", PostedOn: time.Date(2021, 10, 9, 8, 49, 17, 482000000, time.UTC)}
+		if err := st.CreatePost(ctx, &post); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func export(t *testing.T, st store.Store, collection string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Export(context.Background(), st, collection, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	src, dst := store.NewMemoryStore(), store.NewMemoryStore()
+	// more than a batch, to check the paging of Export and the batches of Import
+	seed(t, src, BatchSize+3)
+
+	for _, collection := range Collections {
+		data := export(t, src, collection)
+		if n := strings.Count(data, "\n"); n != BatchSize+3 {
+			t.Fatalf("exported %d %s", n, collection)
+		}
+
+		res, err := Import(context.Background(), dst, collection, strings.NewReader(data), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Inserted != BatchSize+3 {
+			t.Errorf("imported %+v", res)
+		}
+		if again := export(t, dst, collection); again != data {
+			t.Errorf("%s differ after the import", collection)
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	ctx := context.Background()
+	src := store.NewMemoryStore()
+	seed(t, src, 3)
+	data := export(t, src, "users")
+
+	dst := store.NewMemoryStore()
+	first := strings.SplitAfter(data, "\n")[0]
+	if _, err := Import(ctx, dst, "users", strings.NewReader(first), Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Import(ctx, dst, "users", strings.NewReader(data), Options{}); !errors.Is(err, store.ErrDuplicateID) {
+		t.Errorf("expected a duplicate ID error, got %v", err)
+	}
+
+	res, err := Import(ctx, dst, "users", strings.NewReader(data), Options{OnConflict: store.ConflictSkip})
+	if err != nil || res.Inserted != 2 || res.Skipped != 1 {
+		t.Errorf("skip: %+v, %v", res, err)
+	}
+
+	res, err = Import(ctx, dst, "users", strings.NewReader(data), Options{OnConflict: store.ConflictUpsert})
+	if err != nil || res.Replaced != 3 || res.Inserted != 0 {
+		t.Errorf("upsert: %+v, %v", res, err)
+	}
+}
+
+// recorder records the calls to Record
+type recorder []recorded
+
+type recorded struct {
+	id            primitive.ObjectID
+	before, after interface{}
+}
+
+func (r *recorder) Record(ctx context.Context, action, collection string, id primitive.ObjectID, before, after interface{}) error {
+	*r = append(*r, recorded{id, before, after})
+	return nil
+}
+
+func TestImportAudit(t *testing.T) {
+	ctx := context.Background()
+	src := store.NewMemoryStore()
+	seed(t, src, 3)
+	data := export(t, src, "users")
+	lines := strings.SplitAfter(data, "\n")
+
+	// the second user exists, with another role
+	dst := store.NewMemoryStore()
+	var rec recorder
+	if _, err := Import(ctx, dst, "users", strings.NewReader(lines[1]), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	users, _ := src.ListUsers(ctx, primitive.NilObjectID, 3)
+	dst.SetUserRole(ctx, users[1].UserID, models.RoleAdmin)
+
+	// the import stops at the second user
+	if _, err := Import(ctx, dst, "users", strings.NewReader(data), Options{Audit: &rec}); !errors.Is(err, store.ErrDuplicateID) {
+		t.Fatalf("expected a duplicate ID error, got %v", err)
+	}
+	if len(rec) != 1 || rec[0].id != users[0].UserID || rec[0].before != nil {
+		t.Errorf("error: recorded %+v", rec)
+	}
+
+	rec = nil
+	if _, err := Import(ctx, dst, "users", strings.NewReader(data), Options{OnConflict: store.ConflictSkip, Audit: &rec}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec) != 1 || rec[0].id != users[2].UserID {
+		t.Errorf("skip: recorded %+v", rec)
+	}
+
+	rec = nil
+	if _, err := Import(ctx, dst, "users", strings.NewReader(data), Options{OnConflict: store.ConflictUpsert, Audit: &rec}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec) != 3 {
+		t.Fatalf("upsert: recorded %+v", rec)
+	}
+	if before, ok := rec[1].before.(models.User); !ok || before.Role != models.RoleAdmin || rec[1].after.(models.User).Role != "" {
+		t.Errorf("upsert: recorded %+v for the replaced user", rec[1])
+	}
+}
+
+func TestValidation(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	lines := []string{
+		`{"id":"` + id + `","posted_by":"` + id + `","caption":"c","img_url":"i","posted_on":"2021-10-09T08:49:17.482Z"}`,
+		`{"posted_by":"` + id + `","caption":"c","img_url":"i","posted_on":"2021-10-09T08:49:17.482Z"}`,
+		``,
+		`{"id":"` + primitive.NewObjectID().Hex() + `","caption":"c"}`,
+		`{"id":"nope"}`,
+		`{"id":"` + primitive.NewObjectID().Hex() + `","likes":3}`,
+	}
+	data := strings.Join(lines, "\n")
+	st := store.NewMemoryStore()
+
+	res, err := Import(context.Background(), st, "posts", strings.NewReader(data), Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Valid != 1 || res.Invalid != 4 || len(res.Errors) != 4 || !strings.HasPrefix(res.Errors[0], "line 2: missing id") {
+		t.Errorf("dry run: %+v", res)
+	}
+	if posts, _ := st.ListPosts(context.Background(), primitive.NilObjectID, 0); len(posts) != 0 {
+		t.Errorf("a dry run inserted %d posts", len(posts))
+	}
+
+	_, err = Import(context.Background(), st, "posts", strings.NewReader(data), Options{})
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 2 {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+
+	if _, err := Import(context.Background(), st, "comments", strings.NewReader(data), Options{}); err == nil {
+		t.Error("expected an error for an unknown collection")
+	}
+}
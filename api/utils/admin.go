@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+type adminKey struct{}
+
+// IsAdmin reports whether the request was authenticated by MakeAdminHandler
+func IsAdmin(ctx context.Context) bool {
+	return ctx.Value(adminKey{}) != nil
+}
+
+// This function wraps a handler so that it can only be called with the
+// admin token, sent as "Authorization: Bearer <token>". If the token is
+// empty, every request is rejected. See IsAdmin.
+func MakeAdminHandler(token string, handlerFn func(writer http.ResponseWriter, req *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		sent := strings.TrimPrefix(auth, "Bearer ")
+
+		if token == "" || sent == auth || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="appyinsta admin"`)
+			WriteError(w, req, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handlerFn(w, req.WithContext(context.WithValue(req.Context(), adminKey{}, true)))
+	}
+}
+
+// This function is like MakeAdminHandler for the routes which users can
+// call too: the requests with HTTP Basic credentials go to userHandlerFn,
+// typically a MakeUserAuthHandler around a MakeCheckPermissionHandler, and
+// the others need the admin token.
+func MakeAdminOrUserHandler(token string, userHandlerFn, handlerFn func(writer http.ResponseWriter, req *http.Request)) http.HandlerFunc {
+	admin := MakeAdminHandler(token, handlerFn)
+	return func(w http.ResponseWriter, req *http.Request) {
+		if _, _, ok := req.BasicAuth(); ok {
+			userHandlerFn(w, req)
+			return
+		}
+		admin(w, req)
+	}
+}
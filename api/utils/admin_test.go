@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	ok := func(w http.ResponseWriter, req *http.Request) {
+		if !IsAdmin(req.Context()) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	cases := []struct {
+		token  string
+		auth   string
+		status int
+	}{
+		{"s3cret", "Bearer s3cret", http.StatusOK},
+		{"s3cret", "Bearer nope", http.StatusUnauthorized},
+		{"s3cret", "s3cret", http.StatusUnauthorized},
+		{"s3cret", "Basic czNjcmV0", http.StatusUnauthorized},
+		{"s3cret", "", http.StatusUnauthorized},
+		{"", "Bearer ", http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/admin/export/users", nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		w := httptest.NewRecorder()
+		MakeAdminHandler(c.token, ok)(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("token %q, Authorization %q: expected %d, got %d", c.token, c.auth, c.status, w.Code)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: WWW-Authenticate not set", c.auth)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+
+	"appyinsta/api/logging"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Authenticator checks the login (a user ID or username) and the password
+// of a user, and returns the ID of the user if they are right
+type Authenticator func(ctx context.Context, login, password string) (primitive.ObjectID, bool, error)
+
+type userIDKey struct{}
+
+// UserID returns the ID of the user authenticated by MakeUserAuthHandler
+func UserID(ctx context.Context) (primitive.ObjectID, bool) {
+	id, ok := ctx.Value(userIDKey{}).(primitive.ObjectID)
+	return id, ok
+}
+
+// ContextWithUserID returns a copy of ctx for the requests of a user
+func ContextWithUserID(ctx context.Context, userID primitive.ObjectID) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// This function wraps a handler so that it can only be called by a user,
+// with HTTP Basic authentication. The ID of the user is then in the context
+// of the request, see UserID.
+func MakeUserAuthHandler(authenticate Authenticator, handlerFn func(writer http.ResponseWriter, req *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		login, password, ok := req.BasicAuth()
+		var userID primitive.ObjectID
+		if ok {
+			var err error
+			userID, ok, err = authenticate(req.Context(), login, password)
+			if err == ErrTooManyAttempts {
+				WriteError(w, req, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			} else if err != nil {
+				logging.FromContext(req.Context()).Error("could not authenticate", "err", err)
+				WriteError(w, req, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="appyinsta", charset="UTF-8"`)
+			WriteError(w, req, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handlerFn(w, req.WithContext(ContextWithUserID(req.Context(), userID)))
+	}
+}
+
+// This function is like MakeUserAuthHandler for the handlers which anonymous
+// users can call too: the user is only authenticated if the request has
+// credentials, and else there is no user ID in the context.
+func MakeOptionalUserAuthHandler(authenticate Authenticator, handlerFn func(writer http.ResponseWriter, req *http.Request)) http.HandlerFunc {
+	authenticated := MakeUserAuthHandler(authenticate, handlerFn)
+	return func(w http.ResponseWriter, req *http.Request) {
+		if _, _, ok := req.BasicAuth(); !ok {
+			handlerFn(w, req)
+			return
+		}
+		authenticated(w, req)
+	}
+}
+
+// Authorizer reports whether a user has a permission
+type Authorizer func(ctx context.Context, userID primitive.ObjectID, permission string) (bool, error)
+
+// This function is a wrapper for checking that the user authenticated by
+// MakeUserAuthHandler has a permission
+func MakeCheckPermissionHandler(permission string, authorize Authorizer, handlerFn func(writer http.ResponseWriter, req *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		userID, ok := UserID(req.Context())
+		if ok {
+			var err error
+			if ok, err = authorize(req.Context(), userID, permission); err != nil {
+				logging.FromContext(req.Context()).Error("could not authorize", "err", err, "permission", permission)
+				WriteError(w, req, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if !ok {
+			WriteError(w, req, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handlerFn(w, req)
+	}
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserAuthHandler(t *testing.T) {
+	ann := primitive.NewObjectID()
+	authenticate := func(ctx context.Context, login, password string) (primitive.ObjectID, bool, error) {
+		if login == "broken" {
+			return primitive.NilObjectID, false, errors.New("broken")
+		}
+		return ann, login == "ann" && password == "s3cret", nil
+	}
+	handler := MakeUserAuthHandler(authenticate, func(w http.ResponseWriter, req *http.Request) {
+		if id, ok := UserID(req.Context()); !ok || id != ann {
+			t.Errorf("user ID in the context is %v, %v", id, ok)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		login, password string
+		status          int
+	}{
+		{"ann", "s3cret", http.StatusOK},
+		{"ann", "nope", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+		{"broken", "s3cret", http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/notifications", nil)
+		if c.login != "" {
+			req.SetBasicAuth(c.login, c.password)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("login %q, password %q: expected %d, got %d", c.login, c.password, c.status, w.Code)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("login %q: WWW-Authenticate not set", c.login)
+		}
+	}
+}
+
+func TestOptionalUserAuthHandler(t *testing.T) {
+	ann := primitive.NewObjectID()
+	authenticate := func(ctx context.Context, login, password string) (primitive.ObjectID, bool, error) {
+		return ann, login == "ann" && password == "s3cret", nil
+	}
+	var got []bool
+	handler := MakeOptionalUserAuthHandler(authenticate, func(w http.ResponseWriter, req *http.Request) {
+		_, ok := UserID(req.Context())
+		got = append(got, ok)
+	})
+
+	cases := []struct {
+		login, password string
+		status          int
+	}{
+		{"", "", http.StatusOK},
+		{"ann", "s3cret", http.StatusOK},
+		{"ann", "nope", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/posts/users/6160fe9757a258c6bdc94056", nil)
+		if c.login != "" {
+			req.SetBasicAuth(c.login, c.password)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != c.status {
+			t.Errorf("login %q, password %q: expected %d, got %d", c.login, c.password, c.status, w.Code)
+		}
+	}
+	if len(got) != 2 || got[0] || !got[1] {
+		t.Errorf("the handler was called with a user ID: %v", got)
+	}
+}
+
+func TestCheckPermissionHandler(t *testing.T) {
+	ann, bob := primitive.NewObjectID(), primitive.NewObjectID()
+	authenticate := func(ctx context.Context, login, password string) (primitive.ObjectID, bool, error) {
+		id := map[string]primitive.ObjectID{"ann": ann, "bob": bob}[login]
+		return id, !id.IsZero() && password == "s3cret", nil
+	}
+	// only Ann can moderate
+	authorize := func(ctx context.Context, userID primitive.ObjectID, permission string) (bool, error) {
+		return userID == ann && permission == "moderate", nil
+	}
+	ok := func(w http.ResponseWriter, req *http.Request) { w.WriteHeader(http.StatusOK) }
+	user := MakeUserAuthHandler(authenticate, MakeCheckPermissionHandler("moderate", authorize, ok))
+	handler := MakeAdminOrUserHandler("t0ken", user, ok)
+
+	cases := []struct {
+		login, auth string
+		status      int
+	}{
+		{"ann", "", http.StatusOK},
+		{"bob", "", http.StatusForbidden},
+		{"", "Bearer t0ken", http.StatusOK},
+		{"", "Bearer nope", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/admin/reports", nil)
+		if c.login != "" {
+			req.SetBasicAuth(c.login, "s3cret")
+		} else if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != c.status {
+			t.Errorf("login %q, Authorization %q: expected %d, got %d", c.login, c.auth, c.status, w.Code)
+		}
+	}
+
+	// without an authenticated user
+	w := httptest.NewRecorder()
+	MakeCheckPermissionHandler("moderate", authorize, ok)(w, httptest.NewRequest("GET", "/admin/reports", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("an anonymous request got %d", w.Code)
+	}
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+)
+
+type clientIPKey struct{}
+
+// ClientIP returns the address of the client set by MakeClientIPHandler,
+// or an empty string if the request did not go through it.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// ContextWithClientIP returns a copy of ctx carrying the address of the client
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// This function wraps a handler so that the address of the client, as
+// identified by clientIP (like the key of the rate limits), is in the
+// context of the requests, see ClientIP.
+func MakeClientIPHandler(clientIP func(req *http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(ContextWithClientIP(req.Context(), clientIP(req))))
+	})
+}
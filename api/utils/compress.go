@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Compression of responses according to the Accept-Encoding header.
+// Responses smaller than the minimum size are sent as they are, since
+// compressing them does not save anything.
+
+type ContentEncoding struct {
+	Name      string
+	NewWriter func(w io.Writer) io.WriteCloser
+}
+
+// Supported encodings in order of preference of the server.
+// Other encodings (such as br) can be added with RegisterContentEncoding.
+var contentEncodings = []ContentEncoding{
+	{Name: "gzip", NewWriter: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+	{Name: "deflate", NewWriter: func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	}},
+}
+
+// RegisterContentEncoding adds a content encoding, preferred to the existing
+// ones. It must be called before the server starts.
+func RegisterContentEncoding(enc ContentEncoding) {
+	contentEncodings = append([]ContentEncoding{enc}, contentEncodings...)
+}
+
+// negotiateEncoding chooses the content encoding for an Accept-Encoding header.
+// It returns false if the response should not be compressed.
+func negotiateEncoding(acceptEncoding string) (ContentEncoding, bool) {
+	items := parseAccept(acceptEncoding)
+	named := namedValues(acceptEncoding)
+
+	// at each quality, from the highest, the server's preference wins.
+	// The wildcard only stands for the encodings the client did not name,
+	// so that it never brings back one refused with q=0.
+	for i := 0; i < len(items); {
+		q := items[i].q
+		j := i
+		for j < len(items) && items[j].q == q {
+			j++
+		}
+		for _, enc := range contentEncodings {
+			for _, item := range items[i:j] {
+				if item.value == enc.Name || (item.value == "*" && !named[enc.Name]) {
+					return enc, true
+				}
+			}
+		}
+		i = j
+	}
+	return ContentEncoding{}, false
+}
+
+// Content types which are already compressed or are streamed are not compressed
+func compressible(contentType string) bool {
+	return !strings.HasPrefix(contentType, "image/") &&
+		!strings.HasPrefix(contentType, "video/") &&
+		!strings.HasPrefix(contentType, "text/event-stream")
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding ContentEncoding
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser // nil if the response is not compressed
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+
+	// responses without a body are never compressed
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.minSize {
+			return len(b), nil
+		}
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// start sends the header and the buffered body, compressed or not
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+
+	h := cw.Header()
+	if compress && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", cw.encoding.Name)
+		h.Del("Content-Length")
+		cw.enc = cw.encoding.NewWriter(cw.ResponseWriter)
+	}
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends what has been written so far. A response which is flushed
+// before reaching the minimum size is not compressed.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.start(false)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 {
+			// the handler wrote nothing at all
+			return
+		}
+		cw.start(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+	}
+}
+
+// This function wraps a handler so that responses of at least minSize bytes
+// are compressed with the best encoding accepted by the client.
+func MakeCompressionHandler(minSize int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding, ok := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+		if !ok || req.Method == "HEAD" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+		defer cw.close()
+
+		next.ServeHTTP(cw, req)
+	})
+}
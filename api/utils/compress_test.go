@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                            "",
+		"identity":                    "",
+		"gzip":                        "gzip",
+		"deflate":                     "deflate",
+		"deflate, gzip":               "gzip",
+		"deflate;q=1.0, gzip;q=0.5":   "deflate",
+		"gzip;q=0, deflate":           "deflate",
+		"br;q=1.0, gzip;q=0.8, *;q=0": "gzip",
+		"*":                           "gzip",
+		"gzip;q=0, *":                 "deflate",
+		"gzip;q=0, deflate;q=0, *":    "",
+		"gzip;q=0.5, *":               "deflate",
+		"br, *;q=0.5":                 "gzip",
+		"br, gzip;q=0.2, *;q=0.5":     "deflate",
+	}
+
+	for header, expected := range cases {
+		enc, ok := negotiateEncoding(header)
+		if (expected == "" && ok) || (expected != "" && enc.Name != expected) {
+			t.Errorf("Accept-Encoding %q: expected %q, got %q", header, expected, enc.Name)
+		}
+	}
+}
+
+func serveCompressed(body string, acceptEncoding string) *http.Response {
+	handler := MakeCompressionHandler(100, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		AddCommonHeaders(&w)
+		io.WriteString(w, body)
+	}))
+
+	req := httptest.NewRequest("GET", "/posts/users/616156d49ab2934adcee255e", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestCompressionHandler(t *testing.T) {
+	large := "[" + strings.Repeat(`{"caption":"Caption","img_url":"some.url.here"},`, 20) + "{}]"
+
+	resp := serveCompressed(large, "gzip")
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expected a gzip response, got headers %v", resp.Header)
+	}
+	gr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("Could not read gzip body: %s", err)
+	}
+	if body, _ := ioutil.ReadAll(gr); string(body) != large {
+		t.Errorf("Decompressed body does not match. Got %s", string(body))
+	}
+
+	resp = serveCompressed(large, "deflate")
+	if resp.Header.Get("Content-Encoding") != "deflate" {
+		t.Fatalf("Expected a deflate response, got headers %v", resp.Header)
+	}
+	if body, _ := ioutil.ReadAll(flate.NewReader(resp.Body)); string(body) != large {
+		t.Errorf("Decompressed body does not match. Got %s", string(body))
+	}
+
+	// small responses are sent as they are
+	resp = serveCompressed(`{"id":"6161578d7ca34c010e0f21d8"}`, "gzip")
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Encoding") != "" || string(body) != `{"id":"6161578d7ca34c010e0f21d8"}` {
+		t.Errorf("Expected an uncompressed response, got headers %v and body %s", resp.Header, string(body))
+	}
+
+	// as are responses to clients which do not accept compression
+	resp = serveCompressed(large, "")
+	body, _ = ioutil.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Encoding") != "" || string(body) != large {
+		t.Errorf("Expected an uncompressed response, got headers %v", resp.Header)
+	}
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Options for the CORS middleware, see MakeCORSHandler
+type CORSOptions struct {
+	// Origins allowed to make requests, for example https://app.example.com.
+	// "*" allows any origin and https://*.example.com allows any subdomain of example.com.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// Request headers allowed in requests, "*" allows any header
+	AllowedHeaders []string
+	// Response headers made available to the scripts of allowed origins
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// How long (in seconds) browsers may cache the result of a preflight request
+	MaxAge int
+}
+
+// Validate refuses to allow any origin with credentials, which would let any
+// website make requests with the credentials of its visitors
+func (opts CORSOptions) Validate() error {
+	if !opts.AllowCredentials {
+		return nil
+	}
+	for _, origin := range opts.AllowedOrigins {
+		if strings.TrimSpace(origin) == "*" {
+			return errors.New("credentials cannot be allowed for any origin (*), list the allowed origins instead")
+		}
+	}
+	return nil
+}
+
+type corsPolicy struct {
+	opts           CORSOptions
+	anyOrigin      bool
+	anyHeader      bool
+	origins        map[string]bool
+	wildcards      []wildcardOrigin
+	methods        map[string]bool
+	headers        map[string]bool
+	allowedMethods string
+	exposedHeaders string
+}
+
+// wildcardOrigin matches origins such as https://*.example.com
+type wildcardOrigin struct {
+	prefix string // https://
+	suffix string // .example.com
+}
+
+func (wo wildcardOrigin) matches(origin string) bool {
+	return len(origin) > len(wo.prefix)+len(wo.suffix) &&
+		strings.HasPrefix(origin, wo.prefix) &&
+		strings.HasSuffix(origin, wo.suffix)
+}
+
+func newCORSPolicy(opts CORSOptions) *corsPolicy {
+	p := &corsPolicy{
+		opts:           opts,
+		origins:        make(map[string]bool),
+		methods:        make(map[string]bool),
+		headers:        make(map[string]bool),
+		allowedMethods: strings.Join(opts.AllowedMethods, ", "),
+		exposedHeaders: strings.Join(opts.ExposedHeaders, ", "),
+	}
+
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		if origin == "*" {
+			p.anyOrigin = true
+		} else if i := strings.Index(origin, "*"); i >= 0 {
+			p.wildcards = append(p.wildcards, wildcardOrigin{prefix: origin[:i], suffix: origin[i+1:]})
+		} else {
+			p.origins[origin] = true
+		}
+	}
+	for _, method := range opts.AllowedMethods {
+		p.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range opts.AllowedHeaders {
+		if header == "*" {
+			p.anyHeader = true
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return p
+}
+
+func (p *corsPolicy) originAllowed(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, wo := range p.wildcards {
+		if wo.matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) headersAllowed(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !p.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin sets the Access-Control-Allow-Origin header. Any origin gets "*",
+// which browsers reject for credentialed requests, so credentials are only
+// allowed to the listed origins, see CORSOptions.Validate.
+func (p *corsPolicy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// This function wraps a handler so that browsers can call the API from the
+// allowed origins. Preflight requests are answered here and never reach the
+// wrapped handler (which would reject the OPTIONS method).
+func MakeCORSHandler(opts CORSOptions, next http.Handler) http.Handler {
+	p := newCORSPolicy(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		h := w.Header()
+
+		// the response depends on the Origin header unless every origin gets "*"
+		if !p.anyOrigin {
+			h.Add("Vary", "Origin")
+		}
+
+		preflight := req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != ""
+		if !preflight {
+			if origin != "" && p.originAllowed(origin) {
+				p.setOrigin(h, origin)
+				if p.exposedHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", p.exposedHeaders)
+				}
+			}
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+
+		method := strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+		requestedHeaders := req.Header.Get("Access-Control-Request-Headers")
+
+		// a failed preflight is answered without CORS headers, so that the browser blocks the request
+		if origin == "" || !p.originAllowed(origin) || !p.methods[method] || !p.headersAllowed(requestedHeaders) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		p.setOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", p.allowedMethods)
+		if requestedHeaders != "" {
+			// the requested headers have been checked, so they can be echoed
+			h.Set("Access-Control-Allow-Headers", requestedHeaders)
+		}
+		if p.opts.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(p.opts.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
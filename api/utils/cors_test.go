@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var testCORSOptions = CORSOptions{
+	AllowedOrigins:   []string{"https://app.example.com", "https://*.preview.example.com"},
+	AllowedMethods:   []string{"GET", "POST"},
+	AllowedHeaders:   []string{"Content-Type", "X-Request-ID"},
+	ExposedHeaders:   []string{"X-Request-ID"},
+	AllowCredentials: true,
+	MaxAge:           600,
+}
+
+func TestCORSPreflight(t *testing.T) {
+	handler := MakeCORSHandler(testCORSOptions, MakeCheckMethodHandler("POST", func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("Preflight request reached the handler")
+	}))
+
+	cases := []struct {
+		origin  string
+		method  string
+		headers string
+		allowed bool
+	}{
+		{"https://app.example.com", "POST", "content-type", true},
+		{"https://pr-12.preview.example.com", "POST", "Content-Type, X-Request-ID", true},
+		{"https://preview.example.com", "POST", "", false},
+		{"https://evil.com", "POST", "", false},
+		{"https://app.example.com", "DELETE", "", false},
+		{"https://app.example.com", "POST", "X-Admin", false},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("OPTIONS", "/posts", nil)
+		req.Header.Set("Origin", c.origin)
+		req.Header.Set("Access-Control-Request-Method", c.method)
+		if c.headers != "" {
+			req.Header.Set("Access-Control-Request-Headers", c.headers)
+		}
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("%s %s: expected status %d but received %d", c.origin, c.method, http.StatusNoContent, resp.StatusCode)
+		}
+
+		allowOrigin := resp.Header.Get("Access-Control-Allow-Origin")
+		if c.allowed {
+			if allowOrigin != c.origin || resp.Header.Get("Access-Control-Allow-Credentials") != "true" ||
+				resp.Header.Get("Access-Control-Allow-Methods") != "GET, POST" || resp.Header.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("%s %s: unexpected preflight headers: %v", c.origin, c.method, resp.Header)
+			}
+		} else if allowOrigin != "" {
+			t.Errorf("%s %s: expected the preflight to fail, got headers: %v", c.origin, c.method, resp.Header)
+		}
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	handler := MakeCORSHandler(testCORSOptions, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/users/6160fe9757a258c6bdc94056", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" || resp.Header.Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+		t.Errorf("Unexpected CORS headers: %v", resp.Header)
+	}
+	if resp.Header.Get("Vary") != "Origin" {
+		t.Errorf("Expected Vary: Origin, got %q", resp.Header.Get("Vary"))
+	}
+}
+
+func TestCORSAnyOriginWithoutCredentials(t *testing.T) {
+	handler := MakeCORSHandler(CORSOptions{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/posts/6161578d7ca34c010e0f21d8", nil)
+	req.Header.Set("Origin", "https://anything.example.org")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if got := w.Result().Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected Access-Control-Allow-Origin: *, got %q", got)
+	}
+}
+
+func TestCORSAnyOriginWithCredentials(t *testing.T) {
+	opts := CORSOptions{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowedMethods: []string{"GET"}, AllowCredentials: true}
+	if err := opts.Validate(); err == nil {
+		t.Error("Expected any origin with credentials to be refused")
+	}
+	opts.AllowedOrigins = []string{"https://app.example.com"}
+	if err := opts.Validate(); err != nil {
+		t.Errorf("Expected a listed origin with credentials to be allowed, got %v", err)
+	}
+
+	// the handler never allows credentials to any origin anyway
+	opts.AllowedOrigins = []string{"*"}
+	handler := MakeCORSHandler(opts, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	req := httptest.NewRequest("GET", "/notifications", nil)
+	req.Header.Set("Origin", "https://evil.example.org")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if h := w.Result().Header; h.Get("Access-Control-Allow-Origin") != "*" || h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("Expected no credentials for any origin, got %v", h)
+	}
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"appyinsta/api/codec"
+)
+
+// Maximum size of a request body accepted by DecodeBody
+var MaxBodyBytes int64 = 1 << 20
+
+// BodyError is returned by DecodeBody when the request body cannot be
+// accepted. Status is the status code that should be sent to the client.
+type BodyError struct {
+	Status  int
+	Message string
+}
+
+func (e *BodyError) Error() string {
+	return e.Message
+}
+
+func badBody(format string, args ...interface{}) *BodyError {
+	return &BodyError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// isJSONContentType accepts application/json and the application/*+json types.
+// A missing Content-Type is accepted as JSON, as the API has always done.
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// Decoder converts request bodies of a non-JSON format to JSON
+type Decoder struct {
+	MediaType string
+	ToJSON    func(body []byte) ([]byte, error)
+}
+
+var decoders = []Decoder{
+	{MediaType: codec.MsgpackMediaType, ToJSON: codec.MsgpackToJSON},
+	{MediaType: "application/x-msgpack", ToJSON: codec.MsgpackToJSON},
+	{MediaType: codec.CBORMediaType, ToJSON: codec.CBORToJSON},
+}
+
+// RegisterDecoder adds a request body format. It must be called before the server starts.
+func RegisterDecoder(dec Decoder) {
+	decoders = append(decoders, dec)
+}
+
+func findDecoder(contentType string) (Decoder, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Decoder{}, false
+	}
+	for _, dec := range decoders {
+		if dec.MediaType == mediaType {
+			return dec, true
+		}
+	}
+	return Decoder{}, false
+}
+
+// DecodeBody decodes the request body, which must be a single object with
+// no fields other than those of dst, into dst. Bodies in JSON or in one of the
+// registered formats (see the codec package) are accepted according to their
+// Content-Type. The size of the body is limited to MaxBodyBytes.
+// The error returned (if any) is a *BodyError.
+func DecodeBody(w http.ResponseWriter, req *http.Request, dst interface{}) error {
+	contentType := req.Header.Get("Content-Type")
+	req.Body = http.MaxBytesReader(w, req.Body, MaxBodyBytes)
+
+	if isJSONContentType(contentType) {
+		return decodeJSON(req.Body, dst)
+	}
+
+	dec, ok := findDecoder(contentType)
+	if !ok {
+		return &BodyError{Status: http.StatusUnsupportedMediaType, Message: "Content-Type must be application/json, application/msgpack or application/cbor"}
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return decodeError(err)
+	}
+	if len(body) == 0 {
+		return badBody("Request body must not be empty")
+	}
+
+	jsonBody, err := dec.ToJSON(body)
+	if err != nil {
+		return badBody("Request body is invalid: %s", err.Error())
+	}
+
+	// the converted body is decoded with the same rules as JSON bodies
+	return decodeJSON(bytes.NewReader(jsonBody), dst)
+}
+
+func decodeJSON(r io.Reader, dst interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	// anything other than whitespace after the object is rejected
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		if isTooLarge(err) {
+			return decodeError(err)
+		}
+		return badBody("Request body must only contain a single JSON object")
+	}
+
+	return nil
+}
+
+func decodeError(err error) *BodyError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case isTooLarge(err):
+		return &BodyError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("Request body must not be larger than %d bytes", MaxBodyBytes)}
+	case errors.Is(err, io.EOF):
+		return badBody("Request body must not be empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return badBody("Request body contains badly-formed JSON")
+	case errors.As(err, &syntaxErr):
+		return badBody("Request body contains badly-formed JSON (at position %d)", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return badBody("Request body contains an invalid value for the %q field", typeErr.Field)
+		}
+		return badBody("Request body must be a JSON object")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return badBody("Request body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	default:
+		// for example, errors returned by UnmarshalJSON methods such as that of ObjectIDs
+		return badBody("Request body is invalid: %s", err.Error())
+	}
+}
+
+func isTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// Function to write the error returned by DecodeBody
+func WriteBodyError(w http.ResponseWriter, req *http.Request, err error) {
+	var bodyErr *BodyError
+	if errors.As(err, &bodyErr) {
+		WriteError(w, req, bodyErr.Message, bodyErr.Status)
+		return
+	}
+	WriteError(w, req, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type decodeTarget struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestDecodeBody(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int // 0 if the body should be accepted
+	}{
+		{"valid", "application/json", `{"name":"a","count":1}`, 0},
+		{"valid with charset", "application/json; charset=utf-8", `{"name":"a"}`, 0},
+		{"no content type", "", `{"name":"a"}`, 0},
+		{"trailing whitespace", "application/json", "{\"name\":\"a\"}\n", 0},
+		{"form content type", "application/x-www-form-urlencoded", `{"name":"a"}`, http.StatusUnsupportedMediaType},
+		{"text content type", "text/plain", `{"name":"a"}`, http.StatusUnsupportedMediaType},
+		{"unknown field", "application/json", `{"name":"a","admin":true}`, http.StatusBadRequest},
+		{"two objects", "application/json", `{"name":"a"}{"name":"b"}`, http.StatusBadRequest},
+		{"trailing garbage", "application/json", `{"name":"a"} xyz`, http.StatusBadRequest},
+		{"empty", "application/json", ``, http.StatusBadRequest},
+		{"malformed", "application/json", `{"name":`, http.StatusBadRequest},
+		{"wrong type", "application/json", `{"count":"one"}`, http.StatusBadRequest},
+		{"msgpack", "application/msgpack", "\x81\xa4name\xa1a", 0},
+		{"msgpack unknown field", "application/msgpack", "\x81\xa5admin\xc3", http.StatusBadRequest},
+		{"msgpack truncated", "application/msgpack", "\x81\xa4name", http.StatusBadRequest},
+		{"cbor", "application/cbor", "\xa2\x64name\x61a\x65count\x02", 0},
+		{"too large", "application/json", `{"name":"` + strings.Repeat("a", int(MaxBodyBytes)) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", "/users", strings.NewReader(c.body))
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		w := httptest.NewRecorder()
+
+		var dst decodeTarget
+		err := DecodeBody(w, req, &dst)
+
+		if c.status == 0 {
+			if err != nil {
+				t.Errorf("%s: expected the body to be accepted, got %s", c.name, err)
+			}
+			continue
+		}
+
+		bodyErr, ok := err.(*BodyError)
+		if !ok {
+			t.Errorf("%s: expected a *BodyError, got %v", c.name, err)
+			continue
+		}
+		if bodyErr.Status != c.status {
+			t.Errorf("%s: expected status %d but got %d (%s)", c.name, c.status, bodyErr.Status, bodyErr.Message)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"appyinsta/api/codec"
+	"appyinsta/api/logging"
+)
+
+// Content negotiation: responses are encoded in the first of the registered
+// formats that is acceptable to the client according to its Accept header.
+// JSON is always registered first, so it is used when the client accepts anything.
+
+type Encoder struct {
+	// the media type matched against the Accept header, e.g. application/json
+	MediaType string
+	// the value of the Content-Type header of responses in this format
+	ContentType string
+	Marshal     func(v interface{}) ([]byte, error)
+}
+
+var encoders = []Encoder{
+	{MediaType: "application/json", ContentType: "application/json; charset=utf-8", Marshal: json.Marshal},
+	{MediaType: codec.MsgpackMediaType, ContentType: codec.MsgpackMediaType, Marshal: codec.MarshalMsgpack},
+	{MediaType: "application/x-msgpack", ContentType: "application/x-msgpack", Marshal: codec.MarshalMsgpack},
+	{MediaType: codec.CBORMediaType, ContentType: codec.CBORMediaType, Marshal: codec.MarshalCBOR},
+}
+
+// RegisterEncoder adds a response format. It must be called before the server starts.
+func RegisterEncoder(enc Encoder) {
+	encoders = append(encoders, enc)
+}
+
+// acceptItem is an entry of an Accept or Accept-Encoding header
+type acceptItem struct {
+	value string
+	q     float64
+	order int
+}
+
+// parseAccept parses a header of comma-separated values with optional q
+// parameters, and returns the values with q > 0, most preferred first
+func parseAccept(header string) []acceptItem {
+	var items []acceptItem
+
+	for i, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		items = append(items, acceptItem{value: value, q: q, order: i})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].q != items[j].q {
+			return items[i].q > items[j].q
+		}
+		// more specific media ranges take precedence at the same quality
+		return strings.Count(items[i].value, "*") < strings.Count(items[j].value, "*")
+	})
+	return items
+}
+
+// namedValues returns the values named in a header like Accept, whatever
+// their quality, other than the wildcards. A wildcard only stands for the
+// values which are not named, so that it never brings back one refused
+// with q=0.
+func namedValues(header string) map[string]bool {
+	named := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		value := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		if value != "" && !strings.Contains(value, "*") {
+			named[value] = true
+		}
+	}
+	return named
+}
+
+func mediaRangeMatches(mediaRange string, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	if strings.HasSuffix(mediaRange, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+	}
+	return false
+}
+
+// NegotiateEncoder chooses the response format for an Accept header.
+// It returns false if none of the registered formats is acceptable.
+func NegotiateEncoder(accept string) (Encoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return encoders[0], true
+	}
+
+	named := namedValues(accept)
+	for _, item := range parseAccept(accept) {
+		mediaRange := item.value
+		if parsed, _, err := mime.ParseMediaType(mediaRange); err == nil {
+			mediaRange = parsed
+		}
+
+		for _, enc := range encoders {
+			if strings.Contains(mediaRange, "*") && named[enc.MediaType] {
+				continue
+			}
+			if mediaRangeMatches(mediaRange, enc.MediaType) {
+				return enc, true
+			}
+		}
+	}
+
+	return Encoder{}, false
+}
+
+// WriteResponse encodes v in the format negotiated from the Accept header
+// of the request and writes it with a 200 status.
+func WriteResponse(w http.ResponseWriter, req *http.Request, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	enc, ok := NegotiateEncoder(req.Header.Get("Accept"))
+	if !ok {
+		WriteError(w, req, "Not Acceptable", http.StatusNotAcceptable)
+		return
+	}
+
+	body, err := enc.Marshal(v)
+	if err != nil {
+		logging.FromContext(req.Context()).Error("could not encode response", "err", err, "content_type", enc.MediaType)
+		WriteError(w, req, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", enc.ContentType)
+	w.Write(body)
+}
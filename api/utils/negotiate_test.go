@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"appyinsta/api/codec"
+)
+
+func TestNegotiateEncoder(t *testing.T) {
+	cases := map[string]string{
+		"":                                  "application/json",
+		"*/*":                               "application/json",
+		"application/*":                     "application/json",
+		"application/json":                  "application/json",
+		"text/html, application/json;q=0.9": "application/json",
+		"text/html,*/*;q=0.8":               "application/json",
+		// the wildcards do not bring back a type refused with q=0
+		"application/json;q=0, */*":                 codec.MsgpackMediaType,
+		"application/json;q=0, application/*":       codec.MsgpackMediaType,
+		"application/json;q=0.5, */*;q=0.8":         codec.MsgpackMediaType,
+		"application/json;q=0.9, text/*, */*;q=0.1": "application/json",
+	}
+
+	for accept, expected := range cases {
+		enc, ok := NegotiateEncoder(accept)
+		if !ok || enc.MediaType != expected {
+			t.Errorf("Accept %q: expected %s, got %s", accept, expected, enc.MediaType)
+		}
+	}
+
+	for _, accept := range []string{"text/html", "application/json;q=0"} {
+		if enc, ok := NegotiateEncoder(accept); ok {
+			t.Errorf("Accept %q: expected no encoder to be acceptable, got %s", accept, enc.MediaType)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/users/6160fe9757a258c6bdc94056", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+
+	WriteResponse(w, req, struct{}{})
+
+	if w.Result().StatusCode != http.StatusNotAcceptable {
+		t.Errorf("Expected status %d but received %d", http.StatusNotAcceptable, w.Result().StatusCode)
+	}
+}
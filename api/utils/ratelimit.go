@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/ratelimit"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// This function wraps a handler so that each client can make at most
+// limit requests to the route. Buckets are kept per route, so the name
+// must be unique for every limited route. If the store fails, the request
+// is let through rather than failing because of the limiter.
+func MakeRateLimitHandler(limiter *ratelimit.Limiter, route string, limit ratelimit.Limit, handlerFn func(writer http.ResponseWriter, req *http.Request)) http.HandlerFunc {
+	policy := fmt.Sprintf("%d;w=%d", limit.Burst, int(math.Ceil(limit.Window().Seconds())))
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		key := route + ":" + limiter.Key(req)
+
+		res, err := limiter.Store.Take(req.Context(), key, limit, time.Now())
+		if err != nil {
+			logging.FromContext(req.Context()).Warn("rate limiter unavailable", "err", err, "route", route)
+			handlerFn(w, req)
+			return
+		}
+
+		w.Header().Set("RateLimit-Policy", policy)
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			WriteError(w, req, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+
+		handlerFn(w, req)
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// UserOrClientKey identifies the clients of the rate limits by the user
+// authenticated by MakeUserAuthHandler, or else by clientIP. The routes
+// must then be rate limited after the authentication of their users.
+func UserOrClientKey(clientIP ratelimit.KeyFunc) ratelimit.KeyFunc {
+	return func(req *http.Request) string {
+		if userID, ok := UserID(req.Context()); ok {
+			return "user:" + userID.Hex()
+		}
+		return clientIP(req)
+	}
+}
+
+// ErrTooManyAttempts is returned by the Authenticator of LimitFailedAuth
+// to the clients which failed to authenticate too often
+var ErrTooManyAttempts = errors.New("too many failed authentication attempts")
+
+// LimitFailedAuth wraps an Authenticator so that each client, identified
+// by the address of ClientIP, can fail to authenticate at most limit times.
+// Beyond that, the credentials are not even checked until the bucket of the
+// client refills, so that passwords cannot be guessed at the rate of the
+// routes. If the store fails, the credentials are checked anyway.
+func LimitFailedAuth(st ratelimit.Store, limit ratelimit.Limit, authenticate Authenticator) Authenticator {
+	return func(ctx context.Context, login, password string) (primitive.ObjectID, bool, error) {
+		key := "auth-failures:" + ClientIP(ctx)
+		now := time.Now()
+
+		res, err := st.Peek(ctx, key, limit, now)
+		if err != nil {
+			logging.FromContext(ctx).Warn("rate limiter unavailable", "err", err, "route", "auth")
+		} else if !res.Allowed {
+			return primitive.NilObjectID, false, ErrTooManyAttempts
+		}
+
+		userID, ok, err := authenticate(ctx, login, password)
+		if err == nil && !ok {
+			if _, err := st.Take(ctx, key, limit, now); err != nil {
+				logging.FromContext(ctx).Warn("rate limiter unavailable", "err", err, "route", "auth")
+			}
+		}
+		return userID, ok, err
+	}
+}
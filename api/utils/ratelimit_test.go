@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"appyinsta/api/ratelimit"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil)
+	limit, _ := ratelimit.ParseLimit("2/m")
+
+	handler := MakeRateLimitHandler(limiter, "users.create", limit, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	expectedStatus := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	expectedRemaining := []string{"1", "0", "0"}
+
+	for i, status := range expectedStatus {
+		req := httptest.NewRequest("POST", "/users", nil)
+		req.RemoteAddr = "203.0.113.7:51234"
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != status {
+			t.Errorf("Request %d: expected status %d but received %d", i+1, status, resp.StatusCode)
+		}
+		if resp.Header.Get("RateLimit-Limit") != "2" || resp.Header.Get("RateLimit-Remaining") != expectedRemaining[i] {
+			t.Errorf("Request %d: unexpected RateLimit headers: %v", i+1, resp.Header)
+		}
+		if status == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "30" {
+			t.Errorf("Request %d: expected Retry-After of 30 seconds, got %q", i+1, resp.Header.Get("Retry-After"))
+		}
+	}
+
+	// a different client is not affected
+	req := httptest.NewRequest("POST", "/users", nil)
+	req.RemoteAddr = "198.51.100.1:40000"
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected request from another client to be allowed, got %d", w.Result().StatusCode)
+	}
+}
+
+func TestUserOrClientKey(t *testing.T) {
+	key := UserOrClientKey(ratelimit.ClientIP)
+	req := httptest.NewRequest("GET", "/notifications", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	if got := key(req); got != "203.0.113.7" {
+		t.Errorf("anonymous client keyed by %q", got)
+	}
+	userID := primitive.NewObjectID()
+	req = req.WithContext(ContextWithUserID(req.Context(), userID))
+	if got := key(req); got != "user:"+userID.Hex() {
+		t.Errorf("authenticated user keyed by %q", got)
+	}
+}
+
+func TestLimitFailedAuth(t *testing.T) {
+	ann := primitive.NewObjectID()
+	checked := 0
+	authenticate := LimitFailedAuth(ratelimit.NewMemoryStore(), ratelimit.Limit{Rate: 0.01, Burst: 2}, func(ctx context.Context, login, password string) (primitive.ObjectID, bool, error) {
+		checked++
+		return ann, password == "s3cret", nil
+	})
+	handler := MakeUserAuthHandler(authenticate, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(ip, password string) int {
+		req := httptest.NewRequest("GET", "/notifications", nil)
+		req.SetBasicAuth("ann", password)
+		req = req.WithContext(ContextWithClientIP(req.Context(), ip))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	// successes are not counted
+	for i := 0; i < 3; i++ {
+		if status := call("203.0.113.7", "s3cret"); status != http.StatusOK {
+			t.Fatalf("right password: got %d", status)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if status := call("203.0.113.7", "nope"); status != http.StatusUnauthorized {
+			t.Errorf("failed attempt %d: got %d", i+1, status)
+		}
+	}
+	// then even the right password is not checked
+	checked = 0
+	if status := call("203.0.113.7", "s3cret"); status != http.StatusTooManyRequests || checked != 0 {
+		t.Errorf("after too many failures: got %d, with %d checks", status, checked)
+	}
+	if status := call("198.51.100.1", "s3cret"); status != http.StatusOK {
+		t.Errorf("another client: got %d", status)
+	}
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"appyinsta/api/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID returns the ID assigned to the request by MakeLoggingHandler,
+// or an empty string if the request did not go through it.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the given request ID,
+// for requests which do not go through MakeLoggingHandler (such as RPCs)
+func ContextWithRequestID(ctx context.Context, reqID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, reqID)
+}
+
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// An incoming request ID is only propagated if it is reasonably short
+// and made up of printable ASCII characters, since it ends up in the logs.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder keeps track of the status code and the number of bytes
+// written by a handler so that they can be logged once it returns
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// This function wraps a handler so that every request gets an ID
+// (taken from the X-Request-ID header if the client sent one) and a
+// request-scoped logger, and writes an access log line once the request is served.
+func MakeLoggingHandler(logger *logging.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		reqID := req.Header.Get(RequestIDHeader)
+		if !ValidRequestID(reqID) {
+			reqID = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, reqID)
+
+		reqLogger := logger.With("request_id", reqID)
+		ctx := ContextWithRequestID(req.Context(), reqID)
+		ctx = logging.NewContext(ctx, reqLogger)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		reqLogger.Info("request served",
+			"method", req.Method,
+			"path", req.URL.Path,
+			"status", rec.status,
+			"latency_ms", time.Since(start),
+			"bytes", rec.bytes,
+			"remote_addr", req.RemoteAddr,
+		)
+	})
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"appyinsta/api/logging"
+)
+
+func TestLoggingHandlerPropagatesRequestID(t *testing.T) {
+	var logBuf bytes.Buffer
+	logger := logging.New(&logBuf, logging.LevelInfo)
+
+	handler := MakeLoggingHandler(logger, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		WriteError(w, req, "Bad Request", http.StatusBadRequest)
+	}))
+
+	req := httptest.NewRequest("POST", "/users", nil)
+	req.Header.Set(RequestIDHeader, "client-supplied-id")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.Header.Get(RequestIDHeader) != "client-supplied-id" {
+		t.Errorf("Expected the request ID to be echoed, got %q", resp.Header.Get(RequestIDHeader))
+	}
+
+	expectedBody := `{"error":"Bad Request","request_id":"client-supplied-id"}`
+	if string(body) != expectedBody {
+		t.Errorf("Unexpected body returned. Expected %s and got %s", expectedBody, string(body))
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logBuf.Bytes(), &entry); err != nil {
+		t.Fatalf("Access log line is not valid JSON: %s", err)
+	}
+
+	if entry["request_id"] != "client-supplied-id" || entry["status"] != float64(400) || entry["path"] != "/users" {
+		t.Errorf("Unexpected access log line: %s", logBuf.String())
+	}
+}
+
+func TestLoggingHandlerAssignsRequestID(t *testing.T) {
+	handler := MakeLoggingHandler(logging.New(ioutil.Discard, logging.LevelInfo), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if RequestID(req.Context()) == "" {
+			t.Errorf("Request ID not available to the handler")
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/users/6160fe9757a258c6bdc94056", nil)
+	req.Header.Set(RequestIDHeader, "has spaces in it")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	id := w.Result().Header.Get(RequestIDHeader)
+	if id == "" || id == "has spaces in it" {
+		t.Errorf("Expected a new request ID to be assigned, got %q", id)
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/tracing"
+)
+
+// This function wraps a handler so that every request is recorded as a
+// server span. If the client sent a valid traceparent header, the span
+// joins the client's trace. The trace ID is added to the request logger.
+func MakeTracingHandler(tracer *tracing.Tracer, next http.Handler) http.Handler {
+	if tracer == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		if sc, err := tracing.ParseTraceparent(req.Header.Get(tracing.TraceparentHeader)); err == nil {
+			ctx = tracing.ContextWithRemoteParent(ctx, sc)
+		}
+
+		ctx, span := tracer.Start(ctx, fmt.Sprintf("%s %s", req.Method, req.URL.Path), tracing.SpanKindServer)
+		defer span.End()
+
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.target", req.URL.RequestURI())
+		span.SetAttribute("http.user_agent", req.UserAgent())
+		span.SetAttribute("net.peer.addr", req.RemoteAddr)
+		if reqID := RequestID(ctx); reqID != "" {
+			span.SetAttribute("http.request_id", reqID)
+		}
+
+		ctx = logging.NewContext(ctx, logging.FromContext(ctx).With("trace_id", span.SpanContext().TraceID.String()))
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttribute("http.status_code", rec.status)
+		if rec.status >= 500 {
+			span.SetStatus(tracing.StatusError, http.StatusText(rec.status))
+		}
+	})
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"net/http"
 )
@@ -15,7 +16,7 @@ func GetHashed256(pass string) string {
 func MakeCheckMethodHandler(method string, handlerFn func(writer http.ResponseWriter, req *http.Request)) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		if req.Method != method {
-			http.Error(w, fmt.Sprintf("This endpoint only accepts %s requests!", method), http.StatusBadRequest)
+			WriteError(w, req, fmt.Sprintf("This endpoint only accepts %s requests!", method), http.StatusBadRequest)
 			return
 		} else {
 			handlerFn(w, req)
@@ -36,3 +37,21 @@ func AddCommonHeaders(w *http.ResponseWriter) {
 		"Content-Type": "application/json; charset=utf-8",
 	}, w)
 }
+
+// Error responses are sent as JSON so that clients can parse them like
+// any other response. The request ID (if any) is included so that a
+// failing request can be matched with the server logs.
+type ErrorResponse struct {
+	Error     string `json:"error" openapi:"required"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Function to write an error response
+func WriteError(w http.ResponseWriter, req *http.Request, message string, status int) {
+	body, _ := json.Marshal(ErrorResponse{Error: message, RequestID: RequestID(req.Context())})
+
+	AddCommonHeaders(&w)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body)
+}
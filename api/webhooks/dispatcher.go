@@ -0,0 +1,164 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+)
+
+// Defaults of the Dispatcher
+const (
+	DefaultMaxAttempts = 8
+	DefaultMinBackoff  = 30 * time.Second
+	DefaultMaxBackoff  = time.Hour
+
+	// the time a claimed delivery is not sent by other dispatchers, which is
+	// longer than the timeout of the requests
+	claimLease = 2 * time.Minute
+	batchSize  = 50
+)
+
+// Dispatcher sends the pending deliveries of the outbox. Several
+// dispatchers can share an outbox, as each delivery is claimed by one of them.
+type Dispatcher struct {
+	Store  store.Store
+	Client *http.Client
+
+	// a delivery is dead after MaxAttempts failed attempts
+	MaxAttempts int
+	// the delay before the first retry, which doubles with each attempt up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Now returns the current time, and can be replaced in tests
+	Now func() time.Time
+}
+
+// NewDispatcher returns a dispatcher with the default settings
+func NewDispatcher(st store.Store) *Dispatcher {
+	return &Dispatcher{
+		Store:       st,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: DefaultMaxAttempts,
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		Now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run sends the due deliveries every interval, until ctx is done
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.RunOnce(ctx); err != nil {
+			logging.FromContext(ctx).Error("could not send webhook deliveries", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce sends the deliveries which are due, and returns how many it attempted
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		now := d.Now()
+		deliveries, err := d.Store.ClaimDeliveries(ctx, now, now.Add(claimLease), batchSize)
+		if err != nil {
+			return attempted, err
+		}
+		for _, delivery := range deliveries {
+			if err := d.attempt(ctx, delivery); err != nil {
+				return attempted, err
+			}
+			attempted++
+		}
+		if len(deliveries) < batchSize {
+			return attempted, nil
+		}
+	}
+}
+
+// attempt sends a delivery, and records the outcome. Only the errors of the store are returned.
+func (d *Dispatcher) attempt(ctx context.Context, delivery models.Delivery) error {
+	logger := logging.FromContext(ctx).With("delivery_id", delivery.ID.Hex(), "webhook_id", delivery.WebhookID.Hex())
+
+	webhook, err := d.Store.GetWebhook(ctx, delivery.WebhookID)
+	if err == store.ErrNotFound {
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = "the webhook was deleted"
+		return d.Store.UpdateDelivery(ctx, delivery)
+	} else if err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	sendErr := d.send(ctx, webhook, delivery)
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		logger.Info("webhook delivered", "event", delivery.Event, "attempts", delivery.Attempts)
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = sendErr.Error()
+		logger.Warn("webhook delivery is dead", "event", delivery.Event, "attempts", delivery.Attempts, "err", sendErr)
+	default:
+		delivery.NextAttempt = d.Now().Add(d.backoff(delivery.Attempts))
+		delivery.LastError = sendErr.Error()
+		logger.Info("webhook delivery failed", "event", delivery.Event, "attempts", delivery.Attempts, "err", sendErr)
+	}
+	return d.Store.UpdateDelivery(ctx, delivery)
+}
+
+// backoff returns the delay after a number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.MinBackoff
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook models.Webhook, delivery models.Delivery) error {
+	body := []byte(delivery.Payload)
+	timestamp := d.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "appyinsta-webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the receiver returned %s", resp.Status)
+	}
+	return nil
+}
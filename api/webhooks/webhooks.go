@@ -0,0 +1,197 @@
+// Package webhooks sends the events of posts and users to the URLs of the
+// webhooks registered by partners.
+//
+// The Outbox is a handler of the domain events, which are recorded with
+// the writes which cause them (see the events package). It stores a delivery
+// for each webhook of an event in the collection of deliveries, once even
+// if the event is handled again. The Dispatcher sends the pending
+// deliveries, so that they are not lost if the server stops, and retries
+// the failed ones with an exponential backoff. Deliveries which fail
+// MaxAttempts times are dead letters, which admins can list and retry.
+//
+// Each delivery is a POST request with a JSON Payload, signed with the
+// secret of the webhook: the X-Appyinsta-Signature header is "sha256="
+// followed by the hexadecimal HMAC-SHA256 of the X-Appyinsta-Timestamp
+// header, a dot, and the body (see Sign). Receivers should check the
+// signature, and reject old timestamps to prevent replays.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The types of the events sent to webhooks
+const (
+	PostCreated = "post.created"
+	PostDeleted = "post.deleted"
+	UserCreated = "user.created"
+)
+
+// EventTypes are the types which webhooks can subscribe to
+var EventTypes = []string{PostCreated, PostDeleted, UserCreated}
+
+// the types of the domain events which are sent
+var eventTypes = map[string]string{
+	events.Posted:      PostCreated,
+	events.PostDeleted: PostDeleted,
+	events.SignedUp:    UserCreated,
+}
+
+// Headers of the deliveries
+const (
+	SignatureHeader = "X-Appyinsta-Signature"
+	TimestampHeader = "X-Appyinsta-Timestamp"
+	EventHeader     = "X-Appyinsta-Event"
+	DeliveryHeader  = "X-Appyinsta-Delivery"
+)
+
+// Payload is the body of a delivery
+type Payload struct {
+	// the ID of the event, which is the same for the deliveries of an event
+	// to several webhooks, and for the retries of a delivery
+	ID   primitive.ObjectID `json:"id"`
+	Type string             `json:"type"`
+	Time time.Time          `json:"time"`
+	// the post of post.created, the public fields of the user of user.created
+	// (see createdUser), and the IDs of the
+	// post and of its author for post.deleted
+	Data interface{} `json:"data"`
+}
+
+type deletedPost struct {
+	ID       primitive.ObjectID `json:"id"`
+	PostedBy primitive.ObjectID `json:"posted_by"`
+}
+
+// createdUser has the public fields of a user: the receivers are third
+// parties, which must not get the email or the role
+type createdUser struct {
+	ID       primitive.ObjectID `json:"id"`
+	Name     string             `json:"name"`
+	Username string             `json:"username,omitempty"`
+}
+
+// IsEventType reports whether webhooks can subscribe to a type of events
+func IsEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret returns a random secret for a webhook
+func NewSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Sign returns the signature of a body sent at a time, as sent in the SignatureHeader
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether a signature is the one of a body sent at a time
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Outbox stores the deliveries of the domain events to the webhooks
+type Outbox struct {
+	Store store.Store
+}
+
+// Handle is an events.Handler
+func (o *Outbox) Handle(ctx context.Context, event events.Event) error {
+	eventType, ok := eventTypes[event.Type]
+	if !ok {
+		return nil
+	}
+	webhooks, err := o.Store.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	var subscribed []models.Webhook
+	for _, w := range webhooks {
+		for _, t := range w.Events {
+			if t == eventType {
+				subscribed = append(subscribed, w)
+				break
+			}
+		}
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	// the ID of an event delivered again is the same
+	payload := Payload{ID: event.ID, Type: eventType, Time: event.Time}
+	if payload.ID.IsZero() {
+		payload.ID = primitive.NewObjectID()
+	}
+	switch event.Type {
+	case events.Posted:
+		post, err := o.Store.GetPost(ctx, event.Post)
+		// the post was deleted since, which is another event
+		if err == store.ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// partners only receive the posts everyone sees
+		if !(&store.Viewer{}).CanSee(post) {
+			return nil
+		}
+		payload.Data = post
+	case events.PostDeleted:
+		payload.Data = deletedPost{ID: event.Post, PostedBy: event.Actor}
+	case events.SignedUp:
+		user, err := o.Store.GetUser(ctx, event.Actor)
+		if err == store.ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		payload.Data = createdUser{ID: user.UserID, Name: user.Name, Username: user.Username}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	deliveries := make([]models.Delivery, len(subscribed))
+	for i, w := range subscribed {
+		deliveries[i] = models.Delivery{
+			WebhookID:   w.ID,
+			EventID:     payload.ID,
+			Event:       eventType,
+			Payload:     string(body),
+			Status:      models.DeliveryPending,
+			NextAttempt: now,
+			CreatedOn:   now,
+		}
+	}
+	return o.Store.AddDeliveries(ctx, deliveries)
+}
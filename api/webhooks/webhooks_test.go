@@ -0,0 +1,185 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"appyinsta/api/events"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+)
+
+// receiver is a webhook receiver which checks the signatures of the deliveries
+type receiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	payloads []Payload
+	// the status returned to the next requests
+	status int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	timestamp, _ := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+	if !Verify(r.secret, timestamp, body, req.Header.Get(SignatureHeader)) {
+		r.t.Errorf("wrong signature %q", req.Header.Get(SignatureHeader))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != http.StatusOK {
+		w.WriteHeader(r.status)
+		return
+	}
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil || p.Type != req.Header.Get(EventHeader) {
+		r.t.Errorf("unexpected payload %s (%v)", body, err)
+	}
+	r.payloads = append(r.payloads, p)
+}
+
+func TestSign(t *testing.T) {
+	sig := Sign("secret", 1700000000, []byte(`{}`))
+	if !Verify("secret", 1700000000, []byte(`{}`), sig) {
+		t.Error("the signature is not verified")
+	}
+	for _, c := range []struct {
+		secret    string
+		timestamp int64
+		body      string
+	}{
+		{"other", 1700000000, `{}`},
+		{"secret", 1700000001, `{}`},
+		{"secret", 1700000000, `{ }`},
+	} {
+		if Verify(c.secret, c.timestamp, []byte(c.body), sig) {
+			t.Errorf("the signature is verified for %+v", c)
+		}
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	rec := &receiver{t: t, secret: "s3cret", status: http.StatusOK}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	webhook := models.Webhook{URL: server.URL, Events: []string{PostCreated, PostDeleted}, Secret: rec.secret}
+	if err := st.CreateWebhook(ctx, &webhook); err != nil {
+		t.Fatal(err)
+	}
+	post := models.Post{PostedByUID: webhook.ID, Caption: "hello", ImgURL: "img", PostedOn: time.Now().UTC()}
+	if err := st.CreatePost(ctx, &post); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus()
+	bus.Subscribe((&Outbox{Store: st}).Handle)
+	bus.Publish(ctx, events.PostCreated(post)...)
+	bus.Publish(ctx, events.Event{Type: events.SignedUp, Actor: post.PostedByUID})
+	bus.Publish(ctx, events.Event{Type: events.PostDeleted, Actor: post.PostedByUID, Post: post.PostID})
+
+	now := time.Now().UTC()
+	d := NewDispatcher(st)
+	d.Now = func() time.Time { return now }
+
+	// the receiver fails: the deliveries are retried later, with a longer delay each time
+	rec.status = http.StatusServiceUnavailable
+	if n, err := d.RunOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("attempted %d deliveries (%v), expected the 2 of the subscribed events", n, err)
+	}
+	if n, _ := d.RunOnce(ctx); n != 0 {
+		t.Errorf("attempted %d deliveries before their next attempt", n)
+	}
+	now = now.Add(d.MinBackoff)
+	d.RunOnce(ctx)
+	now = now.Add(d.MinBackoff)
+	if n, _ := d.RunOnce(ctx); n != 0 {
+		t.Errorf("attempted %d deliveries before the backoff doubled", n)
+	}
+
+	rec.status = http.StatusOK
+	now = now.Add(d.MinBackoff)
+	if n, err := d.RunOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("attempted %d deliveries (%v), expected 2", n, err)
+	}
+	if len(rec.payloads) != 2 || rec.payloads[0].Type != PostCreated || rec.payloads[1].Type != PostDeleted {
+		t.Fatalf("received %+v", rec.payloads)
+	}
+	data, _ := json.Marshal(rec.payloads[0].Data)
+	var got models.Post
+	if json.Unmarshal(data, &got); got.PostID != post.PostID || got.Caption != post.Caption {
+		t.Errorf("the payload of post.created has the post %s", data)
+	}
+	delivered, _ := st.ListDeliveries(ctx, models.DeliveryDelivered, 10)
+	if len(delivered) != 2 || delivered[0].Attempts != 3 {
+		t.Errorf("delivered %+v", delivered)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	rec := &receiver{t: t, secret: "s3cret", status: http.StatusInternalServerError}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	webhook := models.Webhook{URL: server.URL, Events: []string{UserCreated}, Secret: rec.secret}
+	st.CreateWebhook(ctx, &webhook)
+	user := models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "hash", Username: "ann", Role: models.RoleModerator}
+	st.CreateUser(ctx, &user)
+	if err := (&Outbox{Store: st}).Handle(ctx, events.Event{Type: events.SignedUp, Actor: user.UserID, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	d := NewDispatcher(st)
+	d.MaxAttempts = 3
+	d.Now = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		d.RunOnce(ctx)
+		now = now.Add(d.MaxBackoff)
+	}
+
+	dead, _ := st.ListDeliveries(ctx, models.DeliveryDead, 10)
+	if len(dead) != 1 || dead[0].Attempts != 3 || dead[0].LastError != "the receiver returned 500 Internal Server Error" {
+		t.Fatalf("dead letters %+v", dead)
+	}
+
+	// a dead letter which is retried is sent again
+	rec.status = http.StatusOK
+	if _, err := st.RetryDelivery(ctx, dead[0].ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := d.RunOnce(ctx); n != 1 || len(rec.payloads) != 1 {
+		t.Fatalf("attempted %d deliveries, received %+v", n, rec.payloads)
+	}
+	// only the public fields of the user are sent
+	data, _ := json.Marshal(rec.payloads[0].Data)
+	want := fmt.Sprintf(`{"id":%q,"name":"Ann","username":"ann"}`, user.UserID.Hex())
+	if string(data) != want {
+		t.Errorf("the payload of user.created has the user %s, want %s", data, want)
+	}
+
+	// the deliveries of deleted webhooks are dead
+	st.DeleteWebhook(ctx, webhook.ID)
+	(&Outbox{Store: st}).Handle(ctx, events.Event{Type: events.SignedUp, Actor: user.UserID})
+	if err := st.AddDeliveries(ctx, []models.Delivery{{WebhookID: webhook.ID, Event: UserCreated, Status: models.DeliveryPending, NextAttempt: now}}); err != nil {
+		t.Fatal(err)
+	}
+	d.RunOnce(ctx)
+	if dead, _ := st.ListDeliveries(ctx, models.DeliveryDead, 10); len(dead) != 1 || dead[0].LastError != "the webhook was deleted" {
+		t.Errorf("dead letters %+v", dead)
+	}
+}
@@ -0,0 +1,245 @@
+// Package client is a Go client of the AppyInsta REST API.
+//
+//	c := client.New("http://localhost:8080")
+//	id, err := c.CreateUser(ctx, models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "secret"})
+//
+// Requests which fail with a network error or a status code that may be
+// temporary are retried with exponential backoff, see Client.MaxRetries.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"appyinsta/api/models"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Client struct {
+	// BaseURL is the URL of the server, without a trailing slash
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// MaxRetries is the number of times a failed request is retried.
+	// The delay before the nth retry is MinBackoff * 2^(n-1), at most MaxBackoff,
+	// with jitter, unless the server asks for a longer delay with Retry-After.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Login and Password are the HTTP Basic credentials of a user, sent
+	// with every request if Login is set
+	Login    string
+	Password string
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.HTTPClient = hc }
+}
+
+func WithRetries(maxRetries int) Option {
+	return func(c *Client) { c.MaxRetries = maxRetries }
+}
+
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Client) { c.MinBackoff, c.MaxBackoff = min, max }
+}
+
+// WithBasicAuth makes the requests as a user, with their ID or username and
+// their password, which CreatePost needs
+func WithBasicAuth(login, password string) Option {
+	return func(c *Client) { c.Login, c.Password = login, password }
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		MaxRetries: 3,
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// CreateUser creates a user and returns its ID. The password is sent in PwdHash
+// and is hashed at the server.
+func (c *Client) CreateUser(ctx context.Context, user models.User) (primitive.ObjectID, error) {
+	var res models.InsertedID
+	if err := c.do(ctx, "POST", "/users", user, &res); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return res.ID, nil
+}
+
+// GetUser returns the user with the given ID, or ErrNotFound
+func (c *Client) GetUser(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	if err := c.do(ctx, "GET", "/users/"+id.Hex(), nil, &user); err != nil {
+		return models.User{}, err
+	}
+	if user.UserID.IsZero() {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// CreatePost creates a post of the user of the client, see WithBasicAuth,
+// and returns its ID. PostedByUID may be left zero. PostedOn is set by the server.
+func (c *Client) CreatePost(ctx context.Context, post models.Post) (primitive.ObjectID, error) {
+	var res models.InsertedID
+	if err := c.do(ctx, "POST", "/posts", post, &res); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return res.ID, nil
+}
+
+// GetPost returns the post with the given ID, or ErrNotFound
+func (c *Client) GetPost(ctx context.Context, id primitive.ObjectID) (models.Post, error) {
+	var post models.Post
+	if err := c.do(ctx, "GET", "/posts/"+id.Hex(), nil, &post); err != nil {
+		return models.Post{}, err
+	}
+	if post.PostID.IsZero() {
+		return models.Post{}, ErrNotFound
+	}
+	return post, nil
+}
+
+// idempotent requests are retried on any temporary failure, others only
+// when the server did not process them
+func retryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return method == "GET"
+	}
+	return false
+}
+
+// do sends a request with a JSON body (if in is not nil) and decodes the
+// JSON response into out. The same request ID is sent with every attempt
+// so that the retries can be found in the server logs.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	reqID := utils.NewRequestID()
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set(utils.RequestIDHeader, reqID)
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.Login != "" {
+			req.SetBasicAuth(c.Login, c.Password)
+		}
+
+		res, err := c.HTTPClient.Do(req)
+		var retryAfter time.Duration
+		if err == nil {
+			err = decodeResponse(res, out)
+			if err == nil {
+				return nil
+			}
+			apiErr, ok := err.(*APIError)
+			if !ok || !retryable(method, apiErr.StatusCode) {
+				return err
+			}
+			retryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+		} else if ctx.Err() != nil || method != "GET" {
+			// a POST may have reached the server, so it is not sent again
+			return err
+		}
+
+		if attempt >= c.MaxRetries {
+			return err
+		}
+
+		delay := c.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before retrying after the given attempt,
+// between half and all of the exponential delay
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.MinBackoff << attempt
+	if d <= 0 || d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func decodeResponse(res *http.Response, out interface{}) error {
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 400 {
+		apiErr := &APIError{StatusCode: res.StatusCode, RequestID: res.Header.Get(utils.RequestIDHeader)}
+		var errRes utils.ErrorResponse
+		if json.Unmarshal(data, &errRes) == nil {
+			apiErr.Message = errRes.Error
+			if errRes.RequestID != "" {
+				apiErr.RequestID = errRes.RequestID
+			}
+		}
+		return apiErr
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("appyinsta: could not decode the response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"appyinsta/api/handlers"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/store"
+	"appyinsta/api/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newServer starts a server with the real handlers on an in-memory store.
+// wrap, if not nil, is put in front of the handlers.
+func newServer(t *testing.T, wrap func(http.Handler) http.Handler) *Client {
+	t.Helper()
+	return newStoreServer(t, store.NewMemoryStore(), wrap)
+}
+
+// newStoreServer is like newServer, on a given store
+func newStoreServer(t *testing.T, st store.Store, wrap func(http.Handler) http.Handler) *Client {
+	t.Helper()
+
+	senv := &handlers.ServerEnv{Store: st}
+	mux := handlers.NewMux(senv.Routes(), func(route handlers.Route) http.HandlerFunc {
+		handlerFn := route.Handler
+		if route.Auth {
+			handlerFn = utils.MakeUserAuthHandler(senv.Authenticate, handlerFn)
+		}
+		return utils.MakeCheckMethodHandler(route.Method, handlerFn)
+	})
+
+	var handler http.Handler = mux
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	handler = utils.MakeLoggingHandler(logging.New(io.Discard, logging.LevelError), handler)
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return New(srv.URL, WithBackoff(time.Millisecond, 10*time.Millisecond))
+}
+
+func TestUsersAndPosts(t *testing.T) {
+	c := newServer(t, nil)
+	ctx := context.Background()
+
+	userID, err := c.CreateUser(ctx, models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.GetUser(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.UserID != userID || user.Name != "Ann" || user.PwdHash != "" {
+		t.Errorf("GetUser returned %+v", user)
+	}
+
+	if _, err := c.CreatePost(ctx, models.Post{PostedByUID: userID, Caption: "hello", ImgURL: "img"}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("CreatePost without credentials returned %v", err)
+	}
+	c.Login, c.Password = userID.Hex(), "secret"
+	postID, err := c.CreatePost(ctx, models.Post{Caption: "hello", ImgURL: "https://example.com/a.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := c.GetPost(ctx, postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.PostedByUID != userID || post.Caption != "hello" || post.PostedOn.IsZero() {
+		t.Errorf("GetPost returned %+v", post)
+	}
+
+	if _, err := c.GetUser(ctx, primitive.NewObjectID()); err != ErrNotFound {
+		t.Errorf("GetUser of an unknown user returned %v", err)
+	}
+	if _, err := c.GetPost(ctx, primitive.NewObjectID()); err != ErrNotFound {
+		t.Errorf("GetPost of an unknown post returned %v", err)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	c := newServer(t, nil)
+
+	_, err := c.CreateUser(context.Background(), models.User{Name: "Ann"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("expected a bad request error, got %v", err)
+	}
+	if apiErr.Message != "Bad Request" || apiErr.RequestID == "" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestListUserPosts(t *testing.T) {
+	c := newServer(t, nil)
+	ctx := context.Background()
+	userID, err := c.CreateUser(ctx, models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Login, c.Password = userID.Hex(), "secret"
+
+	var ids []primitive.ObjectID
+	for i := 0; i < 7; i++ {
+		id, err := c.CreatePost(ctx, models.Post{PostedByUID: userID, Caption: "post", ImgURL: "img"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	for _, pageSize := range []int64{1, 3, 7, 10} {
+		var got []primitive.ObjectID
+		it := c.ListUserPosts(ctx, userID, pageSize)
+		for it.Next() {
+			got = append(got, it.Post().PostID)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(ids) {
+			t.Fatalf("page size %d: got %d posts, expected %d", pageSize, len(got), len(ids))
+		}
+		for i := range ids {
+			if got[i] != ids[i] {
+				t.Errorf("page size %d: post %d is %v, expected %v", pageSize, i, got[i], ids[i])
+			}
+		}
+	}
+
+	if it := c.ListUserPosts(ctx, primitive.NewObjectID(), 5); it.Next() || it.Err() != nil {
+		t.Errorf("expected no posts, got error %v", it.Err())
+	}
+}
+
+func TestListUserPostsTiedTimes(t *testing.T) {
+	st := store.NewMemoryStore()
+	c := newStoreServer(t, st, nil)
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+
+	// posts imported or created in the same millisecond have the same time
+	postedOn := time.Date(2021, 10, 9, 12, 0, 0, 0, time.UTC)
+	seen := map[primitive.ObjectID]bool{}
+	for i := 0; i < 5; i++ {
+		post := models.Post{PostedByUID: userID, Caption: "post", ImgURL: "img", PostedOn: postedOn}
+		if i == 4 {
+			post.PostedOn = postedOn.Add(time.Second)
+		}
+		if err := st.CreatePost(ctx, &post); err != nil {
+			t.Fatal(err)
+		}
+		seen[post.PostID] = false
+	}
+
+	for _, pageSize := range []int64{1, 2, 5} {
+		var got []primitive.ObjectID
+		it := c.ListUserPosts(ctx, userID, pageSize)
+		for it.Next() && len(got) <= len(seen) {
+			got = append(got, it.Post().PostID)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(seen) {
+			t.Fatalf("page size %d: got %d posts, expected %d", pageSize, len(got), len(seen))
+		}
+		for id := range seen {
+			seen[id] = false
+		}
+		for _, id := range got {
+			if _, ok := seen[id]; !ok || seen[id] {
+				t.Errorf("page size %d: post %v is unknown or repeated", pageSize, id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+// failing makes the first n requests fail with the given status
+func failing(n int32, status int, calls *int32, reqIDs chan<- string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if reqIDs != nil {
+				reqIDs <- req.Header.Get(utils.RequestIDHeader)
+			}
+			if atomic.AddInt32(calls, 1) <= n {
+				w.Header().Set("Retry-After", "0")
+				utils.WriteError(w, req, http.StatusText(status), status)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("get", func(t *testing.T) {
+		var calls int32
+		reqIDs := make(chan string, 10)
+		c := newServer(t, failing(2, http.StatusServiceUnavailable, &calls, reqIDs))
+		if _, err := c.GetUser(ctx, primitive.NewObjectID()); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound after retries, got %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 requests, got %d", calls)
+		}
+		first := <-reqIDs
+		for i := 1; i < 3; i++ {
+			if id := <-reqIDs; id != first {
+				t.Errorf("request ID changed from %q to %q", first, id)
+			}
+		}
+	})
+
+	t.Run("post rate limited", func(t *testing.T) {
+		var calls int32
+		c := newServer(t, failing(1, http.StatusTooManyRequests, &calls, nil))
+		if _, err := c.CreateUser(ctx, models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "secret"}); err != nil {
+			t.Fatal(err)
+		}
+		if calls != 2 {
+			t.Errorf("expected 2 requests, got %d", calls)
+		}
+	})
+
+	t.Run("post not retried", func(t *testing.T) {
+		var calls int32
+		c := newServer(t, failing(1, http.StatusBadGateway, &calls, nil))
+		_, err := c.CreateUser(ctx, models.User{Name: "Ann", Email: "ann@example.com", PwdHash: "secret"})
+		if !errors.Is(err, &APIError{StatusCode: http.StatusBadGateway}) || calls != 1 {
+			t.Errorf("expected one failed request, got %v after %d requests", err, calls)
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		var calls int32
+		c := newServer(t, failing(100, http.StatusTooManyRequests, &calls, nil))
+		c.MaxRetries = 2
+		if _, err := c.GetPost(ctx, primitive.NewObjectID()); !errors.Is(err, ErrTooManyRequests) {
+			t.Errorf("expected ErrTooManyRequests, got %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 requests, got %d", calls)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		var calls int32
+		c := newServer(t, failing(100, http.StatusServiceUnavailable, &calls, nil))
+		c.MinBackoff, c.MaxBackoff = time.Hour, time.Hour
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := c.GetUser(ctx, primitive.NewObjectID()); err != context.DeadlineExceeded {
+			t.Errorf("expected the deadline to be exceeded, got %v", err)
+		}
+	})
+}
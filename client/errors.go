@@ -0,0 +1,50 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIError is returned when the server responds with an error status.
+// Message and RequestID are read from the JSON error body (see utils.WriteError).
+type APIError struct {
+	StatusCode int
+	Message    string
+	RequestID  string
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("appyinsta: %d %s (request %s)", e.StatusCode, msg, e.RequestID)
+	}
+	return fmt.Sprintf("appyinsta: %d %s", e.StatusCode, msg)
+}
+
+// Is reports whether target is an *APIError with the same status code,
+// so that errors.Is(err, client.ErrTooManyRequests) works on any 429 response.
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.StatusCode == e.StatusCode
+}
+
+// Errors for the status codes sent by the server, to be used with errors.Is
+var (
+	ErrBadRequest           = &APIError{StatusCode: http.StatusBadRequest}
+	ErrUnauthorized         = &APIError{StatusCode: http.StatusUnauthorized}
+	ErrForbidden            = &APIError{StatusCode: http.StatusForbidden}
+	ErrNotAcceptable        = &APIError{StatusCode: http.StatusNotAcceptable}
+	ErrRequestTooLarge      = &APIError{StatusCode: http.StatusRequestEntityTooLarge}
+	ErrUnsupportedMediaType = &APIError{StatusCode: http.StatusUnsupportedMediaType}
+	ErrTooManyRequests      = &APIError{StatusCode: http.StatusTooManyRequests}
+	ErrInternalServerError  = &APIError{StatusCode: http.StatusInternalServerError}
+	ErrServiceUnavailable   = &APIError{StatusCode: http.StatusServiceUnavailable}
+)
+
+// ErrNotFound is returned by GetUser and GetPost when there is no document
+// with the given ID. The server responds to these with an empty object.
+var ErrNotFound = errors.New("appyinsta: not found")
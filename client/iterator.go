@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+
+	"appyinsta/api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PostIterator iterates over the posts of a user, in the order they were
+// posted, fetching a page at a time.
+//
+//	it := c.ListUserPosts(ctx, userID, 20)
+//	for it.Next() {
+//		post := it.Post()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type PostIterator struct {
+	c        *Client
+	ctx      context.Context
+	path     string
+	pageSize int64
+
+	pagInfo models.PostPaginationInfo
+	page    []models.Post
+	post    models.Post
+	done    bool
+	err     error
+}
+
+// ListUserPosts returns an iterator over the posts of a user, oldest first. The pages
+// requested from the server have at most pageSize posts (20 if pageSize <= 0).
+func (c *Client) ListUserPosts(ctx context.Context, userID primitive.ObjectID, pageSize int64) *PostIterator {
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	return &PostIterator{
+		c:        c,
+		ctx:      ctx,
+		path:     "/posts/users/" + userID.Hex(),
+		pageSize: pageSize,
+		pagInfo:  models.PostPaginationInfo{NumberOfNewPosts: pageSize, FirstRequest: true},
+	}
+}
+
+// Next advances to the next post, fetching the next page if needed.
+// It returns false at the end of the posts or on an error.
+func (it *PostIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		if err := it.c.do(it.ctx, "GET", it.path, it.pagInfo, &it.page); err != nil {
+			it.err = err
+			return false
+		}
+		// a short page is the last one
+		if int64(len(it.page)) < it.pageSize {
+			it.done = true
+		}
+		if len(it.page) == 0 {
+			return false
+		}
+		last := it.page[len(it.page)-1]
+		it.pagInfo = models.PostPaginationInfo{LastPostID: last.PostID, LastPostedOn: last.PostedOn, NumberOfNewPosts: it.pageSize}
+	}
+
+	it.post, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Post returns the current post
+func (it *PostIterator) Post() models.Post {
+	return it.post
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *PostIterator) Err() error {
+	return it.err
+}
@@ -4,52 +4,274 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"time"
 
+	"appyinsta/api/audit"
+	"appyinsta/api/cli"
+	"appyinsta/api/config"
+	"appyinsta/api/events"
+	"appyinsta/api/grpcserver"
 	"appyinsta/api/handlers"
+	"appyinsta/api/logging"
+	"appyinsta/api/models"
+	"appyinsta/api/moderation"
+	"appyinsta/api/notifications"
+	"appyinsta/api/openapi"
+	"appyinsta/api/ratelimit"
+	"appyinsta/api/store"
+	"appyinsta/api/stream"
+	"appyinsta/api/tracing"
 	"appyinsta/api/utils"
+	"appyinsta/api/webhooks"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// appyinsta runs the server, or one of the commands of the cli package
 func main() {
-	uri := os.Getenv("MONGODB_URI")
-	dbname := os.Getenv("MONGODB_DBNAME")
-	port := os.Getenv("APPYINSTA_PORT")
+	args := os.Args[1:]
+	if len(args) == 0 || args[0] == "serve" {
+		serve()
+		return
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		cli.Usage(os.Stdout)
+		return
+	}
+	os.Exit(runCommand(args))
+}
 
-	if uri == "" || dbname == "" || port == "" {
-		log.Fatal("You must set the MONGODB_URI, MONGODB_DBNAME and APPYINSTA_PORT environment variables.")
+func runCommand(args []string) int {
+	conf, err := config.FromEnvForCLI()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx := context.Background()
+	client, err := connect(ctx, conf, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer client.Disconnect(ctx)
+
+	env := &cli.Env{
+		Store:  store.NewMongoStore(client.Database(conf.DBName)),
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Getenv: os.Getenv,
+
+		AuditHashChain: conf.AuditHashChain,
+	}
+	if err := cli.Run(ctx, env, args); err == cli.ErrUsage {
+		return 2
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "appyinsta %s: %s\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func connect(ctx context.Context, conf *config.Config, tracer *tracing.Tracer) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return mongo.Connect(ctx, options.Client().ApplyURI(conf.MongoURI).SetMonitor(tracing.NewCommandMonitor(tracer)))
+}
+
+func serve() {
+	conf, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger := logging.New(os.Stdout, logging.ParseLevel(conf.LogLevel))
+	logging.SetDefault(logger)
+
+	// tracing is enabled by setting APPYINSTA_TRACES, see tracing.NewExporter
+	var tracer *tracing.Tracer
+	if conf.Traces != "" {
+		exporter, err := tracing.NewExporter("appyinsta", conf.Traces)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tracer = tracing.NewTracer("appyinsta", exporter, func(err error) {
+			logger.Warn("Could not export spans", "err", err)
+		})
+		defer tracer.Shutdown(context.Background())
 	}
 
 	ctx, cancelCtx := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancelCtx()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := connect(ctx, conf, tracer)
 	if err != nil {
 		panic(err)
 	}
 
 	defer func() {
-		log.Println("Closing connection to MongoDB Atlas database")
+		logger.Info("Closing connection to MongoDB Atlas database")
 		if err := client.Disconnect(ctx); err != nil {
 			panic(err)
 		}
 	}()
 
-	log.Println("Connected to MongoDB Atlas database.")
-	log.Println(fmt.Sprintf("Selecting database: %s", dbname))
+	logger.Info("Connected to MongoDB Atlas database.")
+	logger.Info("Selecting database", "dbname", conf.DBName)
+
+	db := client.Database(conf.DBName)
+	senv := &handlers.ServerEnv{DB: db, Store: store.NewMongoStore(db), GraphQLLimits: conf.GraphQL}
+	senv.CaptionFilter = moderation.NewFilter(conf.Moderation.RejectedWords, conf.Moderation.FlaggedWords, conf.Moderation.MaxLinks)
+	senv.ReportThreshold = conf.Moderation.ReportThreshold
+	senv.AuditHashChain = conf.AuditHashChain
+
+	// the indexes the store relies on, like the unique usernames, are
+	// created by the migrations
+	if conf.AutoMigrate {
+		applied, err := senv.Store.(store.Migrator).Migrate(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range applied {
+			logger.Info("Applied migration", "version", m.Version, "description", m.Description)
+		}
+	} else if err := store.CheckMigrations(ctx, senv.Store.(store.Migrator)); err != nil {
+		log.Fatal(err)
+	}
+
+	if conf.BootstrapAdmin.Email != "" {
+		admin := conf.BootstrapAdmin
+		admin.PwdHash = utils.GetHashed256(admin.PwdHash)
+		created, err := store.BootstrapAdmin(ctx, senv.Store, &admin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if created {
+			systemCtx := audit.ContextWithActor(ctx, models.ActorSystem)
+			if err := (audit.Log{Store: senv.Store, Chain: conf.AuditHashChain}).Record(systemCtx, "admin.bootstrap", "users", admin.UserID, nil, admin); err != nil {
+				log.Fatal(err)
+			}
+			logger.Info("Bootstrapped the first admin", "user_id", admin.UserID.Hex())
+		}
+	}
+
+	// the subscribers of the domain events, which are recorded in the outbox
+	// with the writes, and delivered to them by the dispatcher
+	bus := events.NewBus()
+	notifier := &notifications.Notifier{Store: senv.Store}
+	bus.Subscribe(notifier.Handle)
 
-	senv := &handlers.ServerEnv{DB: client.Database(dbname)}
-	mux := http.NewServeMux()
+	// the new posts and notifications are streamed from the events of this
+	// server, or from the change stream of the database to share them between replicas
+	senv.Stream = stream.NewHub(conf.Stream.Buffer)
+	publisher := &stream.Publisher{Hub: senv.Stream, Store: senv.Store}
+	if conf.Stream.Source == "mongo" {
+		watchCtx, stopWatching := context.WithCancel(logging.NewContext(context.Background(), logger))
+		defer stopWatching()
+		go publisher.WatchMongo(watchCtx, db)
+	} else {
+		bus.Subscribe(publisher.HandleEvent)
+		notifier.OnNotify = publisher.Notify
+	}
 
-	mux.HandleFunc("/users", utils.MakeCheckMethodHandler("POST", senv.HandleUserCreate))
-	mux.HandleFunc("/users/", utils.MakeCheckMethodHandler("GET", senv.HandleUserGet))
-	mux.HandleFunc("/posts", utils.MakeCheckMethodHandler("POST", senv.HandlePostCreate))
-	mux.HandleFunc("/posts/", utils.MakeCheckMethodHandler("GET", senv.HandlePostGet))
-	mux.HandleFunc("/posts/users/", utils.MakeCheckMethodHandler("GET", senv.HandleUserPostsGet))
+	// the events are stored in the outbox of the webhooks, and sent in the background
+	bus.Subscribe((&webhooks.Outbox{Store: senv.Store}).Handle)
+	dispatchCtx, stopDispatching := context.WithCancel(logging.NewContext(context.Background(), logger))
+	defer stopDispatching()
+	senv.Events = events.NewDispatcher(senv.Store, bus, "appyinsta")
+	go senv.Events.Run(dispatchCtx, time.Second)
+	deliverer := webhooks.NewDispatcher(senv.Store)
+	deliverer.MaxAttempts = conf.WebhookMaxAttempts
+	go deliverer.Run(dispatchCtx, 5*time.Second)
+
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if conf.RateLimits.Store == "mongo" {
+		if limitStore, err = ratelimit.NewMongoStore(ctx, senv.DB); err != nil {
+			log.Fatal(err)
+		}
+	}
+	limitKey := ratelimit.ClientIP
+	if conf.RateLimits.TrustProxy {
+		limitKey = ratelimit.ForwardedClientIP
+	}
+	// the users are limited as users once authenticated, wherever they connect from
+	limiter := ratelimit.NewLimiter(limitStore, utils.UserOrClientKey(limitKey))
+	limits := conf.RateLimits
+	authenticate := utils.LimitFailedAuth(limitStore, limits.AuthFailures, senv.Authenticate)
+	senv.RateLimits, senv.SignupLimit = limitStore, limits.Signup
+
+	limitsByClass := map[string]ratelimit.Limit{
+		handlers.LimitRead:   limits.Read,
+		handlers.LimitWrite:  limits.Write,
+		handlers.LimitSignup: limits.Signup,
+	}
 
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), mux))
+	routes := senv.Routes()
+	mux := handlers.NewMux(routes, func(route handlers.Route) http.HandlerFunc {
+		// the limits apply after the authentication, to key them by user
+		handlerFn := utils.MakeRateLimitHandler(limiter, route.Name, limitsByClass[route.Limit], utils.MakeCheckMethodHandler(route.Method, route.Handler))
+		if route.Admin {
+			// the users with the permission of the route are served
+			// even without an admin token
+			if conf.AdminToken == "" && route.Permission == "" {
+				return nil
+			}
+			if route.Permission == "" {
+				handlerFn = utils.MakeAdminHandler(conf.AdminToken, handlerFn)
+			} else {
+				user := utils.MakeUserAuthHandler(authenticate, utils.MakeCheckPermissionHandler(route.Permission, senv.Authorize, handlerFn))
+				handlerFn = utils.MakeAdminOrUserHandler(conf.AdminToken, user, handlerFn)
+			}
+		}
+		if route.Auth {
+			handlerFn = utils.MakeUserAuthHandler(authenticate, handlerFn)
+		} else if route.OptionalAuth {
+			handlerFn = utils.MakeOptionalUserAuthHandler(authenticate, handlerFn)
+		}
+		return handlerFn
+	})
+
+	// the API documentation, built from the route table
+	serveSpec, err := openapi.MakeJSONHandler(handlers.OpenAPI(routes))
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux.HandleFunc("/openapi.json", utils.MakeRateLimitHandler(limiter, "openapi", limits.Read, utils.MakeCheckMethodHandler("GET", serveSpec)))
+	mux.HandleFunc("/docs", utils.MakeRateLimitHandler(limiter, "docs", limits.Read, utils.MakeCheckMethodHandler("GET", openapi.HandleDocs)))
+
+	// middleware in front of every route, the last one wrapped is the first to run
+	var handler http.Handler = mux
+	handler = utils.MakeCompressionHandler(conf.CompressionMinSize, handler)
+	handler = utils.MakeCORSHandler(conf.CORS, handler)
+	handler = utils.MakeTracingHandler(tracer, handler)
+	handler = utils.MakeClientIPHandler(limitKey, handler)
+	handler = utils.MakeLoggingHandler(logger, handler)
+
+	// the gRPC API uses the same store as the REST API
+	if conf.GRPCPort != "" {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%s", conf.GRPCPort))
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcLimits := grpcserver.RateLimits{Store: limitStore, Read: limits.Read, Write: limits.Write, Signup: limits.Signup}
+		grpcServer := grpcserver.NewServer(senv.Store, senv.Events, audit.Log{Store: senv.Store, Chain: conf.AuditHashChain}, authenticate, senv.CreatePost, grpcLimits, logger, tracer)
+		defer grpcServer.GracefulStop()
+
+		go func() {
+			logger.Info("Starting gRPC server", "port", conf.GRPCPort)
+			if err := grpcServer.Serve(lis); err != nil {
+				logger.Error("gRPC server stopped", "err", err)
+			}
+		}()
+	}
+
+	logger.Info("Starting server", "port", conf.Port)
+	if err := http.ListenAndServe(fmt.Sprintf(":%s", conf.Port), handler); err != nil {
+		logger.Error("Server stopped", "err", err)
+	}
 }